@@ -1,9 +1,12 @@
 package metadata
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 
@@ -29,7 +32,8 @@ const (
 	ExampleMDSRoot = "MIIGGTCCBAGgAwIBAgIUdT9qLX0sVMRe8l0sLmHd3mZovQ0wDQYJKoZIhvcNAQELBQAwgZsxHzAdBgNVBAMMFkVYQU1QTEUgTURTMyBURVNUIFJPT1QxIjAgBgkqhkiG9w0BCQEWE2V4YW1wbGVAZXhhbXBsZS5jb20xFDASBgNVBAoMC0V4YW1wbGUgT1JHMRAwDgYDVQQLDAdFeGFtcGxlMQswCQYDVQQGEwJVUzELMAkGA1UECAwCTVkxEjAQBgNVBAcMCVdha2VmaWVsZDAeFw0yMTA0MTkxMTM1MDdaFw00ODA5MDQxMTM1MDdaMIGbMR8wHQYDVQQDDBZFWEFNUExFIE1EUzMgVEVTVCBST09UMSIwIAYJKoZIhvcNAQkBFhNleGFtcGxlQGV4YW1wbGUuY29tMRQwEgYDVQQKDAtFeGFtcGxlIE9SRzEQMA4GA1UECwwHRXhhbXBsZTELMAkGA1UEBhMCVVMxCzAJBgNVBAgMAk1ZMRIwEAYDVQQHDAlXYWtlZmllbGQwggIiMA0GCSqGSIb3DQEBAQUAA4ICDwAwggIKAoICAQDDjF5wyEWuhwDHsZosGdGFTCcI677rW881vV+UfW38J+K2ioFFNeGVsxbcebK6AVOiCDPFj0974IpeD9SFOhwAHoDu/LCfXdQWp8ZgQ91ULYWoW8o7NNSp01nbN9zmaO6/xKNCa0bzjmXoGqglqnP1AtRcWYvXOSKZy1rcPeDv4Dhcpdp6W72fBw0eWIqOhsrItuY2/N8ItBPiG03EX72nACq4nZJ/nAIcUbER8STSFPPzvE97TvShsi1FD8aO6l1WkR/QkreAGjMI++GbB2Qc1nN9Y/VEDbMDhQtxXQRdpFwubTjejkN9hKOtF3B71YrwIrng3V9RoPMFdapWMzSlI+WWHog0oTj1PqwJDDg7+z1I6vSDeVWAMKr9mq1w1OGNzgBopIjd9lRWkRtt2kQSPX9XxqS4E1gDDr8MKbpM3JuubQtNCg9D7Ljvbz6vwvUrbPHH+oREvucsp0PZ5PpizloepGIcLFxDQqCulGY2n7Ahl0JOFXJqOFCaK3TWHwBvZsaY5DgBuUvdUrwtgZNg2eg2omWXEepiVFQn3Fvj43Wh2npPMgIe5P0rwncXvROxaczd4rtajKS1ucoB9b9iKqM2+M1y/FDIgVf1fWEHwK7YdzxMlgOeLdeV/kqRU5PEUlLU9a2EwdOErrPbPKZmIfbs/L4B3k4zejMDH3Y+ZwIDAQABo1MwUTAdBgNVHQ4EFgQU8sWwq1TrurK7xMTwO1dKfeJBbCMwHwYDVR0jBBgwFoAU8sWwq1TrurK7xMTwO1dKfeJBbCMwDwYDVR0TAQH/BAUwAwEB/zANBgkqhkiG9w0BAQsFAAOCAgEAFw6M1PiIfCPIBQ5EBUPNmRvRFuDpolOmDofnf/+mv63LqwQZAdo/W8tzZ9kOFhq24SiLw0H7fsdG/jeREXiIZMNoW/rA6Uac8sU+FYF7Q+qp6CQLlSQbDcpVMifTQjcBk2xh+aLK9SrrXBqnTAhwS+offGtAW8DpoLuH4tAcQmIjlgMlN65jnELCuqNR/wpA+zch8LZW8saQ2cwRCwdr8mAzZoLbsDSVCHxQF3/kQjPT7Nao1q2iWcY3OYcRmKrieHDP67yeLUbVmetfZis2d6ZlkqHLB4ZW1xX4otsEFkuTJA3HWDRsNyhTwx1YoCLsYut5Zp0myqPNBq28w6qGMyyoJN0Z4RzMEO3R6i/MQNfhK55/8O2HciM6xb5t/aBSuHPKlBDrFWhpRnKYkaNtlUo35qV5IbKGKau3SdZdSRciaXUd/p81YmoF01UlhhMz/Rqr1k2gyA0a9tF8+awCeanYt5izl8YO0FlrOU1SQ5UQw4szqqZqbrf4e8fRuU2TXNx4zk+ImE7WRB44f6mSD746ZCBRogZ/SA5jUBu+OPe4/sEtERWRcQD+fXgce9ZEN0+peyJIKAsl5Rm2Bmgyg5IoyWwSG5W+WekGyEokpslou2Yc6EjUj5ndZWz5EiHAiQ74hNfDoCZIxVVLU3Qbp8a0S1bmsoT2JOsspIbtZUg="
 )
 
-// Metadata is a map of authenticator AAGUIDs to corresponding metadata statements
+// Metadata is a map of authenticator AAGUIDs to corresponding metadata statements. It's the AAGUID index of
+// DefaultStore, which should be used instead to access it concurrently with RefreshCtx.
 var Metadata = make(map[uuid.UUID]MetadataBLOBPayloadEntry)
 
 // Conformance indicates if test metadata is currently being used
@@ -119,6 +123,9 @@ const (
 	AnonCA AuthenticatorAttestationType = "anonca"
 	// None - Indicates absence of attestation
 	None AuthenticatorAttestationType = "none"
+
+	// SelfAttestation - Indicates self attestation as defined in WebAuthn §6.5.4, where the attestation statement is signed by the credential private key. The metadata describes this attestation type as BasicSurrogate.
+	SelfAttestation = BasicSurrogate
 )
 
 // AuthenticatorStatus - This enumeration describes the status of an authenticator model as identified by its AAID and potentially some additional information (such as a specific attestation key).
@@ -178,6 +185,60 @@ func IsUndesiredAuthenticatorStatus(status AuthenticatorStatus) bool {
 	return false
 }
 
+// CertificationLevel is the FIDO Authenticator certification level of an authenticator, ordered such that a higher
+// level is more strict.
+type CertificationLevel int
+
+const (
+	// CertificationLevelNone - The authenticator has not passed FIDO Authenticator certification at any level. The
+	// phased out FIDO_CERTIFIED status is also reported as this level.
+	CertificationLevelNone CertificationLevel = iota
+	// CertificationLevelL1 - The authenticator has passed FIDO Authenticator certification at level 1.
+	CertificationLevelL1
+	// CertificationLevelL1plus - The authenticator has passed FIDO Authenticator certification at level 1+.
+	CertificationLevelL1plus
+	// CertificationLevelL2 - The authenticator has passed FIDO Authenticator certification at level 2.
+	CertificationLevelL2
+	// CertificationLevelL2plus - The authenticator has passed FIDO Authenticator certification at level 2+.
+	CertificationLevelL2plus
+	// CertificationLevelL3 - The authenticator has passed FIDO Authenticator certification at level 3.
+	CertificationLevelL3
+	// CertificationLevelL3plus - The authenticator has passed FIDO Authenticator certification at level 3+.
+	CertificationLevelL3plus
+)
+
+var certificationLevels = map[AuthenticatorStatus]CertificationLevel{
+	FidoCertifiedL1:     CertificationLevelL1,
+	FidoCertifiedL1plus: CertificationLevelL1plus,
+	FidoCertifiedL2:     CertificationLevelL2,
+	FidoCertifiedL2plus: CertificationLevelL2plus,
+	FidoCertifiedL3:     CertificationLevelL3,
+	FidoCertifiedL3plus: CertificationLevelL3plus,
+}
+
+// String returns the authenticator status of the certification level, or NOT_FIDO_CERTIFIED for CertificationLevelNone.
+func (l CertificationLevel) String() string {
+	for status, level := range certificationLevels {
+		if level == l {
+			return string(status)
+		}
+	}
+
+	return string(NotFidoCertified)
+}
+
+// CertificationLevel returns the highest FIDO Authenticator certification level reported by the status reports of the
+// entry, or CertificationLevelNone if the entry reports no certification level.
+func (e MetadataBLOBPayloadEntry) CertificationLevel() (level CertificationLevel) {
+	for _, report := range e.StatusReports {
+		if l, ok := certificationLevels[report.Status]; ok && l > level {
+			level = l
+		}
+	}
+
+	return level
+}
+
 // RogueListEntry - Contains a list of individual authenticators known to be rogue
 type RogueListEntry struct {
 	// Base64url encoding of the rogue authenticator's secret key
@@ -373,6 +434,35 @@ type MetadataStatement struct {
 	AuthenticatorGetInfo AuthenticatorGetInfo `json:"authenticatorGetInfo"`
 }
 
+// IsUserVerificationCapable returns true if any of the alternative userVerificationDetails includes a user verification
+// method, which is every method other than none and presence_internal. It returns false when the statement declares no
+// userVerificationDetails, so callers should check those are present to distinguish an unknown capability.
+//
+// Specification: §3.1. Metadata Keys (https://fidoalliance.org/specs/mds/fido-metadata-statement-v3.0-ps-20210518.html#dom-metadatastatement-userverificationdetails)
+func (s MetadataStatement) IsUserVerificationCapable() bool {
+	for _, combination := range s.UserVerificationDetails {
+		for _, method := range combination {
+			switch method.UserVerificationMethod {
+			case "", UserVerificationMethodNone, UserVerificationMethodPresenceInternal:
+				continue
+			default:
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+const (
+	// UserVerificationMethodNone is the USER_VERIFY_NONE method of authenticators which don't verify users.
+	UserVerificationMethodNone = "none"
+
+	// UserVerificationMethodPresenceInternal is the USER_VERIFY_PRESENCE_INTERNAL method which only tests for user
+	// presence.
+	UserVerificationMethodPresenceInternal = "presence_internal"
+)
+
 type AuthenticationAlgorithm string
 
 const (
@@ -481,6 +571,10 @@ type Version struct {
 	Minor uint16 `json:"minor"`
 }
 
+// AuthenticatorGetInfo - Describes the CTAP capabilities the authenticator reports in its authenticatorGetInfo response,
+// such as the supported versions, extensions, and options.
+//
+// Specification: CTAP2.1 §6.4. authenticatorGetInfo (https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorGetInfo)
 type AuthenticatorGetInfo struct {
 	// List of supported versions.
 	Versions []string `json:"versions"`
@@ -493,15 +587,19 @@ type AuthenticatorGetInfo struct {
 	// Maximum message size supported by the authenticator.
 	MaxMsgSize uint `json:"maxMsgSize"`
 	// List of supported PIN/UV auth protocols in order of decreasing authenticator preference.
-	PivUvAuthProtocols []uint `json:"pinUvAuthProtocols"`
+	PinUvAuthProtocols []uint `json:"pinUvAuthProtocols"`
 	// Maximum number of credentials supported in credentialID list at a time by the authenticator.
 	MaxCredentialCountInList uint `json:"maxCredentialCountInList"`
 	// Maximum Credential ID Length supported by the authenticator.
-	MaxCredentialIdLength uint `json:"maxCredentialLength"`
+	MaxCredentialIdLength uint `json:"maxCredentialIdLength"`
 	// List of supported transports.
 	Transports []string `json:"transports"`
 	// List of supported algorithms for credential generation, as specified in WebAuthn.
 	Algorithms []PublicKeyCredentialParameters `json:"algorithms"`
+	// Maximum size, in bytes, of the input to the authenticatorConfig command.
+	MaxAuthenticatorConfigLength uint `json:"maxAuthenticatorConfigLength"`
+	// The credProtect policy the authenticator applies when the credProtect extension is not requested.
+	DefaultCredProtect uint `json:"defaultCredProtect"`
 	// The maximum size, in bytes, of the serialized large-blob array that this authenticator can store.
 	MaxSerializedLargeBlobArray uint `json:"maxSerializedLargeBlobArray"`
 	// If this member is present and set to true, the PIN must be changed.
@@ -526,6 +624,15 @@ type AuthenticatorGetInfo struct {
 	VendorPrototypeConfigCommands []uint `json:"vendorPrototypeConfigCommands"`
 }
 
+// Option returns the value of the option with the given ID, such as "rk" or "uv", and whether the authenticator reports
+// the option at all. An absent option generally means the authenticator lacks the capability, while a present option
+// set to false means the capability exists but is not configured, such as a user verification method not yet enrolled.
+func (i AuthenticatorGetInfo) Option(id string) (value, ok bool) {
+	value, ok = i.Options[id]
+
+	return value, ok
+}
+
 // MDSGetEndpointsRequest is the request sent to the conformance metadata getEndpoints endpoint.
 type MDSGetEndpointsRequest struct {
 	// The URL of the local server endpoint, e.g. https://webauthn.io/
@@ -540,7 +647,58 @@ type MDSGetEndpointsResponse struct {
 	Result []string `json:"result"`
 }
 
-func unmarshalMDSBLOB(body []byte, c http.Client) (MetadataBLOBPayload, error) {
+// Fetch downloads the metadata BLOB from the given URL and validates it against MDSRoot.
+func Fetch(c http.Client, url string) (MetadataBLOBPayload, error) {
+	return FetchCtx(context.Background(), c, url)
+}
+
+// FetchCtx downloads the metadata BLOB from the given URL and validates it against MDSRoot. The context controls the
+// download as well as the revocation checks of the BLOB signing certificate chain.
+func FetchCtx(ctx context.Context, c http.Client, url string) (payload MetadataBLOBPayload, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return payload, err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return payload, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return payload, fmt.Errorf("metadata BLOB request to '%s' returned status code %d", url, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return payload, err
+	}
+
+	return unmarshalMDSBLOB(ctx, body, c)
+}
+
+// Refresh downloads the metadata BLOB from the given URL and loads its entries into DefaultStore.
+func Refresh(c http.Client, url string) error {
+	return RefreshCtx(context.Background(), c, url)
+}
+
+// RefreshCtx downloads the metadata BLOB from the given URL and loads its entries into DefaultStore. It is left
+// untouched when the context is cancelled or the BLOB fails validation. It's safe to call while attestations are
+// verified against DefaultStore, but not while the Metadata map is accessed directly.
+func RefreshCtx(ctx context.Context, c http.Client, url string) error {
+	payload, err := FetchCtx(ctx, c, url)
+	if err != nil {
+		return err
+	}
+
+	DefaultStore.AddAll(payload.Entries...)
+
+	return nil
+}
+
+func unmarshalMDSBLOB(ctx context.Context, body []byte, c http.Client) (MetadataBLOBPayload, error) {
 	var payload MetadataBLOBPayload
 
 	token, err := jwt.Parse(string(body), func(token *jwt.Token) (interface{}, error) {
@@ -560,7 +718,7 @@ func unmarshalMDSBLOB(body []byte, c http.Client) (MetadataBLOBPayload, error) {
 		}
 
 		// The certificate chain MUST be verified to properly chain to the metadata TOC signing trust anchor.
-		valid, err := validateChain(chain, c)
+		valid, err := validateChain(ctx, chain, c)
 		if !valid || err != nil {
 			return nil, err
 		}
@@ -595,7 +753,7 @@ func unmarshalMDSBLOB(body []byte, c http.Client) (MetadataBLOBPayload, error) {
 	return payload, err
 }
 
-func validateChain(chain []interface{}, c http.Client) (bool, error) {
+func validateChain(ctx context.Context, chain []interface{}, c http.Client) (bool, error) {
 	oRoot := make([]byte, base64.StdEncoding.DecodedLen(len(MDSRoot)))
 
 	nRoot, err := base64.StdEncoding.Decode(oRoot, []byte(MDSRoot))
@@ -624,7 +782,12 @@ func validateChain(chain []interface{}, c http.Client) (bool, error) {
 		return false, err
 	}
 
-	if revoked, ok := revoke.VerifyCertificate(intcert); !ok {
+	revoked, ok, err := verifyCertificateRevocation(ctx, intcert)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
 		issuer := intcert.IssuingCertificateURL
 
 		if issuer != nil {
@@ -649,7 +812,9 @@ func validateChain(chain []interface{}, c http.Client) (bool, error) {
 		return false, err
 	}
 
-	if revoked, ok := revoke.VerifyCertificate(leafcert); !ok {
+	if revoked, ok, err = verifyCertificateRevocation(ctx, leafcert); err != nil {
+		return false, err
+	} else if !ok {
 		return false, errCRLUnavailable
 	} else if revoked {
 		return false, errLeafCertRevoked
@@ -665,6 +830,35 @@ func validateChain(chain []interface{}, c http.Client) (bool, error) {
 	return err == nil, err
 }
 
+// verifyCertificateRevocation performs the CRL and OCSP revocation checks for the certificate, returning early with the
+// context error if the context is done before the revocation responders answer. Only the wait is bounded by the
+// context: the revocation requests are made with revoke.HTTPClient which doesn't accept a context, so they continue in
+// the background until they complete or the client times out. Configure a timeout on revoke.HTTPClient to bound them.
+func verifyCertificateRevocation(ctx context.Context, cert *x509.Certificate) (revoked, ok bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return false, false, err
+	}
+
+	type result struct {
+		revoked, ok bool
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		r, o := revoke.VerifyCertificate(cert)
+
+		results <- result{r, o}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false, false, ctx.Err()
+	case res := <-results:
+		return res.revoked, res.ok, nil
+	}
+}
+
 type MetadataError struct {
 	// Short name for the type of error that has occurred.
 	Type string `json:"type"`
@@ -2,13 +2,18 @@ package metadata
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
@@ -102,7 +107,7 @@ func TestProductionMetadataTOCParsing(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if _, err = unmarshalMDSBLOB(bytes, *httpClient); err != nil {
+	if _, err = unmarshalMDSBLOB(context.Background(), bytes, *httpClient); err != nil {
 		t.Fail()
 	}
 }
@@ -155,7 +160,7 @@ func TestConformanceMetadataTOCParsing(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		blob, err := unmarshalMDSBLOB(bytes, *httpClient)
+		blob, err := unmarshalMDSBLOB(context.Background(), bytes, *httpClient)
 		if err != nil {
 			if me, ok := err.(*MetadataError); ok {
 				t.Log(me.Details)
@@ -209,12 +214,71 @@ func TestExampleMetadataTOCParsing(t *testing.T) {
 
 	exampleMetadataBLOBBytes := bytes.NewBufferString(exampleMetadataBLOB)
 
-	_, err := unmarshalMDSBLOB(exampleMetadataBLOBBytes.Bytes(), *httpClient)
+	_, err := unmarshalMDSBLOB(context.Background(), exampleMetadataBLOBBytes.Bytes(), *httpClient)
 	if err != nil {
 		t.Fail()
 	}
 }
 
+func TestExampleMetadataAuthenticatorGetInfo(t *testing.T) {
+	MDSRoot = ExampleMDSRoot
+
+	payload, err := unmarshalMDSBLOB(context.Background(), []byte(exampleMetadataBLOB), http.Client{})
+	require.NoError(t, err)
+
+	var info *AuthenticatorGetInfo
+
+	for i := range payload.Entries {
+		if payload.Entries[i].AaGUID == "0132d110-bf4e-4208-a403-ab4f5f12efe5" {
+			info = &payload.Entries[i].MetadataStatement.AuthenticatorGetInfo
+		}
+	}
+
+	require.NotNil(t, info)
+
+	assert.Equal(t, []string{"U2F_V2", "FIDO_2_0"}, info.Versions)
+	assert.Equal(t, []string{"credProtect", "hmac-secret"}, info.Extensions)
+	assert.Equal(t, "0132d110bf4e4208a403ab4f5f12efe5", info.AaGUID)
+	assert.Equal(t, uint(1200), info.MaxMsgSize)
+	assert.Equal(t, []uint{1}, info.PinUvAuthProtocols)
+	assert.Equal(t, uint(16), info.MaxCredentialCountInList)
+	assert.Equal(t, uint(128), info.MaxCredentialIdLength)
+	assert.Equal(t, []string{"usb", "nfc"}, info.Transports)
+	assert.Equal(t, []PublicKeyCredentialParameters{{Type: "public-key", Alg: webauthncose.AlgES256}, {Type: "public-key", Alg: webauthncose.AlgRS256}}, info.Algorithms)
+	assert.Equal(t, uint(1024), info.MaxAuthenticatorConfigLength)
+	assert.Equal(t, uint(2), info.DefaultCredProtect)
+	assert.Equal(t, uint(5), info.FirmwareVersion)
+
+	rk, ok := info.Option("rk")
+	assert.True(t, ok)
+	assert.True(t, rk)
+
+	uvToken, ok := info.Option("uvToken")
+	assert.True(t, ok)
+	assert.False(t, uvToken)
+
+	_, ok = info.Option("bioEnroll")
+	assert.False(t, ok)
+}
+
+func TestFetchCtxCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(exampleMetadataBLOB))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := FetchCtx(ctx, *server.Client(), server.URL); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected fetch to be aborted by the cancelled context, got %v", err)
+	}
+
+	if err := RefreshCtx(ctx, *server.Client(), server.URL); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected refresh to be aborted by the cancelled context, got %v", err)
+	}
+}
+
 func TestIsUndesiredAuthenticatorStatus(t *testing.T) {
 	tests := []struct {
 		status AuthenticatorStatus
@@ -291,6 +355,35 @@ func TestIsUndesiredAuthenticatorStatus(t *testing.T) {
 	}
 }
 
+func TestMetadataBLOBPayloadEntry_CertificationLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []AuthenticatorStatus
+		level    CertificationLevel
+	}{
+		{"ShouldReportNoneWithoutReports", nil, CertificationLevelNone},
+		{"ShouldReportNoneForLegacyCertification", []AuthenticatorStatus{FidoCertified}, CertificationLevelNone},
+		{"ShouldReportL1", []AuthenticatorStatus{FidoCertifiedL1}, CertificationLevelL1},
+		{"ShouldReportHighestLevel", []AuthenticatorStatus{FidoCertifiedL1, FidoCertifiedL2plus, UpdateAvailable}, CertificationLevelL2plus},
+		{"ShouldReportL3plus", []AuthenticatorStatus{FidoCertifiedL3plus, FidoCertifiedL3}, CertificationLevelL3plus},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var entry MetadataBLOBPayloadEntry
+
+			for _, status := range tc.statuses {
+				entry.StatusReports = append(entry.StatusReports, StatusReport{Status: status})
+			}
+
+			assert.Equal(t, tc.level, entry.CertificationLevel())
+		})
+	}
+
+	assert.Equal(t, "FIDO_CERTIFIED_L2", CertificationLevelL2.String())
+	assert.Equal(t, "NOT_FIDO_CERTIFIED", CertificationLevelNone.String())
+}
+
 func TestAlgKeyMatch(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,137 @@
+package metadata
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Store holds metadata BLOB payload entries indexed by their AAGUID, and by their attestation certificate key
+// identifiers for the authenticators which are not identified by an AAGUID such as U2F authenticators. Add and the
+// lookups are safe for concurrent use, while the maps must not be accessed directly while the Store is in use.
+type Store struct {
+	mu sync.RWMutex
+
+	// AAGUIDs are the entries indexed by AAGUID.
+	AAGUIDs map[uuid.UUID]MetadataBLOBPayloadEntry
+
+	// CertKeyIDs are the entries indexed by the lowercase hex encoding of each of their attestation certificate key
+	// identifiers.
+	CertKeyIDs map[string]MetadataBLOBPayloadEntry
+}
+
+// DefaultStore is the Store used during attestation verification. Its AAGUID index is the Metadata map.
+var DefaultStore = &Store{
+	AAGUIDs:    Metadata,
+	CertKeyIDs: make(map[string]MetadataBLOBPayloadEntry),
+}
+
+// NewStore creates a new Store with the provided entries.
+func NewStore(entries ...MetadataBLOBPayloadEntry) *Store {
+	store := &Store{
+		AAGUIDs:    make(map[uuid.UUID]MetadataBLOBPayloadEntry),
+		CertKeyIDs: make(map[string]MetadataBLOBPayloadEntry),
+	}
+
+	store.AddAll(entries...)
+
+	return store
+}
+
+// NewStoreFromPayload creates a new Store with the entries of the provided metadata BLOB payload, which allows
+// verifying attestations against a specific metadata snapshot rather than DefaultStore.
+func NewStoreFromPayload(payload *MetadataBLOBPayload) *Store {
+	if payload == nil {
+		return NewStore()
+	}
+
+	return NewStore(payload.Entries...)
+}
+
+type storeContextKey struct{}
+
+// WithStore returns a copy of the context which uses the provided Store in place of DefaultStore for the attestation
+// verification performed with the context, such as pinning a registration to a specific metadata snapshot.
+func WithStore(ctx context.Context, store *Store) context.Context {
+	return context.WithValue(ctx, storeContextKey{}, store)
+}
+
+// StoreFromContext returns the Store set on the context with WithStore, or DefaultStore if there is none.
+func StoreFromContext(ctx context.Context) *Store {
+	if store, ok := ctx.Value(storeContextKey{}).(*Store); ok && store != nil {
+		return store
+	}
+
+	return DefaultStore
+}
+
+// Add indexes the entry by its AAGUID if it has one, and by each of its attestation certificate key identifiers.
+func (s *Store) Add(entry MetadataBLOBPayloadEntry) {
+	s.AddAll(entry)
+}
+
+// AddAll indexes each of the entries as per Add, such that concurrent lookups either see none or all of the entries.
+func (s *Store) AddAll(entries ...MetadataBLOBPayloadEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		s.add(entry)
+	}
+}
+
+func (s *Store) add(entry MetadataBLOBPayloadEntry) {
+	if aaguid, err := uuid.Parse(entry.AaGUID); err == nil {
+		s.AAGUIDs[aaguid] = entry
+	}
+
+	for _, id := range entry.AttestationCertificateKeyIdentifiers {
+		s.CertKeyIDs[strings.ToLower(id)] = entry
+	}
+}
+
+// Lookup returns the entry for the provided AAGUID.
+func (s *Store) Lookup(aaguid uuid.UUID) (entry MetadataBLOBPayloadEntry, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok = s.AAGUIDs[aaguid]
+
+	return entry, ok
+}
+
+// LookupByCertKeyID returns the entry for the provided attestation certificate key identifier.
+func (s *Store) LookupByCertKeyID(id []byte) (entry MetadataBLOBPayloadEntry, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok = s.CertKeyIDs[hex.EncodeToString(id)]
+
+	return entry, ok
+}
+
+// CertificateKeyIdentifier returns the attestation certificate key identifier of the certificate, which is the SHA-1
+// hash of the subjectPublicKey BIT STRING of the certificate as described in RFC5280 §4.2.1.2. method (1).
+//
+// Specification: §3.1.1. Metadata BLOB Payload Entry Dictionary (https://fidoalliance.org/specs/mds/fido-metadata-service-v3.0-ps-20210518.html#metadata-blob-payload-entry-dictionary)
+func CertificateKeyIdentifier(cert *x509.Certificate) ([]byte, error) {
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+
+	id := sha1.Sum(spki.SubjectPublicKey.Bytes)
+
+	return id[:], nil
+}
@@ -0,0 +1,87 @@
+package metadata
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	aaguid := uuid.MustParse("ee882879-721c-4913-9775-3dfcce97072a")
+
+	store := NewStore(
+		MetadataBLOBPayloadEntry{
+			AaGUID: aaguid.String(),
+		},
+		MetadataBLOBPayloadEntry{
+			AttestationCertificateKeyIdentifiers: []string{"923881FE2F214EE465484371AEB72E97F5A58E0A"},
+		},
+	)
+
+	entry, ok := store.Lookup(aaguid)
+	assert.True(t, ok)
+	assert.Equal(t, aaguid.String(), entry.AaGUID)
+
+	_, ok = store.Lookup(uuid.Nil)
+	assert.False(t, ok)
+
+	entry, ok = store.LookupByCertKeyID([]byte{0x92, 0x38, 0x81, 0xfe, 0x2f, 0x21, 0x4e, 0xe4, 0x65, 0x48, 0x43, 0x71, 0xae, 0xb7, 0x2e, 0x97, 0xf5, 0xa5, 0x8e, 0x0a})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"923881FE2F214EE465484371AEB72E97F5A58E0A"}, entry.AttestationCertificateKeyIdentifiers)
+
+	_, ok = store.LookupByCertKeyID([]byte{0x00})
+	assert.False(t, ok)
+}
+
+func TestStoreFromContext(t *testing.T) {
+	aaguid := uuid.MustParse("ee882879-721c-4913-9775-3dfcce97072a")
+
+	assert.Same(t, DefaultStore, StoreFromContext(context.Background()))
+	assert.Same(t, DefaultStore, StoreFromContext(WithStore(context.Background(), nil)))
+
+	store := NewStoreFromPayload(&MetadataBLOBPayload{
+		Number:  42,
+		Entries: []MetadataBLOBPayloadEntry{{AaGUID: aaguid.String()}},
+	})
+
+	assert.Same(t, store, StoreFromContext(WithStore(context.Background(), store)))
+
+	_, ok := store.Lookup(aaguid)
+	assert.True(t, ok)
+
+	_, ok = NewStoreFromPayload(nil).Lookup(aaguid)
+	assert.False(t, ok)
+}
+
+func TestStoreConcurrentAccess(t *testing.T) {
+	aaguid := uuid.MustParse("ee882879-721c-4913-9775-3dfcce97072a")
+
+	store := NewStore()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			store.AddAll(MetadataBLOBPayloadEntry{AaGUID: aaguid.String()}, MetadataBLOBPayloadEntry{AttestationCertificateKeyIdentifiers: []string{"00"}})
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			store.Lookup(aaguid)
+			store.LookupByCertKeyID([]byte{0x00})
+		}()
+	}
+
+	wg.Wait()
+
+	_, ok := store.Lookup(aaguid)
+	assert.True(t, ok)
+}
@@ -0,0 +1,72 @@
+package metadata
+
+import (
+	"strings"
+)
+
+// TPMManufacturer describes a TPM vendor registered with the TCG.
+type TPMManufacturer struct {
+	// ID is the TPM vendor ID as hex encoded in the tcg-at-tpmManufacturer attribute without the "id:" prefix.
+	ID string
+
+	// Name is the friendly name of the vendor.
+	Name string
+
+	// Code is the vendor ID as its ASCII representation.
+	Code string
+}
+
+var tpmManufacturers = []TPMManufacturer{
+	{"414D4400", "AMD", "AMD"},
+	{"41544D4C", "Atmel", "ATML"},
+	{"4252434D", "Broadcom", "BRCM"},
+	{"49424D00", "IBM", "IBM"},
+	{"49465800", "Infineon", "IFX"},
+	{"494E5443", "Intel", "INTC"},
+	{"4C454E00", "Lenovo", "LEN"},
+	{"4E534D20", "National Semiconductor", "NSM"},
+	{"4E545A00", "Nationz", "NTZ"},
+	{"4E544300", "Nuvoton Technology", "NTC"},
+	{"51434F4D", "Qualcomm", "QCOM"},
+	{"534D5343", "SMSC", "SMSC"},
+	{"53544D20", "ST Microelectronics", "STM"},
+	{"534D534E", "Samsung", "SMSN"},
+	{"534E5300", "Sinosun", "SNS"},
+	{"54584E00", "Texas Instruments", "TXN"},
+	{"57454300", "Winbond", "WEC"},
+	{"524F4343", "Fuzhouk Rockchip", "ROCC"},
+	{"43534353", "Cisco", "CSCO"},
+	{"474F4F47", "Google", "GOOG"},
+	{"48504500", "Hewlett Packard Enterprise", "HPE"},
+	{"48495349", "Huawei", "HISI"},
+	{"4D534654", "Microsoft", "MSFT"},
+	{"FFFFF1D0", "FIDO Alliance Conformance Testing", "FIDO"},
+}
+
+// tpmManufacturerIDs indexes the tpmManufacturers by their uppercase ID, as vendors are inconsistent in the case of
+// the hex encoding in the AIK certificate SAN.
+var tpmManufacturerIDs map[string]TPMManufacturer
+
+func init() {
+	tpmManufacturerIDs = make(map[string]TPMManufacturer, len(tpmManufacturers))
+
+	for _, m := range tpmManufacturers {
+		RegisterTPMManufacturer(m.ID, m.Name, m.Code)
+	}
+}
+
+// RegisterTPMManufacturer adds a TPM vendor to the manufacturers accepted in the AIK certificate of TPM attestations,
+// replacing any manufacturer already registered with the same ID. The ID is the hex encoded TPM vendor ID and is
+// matched case insensitively. It should be called during initialization as it's not safe for concurrent use with
+// attestation verification.
+func RegisterTPMManufacturer(id, name, code string) {
+	tpmManufacturerIDs[strings.ToUpper(id)] = TPMManufacturer{ID: id, Name: name, Code: code}
+}
+
+// TPMManufacturerByID returns the TPMManufacturer with the provided hex encoded vendor ID. The ID is matched case
+// insensitively.
+func TPMManufacturerByID(id string) (manufacturer TPMManufacturer, ok bool) {
+	manufacturer, ok = tpmManufacturerIDs[strings.ToUpper(id)]
+
+	return manufacturer, ok
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTPMManufacturerByID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		id       string
+		ok       bool
+		expected TPMManufacturer
+	}{
+		{
+			name:     "ShouldFindUppercase",
+			id:       "414D4400",
+			ok:       true,
+			expected: TPMManufacturer{ID: "414D4400", Name: "AMD", Code: "AMD"},
+		},
+		{
+			name:     "ShouldFindLowercase",
+			id:       "494e5443",
+			ok:       true,
+			expected: TPMManufacturer{ID: "494E5443", Name: "Intel", Code: "INTC"},
+		},
+		{
+			name:     "ShouldFindLowercaseIBM",
+			id:       "49424d00",
+			ok:       true,
+			expected: TPMManufacturer{ID: "49424D00", Name: "IBM", Code: "IBM"},
+		},
+		{
+			name:     "ShouldFindMixedCase",
+			id:       "fffff1D0",
+			ok:       true,
+			expected: TPMManufacturer{ID: "FFFFF1D0", Name: "FIDO Alliance Conformance Testing", Code: "FIDO"},
+		},
+		{
+			name: "ShouldNotFindUnknown",
+			id:   "00000000",
+		},
+		{
+			name: "ShouldNotFindEmpty",
+			id:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok := TPMManufacturerByID(tc.id)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestRegisterTPMManufacturer(t *testing.T) {
+	t.Cleanup(func() {
+		delete(tpmManufacturerIDs, "54455354")
+	})
+
+	_, ok := TPMManufacturerByID("54455354")
+	assert.False(t, ok)
+
+	RegisterTPMManufacturer("54455354", "Test", "TEST")
+
+	actual, ok := TPMManufacturerByID("54455354")
+	assert.True(t, ok)
+	assert.Equal(t, TPMManufacturer{ID: "54455354", Name: "Test", Code: "TEST"}, actual)
+
+	actual, ok = TPMManufacturerByID("4D534654")
+	assert.True(t, ok)
+	assert.Equal(t, "Microsoft", actual.Name)
+}
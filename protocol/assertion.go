@@ -1,12 +1,13 @@
 package protocol
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
@@ -47,23 +48,87 @@ type ParsedAssertionResponse struct {
 // specification or makes the assertion verification steps easier to complete. This takes a http.Request that contains
 // the assertion response data in a raw, mostly base64 encoded format, and parses the data into manageable structures.
 func ParseCredentialRequestResponse(response *http.Request) (*ParsedCredentialAssertionData, error) {
+	return ParseCredentialRequestResponseMaxSize(response, DefaultMaxClientDataSize)
+}
+
+// ParseCredentialRequestResponseMaxSize is the same as ParseCredentialRequestResponse but the clientDataJSON must not
+// be larger than maxClientDataSize bytes. If maxClientDataSize is 0 or less the DefaultMaxClientDataSize is used.
+func ParseCredentialRequestResponseMaxSize(response *http.Request, maxClientDataSize int) (*ParsedCredentialAssertionData, error) {
 	if response == nil || response.Body == nil {
 		return nil, ErrBadRequest.WithDetails("No response given")
 	}
 
-	return ParseCredentialRequestResponseBody(response.Body)
+	return ParseCredentialRequestResponseBodyMaxSize(response.Body, maxClientDataSize)
 }
 
 // ParseCredentialRequestResponseBody parses the credential request response into a format that is either required by
 // the specification or makes the assertion verification steps easier to complete. This takes an io.Reader that contains
 // the assertion response data in a raw, mostly base64 encoded format, and parses the data into manageable structures.
 func ParseCredentialRequestResponseBody(body io.Reader) (par *ParsedCredentialAssertionData, err error) {
+	return ParseCredentialRequestResponseBodyMaxSize(body, DefaultMaxClientDataSize)
+}
+
+// ParseCredentialRequestResponseBodyMaxSize is the same as ParseCredentialRequestResponseBody but the clientDataJSON
+// must not be larger than maxClientDataSize bytes. If maxClientDataSize is 0 or less the DefaultMaxClientDataSize is
+// used.
+func ParseCredentialRequestResponseBodyMaxSize(body io.Reader, maxClientDataSize int) (par *ParsedCredentialAssertionData, err error) {
 	var car CredentialAssertionResponse
 
 	if err = json.NewDecoder(body).Decode(&car); err != nil {
 		return nil, ErrBadRequest.WithDetails("Parse error for Assertion")
 	}
 
+	return car.ParseMaxSize(maxClientDataSize)
+}
+
+// ParseCredentialRequestResponseJSON parses the credential request response from the AuthenticationResponseJSON
+// produced by the PublicKeyCredential toJSON() method of WebAuthn Level 3 clients, whose binary members are base64url
+// encoded, so frontends can pass the output through unchanged. An omitted, null, or empty userHandle are all parsed
+// as the absence of a user handle.
+//
+// Specification: §5.1.8. Serialization (https://www.w3.org/TR/webauthn-3/#dom-publickeycredential-tojson)
+func ParseCredentialRequestResponseJSON(data []byte) (par *ParsedCredentialAssertionData, err error) {
+	var car CredentialAssertionResponse
+
+	if err = json.Unmarshal(data, &car); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
+	if len(car.AssertionResponse.UserHandle) == 0 {
+		car.AssertionResponse.UserHandle = nil
+	}
+
+	return car.Parse()
+}
+
+// ParseCredentialRequestResponseForm parses the credential request response from form fields, for frontends which
+// submit the response as a form rather than a JSON body. The fields are named after the members of the JSON response:
+// the base64url encoded rawId, clientDataJSON, authenticatorData, signature, and userHandle fields, the id, type, and
+// authenticatorAttachment fields, and the clientExtensionResults field containing the JSON encoded client extension
+// results.
+func ParseCredentialRequestResponseForm(values url.Values) (par *ParsedCredentialAssertionData, err error) {
+	var car CredentialAssertionResponse
+
+	if car.PublicKeyCredential, err = parsePublicKeyCredentialForm(values); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
+	if car.AssertionResponse.ClientDataJSON, err = parseFormBase64(values, "clientDataJSON"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
+	if car.AssertionResponse.AuthenticatorData, err = parseFormBase64(values, "authenticatorData"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
+	if car.AssertionResponse.Signature, err = parseFormBase64(values, "signature"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
+	if car.AssertionResponse.UserHandle, err = parseFormBase64(values, "userHandle"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(err.Error())
+	}
+
 	return car.Parse()
 }
 
@@ -72,6 +137,12 @@ func ParseCredentialRequestResponseBody(body io.Reader) (par *ParsedCredentialAs
 // ParseCredentialRequestResponseBody instead, and this receiver should only be used if that function is inadequate
 // for their use case.
 func (car CredentialAssertionResponse) Parse() (par *ParsedCredentialAssertionData, err error) {
+	return car.ParseMaxSize(DefaultMaxClientDataSize)
+}
+
+// ParseMaxSize is the same as Parse but the clientDataJSON must not be larger than maxClientDataSize bytes, and must be
+// valid UTF-8. If maxClientDataSize is 0 or less the DefaultMaxClientDataSize is used.
+func (car CredentialAssertionResponse) ParseMaxSize(maxClientDataSize int) (par *ParsedCredentialAssertionData, err error) {
 	if car.ID == "" {
 		return nil, ErrBadRequest.WithDetails("CredentialAssertionResponse with ID missing")
 	}
@@ -84,6 +155,11 @@ func (car CredentialAssertionResponse) Parse() (par *ParsedCredentialAssertionDa
 		return nil, ErrBadRequest.WithDetails("CredentialAssertionResponse with bad type")
 	}
 
+	// NON-NORMATIVE: Limit the size and ensure the encoding of the client data before it's decoded.
+	if reason, ok := validateClientDataJSON(car.AssertionResponse.ClientDataJSON, maxClientDataSize); !ok {
+		return nil, ErrBadRequest.WithDetails("Parse error for Assertion").WithInfo(reason)
+	}
+
 	var attachment AuthenticatorAttachment
 
 	switch car.AuthenticatorAttachment {
@@ -111,7 +187,7 @@ func (car CredentialAssertionResponse) Parse() (par *ParsedCredentialAssertionDa
 	}
 
 	if err = par.Response.AuthenticatorData.Unmarshal(car.AssertionResponse.AuthenticatorData); err != nil {
-		return nil, ErrParsingData.WithDetails("Error unmarshalling auth data")
+		return nil, ErrParsingData.WithDetails(fmt.Sprintf("Error unmarshalling auth data: %v", err))
 	}
 
 	return par, nil
@@ -120,29 +196,40 @@ func (car CredentialAssertionResponse) Parse() (par *ParsedCredentialAssertionDa
 // Verify the remaining elements of the assertion data by following the steps outlined in the referenced specification
 // documentation.
 //
+// The additionalTypes are accepted as the client data type in addition to webauthn.get.
+//
 // Specification: §7.2 Verifying an Authentication Assertion (https://www.w3.org/TR/webauthn/#sctn-verifying-assertion)
-func (p *ParsedCredentialAssertionData) Verify(storedChallenge string, relyingPartyID string, relyingPartyOrigins []string, appID string, verifyUser bool, credentialBytes []byte) error {
+func (p *ParsedCredentialAssertionData) Verify(storedChallenge string, relyingPartyID string, relyingPartyOrigins []string, appID string, verifyUser bool, credentialBytes []byte, additionalTypes ...CeremonyType) error {
 	// Steps 4 through 6 in verifying the assertion data (https://www.w3.org/TR/webauthn/#verifying-assertion) are
 	// "assertive" steps, i.e "Let JSONtext be the result of running UTF-8 decode on the value of cData."
 	// We handle these steps in part as we verify but also beforehand
 
+	// NON-NORMATIVE: Verify that the id of the asserted credential is the same credential as the rawId, as the rawId is
+	// used to look up the credential public key.
+	if id, err := base64.RawURLEncoding.DecodeString(p.ID); err != nil || !bytes.Equal(id, p.RawID) {
+		return ErrBadRequest.WithDetails("Credential ID does not match the credential raw ID")
+	}
+
 	// Handle steps 7 through 10 of assertion by verifying stored data against the Collected Client Data
 	// returned by the authenticator
-	validError := p.Response.CollectedClientData.Verify(storedChallenge, AssertCeremony, relyingPartyOrigins)
+	validError := p.Response.CollectedClientData.Verify(storedChallenge, AssertCeremony, relyingPartyOrigins, additionalTypes...)
 	if validError != nil {
 		return validError
 	}
 
-	// Begin Step 11. Verify that the rpIdHash in authData is the SHA-256 hash of the RP ID expected by the RP.
-	rpIDHash := sha256.Sum256([]byte(relyingPartyID))
+	// Begin Step 11. Verify that the rpIdHash in authData is the SHA-256 hash of the RP ID expected by the RP. When the
+	// client reports the appid extension was used the authenticator signed over the AppID instead, so the rpIdHash must
+	// be the SHA-256 hash of the AppID rather than the RP ID.
+	//
+	// Specification: §10.1.1. FIDO AppID Extension (appid) (https://www.w3.org/TR/webauthn/#sctn-appid-extension)
+	rpIDHash := RPIDHash(relyingPartyID)
 
-	var appIDHash [32]byte
 	if appID != "" {
-		appIDHash = sha256.Sum256([]byte(appID))
+		rpIDHash = RPIDHash(appID)
 	}
 
 	// Handle steps 11 through 14, verifying the authenticator data.
-	validError = p.Response.AuthenticatorData.Verify(rpIDHash[:], appIDHash[:], verifyUser)
+	validError = p.Response.AuthenticatorData.Verify(rpIDHash, nil, verifyUser)
 	if validError != nil {
 		return validError
 	}
@@ -150,12 +237,13 @@ func (p *ParsedCredentialAssertionData) Verify(storedChallenge string, relyingPa
 	// allowedUserCredentialIDs := session.AllowedCredentialIDs
 
 	// Step 15. Let hash be the result of computing a hash over the cData using SHA-256.
-	clientDataHash := sha256.Sum256(p.Raw.AssertionResponse.ClientDataJSON)
+	clientDataHash := p.Raw.AssertionResponse.ClientDataHash()
 
 	// Step 16. Using the credential public key looked up in step 3, verify that sig is
-	// a valid signature over the binary concatenation of authData and hash.
-
-	sigData := append(p.Raw.AssertionResponse.AuthenticatorData, clientDataHash[:]...)
+	// a valid signature over the binary concatenation of authData and hash. The authData is the raw authenticator data
+	// as returned by the client, as re-encoding the parsed authenticator data would not necessarily reproduce the bytes
+	// signed by the authenticator, and it's copied so appending the hash never writes into its backing array.
+	sigData := append(append([]byte{}, p.Raw.AssertionResponse.AuthenticatorData...), clientDataHash...)
 
 	var (
 		key interface{}
@@ -174,6 +262,14 @@ func (p *ParsedCredentialAssertionData) Verify(storedChallenge string, relyingPa
 		return ErrAssertionSignature.WithDetails(fmt.Sprintf("Error parsing the assertion public key: %+v", err))
 	}
 
+	// NON-NORMATIVE: Ensure the signature is verified using the algorithm declared by the credential public key, which
+	// must be consistent with its key type and curve. The FIDO U2F keys of the appID extension don't declare one.
+	if appID == "" {
+		if err = webauthncose.VerifyKeyAlgorithm(key); err != nil {
+			return ErrAssertionSignature.WithDetails(fmt.Sprintf("Error validating the assertion public key algorithm: %+v", err))
+		}
+	}
+
 	valid, err := webauthncose.VerifySignature(key, sigData, p.Response.Signature)
 	if !valid || err != nil {
 		return ErrAssertionSignature.WithDetails(fmt.Sprintf("Error validating the assertion signature: %+v", err))
@@ -181,3 +277,36 @@ func (p *ParsedCredentialAssertionData) Verify(storedChallenge string, relyingPa
 
 	return nil
 }
+
+// VerifyDevicePublicKey verifies the device-bound key signature of the devicePubKey extension, which like the assertion
+// signature is over the binary concatenation of authData and the hash of the cData. It returns a nil dpk if the
+// authenticator did not return the extension output. The dpk is returned alongside the error if only the signature is
+// not valid.
+//
+// Specification: §10.2.2.3.2. Authentication (https://www.w3.org/TR/2023/WD-webauthn-3-20230927/#sctn-device-publickey-extension-verification-get)
+func (p *ParsedCredentialAssertionData) VerifyDevicePublicKey() (dpk *DevicePublicKey, err error) {
+	var ok bool
+
+	if dpk, ok, err = p.Response.AuthenticatorData.Extensions.DevicePublicKey(); !ok || err != nil {
+		return nil, err
+	}
+
+	signature, ok := p.ClientExtensionResults.DevicePublicKeySignature()
+	if !ok {
+		return dpk, ErrDevicePublicKey.WithDetails("Device public key signature is missing from the client extension outputs")
+	}
+
+	key, err := webauthncose.ParsePublicKey(dpk.PublicKey)
+	if err != nil {
+		return dpk, ErrDevicePublicKey.WithDetails(fmt.Sprintf("Error parsing the device public key: %+v", err))
+	}
+
+	sigData := append(append([]byte{}, p.Raw.AssertionResponse.AuthenticatorData...), p.Raw.AssertionResponse.ClientDataHash()...)
+
+	valid, err := webauthncose.VerifySignature(key, sigData, signature)
+	if !valid || err != nil {
+		return dpk, ErrDevicePublicKey.WithDetails(fmt.Sprintf("Error validating the device public key signature: %+v", err))
+	}
+
+	return dpk, nil
+}
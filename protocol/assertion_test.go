@@ -2,14 +2,23 @@ package protocol
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 func TestParseCredentialRequestResponse(t *testing.T) {
@@ -171,6 +180,272 @@ func TestParsedCredentialAssertionData_Verify(t *testing.T) {
 	}
 }
 
+func TestParsedCredentialAssertionData_VerifyCredentialIDMismatch(t *testing.T) {
+	par, err := ParseCredentialRequestResponseBody(bytes.NewReader([]byte(testAssertionResponses["success"])))
+	require.NoError(t, err)
+
+	par.RawID = append(URLEncodedBase64{}, par.RawID[1:]...)
+
+	err = par.Verify(par.Response.CollectedClientData.Challenge, "webauthn.io", []string{"https://webauthn.io"}, "", false, nil)
+	assert.EqualError(t, err, "Credential ID does not match the credential raw ID")
+}
+
+func TestParsedCredentialAssertionData_VerifyWithExtensions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	// The uvm extension output is an array of the user verification methods, each being the userVerificationMethod,
+	// keyProtectionType and matcherProtectionType.
+	extensions, err := webauthncbor.Marshal(map[string]interface{}{
+		ExtensionUVM: [][]uint64{{2, 2, 2}},
+	})
+	require.NoError(t, err)
+
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, byte(FlagUserPresent|FlagUserVerified|FlagHasExtensions))
+	authData = binary.BigEndian.AppendUint32(authData, 1)
+	authData = append(authData, extensions...)
+
+	clientDataJSON := []byte(`{"type":"webauthn.get","challenge":"E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k","origin":"https://example.com"}`)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	body := fmt.Sprintf(`{"id":"%[1]s","rawId":"%[1]s","type":"public-key","response":{"authenticatorData":"%[2]s","clientDataJSON":"%[3]s","signature":"%[4]s"}}`,
+		encode([]byte("credential")), encode(authData), encode(clientDataJSON), encode(signature))
+
+	par, err := ParseCredentialRequestResponseBody(bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+
+	assert.True(t, par.Response.AuthenticatorData.Flags.HasExtensions())
+	assert.Equal(t, extensions, par.Response.AuthenticatorData.ExtData)
+	assert.Equal(t, []interface{}{[]interface{}{uint64(2), uint64(2), uint64(2)}}, par.Response.AuthenticatorData.Extensions[ExtensionUVM])
+
+	assert.NoError(t, par.Verify("E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k", "example.com", []string{"https://example.com"}, "", true, credentialPublicKey))
+
+	par.Raw.AssertionResponse.AuthenticatorData = par.Raw.AssertionResponse.AuthenticatorData[:minAuthDataLength]
+
+	assert.EqualError(t, par.Verify("E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k", "example.com", []string{"https://example.com"}, "", true, credentialPublicKey), "Error validating the assertion signature: <nil>")
+}
+
+func TestParsedCredentialAssertionData_VerifySignedData(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	// The credProtect extension output with the value 2 encoded in the non-minimal one byte argument form, which is
+	// valid CBOR but is encoded as the single byte 0x02 when the parsed extensions are marshaled again.
+	extensions := append([]byte{0xa1, 0x6b}, "credProtect"...)
+	extensions = append(extensions, 0x18, 0x02)
+
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, byte(FlagUserPresent|FlagHasExtensions))
+	authData = binary.BigEndian.AppendUint32(authData, 1)
+	authData = append(authData, extensions...)
+
+	clientDataJSON := []byte(`{"type":"webauthn.get","challenge":"E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k","origin":"https://example.com"}`)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	parse := func(t *testing.T, signed []byte) *ParsedCredentialAssertionData {
+		digest := sha256.Sum256(signed)
+
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+
+		body := fmt.Sprintf(`{"id":"%[1]s","rawId":"%[1]s","type":"public-key","response":{"authenticatorData":"%[2]s","clientDataJSON":"%[3]s","signature":"%[4]s"}}`,
+			encode([]byte("credential")), encode(authData), encode(clientDataJSON), encode(signature))
+
+		par, err := ParseCredentialRequestResponseBody(bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+
+		return par
+	}
+
+	verify := func(par *ParsedCredentialAssertionData) error {
+		return par.Verify("E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k", "example.com", []string{"https://example.com"}, "", false, credentialPublicKey)
+	}
+
+	t.Run("ShouldVerifyRawAuthenticatorData", func(t *testing.T) {
+		par := parse(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+		assert.NoError(t, verify(par))
+	})
+
+	t.Run("ShouldFailReencodedAuthenticatorData", func(t *testing.T) {
+		par := parse(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+		reencoded, err := webauthncbor.Marshal(par.Response.AuthenticatorData.Extensions)
+		require.NoError(t, err)
+		require.NotEqual(t, extensions, reencoded)
+
+		raw := append([]byte{}, par.Raw.AssertionResponse.AuthenticatorData[:minAuthDataLength]...)
+		par.Raw.AssertionResponse.AuthenticatorData = append(raw, reencoded...)
+
+		assert.EqualError(t, verify(par), "Error validating the assertion signature: <nil>")
+	})
+
+	t.Run("ShouldFailReversedOrder", func(t *testing.T) {
+		par := parse(t, append(append([]byte{}, clientDataHash[:]...), authData...))
+
+		assert.EqualError(t, verify(par), "Error validating the assertion signature: <nil>")
+	})
+
+	t.Run("ShouldNotModifyRawAuthenticatorData", func(t *testing.T) {
+		par := parse(t, append(append([]byte{}, authData...), clientDataHash[:]...))
+
+		// Spare capacity after the raw authenticator data must not be written to when the hash is appended.
+		spare := make([]byte, len(authData), len(authData)+sha256.Size)
+		copy(spare, par.Raw.AssertionResponse.AuthenticatorData)
+
+		par.Raw.AssertionResponse.AuthenticatorData = spare
+
+		require.NoError(t, verify(par))
+		assert.Equal(t, make([]byte, sha256.Size), spare[len(authData):cap(spare)])
+	})
+}
+
+func TestParseCredentialRequestResponseForm(t *testing.T) {
+	values := url.Values{
+		"id":                     {"AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng"},
+		"rawId":                  {"AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng"},
+		"type":                   {"public-key"},
+		"clientExtensionResults": {`{"appID":"example.com"}`},
+		"authenticatorData":      {"dKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBFXJJiGa3OAAI1vMYKZIsLJfHwVQMANwCOw-atj9C0vhWpfWU-whzNjeQS21Lpxfdk_G-omAtffWztpGoErlNOfuXWRqm9Uj9ANJck1p6lAQIDJiABIVggKAhfsdHcBIc0KPgAcRyAIK_-Vi-nCXHkRHPNaCMBZ-4iWCBxB8fGYQSBONi9uvq0gv95dGWlhJrBwCsj_a4LJQKVHQ"},
+		"clientDataJSON":         {"eyJjaGFsbGVuZ2UiOiJFNFBUY0lIX0hmWDFwQzZTaWdrMVNDOU5BbGdlenROMDQzOXZpOHpfYzlrIiwibmV3X2tleXNfbWF5X2JlX2FkZGVkX2hlcmUiOiJkbyBub3QgY29tcGFyZSBjbGllbnREYXRhSlNPTiBhZ2FpbnN0IGEgdGVtcGxhdGUuIFNlZSBodHRwczovL2dvby5nbC95YWJQZXgiLCJvcmlnaW4iOiJodHRwczovL3dlYmF1dGhuLmlvIiwidHlwZSI6IndlYmF1dGhuLmdldCJ9"},
+		"signature":              {"MEUCIBtIVOQxzFYdyWQyxaLR0tik1TnuPhGVhXVSNgFwLmN5AiEAnxXdCq0UeAVGWxOaFcjBZ_mEZoXqNboY5IkQDdlWZYc"},
+		"userHandle":             {"0ToAAAAAAAAAAA"},
+	}
+
+	// The form is submitted as application/x-www-form-urlencoded.
+	values, err := url.ParseQuery(values.Encode())
+	require.NoError(t, err)
+
+	expected, err := ParseCredentialRequestResponseBody(bytes.NewReader([]byte(testAssertionResponses["success"])))
+	require.NoError(t, err)
+
+	actual, err := ParseCredentialRequestResponseForm(values)
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, actual)
+
+	values.Set("signature", "not base64!")
+
+	_, err = ParseCredentialRequestResponseForm(values)
+	require.Error(t, err)
+	assert.Equal(t, "Parse error for Assertion", err.Error())
+	assert.Equal(t, "error decoding form field 'signature': illegal base64 data at input byte 3", err.(*Error).DevInfo)
+}
+
+func TestParseCredentialRequestResponseJSON(t *testing.T) {
+	const body = `{
+		"id":"AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng",
+		"rawId":"AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng",
+		"response":{
+			"clientDataJSON":"eyJjaGFsbGVuZ2UiOiJFNFBUY0lIX0hmWDFwQzZTaWdrMVNDOU5BbGdlenROMDQzOXZpOHpfYzlrIiwibmV3X2tleXNfbWF5X2JlX2FkZGVkX2hlcmUiOiJkbyBub3QgY29tcGFyZSBjbGllbnREYXRhSlNPTiBhZ2FpbnN0IGEgdGVtcGxhdGUuIFNlZSBodHRwczovL2dvby5nbC95YWJQZXgiLCJvcmlnaW4iOiJodHRwczovL3dlYmF1dGhuLmlvIiwidHlwZSI6IndlYmF1dGhuLmdldCJ9",
+			"authenticatorData":"dKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBFXJJiGa3OAAI1vMYKZIsLJfHwVQMANwCOw-atj9C0vhWpfWU-whzNjeQS21Lpxfdk_G-omAtffWztpGoErlNOfuXWRqm9Uj9ANJck1p6lAQIDJiABIVggKAhfsdHcBIc0KPgAcRyAIK_-Vi-nCXHkRHPNaCMBZ-4iWCBxB8fGYQSBONi9uvq0gv95dGWlhJrBwCsj_a4LJQKVHQ",
+			"signature":"MEUCIBtIVOQxzFYdyWQyxaLR0tik1TnuPhGVhXVSNgFwLmN5AiEAnxXdCq0UeAVGWxOaFcjBZ_mEZoXqNboY5IkQDdlWZYc"%s
+		},
+		"authenticatorAttachment":"platform",
+		"clientExtensionResults":{},
+		"type":"public-key"
+	}`
+
+	testCases := []struct {
+		name       string
+		userHandle string
+		expected   []byte
+	}{
+		{"ShouldParseUserHandle", `,"userHandle":"0ToAAAAAAAAAAA"`, []byte{0xd1, 0x3a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"ShouldParseOmittedUserHandle", ``, nil},
+		{"ShouldParseNullUserHandle", `,"userHandle":null`, nil},
+		{"ShouldParseEmptyUserHandle", `,"userHandle":""`, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			par, err := ParseCredentialRequestResponseJSON([]byte(fmt.Sprintf(body, tc.userHandle)))
+			require.NoError(t, err)
+
+			assert.Equal(t, "AI7D5q2P0LS-Fal9ZT7CHM2N5BLbUunF92T8b6iYC199bO2kagSuU05-5dZGqb1SP0A0lyTWng", par.ID)
+			assert.Equal(t, Platform, par.AuthenticatorAttachment)
+			assert.Equal(t, AssertCeremony, par.Response.CollectedClientData.Type)
+			assert.Equal(t, "https://webauthn.io", par.Response.CollectedClientData.Origin)
+			assert.True(t, par.Response.AuthenticatorData.Flags.HasUserPresent())
+			assert.Len(t, par.Response.Signature, 71)
+			assert.Equal(t, tc.expected, par.Response.UserHandle)
+			assert.Equal(t, tc.expected, []byte(par.Raw.AssertionResponse.UserHandle))
+		})
+	}
+
+	_, err := ParseCredentialRequestResponseJSON([]byte(`{"id":`))
+	require.Error(t, err)
+	assert.Equal(t, "Parse error for Assertion", err.Error())
+}
+
+func TestCredentialAssertionResponse_ParseMaxSize(t *testing.T) {
+	var car CredentialAssertionResponse
+
+	require.NoError(t, json.Unmarshal([]byte(testAssertionResponses["success"]), &car))
+
+	size := len(car.AssertionResponse.ClientDataJSON)
+
+	_, err := car.ParseMaxSize(size)
+	assert.NoError(t, err)
+
+	_, err = car.ParseMaxSize(size - 1)
+	require.Error(t, err)
+	assert.Equal(t, ErrBadRequest.Type, err.(*Error).Type)
+	assert.Equal(t, fmt.Sprintf("clientDataJSON is %d bytes which exceeds the maximum of %d bytes", size, size-1), err.(*Error).DevInfo)
+
+	car.AssertionResponse.ClientDataJSON = append(URLEncodedBase64(`{"type":"webauthn.get","pad":"`), make([]byte, DefaultMaxClientDataSize)...)
+
+	body, err := json.Marshal(car)
+	require.NoError(t, err)
+
+	_, err = ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	require.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("clientDataJSON is %d bytes which exceeds the maximum of %d bytes", DefaultMaxClientDataSize+30, DefaultMaxClientDataSize), err.(*Error).DevInfo)
+
+	car.AssertionResponse.ClientDataJSON = URLEncodedBase64("{\"type\":\"webauthn.get\",\"origin\":\"\xff\"}")
+
+	_, err = car.Parse()
+	require.Error(t, err)
+	assert.Equal(t, "Parse error for Assertion", err.Error())
+	assert.Equal(t, "clientDataJSON is not valid UTF-8", err.(*Error).DevInfo)
+}
+
 var testAssertionResponses = map[string]string{
 	// None Attestation - MacOS TouchID.
 	`success`: `{
@@ -1,15 +1,26 @@
 package protocol
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 // AuthenticatorAttestationResponse is the initial unpacked 'response' object received by the relying party. This
@@ -42,6 +53,18 @@ type ParsedAttestationResponse struct {
 	CollectedClientData CollectedClientData
 	AttestationObject   AttestationObject
 	Transports          []AuthenticatorTransport
+
+	// TransportsConflict is true when the client reported transports using both the response getTransports() and the
+	// deprecated top-level transports member and the two sets differ. The transports of the response take precedence.
+	TransportsConflict bool
+
+	// AttestationType is the attestation type determined by the attestation statement format verifier, which is only
+	// set once the response has been verified.
+	AttestationType string
+
+	// trustPath is the attestation certificate chain returned by the attestation statement format verifier, which is
+	// only set once the response has been verified.
+	trustPath []interface{}
 }
 
 // AttestationObject is the raw attestationObject.
@@ -65,9 +88,94 @@ type AttestationObject struct {
 	// The format of the Attestation data.
 	Format string `json:"fmt"`
 	// The attestation statement data sent back if attestation is requested.
-	AttStatement map[string]interface{} `json:"attStmt,omitempty"`
+	AttStatement AttestationStatement `json:"attStmt,omitempty"`
+	// PublicKeyOptions customizes the parsing of the credential public key by the attestation statement format
+	// verifiers. It's not part of the attestation object.
+	PublicKeyOptions webauthncose.ParsePublicKeyOptions `json:"-"`
+}
+
+// AttestationStatement is the decoded attestation statement, whose fields are defined by the attestation statement
+// format.
+//
+// Specification: §6.5.2. Attestation Statement Formats (https://www.w3.org/TR/webauthn/#sctn-attestation-formats)
+type AttestationStatement map[string]interface{}
+
+// GetBytes returns the byte string value of the field, and false for ok if it's absent or has another type.
+func (s AttestationStatement) GetBytes(key string) (value []byte, ok bool) {
+	value, ok = s[key].([]byte)
+
+	return value, ok
+}
+
+// GetInt returns the integer value of the field, and false for ok if it's absent or has another type.
+func (s AttestationStatement) GetInt(key string) (value int64, ok bool) {
+	value, ok = s[key].(int64)
+
+	return value, ok
+}
+
+// GetString returns the text string value of the field, and false for ok if it's absent or has another type.
+func (s AttestationStatement) GetString(key string) (value string, ok bool) {
+	value, ok = s[key].(string)
+
+	return value, ok
+}
+
+// GetSlice returns the array value of the field, and false for ok if it's absent or has another type.
+func (s AttestationStatement) GetSlice(key string) (value []interface{}, ok bool) {
+	value, ok = s[key].([]interface{})
+
+	return value, ok
+}
+
+// RequireBytes is the same as GetBytes but returns an ErrAttestationFormat naming the field if it's absent or has
+// another type.
+func (s AttestationStatement) RequireBytes(key string) ([]byte, error) {
+	if value, ok := s.GetBytes(key); ok {
+		return value, nil
+	}
+
+	return nil, errAttestationStatementField(key)
+}
+
+// RequireInt is the same as GetInt but returns an ErrAttestationFormat naming the field if it's absent or has another
+// type.
+func (s AttestationStatement) RequireInt(key string) (int64, error) {
+	if value, ok := s.GetInt(key); ok {
+		return value, nil
+	}
+
+	return 0, errAttestationStatementField(key)
+}
+
+// RequireString is the same as GetString but returns an ErrAttestationFormat naming the field if it's absent or has
+// another type.
+func (s AttestationStatement) RequireString(key string) (string, error) {
+	if value, ok := s.GetString(key); ok {
+		return value, nil
+	}
+
+	return "", errAttestationStatementField(key)
+}
+
+// RequireSlice is the same as GetSlice but returns an ErrAttestationFormat naming the field if it's absent or has
+// another type.
+func (s AttestationStatement) RequireSlice(key string) ([]interface{}, error) {
+	if value, ok := s.GetSlice(key); ok {
+		return value, nil
+	}
+
+	return nil, errAttestationStatementField(key)
+}
+
+func errAttestationStatementField(key string) error {
+	return ErrAttestationFormat.WithDetails(fmt.Sprintf("Error retrieving %s value", key))
 }
 
+// VerificationTime returns the time the validity periods of attestation certificates are checked against. It defaults
+// to time.Now and may be replaced for example to verify attestations as of the time they were originally received.
+var VerificationTime = time.Now
+
 type attestationFormatValidationHandler func(AttestationObject, []byte) (string, []interface{}, error)
 
 var attestationRegistry = make(map[string]attestationFormatValidationHandler)
@@ -78,6 +186,18 @@ func RegisterAttestationFormat(format string, handler attestationFormatValidatio
 	attestationRegistry[format] = handler
 }
 
+// IsAttestationFormatSupported returns true if the attestation statement format is none or has been registered with
+// RegisterAttestationFormat.
+func IsAttestationFormatSupported(format string) bool {
+	if format == "none" {
+		return true
+	}
+
+	_, ok := attestationRegistry[format]
+
+	return ok
+}
+
 // Parse the values returned in the authenticator response and perform attestation verification
 // Step 8. This returns a fully decoded struct with the data put into a format that can be
 // used to verify the user and credential that was created.
@@ -85,42 +205,124 @@ func (ccr *AuthenticatorAttestationResponse) Parse() (p *ParsedAttestationRespon
 	p = &ParsedAttestationResponse{}
 
 	if err = json.Unmarshal(ccr.ClientDataJSON, &p.CollectedClientData); err != nil {
-		return nil, ErrParsingData.WithInfo(err.Error())
+		return nil, ErrParsingData.WithDetails(clientDataJSONParseErrorDetails(err)).WithInfo(err.Error())
 	}
 
 	if err = webauthncbor.Unmarshal(ccr.AttestationObject, &p.AttestationObject); err != nil {
-		return nil, ErrParsingData.WithInfo(err.Error())
+		return nil, ErrParsingData.WithDetails(fmt.Sprintf("Error unmarshalling attestationObject: %v", err)).WithInfo(err.Error())
 	}
 
 	// Step 8. Perform CBOR decoding on the attestationObject field of the AuthenticatorAttestationResponse
 	// structure to obtain the attestation statement format fmt, the authenticator data authData, and
 	// the attestation statement attStmt.
 	if err = p.AttestationObject.AuthData.Unmarshal(p.AttestationObject.RawAuthData); err != nil {
-		return nil, fmt.Errorf("error decoding auth data: %v", err)
+		return nil, fmt.Errorf("error decoding auth data: %w", err)
 	}
 
 	if !p.AttestationObject.AuthData.Flags.HasAttestedCredentialData() {
 		return nil, ErrAttestationFormat.WithInfo("Attestation missing attested credential data flag")
 	}
 
-	for _, t := range ccr.Transports {
-		p.Transports = append(p.Transports, AuthenticatorTransport(t))
-	}
+	p.Transports = parseTransports(ccr.Transports)
 
 	return p, nil
 }
 
+// parseTransports converts the transports reported by the client into the canonical set of transports, which is
+// lowercase, free of empty values, and free of duplicates while otherwise retaining the reported order. Unknown
+// transports are retained as the specification requires Relying Parties to store them.
+func parseTransports(values []string) (transports []AuthenticatorTransport) {
+	for _, value := range values {
+		transport := AuthenticatorTransport(strings.ToLower(strings.TrimSpace(value)))
+
+		if transport == "" || containsTransport(transports, transport) {
+			continue
+		}
+
+		transports = append(transports, transport)
+	}
+
+	return transports
+}
+
+// mergeTransports merges the canonical transports of the response with the canonical transports of the deprecated
+// top-level transports member, returning the transports to store and true if the two sets conflict.
+func mergeTransports(response, legacy []AuthenticatorTransport) (transports []AuthenticatorTransport, conflict bool) {
+	switch {
+	case len(legacy) == 0:
+		return response, false
+	case len(response) == 0:
+		return legacy, false
+	}
+
+	if len(response) != len(legacy) {
+		return response, true
+	}
+
+	for _, transport := range legacy {
+		if !containsTransport(response, transport) {
+			return response, true
+		}
+	}
+
+	return response, false
+}
+
+// containsTransport returns true if the transport is one of the transports.
+func containsTransport(transports []AuthenticatorTransport, transport AuthenticatorTransport) bool {
+	for _, t := range transports {
+		if t == transport {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientDataJSONParseErrorDetails describes a clientDataJSON decoding error including the field and byte offset of the
+// error where they are known.
+func clientDataJSONParseErrorDetails(err error) string {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("Error unmarshalling clientDataJSON at offset %d: %v", syntaxErr.Offset, err)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("Error unmarshalling clientDataJSON field '%s' at offset %d: %v", typeErr.Field, typeErr.Offset, err)
+	default:
+		return fmt.Sprintf("Error unmarshalling clientDataJSON: %v", err)
+	}
+}
+
 // Verify performs Steps 9 through 14 of registration verification.
 //
 // Steps 9 through 12 are verified against the auth data. These steps are identical to 11 through 14 for assertion so we
 // handle them with AuthData.
 func (attestationObject *AttestationObject) Verify(relyingPartyID string, clientDataHash []byte, verificationRequired bool) error {
-	rpIDHash := sha256.Sum256([]byte(relyingPartyID))
+	return attestationObject.VerifyCtx(context.Background(), relyingPartyID, clientDataHash, verificationRequired)
+}
+
+// VerifyCtx is the same as Verify but returns the context error instead of continuing with the attestation statement
+// and metadata checks once the provided context is done.
+func (attestationObject *AttestationObject) VerifyCtx(ctx context.Context, relyingPartyID string, clientDataHash []byte, verificationRequired bool) error {
+	_, _, err := attestationObject.verify(ctx, metadata.StoreFromContext(ctx), relyingPartyID, clientDataHash, verificationRequired)
+
+	return err
+}
+
+// verify performs the attestation object verification against the metadata of the provided store, which may be nil if
+// there is no metadata, and returns the attestation type and trust path determined by the attestation statement format
+// verifier.
+func (attestationObject *AttestationObject) verify(ctx context.Context, store *metadata.Store, relyingPartyID string, clientDataHash []byte, verificationRequired bool) (string, []interface{}, error) {
+	rpIDHash := RPIDHash(relyingPartyID)
 
 	// Begin Step 9 through 12. Verify that the rpIdHash in authData is the SHA-256 hash of the RP ID expected by the RP.
-	authDataVerificationError := attestationObject.AuthData.Verify(rpIDHash[:], nil, verificationRequired)
+	authDataVerificationError := attestationObject.AuthData.Verify(rpIDHash, nil, verificationRequired)
 	if authDataVerificationError != nil {
-		return authDataVerificationError
+		return "", nil, authDataVerificationError
 	}
 
 	// Step 13. Determine the attestation statement format by performing a
@@ -134,63 +336,462 @@ func (attestationObject *AttestationObject) Verify(relyingPartyID string, client
 	// Supported types.
 
 	// But first let's make sure attestation is present. If it isn't, we don't need to handle
-	// any of the following steps
+	// any of the following steps. The none format only skips the attestation statement verification, the client data
+	// and the rpIdHash, user present, and user verified checks of the authenticator data have already been performed.
 	if attestationObject.Format == "none" {
 		if len(attestationObject.AttStatement) != 0 {
-			return ErrAttestationFormat.WithInfo("Attestation format none with attestation present")
+			return "", nil, ErrAttestationFormat.WithInfo("Attestation format none with attestation present")
 		}
 
-		return nil
+		return string(metadata.None), nil, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
 	}
 
 	formatHandler, valid := attestationRegistry[attestationObject.Format]
 	if !valid {
-		return ErrAttestationFormat.WithInfo(fmt.Sprintf("Attestation format %s is unsupported", attestationObject.Format))
+		return "", nil, ErrAttestationFormat.WithInfo(fmt.Sprintf("Attestation format %s is unsupported", attestationObject.Format)).WithReason(AttestationFailureFormatUnsupported)
+	}
+
+	// The verifiers parse the credential public key with the integer labels, which are mapped from the text string labels
+	// here when PublicKeyOptions allows them. The attestation object itself is left unchanged.
+	att := *attestationObject
+
+	if attestationObject.PublicKeyOptions.AllowStringLabels && len(att.AuthData.AttData.CredentialPublicKey) != 0 {
+		normalized, err := webauthncose.NormalizeStringLabels(att.AuthData.AttData.CredentialPublicKey)
+		if err != nil {
+			return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing the public key: %+v", err))
+		}
+
+		att.AuthData.AttData.CredentialPublicKey = normalized
 	}
 
 	// Step 14. Verify that attStmt is a correct attestation statement, conveying a valid attestation signature, by using
 	// the attestation statement format fmt’s verification procedure given attStmt, authData and the hash of the serialized
 	// client data computed in step 7.
-	attestationType, x5c, err := formatHandler(*attestationObject, clientDataHash)
+	attestationType, x5c, err := formatHandler(att, clientDataHash)
 	if err != nil {
-		return err.(*Error).WithInfo(attestationType)
+		return attestationType, nil, attestationFormatError(err, attestationType)
+	}
+
+	if err = verifyCertificateChainValidity(x5c, VerificationTime()); err != nil {
+		return attestationType, nil, err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return attestationType, nil, err
 	}
 
 	aaguid, err := uuid.FromBytes(attestationObject.AuthData.AttData.AAGUID)
 	if err != nil {
-		return err
+		return attestationType, nil, err
 	}
 
-	if meta, ok := metadata.Metadata[aaguid]; ok {
-		for _, s := range meta.StatusReports {
-			if metadata.IsUndesiredAuthenticatorStatus(s.Status) {
-				return ErrInvalidAttestation.WithDetails("Authenticator with undesirable status encountered")
-			}
+	if meta, ok := lookupAttestationMetadata(store, aaguid, x5c); ok {
+		if err = verifyAttestationMetadata(meta, x5c); err != nil {
+			return attestationType, nil, err
 		}
+	} else if metadata.Conformance {
+		return attestationType, nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("AAGUID %s not found in metadata during conformance testing", aaguid.String())).WithReason(AttestationFailureAAGUIDDenied)
+	}
 
-		if x5c != nil {
-			x5cAtt, err := x509.ParseCertificate(x5c[0].([]byte))
-			if err != nil {
-				return ErrInvalidAttestation.WithDetails("Unable to parse attestation certificate from x5c")
-			}
+	return attestationType, x5c, nil
+}
 
-			if x5cAtt.Subject.CommonName != x5cAtt.Issuer.CommonName {
-				var hasBasicFull = false
+// attestationFormatError returns the error of an attestation statement format verifier with the attestation type as
+// its info. Verifiers are expected to return an *Error, any other error is reported as an attestation format error.
+func attestationFormatError(err error, attestationType string) error {
+	var e *Error
 
-				for _, a := range meta.MetadataStatement.AttestationTypes {
-					if a == metadata.BasicFull {
-						hasBasicFull = true
-					}
-				}
+	if errors.As(err, &e) {
+		return e.WithInfo(attestationType)
+	}
+
+	return ErrAttestationFormat.WithDetails(err.Error()).WithInfo(attestationType)
+}
+
+// AttestationResult is the result of an attestation verified with VerifyAttestation.
+type AttestationResult struct {
+	// Format is the attestation statement format.
+	Format string
+
+	// AttestationType is the attestation type determined by the attestation statement format verifier.
+	AttestationType string
+
+	// AuthData is the decoded authenticator data which contains the credential ID, AAGUID, and flags.
+	AuthData AuthenticatorData
+
+	// TPMCertInfo is the clock and firmware information of the TPM for the tpm attestation statement format, which is
+	// nil for the other formats.
+	TPMCertInfo *TPMCertInfo
+}
+
+// VerifyAttestation decodes and verifies a raw attestation object and clientDataJSON for the expected RP ID and
+// challenge, without requiring a parsed registration response, user, or session. The clientDataJSON origin must match
+// one of the expected origins, which default to the https origin of the RP ID. Like a registration, the user must be
+// present but user verification is left to the caller to check via the flags of the result. It returns the credential
+// public key and the attestation result.
+func VerifyAttestation(attestationObject, clientDataJSON []byte, expectedRPID string, expectedChallenge []byte, expectedOrigins ...string) (publicKey []byte, result *AttestationResult, err error) {
+	if len(attestationObject) > DefaultMaxAttestationObjectSize {
+		return nil, nil, ErrBadRequest.
+			WithDetails("Parse error for Registration").
+			WithInfo(fmt.Sprintf("Attestation object is %d bytes which exceeds the maximum of %d bytes", len(attestationObject), DefaultMaxAttestationObjectSize))
+	}
+
+	response := AuthenticatorAttestationResponse{
+		AuthenticatorResponse: AuthenticatorResponse{ClientDataJSON: clientDataJSON},
+		AttestationObject:     attestationObject,
+	}
+
+	parsed, err := response.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(expectedOrigins) == 0 {
+		expectedOrigins = []string{"https://" + expectedRPID}
+	}
+
+	if err = parsed.CollectedClientData.Verify(URLEncodedBase64(expectedChallenge).String(), CreateCeremony, expectedOrigins); err != nil {
+		return nil, nil, err
+	}
+
+	attestationType, _, err := parsed.AttestationObject.verify(context.Background(), metadata.DefaultStore, expectedRPID, response.ClientDataHash(), false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result = &AttestationResult{
+		Format:          parsed.AttestationObject.Format,
+		AttestationType: attestationType,
+		AuthData:        parsed.AttestationObject.AuthData,
+	}
+
+	if result.TPMCertInfo, _, err = parsed.AttestationObject.TPMCertInfo(); err != nil {
+		return nil, nil, err
+	}
+
+	return parsed.AttestationObject.AuthData.AttData.CredentialPublicKey, result, nil
+}
+
+// ReverifyAttestation verifies a stored attestation object again for the RP ID using the provided metadata store,
+// which allows completing the trust decision for attestations registered before the metadata of their authenticator
+// was loaded. The attestation object is verified the same way as during registration, including the RP ID hash and the
+// user present flag of the authenticator data and the metadata checks against the store. The attestation is trusted
+// when the authenticator is found in the store and the attestation certificate chain leads to one of its attestation
+// root certificates. Attestations without a certificate chain, such as self and none attestations, are never trusted.
+func ReverifyAttestation(rawAttestationObject, clientDataHash []byte, relyingPartyID string, store *metadata.Store) (attestationType string, trusted bool, err error) {
+	var attestationObject AttestationObject
+
+	if err = webauthncbor.Unmarshal(rawAttestationObject, &attestationObject); err != nil {
+		return "", false, ErrParsingData.WithDetails(fmt.Sprintf("Error unmarshalling attestationObject: %v", err)).WithInfo(err.Error())
+	}
+
+	if err = attestationObject.AuthData.Unmarshal(attestationObject.RawAuthData); err != nil {
+		return "", false, fmt.Errorf("error decoding auth data: %w", err)
+	}
+
+	attestationType, x5c, err := attestationObject.verify(context.Background(), store, relyingPartyID, clientDataHash, false)
+	if err != nil {
+		return attestationType, false, err
+	}
 
-				if !hasBasicFull {
-					return ErrInvalidAttestation.WithDetails("Attestation with full attestation from authenticator that does not support full attestation")
+	if len(x5c) == 0 {
+		return attestationType, false, nil
+	}
+
+	aaguid, err := uuid.FromBytes(attestationObject.AuthData.AttData.AAGUID)
+	if err != nil {
+		return attestationType, false, err
+	}
+
+	meta, ok := lookupAttestationMetadata(store, aaguid, x5c)
+	if !ok {
+		return attestationType, false, nil
+	}
+
+	if err = verifyAttestationRootCertificates(meta, x5c); err != nil {
+		return attestationType, false, err
+	}
+
+	return attestationType, true, nil
+}
+
+// ReverifyAttestationSnapshot is the same as ReverifyAttestation but uses the entries of the provided metadata BLOB
+// payload, which allows audits to verify an attestation against the metadata that was current when it was registered.
+func ReverifyAttestationSnapshot(rawAttestationObject, clientDataHash []byte, relyingPartyID string, payload *metadata.MetadataBLOBPayload) (attestationType string, trusted bool, err error) {
+	return ReverifyAttestation(rawAttestationObject, clientDataHash, relyingPartyID, metadata.NewStoreFromPayload(payload))
+}
+
+// verifyAttestationMetadata ensures the authenticator described by the metadata entry has no undesired status and
+// supports the attestation type of the certificate chain.
+func verifyAttestationMetadata(meta metadata.MetadataBLOBPayloadEntry, x5c []interface{}) error {
+	for _, s := range meta.StatusReports {
+		if metadata.IsUndesiredAuthenticatorStatus(s.Status) {
+			return ErrInvalidAttestation.WithDetails("Authenticator with undesirable status encountered").WithReason(AttestationFailureAAGUIDDenied)
+		}
+	}
+
+	if x5c != nil {
+		x5cAtt, err := x509.ParseCertificate(x5c[0].([]byte))
+		if err != nil {
+			return ErrInvalidAttestation.WithDetails("Unable to parse attestation certificate from x5c")
+		}
+
+		if x5cAtt.Subject.CommonName != x5cAtt.Issuer.CommonName {
+			var hasBasicFull = false
+
+			for _, a := range meta.MetadataStatement.AttestationTypes {
+				if a == metadata.BasicFull {
+					hasBasicFull = true
 				}
 			}
+
+			if !hasBasicFull {
+				return ErrInvalidAttestation.WithDetails("Attestation with full attestation from authenticator that does not support full attestation")
+			}
+		}
+	}
+
+	return nil
+}
+
+// VerifyAttestationRoots ensures the attestation certificate chain of the verified response leads to one of the provided
+// roots, which are used instead of the attestation root certificates of the metadata. Responses without an attestation
+// certificate chain such as self and none attestations are rejected, as nothing attests them to one of the roots.
+func (p *ParsedAttestationResponse) VerifyAttestationRoots(roots *x509.CertPool) error {
+	if len(p.trustPath) == 0 {
+		return ErrAttestationTrust.WithDetails(fmt.Sprintf("Attestation of type %s has no certificate chain to verify against the attestation root pool", p.AttestationType)).
+			WithReason(AttestationFailureUntrustedRoot)
+	}
+
+	if err := verifyAttestationChain(roots, p.trustPath); err != nil {
+		return ErrAttestationTrust.WithDetails(fmt.Sprintf("Error validating the attestation certificate chain against the attestation root pool: %+v", err)).WithReason(chainFailureReason(err))
+	}
+
+	return nil
+}
+
+// idFIDOU2FTransports is the OID of the FIDO U2F certificate transports extension.
+var idFIDOU2FTransports = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 2, 1, 1}
+
+// fidoU2FTransports are the transports of the bits of the FIDO U2F certificate transports extension, where both the
+// Bluetooth Classic and Bluetooth Low Energy bits are reported as BLE.
+var fidoU2FTransports = [...]AuthenticatorTransport{BLE, BLE, USB, NFC, Internal}
+
+// CertificateTransports returns the transports of the FIDO U2F certificate transports extension
+// (1.3.6.1.4.1.45724.2.1.1) of an attestation certificate, and false for ok if the certificate does not have the
+// extension. The extension is a BIT STRING of the bluetoothRadio, bluetoothLowEnergyRadio, uSB, nFC, and uSBInternal
+// bits, which are reported as the ble, ble, usb, nfc, and internal transports respectively.
+//
+// Specification: FIDO U2F Authenticator Transports Extension (https://fidoalliance.org/specs/fido-u2f-v1.2-ps-20170411/fido-u2f-authenticator-transports-extension-v1.2-ps-20170411.html)
+func CertificateTransports(cert *x509.Certificate) (transports []AuthenticatorTransport, ok bool, err error) {
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(idFIDOU2FTransports) {
+			continue
+		}
+
+		var bits asn1.BitString
+
+		if rest, err := asn1.Unmarshal(extension.Value, &bits); err != nil || len(rest) != 0 {
+			return nil, true, ErrAttestationCertificate.WithDetails("Error parsing the FIDO U2F transports extension of the attestation certificate")
+		}
+
+		transports = []AuthenticatorTransport{}
+
+		for i, transport := range fidoU2FTransports {
+			if bits.At(i) == 1 && (len(transports) == 0 || transports[len(transports)-1] != transport) {
+				transports = append(transports, transport)
+			}
+		}
+
+		return transports, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// AttestationTransports returns the transports of the FIDO U2F certificate transports extension of the attestation
+// certificate of the verified response, and false for ok if the response has no attestation certificate or its
+// certificate does not have the extension.
+func (p *ParsedAttestationResponse) AttestationTransports() (transports []AuthenticatorTransport, ok bool, err error) {
+	if len(p.trustPath) == 0 {
+		return nil, false, nil
+	}
+
+	raw, valid := p.trustPath[0].([]byte)
+	if !valid {
+		return nil, false, ErrAttestationCertificate.WithDetails("Error getting certificate from x5c cert chain")
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, false, ErrAttestationCertificate.WithDetails(fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
+	}
+
+	return CertificateTransports(cert)
+}
+
+// verifyAttestationRootCertificates ensures the attestation certificate chain leads to one of the attestation root
+// certificates of the metadata statement.
+func verifyAttestationRootCertificates(meta metadata.MetadataBLOBPayloadEntry, x5c []interface{}) error {
+	roots := x509.NewCertPool()
+
+	for _, encoded := range meta.MetadataStatement.AttestationRootCertificates {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return ErrAttestationTrust.WithDetails(fmt.Sprintf("Error decoding metadata attestation root certificate: %+v", err)).WithReason(AttestationFailureUntrustedRoot)
+		}
+
+		root, err := x509.ParseCertificate(data)
+		if err != nil {
+			return ErrAttestationTrust.WithDetails(fmt.Sprintf("Error parsing metadata attestation root certificate: %+v", err)).WithReason(AttestationFailureUntrustedRoot)
+		}
+
+		roots.AddCert(root)
+	}
+
+	if err := verifyAttestationChain(roots, x5c); err != nil {
+		return ErrAttestationTrust.WithDetails(fmt.Sprintf("Error validating the attestation certificate chain against the metadata attestation root certificates: %+v", err)).WithReason(chainFailureReason(err))
+	}
+
+	return nil
+}
+
+// verifyAttestationChain verifies the attestation certificate chain, which starts with the attestation certificate
+// followed by its intermediate certificates, leads to one of the roots.
+func verifyAttestationChain(roots *x509.CertPool, x5c []interface{}) error {
+	intermediates := x509.NewCertPool()
+
+	var leaf *x509.Certificate
+
+	for i, c := range x5c {
+		certBytes, valid := c.([]byte)
+		if !valid {
+			return fmt.Errorf("certificate %d in the attestation chain is not a byte string", i)
+		}
+
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			leaf = cert
+
+			handleTPMCriticalExtensions(leaf)
+
+			continue
+		}
+
+		intermediates.AddCert(cert)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   VerificationTime(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	_, err := leaf.Verify(opts)
+
+	return err
+}
+
+// verifyCertificateChainValidity ensures each certificate of the attestation trust path is within its validity period
+// at the provided time.
+func verifyCertificateChainValidity(x5c []interface{}, now time.Time) error {
+	for i, c := range x5c {
+		certBytes, valid := c.([]byte)
+		if !valid {
+			return ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
+		}
+
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
+		}
+
+		switch {
+		case now.Before(cert.NotBefore):
+			return ErrAttestationTrust.WithDetails(fmt.Sprintf("Certificate %d in the attestation chain is not valid before %s", i, cert.NotBefore.UTC().Format(time.RFC3339))).WithReason(AttestationFailureCertificateExpired)
+		case now.After(cert.NotAfter):
+			return ErrAttestationTrust.WithDetails(fmt.Sprintf("Certificate %d in the attestation chain expired at %s", i, cert.NotAfter.UTC().Format(time.RFC3339))).WithReason(AttestationFailureCertificateExpired)
 		}
-	} else if metadata.Conformance {
-		return ErrInvalidAttestation.WithDetails(fmt.Sprintf("AAGUID %s not found in metadata during conformance testing", aaguid.String()))
 	}
 
 	return nil
 }
+
+// chainFailureReason returns the AttestationFailureReason of a certificate chain verification error, which is
+// AttestationFailureCertificateExpired when a certificate of the chain is outside its validity period and
+// AttestationFailureUntrustedRoot otherwise.
+func chainFailureReason(err error) AttestationFailureReason {
+	var invalid x509.CertificateInvalidError
+
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return AttestationFailureCertificateExpired
+	}
+
+	return AttestationFailureUntrustedRoot
+}
+
+// lookupAttestationMetadata finds the metadata entry for the authenticator by AAGUID, falling back to the attestation
+// certificate key identifier of the attestation leaf certificate for authenticators without an AAGUID such as U2F
+// authenticators.
+func lookupAttestationMetadata(store *metadata.Store, aaguid uuid.UUID, x5c []interface{}) (entry metadata.MetadataBLOBPayloadEntry, ok bool) {
+	if store == nil {
+		return entry, false
+	}
+
+	if entry, ok = store.Lookup(aaguid); ok || aaguid != uuid.Nil || len(x5c) == 0 {
+		return entry, ok
+	}
+
+	leafBytes, valid := x5c[0].([]byte)
+	if !valid {
+		return entry, false
+	}
+
+	leaf, err := x509.ParseCertificate(leafBytes)
+	if err != nil {
+		return entry, false
+	}
+
+	id, err := metadata.CertificateKeyIdentifier(leaf)
+	if err != nil {
+		return entry, false
+	}
+
+	return store.LookupByCertKeyID(id)
+}
+
+// isSelfSignedByCredential returns true if the public key of the attestation certificate is the credential public key,
+// in which case the attestation statement was produced with the credential private key and is a self attestation
+// rather than an attestation by a separate attestation key.
+func isSelfSignedByCredential(cert *x509.Certificate, credentialPublicKey []byte) bool {
+	key, err := webauthncose.ParsePublicKey(credentialPublicKey)
+	if err != nil {
+		return false
+	}
+
+	switch k := key.(type) {
+	case webauthncose.EC2PublicKeyData:
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+
+		return ok && pub.X.Cmp(new(big.Int).SetBytes(k.XCoord)) == 0 && pub.Y.Cmp(new(big.Int).SetBytes(k.YCoord)) == 0
+	case webauthncose.RSAPublicKeyData:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+
+		return ok && pub.N.Cmp(new(big.Int).SetBytes(k.Modulus)) == 0 && big.NewInt(int64(pub.E)).Cmp(new(big.Int).SetBytes(k.Exponent)) == 0
+	case webauthncose.OKPPublicKeyData:
+		pub, ok := cert.PublicKey.(ed25519.PublicKey)
+
+		return ok && bytes.Equal(pub, k.XCoord)
+	default:
+		return false
+	}
+}
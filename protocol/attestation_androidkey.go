@@ -63,7 +63,7 @@ func verifyAndroidKeyFormat(att AttestationObject, clientDataHash []byte) (strin
 		return "", nil, ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
 	}
 
-	signatureData := append(att.RawAuthData, clientDataHash...)
+	signatureData := append(append([]byte{}, att.RawAuthData...), clientDataHash...)
 
 	attCert, err := x509.ParseCertificate(attCertBytes)
 	if err != nil {
@@ -74,7 +74,7 @@ func verifyAndroidKeyFormat(att AttestationObject, clientDataHash []byte) (strin
 	sigAlg := webauthncose.SigAlgFromCOSEAlg(coseAlg)
 
 	if err = attCert.CheckSignature(x509.SignatureAlgorithm(sigAlg), signatureData, sig); err != nil {
-		return "", nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err))
+		return "", nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err)).WithReason(AttestationFailureSignatureInvalid)
 	}
 
 	// Verify that the public key in the first certificate in x5c matches the credentialPublicKey in the attestedCredentialData in authenticatorData.
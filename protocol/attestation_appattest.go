@@ -0,0 +1,294 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/flaviup/webauthn/metadata"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
+)
+
+var appAttestAttestationKey = "apple-appattest"
+
+// AppAttestRootCertificate is the PEM encoded Apple App Attestation Root CA which all App Attest credential certificate
+// chains must chain up to.
+//
+// See: https://www.apple.com/certificateauthority/Apple_App_Attestation_Root_CA.pem
+const AppAttestRootCertificate = `-----BEGIN CERTIFICATE-----
+MIICITCCAaegAwIBAgIQC/O+DvHN0uD7jG5yH2IXmDAKBggqhkjOPQQDAzBSMSYw
+JAYDVQQDDB1BcHBsZSBBcHAgQXR0ZXN0YXRpb24gUm9vdCBDQTETMBEGA1UECgwK
+QXBwbGUgSW5jLjETMBEGA1UECAwKQ2FsaWZvcm5pYTAeFw0yMDAzMTgxODMyNTNa
+Fw00NTAzMTUwMDAwMDBaMFIxJjAkBgNVBAMMHUFwcGxlIEFwcCBBdHRlc3RhdGlv
+biBSb290IENBMRMwEQYDVQQKDApBcHBsZSBJbmMuMRMwEQYDVQQIDApDYWxpZm9y
+bmlhMHYwEAYHKoZIzj0CAQYFK4EEACIDYgAERTHhmLW07ATaFQIEVwTtT4dyctdh
+NbJhFs/Ii2FdCgAHGbpphY3+d8qjuDngIN3WVhQUBHAoMeQ/cLiP1sOUtgjqK9au
+Yen1mMEvRq9Sk3Jm5X8U62H+xTD3FE9TgS41o0IwQDAPBgNVHRMBAf8EBTADAQH/
+MB0GA1UdDgQWBBSskRBTM72+aEH/pwyp5frq5eWKoTAOBgNVHQ8BAf8EBAMCAQYw
+CgYIKoZIzj0EAwMDaAAwZQIwQgFGnByvsiVbpTKwSga0kP0e8EeDS4+sQmTvb7vn
+53O5+FRXgeLhpJ06ysC5PrOyAjEAp5U4xDgEgllF7En3VcE3iexZZtKeYnpqtijV
+oyFraWVIyd/dganmrduC1bmTBGwD
+-----END CERTIFICATE-----`
+
+// appAttestRoot is the trust anchor used to verify App Attest certificate chains, swapped out in tests.
+var appAttestRoot = AppAttestRootCertificate
+
+var (
+	appAttestAAGUIDDevelopment = []byte("appattestdevelop")
+	appAttestAAGUIDProduction  = append([]byte("appattest"), make([]byte, 7)...)
+)
+
+// AppAttestResult is the result of an App Attest attestation verified with VerifyAppAttestation.
+type AppAttestResult struct {
+	// PublicKey is the COSE encoded credential public key, which verifies the assertions of the app.
+	PublicKey []byte
+
+	// Development is true if the attestation was generated in the development environment, and false if it was
+	// generated in the production environment.
+	Development bool
+
+	// Receipt is the receipt of the attestation statement, which can be exchanged with Apple for a fraud risk metric.
+	Receipt []byte
+
+	// AuthData is the decoded authenticator data.
+	AuthData AuthenticatorData
+}
+
+// VerifyAppAttestation verifies a raw App Attest attestation object generated by the app for the key identifier keyID,
+// the App ID of the app, i.e. its team identifier and bundle identifier separated by a period, and the one-time
+// challenge the server sent to the app. App Attest is not a WebAuthn ceremony, so unlike AttestationObject.Verify the
+// authenticator data is not expected to have the user present flag, and the clientDataHash is the SHA-256 hash of the
+// challenge rather than of a clientDataJSON.
+//
+// Specification: Validating Apps That Connect to Your Server (https://developer.apple.com/documentation/devicecheck/validating_apps_that_connect_to_your_server)
+func VerifyAppAttestation(attestationObject, challenge []byte, appID string, keyID []byte) (result *AppAttestResult, err error) {
+	if len(attestationObject) > DefaultMaxAttestationObjectSize {
+		return nil, ErrBadRequest.
+			WithDetails("Parse error for App Attest attestation").
+			WithInfo(fmt.Sprintf("Attestation object is %d bytes which exceeds the maximum of %d bytes", len(attestationObject), DefaultMaxAttestationObjectSize))
+	}
+
+	var att AttestationObject
+
+	if err = webauthncbor.Unmarshal(attestationObject, &att); err != nil {
+		return nil, ErrParsingData.WithDetails(fmt.Sprintf("Error unmarshalling attestationObject: %v", err)).WithInfo(err.Error())
+	}
+
+	if err = att.AuthData.Unmarshal(att.RawAuthData); err != nil {
+		return nil, err
+	}
+
+	if att.Format != appAttestAttestationKey {
+		return nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Attestation format %s is not %s", att.Format, appAttestAttestationKey))
+	}
+
+	if !att.AuthData.Flags.HasAttestedCredentialData() {
+		return nil, ErrAttestationFormat.WithDetails("App Attest authenticator data has no attested credential data")
+	}
+
+	// Step 6. Compute the SHA256 hash of your app’s App ID, and verify that it’s the same as the authenticator data’s
+	// RP ID hash.
+	if !bytes.Equal(att.AuthData.RPIDHash, RPIDHash(appID)) {
+		return nil, ErrVerification.WithDetails("App Attest RP ID hash does not match the App ID")
+	}
+
+	// Step 2. Create clientDataHash as the SHA256 hash of the one-time challenge your server sends to your app before
+	// performing the attestation.
+	clientDataHash := sha256.Sum256(challenge)
+
+	attestationType, _, err := verifyAppAttestFormat(att, clientDataHash[:])
+	if err != nil {
+		return nil, attestationFormatError(err, attestationType)
+	}
+
+	// Step 5. Verify that the SHA256 hash of the public key in credCert matches the key identifier from your app. The
+	// hash has been verified to be the credential ID by verifyAppAttestFormat.
+	if !bytes.Equal(att.AuthData.AttData.CredentialID, keyID) {
+		return nil, ErrInvalidAttestation.WithDetails("App Attest key identifier does not match the certificate public key")
+	}
+
+	receipt, _ := att.AppAttestReceipt()
+
+	return &AppAttestResult{
+		PublicKey:   att.AuthData.AttData.CredentialPublicKey,
+		Development: bytes.Equal(att.AuthData.AttData.AAGUID, appAttestAAGUIDDevelopment),
+		Receipt:     receipt,
+		AuthData:    att.AuthData,
+	}, nil
+}
+
+// The apple-appattest attestation statement looks like:
+// $$attStmtType //= (
+//
+//	fmt: "apple-appattest",
+//	attStmt: appAttestStmtFormat
+//
+// )
+//
+//	appAttestStmtFormat = {
+//			x5c: [ credCert: bytes, * (caCert: bytes) ],
+//			receipt: bytes
+//	  }
+//
+// Specification: Validating Apps That Connect to Your Server (https://developer.apple.com/documentation/devicecheck/validating_apps_that_connect_to_your_server)
+func verifyAppAttestFormat(att AttestationObject, clientDataHash []byte) (string, []interface{}, error) {
+	// If x5c is not present, return an error
+	x5c, x509present := att.AttStatement["x5c"].([]interface{})
+	if !x509present || len(x5c) == 0 {
+		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving x5c value")
+	}
+
+	// The receipt is not verified here as it can only be validated by exchanging it with Apple, see AppAttestReceipt.
+	if _, present := att.AppAttestReceipt(); !present {
+		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving receipt value")
+	}
+
+	credCertBytes, valid := x5c[0].([]byte)
+	if !valid {
+		return "", nil, ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
+	}
+
+	credCert, err := x509.ParseCertificate(credCertBytes)
+	if err != nil {
+		return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
+	}
+
+	// Step 1. Verify that the x5c array contains the intermediate and leaf certificates for App Attest, starting from
+	// the credential certificate in the first data buffer in the array (credcert). Verify the validity of the
+	// certificates using Apple's App Attest root certificate.
+	roots := x509.NewCertPool()
+
+	block, _ := pem.Decode([]byte(appAttestRoot))
+	if block == nil {
+		return "", nil, ErrAttestationCertificate.WithDetails("Error decoding App Attest root certificate")
+	}
+
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", nil, ErrAttestationCertificate.WithDetails(fmt.Sprintf("Error parsing App Attest root certificate: %+v", err))
+	}
+
+	roots.AddCert(root)
+
+	intermediates := x509.NewCertPool()
+
+	for _, c := range x5c[1:] {
+		caCertBytes, valid := c.([]byte)
+		if !valid {
+			return "", nil, ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
+		}
+
+		caCert, err := x509.ParseCertificate(caCertBytes)
+		if err != nil {
+			return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
+		}
+
+		intermediates.AddCert(caCert)
+	}
+
+	if _, err = credCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: VerificationTime(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return "", nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Error validating App Attest certificate chain: %+v", err)).WithReason(chainFailureReason(err))
+	}
+
+	// Step 2. Create clientDataHash as the SHA256 hash of the one-time challenge your server sends to your app before
+	// performing the attestation, and append that hash to the end of the authenticator data.
+	nonceToHash := append(append([]byte{}, att.RawAuthData...), clientDataHash...)
+
+	// Step 3. Generate a new SHA256 hash of the composite item to create nonce.
+	nonce := sha256.Sum256(nonceToHash)
+
+	// Step 4. Obtain the value of the credCert extension with OID 1.2.840.113635.100.8.2, which is a DER-encoded ASN.1
+	// sequence. Decode the sequence and extract the single octet string that it contains. Verify that the string
+	// equals nonce.
+	var attExtBytes []byte
+
+	for _, ext := range credCert.Extensions {
+		if ext.Id.Equal([]int{1, 2, 840, 113635, 100, 8, 2}) {
+			attExtBytes = ext.Value
+		}
+	}
+
+	if len(attExtBytes) == 0 {
+		return "", nil, ErrAttestationFormat.WithDetails("Attestation certificate extensions missing 1.2.840.113635.100.8.2")
+	}
+
+	decoded := AppleAnonymousAttestation{}
+
+	if _, err = asn1.Unmarshal(attExtBytes, &decoded); err != nil {
+		return "", nil, ErrAttestationFormat.WithDetails("Unable to parse App Attest certificate extensions")
+	}
+
+	if !bytes.Equal(decoded.Nonce, nonce[:]) {
+		return "", nil, ErrInvalidAttestation.WithDetails("Attestation certificate does not contain expected nonce")
+	}
+
+	// Step 5. Create the SHA256 hash of the public key in credCert, and verify that it matches the key identifier
+	// from your app. The key identifier is compared by VerifyAppAttestation.
+	subjectPK, ok := credCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || subjectPK.Curve != elliptic.P256() {
+		return "", nil, ErrInvalidAttestation.WithDetails("App Attest certificate public key is not a P-256 key")
+	}
+
+	keyID := sha256.Sum256(elliptic.Marshal(elliptic.P256(), subjectPK.X, subjectPK.Y))
+
+	// Step 6. Compute the SHA256 hash of your app’s App ID, and verify that it’s the same as the authenticator data’s
+	// RP ID hash. This is handled by VerifyAppAttestation.
+
+	// Step 7. Verify that the authenticator data’s counter field equals 0.
+	if att.AuthData.Counter != 0 {
+		return "", nil, ErrInvalidAttestation.WithDetails("App Attest authenticator data counter is not 0")
+	}
+
+	// Step 8. Verify that the authenticator data’s aaguid field is either appattestdevelop if operating in the
+	// development environment, or appattest followed by seven 0x00 bytes if operating in the production environment.
+	if !bytes.Equal(att.AuthData.AttData.AAGUID, appAttestAAGUIDDevelopment) && !bytes.Equal(att.AuthData.AttData.AAGUID, appAttestAAGUIDProduction) {
+		return "", nil, ErrInvalidAttestation.WithDetails("App Attest authenticator data AAGUID is not valid")
+	}
+
+	// Step 9. Verify that the authenticator data’s credentialId field is the same as the key identifier.
+	if !bytes.Equal(att.AuthData.AttData.CredentialID, keyID[:]) {
+		return "", nil, ErrInvalidAttestation.WithDetails("App Attest credential ID is not the SHA-256 hash of the certificate public key")
+	}
+
+	// NON-NORMATIVE: Verify that the credential public key equals the Subject Public Key of credCert.
+	pubKey, err := webauthncose.ParsePublicKey(att.AuthData.AttData.CredentialPublicKey)
+	if err != nil {
+		return "", nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Error parsing public key: %+v\n", err))
+	}
+
+	credPK, ok := pubKey.(webauthncose.EC2PublicKeyData)
+	if !ok {
+		return "", nil, ErrInvalidAttestation.WithDetails("Credential public key is not an EC2 key")
+	}
+
+	credPKInfo := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     big.NewInt(0).SetBytes(credPK.XCoord),
+		Y:     big.NewInt(0).SetBytes(credPK.YCoord),
+	}
+
+	if !credPKInfo.Equal(subjectPK) {
+		return "", nil, ErrInvalidAttestation.WithDetails("Certificate public key does not match public key in authData")
+	}
+
+	return string(metadata.AnonCA), x5c, nil
+}
+
+// AppAttestReceipt returns the receipt of an apple-appattest attestation statement. The receipt can be exchanged with
+// Apple for a fraud risk metric, which is not performed by this library.
+//
+// See: Assessing Fraud Risk (https://developer.apple.com/documentation/devicecheck/assessing_fraud_risk)
+func (a *AttestationObject) AppAttestReceipt() (receipt []byte, ok bool) {
+	if a.Format != appAttestAttestationKey {
+		return nil, false
+	}
+
+	return a.AttStatement.GetBytes("receipt")
+}
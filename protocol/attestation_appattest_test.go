@@ -0,0 +1,315 @@
+package protocol
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flaviup/webauthn/metadata"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
+)
+
+func TestVerifyAppAttestFormat(t *testing.T) {
+	clientDataHash := sha256.Sum256([]byte("app attest challenge"))
+
+	testCases := []struct {
+		name   string
+		tamper func(att *AttestationObject, hash []byte) []byte
+		err    string
+	}{
+		{
+			"ShouldVerify",
+			func(att *AttestationObject, hash []byte) []byte {
+				return hash
+			},
+			"",
+		},
+		{
+			"ShouldFailTamperedClientDataHash",
+			func(att *AttestationObject, hash []byte) []byte {
+				tampered := sha256.Sum256([]byte("another challenge"))
+
+				return tampered[:]
+			},
+			"Attestation certificate does not contain expected nonce",
+		},
+		{
+			"ShouldFailTamperedCredentialID",
+			func(att *AttestationObject, hash []byte) []byte {
+				att.AuthData.AttData.CredentialID = append([]byte{}, att.AuthData.AttData.CredentialID...)
+				att.AuthData.AttData.CredentialID[0] ^= 0xff
+
+				return hash
+			},
+			"App Attest credential ID is not the SHA-256 hash of the certificate public key",
+		},
+		{
+			"ShouldFailInvalidAAGUID",
+			func(att *AttestationObject, hash []byte) []byte {
+				att.AuthData.AttData.AAGUID = make([]byte, 16)
+
+				return hash
+			},
+			"App Attest authenticator data AAGUID is not valid",
+		},
+		{
+			"ShouldFailMissingReceipt",
+			func(att *AttestationObject, hash []byte) []byte {
+				delete(att.AttStatement, "receipt")
+
+				return hash
+			},
+			"Error retrieving receipt value",
+		},
+		{
+			"ShouldFailUntrustedChain",
+			func(att *AttestationObject, hash []byte) []byte {
+				att.AttStatement["x5c"] = att.AttStatement["x5c"].([]interface{})[:1]
+
+				return hash
+			},
+			"Error validating App Attest certificate chain: x509: certificate signed by unknown authority",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := appAttestTestAttestationObject(t, clientDataHash[:])
+
+			hash := tc.tamper(&att, clientDataHash[:])
+
+			attestationType, x5c, err := verifyAppAttestFormat(att, hash)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, string(metadata.AnonCA), attestationType)
+			assert.Len(t, x5c, 2)
+		})
+	}
+}
+
+func TestVerifyAppAttestation(t *testing.T) {
+	challenge := []byte("app attest challenge")
+	clientDataHash := sha256.Sum256(challenge)
+
+	att := appAttestTestAttestationObject(t, clientDataHash[:])
+
+	raw, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      att.Format,
+		"attStmt":  att.AttStatement,
+		"authData": att.RawAuthData,
+	})
+	require.NoError(t, err)
+
+	keyID := att.AuthData.AttData.CredentialID
+
+	testCases := []struct {
+		name      string
+		raw       []byte
+		challenge []byte
+		appID     string
+		keyID     []byte
+		err       string
+	}{
+		{"ShouldVerify", raw, challenge, "TEAMID.com.example.app", keyID, ""},
+		{"ShouldFailOtherChallenge", raw, []byte("another challenge"), "TEAMID.com.example.app", keyID, "Attestation certificate does not contain expected nonce"},
+		{"ShouldFailOtherAppID", raw, challenge, "TEAMID.com.example.other", keyID, "App Attest RP ID hash does not match the App ID"},
+		{"ShouldFailOtherKeyID", raw, challenge, "TEAMID.com.example.app", make([]byte, 32), "App Attest key identifier does not match the certificate public key"},
+		{"ShouldFailMalformed", []byte{0xff}, challenge, "TEAMID.com.example.app", keyID, "Error unmarshalling attestationObject: cbor: unexpected \"break\" code"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := VerifyAppAttestation(tc.raw, tc.challenge, tc.appID, tc.keyID)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Nil(t, result)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, att.AuthData.AttData.CredentialPublicKey, result.PublicKey)
+			assert.True(t, result.Development)
+			assert.Equal(t, []byte("receipt"), result.Receipt)
+			assert.False(t, result.AuthData.Flags.HasUserPresent())
+		})
+	}
+
+	// App Attest is not a WebAuthn attestation statement format.
+	assert.False(t, IsAttestationFormatSupported(appAttestAttestationKey))
+
+	otherFormat, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": att.RawAuthData,
+	})
+	require.NoError(t, err)
+
+	_, err = VerifyAppAttestation(otherFormat, challenge, "TEAMID.com.example.app", keyID)
+	assert.EqualError(t, err, "Attestation format none is not apple-appattest")
+}
+
+func TestAttestationObject_AppAttestReceipt(t *testing.T) {
+	clientDataHash := sha256.Sum256([]byte("app attest challenge"))
+
+	att := appAttestTestAttestationObject(t, clientDataHash[:])
+
+	raw, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      att.Format,
+		"attStmt":  att.AttStatement,
+		"authData": att.RawAuthData,
+	})
+	require.NoError(t, err)
+
+	var decoded AttestationObject
+
+	require.NoError(t, webauthncbor.Unmarshal(raw, &decoded))
+
+	receipt, ok := decoded.AppAttestReceipt()
+	assert.True(t, ok)
+	assert.Equal(t, []byte("receipt"), receipt)
+
+	decoded.Format = "apple"
+
+	_, ok = decoded.AppAttestReceipt()
+	assert.False(t, ok)
+}
+
+func TestVerifyAppAttestFormatAppleRoot(t *testing.T) {
+	clientDataHash := sha256.Sum256([]byte("app attest challenge"))
+
+	att := appAttestTestAttestationObject(t, clientDataHash[:])
+
+	appAttestRoot = AppAttestRootCertificate
+
+	_, _, err := verifyAppAttestFormat(att, clientDataHash[:])
+	assert.EqualError(t, err, "Error validating App Attest certificate chain: x509: certificate signed by unknown authority")
+}
+
+// appAttestTestAttestationObject generates an App Attest attestation object issued by a generated root, which replaces
+// the Apple App Attestation Root CA for the duration of the test.
+func appAttestTestAttestationObject(t *testing.T, clientDataHash []byte) AttestationObject {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	notBefore, notAfter := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test App Attestation Root CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	rootBytes, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	root, err := x509.ParseCertificate(rootBytes)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test App Attestation CA 1"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, root, &caKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(caBytes)
+	require.NoError(t, err)
+
+	keyID := sha256.Sum256(elliptic.Marshal(elliptic.P256(), credKey.X, credKey.Y))
+
+	credPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: credKey.X.FillBytes(make([]byte, 32)),
+		YCoord: credKey.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	rpIDHash := sha256.Sum256([]byte("TEAMID.com.example.app"))
+
+	rawAuthData := append([]byte{}, rpIDHash[:]...)
+	rawAuthData = append(rawAuthData, byte(FlagAttestedCredentialData))
+	rawAuthData = append(rawAuthData, 0, 0, 0, 0)
+	rawAuthData = append(rawAuthData, appAttestAAGUIDDevelopment...)
+	rawAuthData = binary.BigEndian.AppendUint16(rawAuthData, uint16(len(keyID)))
+	rawAuthData = append(rawAuthData, keyID[:]...)
+	rawAuthData = append(rawAuthData, credPublicKey...)
+
+	nonce := sha256.Sum256(append(append([]byte{}, rawAuthData...), clientDataHash...))
+
+	nonceExt, err := asn1.Marshal(AppleAnonymousAttestation{Nonce: nonce[:]})
+	require.NoError(t, err)
+
+	credTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test App Attest Credential"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}, Value: nonceExt},
+		},
+	}
+
+	credBytes, err := x509.CreateCertificate(rand.Reader, credTemplate, ca, &credKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	original := appAttestRoot
+	appAttestRoot = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootBytes}))
+
+	t.Cleanup(func() {
+		appAttestRoot = original
+	})
+
+	att := AttestationObject{
+		RawAuthData: rawAuthData,
+		Format:      appAttestAttestationKey,
+		AttStatement: map[string]interface{}{
+			"x5c":     []interface{}{credBytes, caBytes},
+			"receipt": []byte("receipt"),
+		},
+	}
+
+	require.NoError(t, att.AuthData.Unmarshal(rawAuthData))
+
+	return att
+}
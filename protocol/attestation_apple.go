@@ -55,7 +55,7 @@ func verifyAppleFormat(att AttestationObject, clientDataHash []byte) (string, []
 	}
 
 	// Step 2. Concatenate authenticatorData and clientDataHash to form nonceToHash.
-	nonceToHash := append(att.RawAuthData, clientDataHash...)
+	nonceToHash := append(append([]byte{}, att.RawAuthData...), clientDataHash...)
 
 	// Step 3. Perform SHA-256 hash of nonceToHash to produce nonce.
 	nonce := sha256.Sum256(nonceToHash)
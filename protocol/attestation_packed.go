@@ -6,7 +6,6 @@ import (
 	"encoding/asn1"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol/webauthncose"
@@ -58,7 +57,7 @@ func verifyPackedFormat(att AttestationObject, clientDataHash []byte) (string, [
 	x5c, x509present := att.AttStatement["x5c"].([]interface{})
 	if x509present {
 		// Handle Basic Attestation steps for the x509 Certificate
-		return handleBasicAttestation(sig, clientDataHash, att.RawAuthData, att.AuthData.AttData.AAGUID, alg, x5c)
+		return handleBasicAttestation(sig, clientDataHash, att.RawAuthData, att.AuthData.AttData.AAGUID, att.AuthData.AttData.CredentialPublicKey, alg, x5c)
 	}
 
 	// Step 3. If ecdaaKeyId is present, then the attestation type is ECDAA.
@@ -74,25 +73,9 @@ func verifyPackedFormat(att AttestationObject, clientDataHash []byte) (string, [
 }
 
 // Handle the attestation steps laid out in
-func handleBasicAttestation(signature, clientDataHash, authData, aaguid []byte, alg int64, x5c []interface{}) (string, []interface{}, error) {
+func handleBasicAttestation(signature, clientDataHash, authData, aaguid, credentialPublicKey []byte, alg int64, x5c []interface{}) (string, []interface{}, error) {
 	// Step 2.1. Verify that sig is a valid signature over the concatenation of authenticatorData
 	// and clientDataHash using the attestation public key in attestnCert with the algorithm specified in alg.
-	for _, c := range x5c {
-		cb, cv := c.([]byte)
-		if !cv {
-			return "", x5c, ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
-		}
-
-		ct, err := x509.ParseCertificate(cb)
-		if err != nil {
-			return "", x5c, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
-		}
-
-		if ct.NotBefore.After(time.Now()) || ct.NotAfter.Before(time.Now()) {
-			return "", x5c, ErrAttestationFormat.WithDetails("Cert in chain not time valid")
-		}
-	}
-
 	attCertBytes, valid := x5c[0].([]byte)
 	if !valid {
 		return "", x5c, ErrAttestation.WithDetails("Error getting certificate from x5c cert chain")
@@ -108,8 +91,19 @@ func handleBasicAttestation(signature, clientDataHash, authData, aaguid []byte,
 	coseAlg := webauthncose.COSEAlgorithmIdentifier(alg)
 	sigAlg := webauthncose.SigAlgFromCOSEAlg(coseAlg)
 
+	if err = verifyCertificateKeyAlgorithm(attCert, coseAlg); err != nil {
+		return "", x5c, err
+	}
+
 	if err = attCert.CheckSignature(x509.SignatureAlgorithm(sigAlg), signatureData, signature); err != nil {
-		return "", x5c, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err))
+		return "", x5c, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err)).WithReason(AttestationFailureSignatureInvalid)
+	}
+
+	// NON-NORMATIVE: An attestnCert which certifies the credential public key was signed by the credential private key
+	// and is not an attestation by a separate attestation key, so the attestation type is Self and there is no trust
+	// path.
+	if isSelfSignedByCredential(attCert, credentialPublicKey) {
+		return string(metadata.SelfAttestation), nil, nil
 	}
 
 	// Step 2.2 Verify that attestnCert meets the requirements in §8.2.1 Packed attestation statement certificate requirements.
@@ -202,7 +196,7 @@ func handleBasicAttestation(signature, clientDataHash, authData, aaguid []byte,
 }
 
 func handleECDAAAttestation(signature, clientDataHash, ecdaaKeyID []byte) (string, []interface{}, error) {
-	return "Packed (ECDAA)", nil, ErrNotSpecImplemented
+	return "Packed (ECDAA)", nil, ErrECDAANotSupported
 }
 
 func handleSelfAttestation(alg int64, pubKey, authData, clientDataHash, signature []byte) (string, []interface{}, error) {
@@ -234,10 +228,36 @@ func handleSelfAttestation(alg int64, pubKey, authData, clientDataHash, signatur
 
 	valid, err := webauthncose.VerifySignature(key, verificationData, signature)
 	if !valid && err == nil {
-		return "", nil, ErrInvalidAttestation.WithDetails("Unable to verify signature")
+		return "", nil, ErrInvalidAttestation.WithDetails("Unable to verify signature").WithReason(AttestationFailureSignatureInvalid)
 	}
 
-	return string(metadata.BasicSurrogate), nil, err
+	return string(metadata.SelfAttestation), nil, err
+}
+
+// verifyCertificateKeyAlgorithm ensures the attestation statement alg is an algorithm for the type of the public key of
+// the attestation certificate, so a statement which claims an algorithm that attestnCert could not have produced is
+// rejected before the signature is checked.
+func verifyCertificateKeyAlgorithm(cert *x509.Certificate, alg webauthncose.COSEAlgorithmIdentifier) error {
+	var compatible bool
+
+	switch cert.PublicKeyAlgorithm {
+	case x509.ECDSA:
+		compatible = alg == webauthncose.AlgES256 || alg == webauthncose.AlgES384 || alg == webauthncose.AlgES512
+	case x509.RSA:
+		switch alg {
+		case webauthncose.AlgRS1, webauthncose.AlgRS256, webauthncose.AlgRS384, webauthncose.AlgRS512,
+			webauthncose.AlgPS256, webauthncose.AlgPS384, webauthncose.AlgPS512:
+			compatible = true
+		}
+	case x509.Ed25519:
+		compatible = alg == webauthncose.AlgEdDSA
+	}
+
+	if !compatible {
+		return ErrInvalidAttestation.WithDetails(fmt.Sprintf("Attestation statement algorithm %d is not compatible with the %s attestation certificate public key", alg, cert.PublicKeyAlgorithm))
+	}
+
+	return nil
 }
 
 func verifyKeyAlgorithm(keyAlgorithm, attestedAlgorithm int64) error {
@@ -1,10 +1,24 @@
 package protocol
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/metadata"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 func Test_verifyPackedFormat(t *testing.T) {
@@ -110,3 +124,226 @@ var packedTestResponseSolo2 = map[string]string{
 	"type":"public-key"
 	}`,
 }
+
+func Test_verifyPackedFormatCertificateAlgorithm(t *testing.T) {
+	testCases := []struct {
+		name string
+		alg  webauthncose.COSEAlgorithmIdentifier
+		err  string
+	}{
+		{"ShouldVerifyMatchingAlgorithm", webauthncose.AlgES256, ""},
+		{"ShouldFailMismatchedAlgorithm", webauthncose.AlgRS256, "Attestation statement algorithm -257 is not compatible with the ECDSA attestation certificate public key"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			response := attestationTestUnpackResponse(t, packedTestResponseES256["success"])
+			clientDataHash := sha256.Sum256(response.Raw.AttestationResponse.ClientDataJSON)
+
+			att := response.Response.AttestationObject
+			att.AttStatement["alg"] = int64(tc.alg)
+
+			attestationType, _, err := verifyPackedFormat(att, clientDataHash[:])
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, string(metadata.BasicFull), attestationType)
+		})
+	}
+}
+
+func Test_verifyPackedFormatECDAA(t *testing.T) {
+	att := AttestationObject{
+		AttStatement: map[string]interface{}{
+			"alg":        int64(-260),
+			"sig":        []byte("signature"),
+			"ecdaaKeyId": []byte("ecdaa key id"),
+		},
+	}
+
+	_, _, err := verifyPackedFormat(att, make([]byte, 32))
+
+	assert.ErrorIs(t, err, ErrECDAANotSupported)
+	assert.EqualError(t, err, ErrECDAANotSupported.Details)
+}
+
+func Test_verifyPackedFormatSelfAttestation(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientDataHash := sha256.Sum256([]byte("packed self attestation"))
+
+	testCases := []struct {
+		name string
+		alg  webauthncose.COSEAlgorithmIdentifier
+		err  string
+	}{
+		{"ShouldVerify", webauthncose.AlgES256, ""},
+		{"ShouldFailAlgorithmMismatch", webauthncose.AlgES384, "Public key algorithm does not equal att statement algorithm"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := packedTestSelfAttestationObject(t, key, clientDataHash[:], tc.alg)
+
+			attestationType, x5c, err := verifyPackedFormat(att, clientDataHash[:])
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, string(metadata.SelfAttestation), attestationType)
+			assert.Nil(t, x5c)
+		})
+	}
+}
+
+func Test_verifyPackedFormatExtensions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientDataHash := sha256.Sum256([]byte("packed attestation with extensions"))
+
+	att := packedTestSelfAttestationObjectExtensions(t, key, clientDataHash[:], webauthncose.AlgES256, map[string]interface{}{"credProtect": uint64(2)})
+
+	require.True(t, att.AuthData.Flags.HasExtensions())
+	require.NotEmpty(t, att.AuthData.ExtData)
+	assert.Equal(t, AuthenticationExtensionsAuthenticatorOutputs{"credProtect": uint64(2)}, att.AuthData.Extensions)
+
+	attestationType, _, err := verifyPackedFormat(att, clientDataHash[:])
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.SelfAttestation), attestationType)
+
+	require.NoError(t, att.Verify("example.com", clientDataHash[:], false))
+
+	// The signature covers the extensions, so it must not validate once they are stripped from the authenticator data.
+	stripped := att
+	stripped.RawAuthData = bytes.Clone(att.RawAuthData[:len(att.RawAuthData)-len(att.AuthData.ExtData)])
+	stripped.RawAuthData[32] &^= byte(FlagHasExtensions)
+
+	_, _, err = verifyPackedFormat(stripped, clientDataHash[:])
+	assert.EqualError(t, err, "Unable to verify signature")
+}
+
+func Test_verifyPackedFormatSelfSignedCertificate(t *testing.T) {
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	attKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientDataHash := sha256.Sum256([]byte("packed full attestation"))
+
+	testCases := []struct {
+		name            string
+		attKey          *ecdsa.PrivateKey
+		attestationType string
+		x5c             int
+	}{
+		{"ShouldClassifySeparateKeyAsBasic", attKey, string(metadata.BasicFull), 1},
+		{"ShouldClassifyCredentialKeyAsSelf", credKey, string(metadata.SelfAttestation), 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := packedTestSelfAttestationObject(t, credKey, clientDataHash[:], webauthncose.AlgES256)
+
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject: pkix.Name{
+					Country:            []string{"US"},
+					Organization:       []string{"Example"},
+					OrganizationalUnit: []string{"Authenticator Attestation"},
+					CommonName:         "Example Attestation",
+				},
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				BasicConstraintsValid: true,
+			}
+
+			attCert, err := x509.CreateCertificate(rand.Reader, template, template, &tc.attKey.PublicKey, tc.attKey)
+			require.NoError(t, err)
+
+			digest := sha256.Sum256(append(append([]byte{}, att.RawAuthData...), clientDataHash[:]...))
+
+			att.AttStatement["sig"], err = ecdsa.SignASN1(rand.Reader, tc.attKey, digest[:])
+			require.NoError(t, err)
+
+			att.AttStatement["x5c"] = []interface{}{attCert}
+
+			attestationType, x5c, err := verifyPackedFormat(att, clientDataHash[:])
+			require.NoError(t, err)
+			assert.Equal(t, tc.attestationType, attestationType)
+			assert.Len(t, x5c, tc.x5c)
+		})
+	}
+}
+
+// packedTestSelfAttestationObject returns a packed self attestation object for an ES256 credential with the key which
+// attests to the provided algorithm.
+func packedTestSelfAttestationObject(t *testing.T, key *ecdsa.PrivateKey, clientDataHash []byte, alg webauthncose.COSEAlgorithmIdentifier) AttestationObject {
+	return packedTestSelfAttestationObjectExtensions(t, key, clientDataHash, alg, nil)
+}
+
+// packedTestSelfAttestationObjectExtensions is the same as packedTestSelfAttestationObject but the authenticator data
+// carries the authenticator extension outputs when not nil.
+func packedTestSelfAttestationObjectExtensions(t *testing.T, key *ecdsa.PrivateKey, clientDataHash []byte, alg webauthncose.COSEAlgorithmIdentifier, extensions map[string]interface{}) AttestationObject {
+	credPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+
+	flags := FlagUserPresent | FlagAttestedCredentialData
+	if extensions != nil {
+		flags |= FlagHasExtensions
+	}
+
+	rawAuthData := append([]byte{}, rpIDHash[:]...)
+	rawAuthData = append(rawAuthData, byte(flags))
+	rawAuthData = append(rawAuthData, 0, 0, 0, 0)
+	rawAuthData = append(rawAuthData, make([]byte, 16)...)
+	rawAuthData = binary.BigEndian.AppendUint16(rawAuthData, 4)
+	rawAuthData = append(rawAuthData, []byte("cred")...)
+	rawAuthData = append(rawAuthData, credPublicKey...)
+
+	if extensions != nil {
+		extData, err := webauthncbor.Marshal(extensions)
+		require.NoError(t, err)
+
+		rawAuthData = append(rawAuthData, extData...)
+	}
+
+	digest := sha256.Sum256(append(append([]byte{}, rawAuthData...), clientDataHash...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	att := AttestationObject{
+		RawAuthData: rawAuthData,
+		Format:      "packed",
+		AttStatement: map[string]interface{}{
+			"alg": int64(alg),
+			"sig": signature,
+		},
+	}
+
+	require.NoError(t, att.AuthData.Unmarshal(rawAuthData))
+
+	return att
+}
@@ -4,6 +4,10 @@ import (
 	"crypto/sha256"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/metadata"
 )
@@ -17,6 +21,8 @@ func Test_verifySafetyNetFormat(t *testing.T) {
 	successAttResponse := attestationTestUnpackResponse(t, safetyNetTestResponse["success"]).Response.AttestationObject
 	successClientDataHash := sha256.Sum256(attestationTestUnpackResponse(t, safetyNetTestResponse["success"]).Raw.AttestationResponse.ClientDataJSON)
 
+	useSafetyNetTestTime(t, safetyNetTestTimestamp.Add(30*time.Second))
+
 	tests := []struct {
 		name    string
 		args    args
@@ -53,6 +59,78 @@ func Test_verifySafetyNetFormat(t *testing.T) {
 	}
 }
 
+// safetyNetTestTimestamp is the timestampMs of the success SafetyNet response, when its certificate chain was valid.
+var safetyNetTestTimestamp = time.UnixMilli(1553028043529)
+
+func useSafetyNetTestTime(t *testing.T, now time.Time) {
+	original := VerificationTime
+	VerificationTime = func() time.Time {
+		return now
+	}
+
+	t.Cleanup(func() {
+		VerificationTime = original
+	})
+}
+
+func TestVerifySafetyNetFormatTimestamp(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, safetyNetTestResponse["success"])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+
+	testCases := []struct {
+		name string
+		now  time.Time
+		err  string
+	}{
+		{"ShouldAcceptWithinTolerance", safetyNetTestTimestamp.Add(SafetyNetTimestampTolerance), ""},
+		{"ShouldAcceptClockSkew", safetyNetTestTimestamp.Add(-SafetyNetTimestampTolerance), ""},
+		{"ShouldRejectStale", safetyNetTestTimestamp.Add(SafetyNetTimestampTolerance + time.Second), "SafetyNet response with timestamp more than 1m0s before current time"},
+		{"ShouldRejectPostDated", safetyNetTestTimestamp.Add(-SafetyNetTimestampTolerance - time.Second), "SafetyNet response with timestamp after current time"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useSafetyNetTestTime(t, tc.now)
+
+			attestationType, _, err := verifySafetyNetFormat(pcc.Response.AttestationObject, clientDataHash[:])
+			if tc.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, string(metadata.BasicFull), attestationType)
+
+				return
+			}
+
+			var e *Error
+
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, ErrInvalidAttestation.Type, e.Type)
+			assert.Equal(t, tc.err, e.Details)
+		})
+	}
+}
+
+func TestVerifySafetyNetFormatUntrustedRoot(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, safetyNetTestResponse["success"])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+
+	useSafetyNetTestTime(t, safetyNetTestTimestamp)
+
+	original := safetyNetRoots
+	safetyNetRoots = AppAttestRootCertificate
+
+	t.Cleanup(func() {
+		safetyNetRoots = original
+	})
+
+	_, _, err := verifySafetyNetFormat(pcc.Response.AttestationObject, clientDataHash[:])
+
+	var e *Error
+
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, ErrInvalidAttestation.Type, e.Type)
+	assert.Contains(t, e.Details, "certificate signed by unknown authority")
+}
+
 var safetyNetTestRequest = map[string]string{
 	`success`: `{
 		"publicKey": {
@@ -1,12 +1,73 @@
 package protocol
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flaviup/webauthn/metadata"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
+func TestAuthenticatorAttestationResponse_ParseErrorDetails(t *testing.T) {
+	testCases := []struct {
+		name string
+		have AuthenticatorAttestationResponse
+		err  string
+	}{
+		{
+			"ShouldReportClientDataJSONSyntaxOffset",
+			AuthenticatorAttestationResponse{
+				AuthenticatorResponse: AuthenticatorResponse{ClientDataJSON: URLEncodedBase64(`{"type":"webauthn.create",}`)},
+			},
+			"Error unmarshalling clientDataJSON at offset 27: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			"ShouldReportClientDataJSONField",
+			AuthenticatorAttestationResponse{
+				AuthenticatorResponse: AuthenticatorResponse{ClientDataJSON: URLEncodedBase64(`{"type":"webauthn.create","challenge":1}`)},
+			},
+			"Error unmarshalling clientDataJSON field 'challenge' at offset 39: json: cannot unmarshal number into Go struct field CollectedClientData.challenge of type string",
+		},
+		{
+			"ShouldReportAttestationObject",
+			AuthenticatorAttestationResponse{
+				AuthenticatorResponse: AuthenticatorResponse{ClientDataJSON: URLEncodedBase64(`{"type":"webauthn.create"}`)},
+				AttestationObject:     URLEncodedBase64{0xa1, 0x63, 'f', 'm', 't', 0x01},
+			},
+			"Error unmarshalling attestationObject: cbor: cannot unmarshal positive integer into Go struct field protocol.AttestationObject.fmt of type string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.have.Parse()
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("Parse() error = %v, want %v", err, tc.err)
+			}
+
+			if e, ok := err.(*Error); !ok || e.Type != ErrParsingData.Type {
+				t.Errorf("Parse() error type = %T, want %v", err, ErrParsingData.Type)
+			}
+		})
+	}
+}
+
 func TestAttestationVerify(t *testing.T) {
 	for i := range testAttestationOptions {
 		t.Run(fmt.Sprintf("Running test %d", i), func(t *testing.T) {
@@ -48,7 +109,7 @@ func attestationTestUnpackRequest(t *testing.T, request string) CredentialCreati
 	return options
 }
 
-func attestationTestUnpackResponse(t *testing.T, response string) (pcc ParsedCredentialCreationData) {
+func attestationTestUnpackResponse(t testing.TB, response string) (pcc ParsedCredentialCreationData) {
 	ccr := CredentialCreationResponse{}
 	if err := json.Unmarshal([]byte(response), &ccr); err != nil {
 		t.Fatal(err)
@@ -193,3 +254,467 @@ var testAttestationResponses = []string{
 		"type": "public-key"
 	}`,
 }
+
+func TestVerifyCertificateChainValidity(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	certificate := func(notBefore, notAfter time.Time) []byte {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "Test Attestation"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}
+
+		data, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		require.NoError(t, err)
+
+		return data
+	}
+
+	valid := certificate(now.Add(-time.Hour), now.Add(time.Hour))
+	expired := certificate(now.Add(-2*time.Hour), now.Add(-time.Hour))
+	notYetValid := certificate(now.Add(time.Hour), now.Add(2*time.Hour))
+
+	testCases := []struct {
+		name string
+		x5c  []interface{}
+		err  string
+	}{
+		{"ShouldPassValidChain", []interface{}{valid, valid}, ""},
+		{"ShouldPassEmptyChain", nil, ""},
+		{"ShouldFailExpiredLeaf", []interface{}{expired, valid}, "Certificate 0 in the attestation chain expired at 2023-05-31T23:00:00Z"},
+		{"ShouldFailExpiredIntermediate", []interface{}{valid, expired}, "Certificate 1 in the attestation chain expired at 2023-05-31T23:00:00Z"},
+		{"ShouldFailNotYetValid", []interface{}{notYetValid}, "Certificate 0 in the attestation chain is not valid before 2023-06-01T01:00:00Z"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyCertificateChainValidity(tc.x5c, now)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+
+			var e *Error
+
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, ErrAttestationTrust.Type, e.Type)
+		})
+	}
+}
+
+func TestAttestationVerifyExpiredCertificate(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, packedTestResponseES256["success"])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+
+	original := VerificationTime
+	VerificationTime = func() time.Time {
+		return time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Cleanup(func() {
+		VerificationTime = original
+	})
+
+	err := pcc.Response.AttestationObject.Verify("localhost", clientDataHash[:], false)
+
+	var e *Error
+
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, ErrAttestationTrust.Type, e.Type)
+	assert.Contains(t, e.Details, "in the attestation chain expired at")
+}
+
+func TestAttestationVerifyFormatError(t *testing.T) {
+	RegisterAttestationFormat("test-plain-error", func(AttestationObject, []byte) (string, []interface{}, error) {
+		return "basic", nil, fmt.Errorf("plain error")
+	})
+
+	t.Cleanup(func() {
+		delete(attestationRegistry, "test-plain-error")
+	})
+
+	att := AttestationObject{
+		Format: "test-plain-error",
+		AuthData: AuthenticatorData{
+			RPIDHash: RPIDHash("example.com"),
+			Flags:    FlagUserPresent | FlagAttestedCredentialData,
+		},
+	}
+
+	var (
+		err error
+		e   *Error
+	)
+
+	require.NotPanics(t, func() {
+		err = att.Verify("example.com", nil, false)
+	})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, ErrAttestationFormat.Type, e.Type)
+	assert.Equal(t, "plain error", e.Details)
+	assert.Equal(t, "basic", e.DevInfo)
+}
+
+func TestAttestationVerifyStringLabels(t *testing.T) {
+	var verified []byte
+
+	RegisterAttestationFormat("test-public-key", func(att AttestationObject, _ []byte) (string, []interface{}, error) {
+		verified = att.AuthData.AttData.CredentialPublicKey
+
+		_, err := webauthncose.ParsePublicKey(verified)
+
+		return string(metadata.SelfAttestation), nil, err
+	})
+
+	t.Cleanup(func() {
+		delete(attestationRegistry, "test-public-key")
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	expected := webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        key.X.FillBytes(make([]byte, 32)),
+		YCoord:        key.Y.FillBytes(make([]byte, 32)),
+	}
+
+	stringLabels, err := webauthncbor.Marshal(map[string]interface{}{
+		"kty": expected.KeyType,
+		"alg": expected.Algorithm,
+		"crv": expected.Curve,
+		"x":   expected.XCoord,
+		"y":   expected.YCoord,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		opts webauthncose.ParsePublicKeyOptions
+		err  string
+	}{
+		{"ShouldVerifyStringLabelsWhenAllowed", webauthncose.ParsePublicKeyOptions{AllowStringLabels: true}, ""},
+		{"ShouldFailStringLabelsByDefault", webauthncose.ParsePublicKeyOptions{}, "Unsupported Public Key Type"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := AttestationObject{
+				Format: "test-public-key",
+				AuthData: AuthenticatorData{
+					RPIDHash: RPIDHash("example.com"),
+					Flags:    FlagUserPresent | FlagAttestedCredentialData,
+					AttData:  AttestedCredentialData{AAGUID: make([]byte, 16), CredentialPublicKey: stringLabels},
+				},
+				PublicKeyOptions: tc.opts,
+			}
+
+			err := att.Verify("example.com", nil, false)
+
+			// The attestation object keeps the credential public key as encoded by the authenticator.
+			assert.Equal(t, stringLabels, att.AuthData.AttData.CredentialPublicKey)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			parsed, err := webauthncose.ParsePublicKey(verified)
+			require.NoError(t, err)
+			assert.Equal(t, expected, parsed)
+		})
+	}
+}
+
+func TestReverifyAttestation(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, packedTestResponseES256["success"])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+	raw := pcc.Raw.AttestationResponse.AttestationObject
+
+	store := metadata.NewStore()
+
+	attestationType, trusted, err := ReverifyAttestation(raw, clientDataHash[:], "localhost", store)
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.BasicFull), attestationType)
+	assert.False(t, trusted)
+
+	aaguid, err := uuid.FromBytes(pcc.Response.AttestationObject.AuthData.AttData.AAGUID)
+	require.NoError(t, err)
+
+	x5c := pcc.Response.AttestationObject.AttStatement["x5c"].([]interface{})
+
+	entry := metadata.MetadataBLOBPayloadEntry{
+		AaGUID: aaguid.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			AttestationTypes: []metadata.AuthenticatorAttestationType{metadata.BasicFull},
+		},
+	}
+
+	store.Add(entry)
+
+	_, trusted, err = ReverifyAttestation(raw, clientDataHash[:], "localhost", store)
+	assert.EqualError(t, err, "Error validating the attestation certificate chain against the metadata attestation root certificates: x509: certificate signed by unknown authority")
+	assert.False(t, trusted)
+
+	entry.MetadataStatement.AttestationRootCertificates = []string{base64.StdEncoding.EncodeToString(x5c[len(x5c)-1].([]byte))}
+
+	store.Add(entry)
+
+	attestationType, trusted, err = ReverifyAttestation(raw, clientDataHash[:], "localhost", store)
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.BasicFull), attestationType)
+	assert.True(t, trusted)
+
+	_, trusted, err = ReverifyAttestation(raw, make([]byte, 32), "localhost", store)
+	assert.Error(t, err)
+	assert.False(t, trusted)
+
+	_, trusted, err = ReverifyAttestation(raw, clientDataHash[:], "example.com", store)
+	assert.EqualError(t, err, "Error validating the authenticator response")
+	assert.False(t, trusted)
+
+	var att AttestationObject
+
+	require.NoError(t, webauthncbor.Unmarshal(raw, &att))
+
+	att.RawAuthData = append([]byte{}, att.RawAuthData...)
+	att.RawAuthData[32] &^= byte(FlagUserPresent)
+
+	tampered, err := webauthncbor.Marshal(att)
+	require.NoError(t, err)
+
+	_, trusted, err = ReverifyAttestation(tampered, clientDataHash[:], "localhost", store)
+	assert.EqualError(t, err, "Error validating the authenticator response")
+	assert.False(t, trusted)
+}
+
+func TestReverifyAttestationSnapshot(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, packedTestResponseES256["success"])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+	raw := pcc.Raw.AttestationResponse.AttestationObject
+
+	aaguid, err := uuid.FromBytes(pcc.Response.AttestationObject.AuthData.AttData.AAGUID)
+	require.NoError(t, err)
+
+	x5c := pcc.Response.AttestationObject.AttStatement["x5c"].([]interface{})
+
+	entry := metadata.MetadataBLOBPayloadEntry{
+		AaGUID: aaguid.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			AttestationTypes:            []metadata.AuthenticatorAttestationType{metadata.BasicFull},
+			AttestationRootCertificates: []string{base64.StdEncoding.EncodeToString(x5c[len(x5c)-1].([]byte))},
+		},
+	}
+
+	trustedSnapshot := &metadata.MetadataBLOBPayload{Number: 1, Entries: []metadata.MetadataBLOBPayloadEntry{entry}}
+
+	entry.StatusReports = []metadata.StatusReport{{Status: metadata.AttestationKeyCompromise}}
+
+	compromisedSnapshot := &metadata.MetadataBLOBPayload{Number: 2, Entries: []metadata.MetadataBLOBPayloadEntry{entry}}
+
+	attestationType, trusted, err := ReverifyAttestationSnapshot(raw, clientDataHash[:], "localhost", trustedSnapshot)
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.BasicFull), attestationType)
+	assert.True(t, trusted)
+
+	_, trusted, err = ReverifyAttestationSnapshot(raw, clientDataHash[:], "localhost", compromisedSnapshot)
+	assert.EqualError(t, err, "Authenticator with undesirable status encountered")
+	assert.False(t, trusted)
+
+	_, trusted, err = ReverifyAttestationSnapshot(raw, clientDataHash[:], "localhost", nil)
+	require.NoError(t, err)
+	assert.False(t, trusted)
+}
+
+func TestVerifyAttestation(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, packedTestResponseES256["success"])
+
+	attestationObject := pcc.Raw.AttestationResponse.AttestationObject
+	clientDataJSON := pcc.Raw.AttestationResponse.ClientDataJSON
+
+	challenge, err := base64.RawURLEncoding.DecodeString("P_JKQid1tvs4BltiZ1CsEfXl3GZ0IpmLPUQFlY-o0x9sgvCKyW5zPRJcO773ei8OwXCyF9uZN6_pyzXNOAJR7A")
+	require.NoError(t, err)
+
+	publicKey, result, err := VerifyAttestation(attestationObject, clientDataJSON, "localhost", challenge, "https://localhost:44329")
+	require.NoError(t, err)
+
+	assert.Equal(t, pcc.Response.AttestationObject.AuthData.AttData.CredentialPublicKey, publicKey)
+	assert.Equal(t, "packed", result.Format)
+	assert.Equal(t, string(metadata.BasicFull), result.AttestationType)
+	assert.Equal(t, pcc.RawID, result.AuthData.AttData.CredentialID)
+
+	testCases := []struct {
+		name      string
+		rpID      string
+		challenge []byte
+		origins   []string
+		err       string
+	}{
+		{"ShouldFailChallengeMismatch", "localhost", []byte("challenge"), []string{"https://localhost:44329"}, "Error validating challenge"},
+		{"ShouldFailOriginMismatch", "localhost", challenge, []string{"https://example.com"}, "Error validating origin"},
+		{"ShouldFailDefaultOriginMismatch", "localhost", challenge, nil, "Error validating origin"},
+		{"ShouldFailRPIDMismatch", "example.com", challenge, []string{"https://localhost:44329"}, "Error validating the authenticator response"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey, result, err := VerifyAttestation(attestationObject, clientDataJSON, tc.rpID, tc.challenge, tc.origins...)
+
+			assert.EqualError(t, err, tc.err)
+			assert.Nil(t, publicKey)
+			assert.Nil(t, result)
+		})
+	}
+}
+
+func TestAttestationStatement_Accessors(t *testing.T) {
+	statement := AttestationStatement{
+		"sig": []byte{0x01},
+		"alg": int64(-7),
+		"ver": "2.0",
+		"x5c": []interface{}{[]byte{0x02}},
+	}
+
+	testCases := []struct {
+		name    string
+		key     string
+		require func(key string) (interface{}, error)
+		get     func(key string) (interface{}, bool)
+		value   interface{}
+	}{
+		{
+			"Bytes",
+			"sig",
+			func(key string) (interface{}, error) { return statement.RequireBytes(key) },
+			func(key string) (interface{}, bool) { return statement.GetBytes(key) },
+			[]byte{0x01},
+		},
+		{
+			"Int",
+			"alg",
+			func(key string) (interface{}, error) { return statement.RequireInt(key) },
+			func(key string) (interface{}, bool) { return statement.GetInt(key) },
+			int64(-7),
+		},
+		{
+			"String",
+			"ver",
+			func(key string) (interface{}, error) { return statement.RequireString(key) },
+			func(key string) (interface{}, bool) { return statement.GetString(key) },
+			"2.0",
+		},
+		{
+			"Slice",
+			"x5c",
+			func(key string) (interface{}, error) { return statement.RequireSlice(key) },
+			func(key string) (interface{}, bool) { return statement.GetSlice(key) },
+			[]interface{}{[]byte{0x02}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, ok := tc.get(tc.key)
+			assert.True(t, ok)
+			assert.Equal(t, tc.value, value)
+
+			value, err := tc.require(tc.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.value, value)
+
+			_, ok = tc.get("absent")
+			assert.False(t, ok)
+
+			_, err = tc.require("absent")
+			assert.EqualError(t, err, "Error retrieving absent value")
+
+			var e *Error
+
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, ErrAttestationFormat.Type, e.Type)
+
+			for key := range statement {
+				if key == tc.key {
+					continue
+				}
+
+				_, ok = tc.get(key)
+				assert.False(t, ok, "wrong type %s", key)
+
+				_, err = tc.require(key)
+				assert.EqualError(t, err, fmt.Sprintf("Error retrieving %s value", key))
+			}
+		})
+	}
+}
+
+func TestCertificateTransports(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	transportsExtension := func(bits asn1.BitString) []pkix.Extension {
+		value, err := asn1.Marshal(bits)
+		require.NoError(t, err)
+
+		return []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 2, 1, 1}, Value: value}}
+	}
+
+	testCases := []struct {
+		name       string
+		extensions []pkix.Extension
+		transports []AuthenticatorTransport
+		ok         bool
+		err        string
+	}{
+		{"ShouldParseUSBAndNFC", transportsExtension(asn1.BitString{Bytes: []byte{0x30}, BitLength: 4}), []AuthenticatorTransport{USB, NFC}, true, ""},
+		{"ShouldParseBluetoothAsBLE", transportsExtension(asn1.BitString{Bytes: []byte{0xc0}, BitLength: 2}), []AuthenticatorTransport{BLE}, true, ""},
+		{"ShouldParseInternal", transportsExtension(asn1.BitString{Bytes: []byte{0x08}, BitLength: 5}), []AuthenticatorTransport{Internal}, true, ""},
+		{"ShouldParseEmpty", transportsExtension(asn1.BitString{}), []AuthenticatorTransport{}, true, ""},
+		{"ShouldReportAbsent", nil, nil, false, ""},
+		{"ShouldFailMalformed", []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 2, 1, 1}, Value: []byte{0x04, 0x01, 0x00}}}, nil, true, "Error parsing the FIDO U2F transports extension of the attestation certificate"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			template := &x509.Certificate{
+				SerialNumber:    big.NewInt(1),
+				Subject:         pkix.Name{CommonName: "Example Attestation"},
+				NotBefore:       time.Now().Add(-time.Hour),
+				NotAfter:        time.Now().Add(time.Hour),
+				ExtraExtensions: tc.extensions,
+			}
+
+			raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			require.NoError(t, err)
+
+			cert, err := x509.ParseCertificate(raw)
+			require.NoError(t, err)
+
+			transports, ok, err := CertificateTransports(cert)
+
+			assert.Equal(t, tc.ok, ok)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.transports, transports)
+		})
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"errors"
+	"encoding/binary"
 	"fmt"
+	"math"
+	"math/big"
 	"strings"
 
 	"github.com/google/go-tpm/tpm2"
@@ -28,46 +30,46 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	// Verify that attStmt is valid CBOR conforming to the syntax defined
 	// above and perform CBOR decoding on it to extract the contained fields
 
-	ver, present := att.AttStatement["ver"].(string)
-	if !present {
-		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving ver value")
+	ver, err := att.AttStatement.RequireString("ver")
+	if err != nil {
+		return "", nil, err
 	}
 
 	if ver != "2.0" {
-		return "", nil, ErrAttestationFormat.WithDetails("WebAuthn only supports TPM 2.0 currently")
+		return "", nil, ErrAttestationFormat.WithDetails("WebAuthn only supports TPM 2.0 currently").WithReason(AttestationFailureFormatUnsupported)
 	}
 
-	alg, present := att.AttStatement["alg"].(int64)
-	if !present {
-		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving alg value")
+	alg, err := att.AttStatement.RequireInt("alg")
+	if err != nil {
+		return "", nil, err
 	}
 
 	coseAlg := webauthncose.COSEAlgorithmIdentifier(alg)
 
-	x5c, x509present := att.AttStatement["x5c"].([]interface{})
-	if !x509present {
-		// Handle Basic Attestation steps for the x509 Certificate
-		return "", nil, ErrNotImplemented
+	// ECDAA statements don't contain x5c, so ecdaaKeyId is checked first.
+	if _, ecdaaKeyPresent := att.AttStatement.GetBytes("ecdaaKeyId"); ecdaaKeyPresent {
+		return "", nil, ErrECDAANotSupported
 	}
 
-	_, ecdaaKeyPresent := att.AttStatement["ecdaaKeyId"].([]byte)
-	if ecdaaKeyPresent {
+	x5c, x509present := att.AttStatement.GetSlice("x5c")
+	if !x509present {
+		// Handle Basic Attestation steps for the x509 Certificate
 		return "", nil, ErrNotImplemented
 	}
 
-	sigBytes, present := att.AttStatement["sig"].([]byte)
-	if !present {
-		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving sig value")
+	sigBytes, err := att.AttStatement.RequireBytes("sig")
+	if err != nil {
+		return "", nil, err
 	}
 
-	certInfoBytes, present := att.AttStatement["certInfo"].([]byte)
-	if !present {
-		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving certInfo value")
+	certInfoBytes, err := att.AttStatement.RequireBytes("certInfo")
+	if err != nil {
+		return "", nil, err
 	}
 
-	pubAreaBytes, present := att.AttStatement["pubArea"].([]byte)
-	if !present {
-		return "", nil, ErrAttestationFormat.WithDetails("Error retrieving pubArea value")
+	pubAreaBytes, err := att.AttStatement.RequireBytes("pubArea")
+	if err != nil {
+		return "", nil, err
 	}
 
 	// Verify that the public key specified by the parameters and unique fields of pubArea
@@ -79,34 +81,31 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 
 	key, err := webauthncose.ParsePublicKey(att.AuthData.AttData.CredentialPublicKey)
 	if err != nil {
-		return "", nil, err
+		return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing the public key: %+v", err))
 	}
 
 	switch k := key.(type) {
 	case webauthncose.EC2PublicKeyData:
-		if pubArea.ECCParameters.CurveID != k.TPMCurveID() ||
-			!bytes.Equal(pubArea.ECCParameters.Point.XRaw, k.XCoord) ||
-			!bytes.Equal(pubArea.ECCParameters.Point.YRaw, k.YCoord) {
+		if !tpmECCParametersMatch(pubArea.ECCParameters, k) {
 			return "", nil, ErrAttestationFormat.WithDetails("Mismatch between ECCParameters in pubArea and credentialPublicKey")
 		}
 	case webauthncose.RSAPublicKeyData:
-		exp := uint32(k.Exponent[0]) + uint32(k.Exponent[1])<<8 + uint32(k.Exponent[2])<<16
-		if !bytes.Equal(pubArea.RSAParameters.ModulusRaw, k.Modulus) ||
-			pubArea.RSAParameters.Exponent() != exp {
+		// The COSE exponent is a big-endian unsigned integer of any length, while the pubArea exponent of 0 represents
+		// the default exponent of 65537 which Exponent normalizes.
+		if pubArea.RSAParameters == nil ||
+			!bytes.Equal(pubArea.RSAParameters.ModulusRaw, k.Modulus) ||
+			new(big.Int).SetUint64(uint64(pubArea.RSAParameters.Exponent())).Cmp(new(big.Int).SetBytes(k.Exponent)) != 0 {
 			return "", nil, ErrAttestationFormat.WithDetails("Mismatch between RSAParameters in pubArea and credentialPublicKey")
 		}
 	default:
 		return "", nil, ErrUnsupportedKey
 	}
 
-	// Concatenate authenticatorData and clientDataHash to form attToBeSigned
-	attToBeSigned := append(att.RawAuthData, clientDataHash...)
-
 	// Validate that certInfo is valid:
 	// 1/4 Verify that magic is set to TPM_GENERATED_VALUE, handled here
 	certInfo, err := tpm2.DecodeAttestationData(certInfoBytes)
 	if err != nil {
-		return "", nil, err
+		return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Unable to decode TPMS_ATTEST in attestation statement: %+v", err))
 	}
 
 	// 2/4 Verify that type is set to TPM_ST_ATTEST_CERTIFY.
@@ -114,11 +113,15 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 		return "", nil, ErrAttestationFormat.WithDetails("Type is not set to TPM_ST_ATTEST_CERTIFY")
 	}
 
-	// 3/4 Verify that extraData is set to the hash of attToBeSigned using the hash algorithm employed in "alg".
+	// 3/4 Verify that extraData is set to the hash of attToBeSigned using the hash algorithm employed in "alg". The
+	// attToBeSigned is the concatenation of authenticatorData and clientDataHash, which are written to the hash in
+	// turn rather than concatenated into a new buffer.
 	f := webauthncose.HasherFromCOSEAlg(coseAlg)
 	h := f()
 
-	h.Write(attToBeSigned)
+	h.Write(att.RawAuthData)
+	h.Write(clientDataHash)
+
 	if !bytes.Equal(certInfo.ExtraData, h.Sum(nil)) {
 		return "", nil, ErrAttestationFormat.WithDetails("ExtraData is not set to hash of attToBeSigned")
 	}
@@ -129,7 +132,7 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	// using the procedure specified in [TPMv2-Part1] section 16.
 	matches, err := certInfo.AttestedCertifyInfo.Name.MatchesPublic(pubArea)
 	if err != nil {
-		return "", nil, err
+		return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Unable to compute TPM name of pubArea: %+v", err))
 	}
 
 	if !matches {
@@ -138,7 +141,10 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 
 	// Note that the remaining fields in the "Standard Attestation Structure"
 	// [TPMv2-Part1] section 31.2, i.e., qualifiedSigner, clockInfo and firmwareVersion
-	// are ignored. These fields MAY be used as an input to risk engines.
+	// are not verified. These fields MAY be used as an input to risk engines, for which
+	// they are returned by AttestationObject.TPMCertInfo.
+
+	attestationType := string(metadata.AttCA)
 
 	// If x5c is present, this indicates that the attestation type is not ECDAA.
 	if x509present {
@@ -158,7 +164,7 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 
 		err = aikCert.CheckSignature(x509.SignatureAlgorithm(sigAlg), certInfoBytes, sigBytes)
 		if err != nil {
-			return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err))
+			return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Signature validation error: %+v\n", err)).WithReason(AttestationFailureSignatureInvalid)
 		}
 		// Verify that aikCert meets the requirements in §8.3.1 TPM Attestation Statement Certificate Requirements
 
@@ -171,15 +177,28 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate subject must be empty")
 		}
 
+		// The extensions are located in a single pass, x509.ParseCertificate having already rejected certificates with
+		// duplicate extensions, and then verified in the order of the requirements.
+		var sanExt, ekuExt, constraintsExt *pkix.Extension
+
+		for i := range aikCert.Extensions {
+			switch ext := &aikCert.Extensions[i]; {
+			case ext.Id.Equal(oidExtensionSubjectAltName):
+				sanExt = ext
+			case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+				ekuExt = ext
+			case ext.Id.Equal(oidExtensionBasicConstraints):
+				constraintsExt = ext
+			}
+		}
+
 		// 3/6 The Subject Alternative Name extension MUST be set as defined in [TPMv2-EK-Profile] section 3.2.9{}
 		var manufacturer, model, version string
 
-		for _, ext := range aikCert.Extensions {
-			if ext.Id.Equal([]int{2, 5, 29, 17}) {
-				manufacturer, model, version, err = parseSANExtension(ext.Value)
-				if err != nil {
-					return "", nil, err
-				}
+		if sanExt != nil {
+			manufacturer, model, version, err = parseSANExtension(sanExt.Value)
+			if err != nil {
+				return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Invalid SAN data in AIK certificate: %+v", err))
 			}
 		}
 
@@ -187,32 +206,27 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 			return "", nil, ErrAttestationFormat.WithDetails("Invalid SAN data in AIK certificate")
 		}
 
-		if !isValidTPMManufacturer(manufacturer) {
+		if _, ok := metadata.TPMManufacturerByID(manufacturer); !ok {
 			return "", nil, ErrAttestationFormat.WithDetails("Invalid TPM manufacturer")
 		}
 
 		// 4/6 The Extended Key Usage extension MUST contain the "joint-iso-itu-t(2) internationalorganizations(23) 133 tcg-kp(8) tcg-kp-AIKCertificate(3)" OID.
-		var (
-			ekuValid = false
-			eku      []asn1.ObjectIdentifier
-		)
-
-		for _, ext := range aikCert.Extensions {
-			if ext.Id.Equal([]int{2, 5, 29, 37}) {
-				rest, err := asn1.Unmarshal(ext.Value, &eku)
-				if len(rest) != 0 || err != nil || !eku[0].Equal(tcgKpAIKCertificate) {
-					return "", nil, ErrAttestationFormat.WithDetails("AIK certificate EKU missing 2.23.133.8.3")
-				}
+		if ekuExt == nil {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate missing EKU")
+		}
 
-				ekuValid = true
-			}
+		var eku []asn1.ObjectIdentifier
+
+		if rest, err := asn1.Unmarshal(ekuExt.Value, &eku); len(rest) != 0 || err != nil || !eku[0].Equal(tcgKpAIKCertificate) {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate EKU missing 2.23.133.8.3")
 		}
 
-		if !ekuValid {
-			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate missing EKU")
+		// 5/6 The Basic Constraints extension MUST have the CA component set to false. The extension is required to be
+		// present, as an absent extension doesn't assert the CA component is false.
+		if constraintsExt == nil {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate missing basic constraints")
 		}
 
-		// 5/6 The Basic Constraints extension MUST have the CA component set to false.
 		type basicConstraints struct {
 			IsCA       bool `asn1:"optional"`
 			MaxPathLen int  `asn1:"optional,default:-1"`
@@ -220,25 +234,114 @@ func verifyTPMFormat(att AttestationObject, clientDataHash []byte) (string, []in
 
 		var constraints basicConstraints
 
-		for _, ext := range aikCert.Extensions {
-			if ext.Id.Equal([]int{2, 5, 29, 19}) {
-				if rest, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
-					return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints malformed")
-				} else if len(rest) != 0 {
-					return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints contains extra data")
-				}
-			}
+		if rest, err := asn1.Unmarshal(constraintsExt.Value, &constraints); err != nil {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints malformed")
+		} else if len(rest) != 0 {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints contains extra data")
+		}
+
+		if constraints.IsCA {
+			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints CA is true")
 		}
 
 		// 6/6 An Authority Information Access (AIA) extension with entry id-ad-ocsp and a CRL Distribution Point
 		// extension [RFC5280] are both OPTIONAL as the status of many attestation certificates is available
 		// through metadata services. See, for example, the FIDO Metadata Service.
-		if constraints.IsCA {
-			return "", nil, ErrAttestationFormat.WithDetails("AIK certificate basic constraints missing or CA is true")
+
+		// NON-NORMATIVE: An aikCert which certifies the credential public key means certInfo was signed by the
+		// credential private key rather than a separate attestation identity key, so the attestation type is Self and
+		// there is no trust path.
+		if isSelfSignedByCredential(aikCert, att.AuthData.AttData.CredentialPublicKey) {
+			attestationType, x5c = string(metadata.SelfAttestation), nil
 		}
 	}
 
-	return string(metadata.AttCA), x5c, err
+	return attestationType, x5c, err
+}
+
+// TPMCertInfo is the information about the TPM from the certInfo of a TPM attestation statement, which is not verified
+// by the attestation statement verification but may be used as an input to risk engines.
+//
+// Specification: TPMv2-Part2 §10.11.1 TPMS_CLOCK_INFO and §10.12.12 TPMS_ATTEST (https://trustedcomputinggroup.org/resource/tpm-library-specification/)
+type TPMCertInfo struct {
+	// Clock is the time in milliseconds during which the TPM has been powered, which is not reset by a TPM restart.
+	Clock uint64
+
+	// ResetCount is the number of TPM resets since the last TPM clear.
+	ResetCount uint32
+
+	// RestartCount is the number of TPM restarts or resumes since the last TPM reset.
+	RestartCount uint32
+
+	// Safe is true if the Clock value has not been reported to be lower than a previously reported value.
+	Safe bool
+
+	// FirmwareVersion is the vendor specific firmware version of the TPM.
+	FirmwareVersion uint64
+
+	// QualifiedSigner is the Qualified Name of the key which signed the certInfo, i.e. the nameAlg followed by the
+	// digest or the handle, without its size. It's empty if the TPM didn't report the signer.
+	QualifiedSigner []byte
+}
+
+// TPMCertInfo returns the TPMCertInfo decoded from the certInfo of the attestation statement, and false for ok if the
+// attestation statement format is not tpm.
+func (attestationObject *AttestationObject) TPMCertInfo() (info *TPMCertInfo, ok bool, err error) {
+	if attestationObject.Format != tpmAttestationKey {
+		return nil, false, nil
+	}
+
+	certInfoBytes, err := attestationObject.AttStatement.RequireBytes("certInfo")
+	if err != nil {
+		return nil, true, err
+	}
+
+	certInfo, err := tpm2.DecodeAttestationData(certInfoBytes)
+	if err != nil {
+		return nil, true, ErrAttestationFormat.WithDetails("Unable to decode TPMS_ATTEST in attestation statement").WithInfo(err.Error())
+	}
+
+	qualifiedSigner, err := certInfo.QualifiedSigner.Encode()
+	if err != nil {
+		return nil, true, ErrAttestationFormat.WithDetails("Unable to encode the qualifiedSigner in attestation statement").WithInfo(err.Error())
+	}
+
+	return &TPMCertInfo{
+		Clock:           certInfo.ClockInfo.Clock,
+		ResetCount:      certInfo.ClockInfo.ResetCount,
+		RestartCount:    certInfo.ClockInfo.RestartCount,
+		Safe:            certInfo.ClockInfo.Safe != 0,
+		FirmwareVersion: certInfo.FirmwareVersion,
+		QualifiedSigner: qualifiedSigner[2:],
+	}, true, nil
+}
+
+// VerifyTPMName returns true if the name is the Name of the TPMT_PUBLIC structure pubArea, as computed using the
+// algorithm in the nameAlg field of pubArea. The name is the nameAlg followed by the digest, i.e. the name field of the
+// TPMS_CERTIFY_INFO structure of a certInfo without its size.
+//
+// Specification: [TPMv2-Part1] section 16 (https://trustedcomputinggroup.org/wp-content/uploads/TPM-Rev-2.0-Part-1-Architecture-01.38.pdf)
+func VerifyTPMName(nameBytes, pubAreaBytes []byte) (bool, error) {
+	if len(nameBytes) > math.MaxUint16 {
+		return false, ErrAttestationFormat.WithDetails("TPM name is too long")
+	}
+
+	pubArea, err := tpm2.DecodePublic(pubAreaBytes)
+	if err != nil {
+		return false, ErrAttestationFormat.WithDetails("Unable to decode TPMT_PUBLIC")
+	}
+
+	name, err := tpm2.DecodeName(bytes.NewBuffer(append(binary.BigEndian.AppendUint16(nil, uint16(len(nameBytes))), nameBytes...)))
+	if err != nil {
+		return false, ErrAttestationFormat.WithDetails(fmt.Sprintf("Unable to decode TPM name: %+v", err))
+	}
+
+	matches, err := name.MatchesPublic(pubArea)
+	if err != nil {
+		return false, ErrAttestationFormat.WithDetails(fmt.Sprintf("Unable to compute TPM name of pubArea: %+v", err))
+	}
+
+	return matches, nil
 }
 
 func forEachSAN(extension []byte, callback func(tag int, data []byte) error) error {
@@ -262,9 +365,9 @@ func forEachSAN(extension []byte, callback func(tag int, data []byte) error) err
 
 	rest, err := asn1.Unmarshal(extension, &seq)
 	if err != nil {
-		return err
+		return fmt.Errorf("error parsing SAN extension GeneralNames at offset 0: %w", err)
 	} else if len(rest) != 0 {
-		return errors.New("x509: trailing data after X.509 extension")
+		return fmt.Errorf("x509: trailing data after X.509 extension at offset %d", len(extension)-len(rest))
 	}
 
 	if !seq.IsCompound || seq.Tag != 16 || seq.Class != 0 {
@@ -276,13 +379,15 @@ func forEachSAN(extension []byte, callback func(tag int, data []byte) error) err
 	for len(rest) > 0 {
 		var v asn1.RawValue
 
+		offset := len(seq.FullBytes) - len(rest)
+
 		rest, err = asn1.Unmarshal(rest, &v)
 		if err != nil {
-			return err
+			return fmt.Errorf("error parsing SAN extension GeneralName at offset %d: %w", offset, err)
 		}
 
 		if err := callback(v.Tag, v.Bytes); err != nil {
-			return err
+			return fmt.Errorf("error parsing SAN extension GeneralName with tag %d at offset %d: %w", v.Tag, offset, err)
 		}
 	}
 
@@ -293,6 +398,12 @@ const (
 	nameTypeDN = 4
 )
 
+var (
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
 var (
 	tcgKpAIKCertificate  = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
 	tcgAtTpmManufacturer = asn1.ObjectIdentifier{2, 23, 133, 2, 1}
@@ -300,6 +411,49 @@ var (
 	tcgAtTpmVersion      = asn1.ObjectIdentifier{2, 23, 133, 2, 3}
 )
 
+// tpmECCParametersMatch returns true if the ECCParameters of a pubArea and the credential public key are the same point
+// on the same curve, regardless of whether either of the coordinates is padded with leading zeros.
+func tpmECCParametersMatch(params *tpm2.ECCParams, key webauthncose.EC2PublicKeyData) bool {
+	if params == nil || params.CurveID != key.TPMCurveID() {
+		return false
+	}
+
+	return new(big.Int).SetBytes(params.Point.XRaw).Cmp(new(big.Int).SetBytes(key.XCoord)) == 0 &&
+		new(big.Int).SetBytes(params.Point.YRaw).Cmp(new(big.Int).SetBytes(key.YCoord)) == 0
+}
+
+// handleTPMCriticalExtensions marks the SAN extension of a TPM AIK certificate as handled. The TPM EK profile has the SAN
+// marked critical, which x509.ParseCertificate reports as unhandled as it only has directoryName entries, failing the
+// chain verification even though verifyTPMFormat parses the SAN.
+func handleTPMCriticalExtensions(cert *x509.Certificate) {
+	aik := false
+
+	for _, eku := range cert.UnknownExtKeyUsage {
+		if eku.Equal(tcgKpAIKCertificate) {
+			aik = true
+
+			break
+		}
+	}
+
+	if !aik {
+		return
+	}
+
+	unhandled := cert.UnhandledCriticalExtensions[:0]
+
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		if !oid.Equal(oidExtensionSubjectAltName) {
+			unhandled = append(unhandled, oid)
+		}
+	}
+
+	cert.UnhandledCriticalExtensions = unhandled
+}
+
+// parseSANExtension returns the TPM manufacturer, model and version attributes of the directoryName entries of the SAN
+// extension value. The attributes are accumulated across all of the directoryName entries and their RDNs, as some AIK
+// certificates split them across several entries, and an empty attribute value doesn't replace one already found.
 func parseSANExtension(value []byte) (manufacturer string, model string, version string, err error) {
 	err = forEachSAN(value, func(tag int, data []byte) error {
 		switch tag {
@@ -307,7 +461,7 @@ func parseSANExtension(value []byte) (manufacturer string, model string, version
 			tpmDeviceAttributes := pkix.RDNSequence{}
 			_, err := asn1.Unmarshal(data, &tpmDeviceAttributes)
 			if err != nil {
-				return err
+				return fmt.Errorf("error parsing directoryName: %w", err)
 			}
 			for _, rdn := range tpmDeviceAttributes {
 				if len(rdn) == 0 {
@@ -319,14 +473,19 @@ func parseSANExtension(value []byte) (manufacturer string, model string, version
 						continue
 					}
 
-					if atv.Type.Equal(tcgAtTpmManufacturer) {
-						manufacturer = strings.TrimPrefix(value, "id:")
-					}
-					if atv.Type.Equal(tcgAtTpmModel) {
-						model = value
-					}
-					if atv.Type.Equal(tcgAtTpmVersion) {
-						version = strings.TrimPrefix(value, "id:")
+					switch {
+					case atv.Type.Equal(tcgAtTpmManufacturer):
+						if value = strings.TrimPrefix(value, "id:"); value != "" {
+							manufacturer = value
+						}
+					case atv.Type.Equal(tcgAtTpmModel):
+						if value != "" {
+							model = value
+						}
+					case atv.Type.Equal(tcgAtTpmVersion):
+						if value = strings.TrimPrefix(value, "id:"); value != "" {
+							version = value
+						}
 					}
 				}
 			}
@@ -336,39 +495,3 @@ func parseSANExtension(value []byte) (manufacturer string, model string, version
 
 	return
 }
-
-var tpmManufacturers = []struct {
-	id   string
-	name string
-	code string
-}{
-	{"414D4400", "AMD", "AMD"},
-	{"41544D4C", "Atmel", "ATML"},
-	{"4252434D", "Broadcom", "BRCM"},
-	{"49424d00", "IBM", "IBM"},
-	{"49465800", "Infineon", "IFX"},
-	{"494E5443", "Intel", "INTC"},
-	{"4C454E00", "Lenovo", "LEN"},
-	{"4E534D20", "National Semiconductor", "NSM"},
-	{"4E545A00", "Nationz", "NTZ"},
-	{"4E544300", "Nuvoton Technology", "NTC"},
-	{"51434F4D", "Qualcomm", "QCOM"},
-	{"534D5343", "SMSC", "SMSC"},
-	{"53544D20", "ST Microelectronics", "STM"},
-	{"534D534E", "Samsung", "SMSN"},
-	{"534E5300", "Sinosun", "SNS"},
-	{"54584E00", "Texas Instruments", "TXN"},
-	{"57454300", "Winbond", "WEC"},
-	{"524F4343", "Fuzhouk Rockchip", "ROCC"},
-	{"FFFFF1D0", "FIDO Alliance Conformance Testing", "FIDO"},
-}
-
-func isValidTPMManufacturer(id string) bool {
-	for _, m := range tpmManufacturers {
-		if m.id == id {
-			return true
-		}
-	}
-
-	return false
-}
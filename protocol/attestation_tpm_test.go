@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
@@ -13,10 +14,14 @@ import (
 	"encoding/binary"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
 	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
@@ -36,6 +41,209 @@ func TestTPMAttestationVerificationSuccess(t *testing.T) {
 	}
 }
 
+func BenchmarkVerifyTPMFormat(b *testing.B) {
+	pcc := attestationTestUnpackResponse(b, testAttestationTPMResponses[0])
+	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := verifyTPMFormat(pcc.Response.AttestationObject, clientDataHash[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTPMAttestationVerificationOffCurveKey(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	y := key.Y.FillBytes(make([]byte, 32))
+	y[len(y)-1] ^= 0x01
+
+	credPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        key.X.FillBytes(make([]byte, 32)),
+		YCoord:        y,
+	})
+	require.NoError(t, err)
+
+	att := tpmTestAttestationObject(t, credKey, credKey)
+	att.AuthData.RPIDHash = RPIDHash("example.com")
+	att.AuthData.Flags = FlagUserPresent | FlagAttestedCredentialData
+	att.AuthData.AttData.CredentialPublicKey = credPublicKey
+
+	var e *Error
+
+	require.NotPanics(t, func() {
+		err = att.Verify("example.com", nil, false)
+	})
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, ErrAttestationFormat.Type, e.Type)
+	assert.Contains(t, e.Details, "Error parsing the public key")
+	assert.Contains(t, e.Details, "EC2 public key point is not on the curve")
+}
+
+func TestTPMAttestationVerificationMalformedData(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	defaultOptions := tpmTestAttestationOptions{
+		manufacturer:     "FFFFF1D0",
+		exponentRaw:      uint32(credKey.E),
+		exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+		basicConstraints: true,
+	}
+
+	malformedSAN := defaultOptions
+	malformedSAN.san = []byte{0x30, 0x07, 0x82, 0x01, 'a', 0xa4, 0x02, 0x04, 0x00}
+
+	testCases := []struct {
+		name   string
+		att    AttestationObject
+		modify func(att *AttestationObject)
+		err    string
+	}{
+		{
+			"ShouldWrapMalformedSAN",
+			tpmTestAttestationObjectWith(t, credKey, credKey, malformedSAN),
+			func(att *AttestationObject) {},
+			"Invalid SAN data in AIK certificate: error parsing SAN extension GeneralName with tag 4 at offset 5: error parsing directoryName",
+		},
+		{
+			"ShouldWrapMalformedCertInfo",
+			tpmTestAttestationObjectWith(t, credKey, credKey, defaultOptions),
+			func(att *AttestationObject) {
+				att.AttStatement["certInfo"] = []byte{0xff, 0x54}
+			},
+			"Unable to decode TPMS_ATTEST in attestation statement: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := tc.att
+			att.AuthData.RPIDHash = RPIDHash("example.com")
+			att.AuthData.Flags = FlagUserPresent | FlagAttestedCredentialData
+
+			tc.modify(&att)
+
+			var e *Error
+
+			require.NotPanics(t, func() {
+				err = att.Verify("example.com", nil, false)
+			})
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, ErrAttestationFormat.Type, e.Type)
+			assert.Contains(t, e.Details, tc.err)
+		})
+	}
+}
+
+func TestVerifyTPMName(t *testing.T) {
+	for i := range testAttestationTPMResponses {
+		pcc := attestationTestUnpackResponse(t, testAttestationTPMResponses[i])
+
+		pubAreaBytes, err := pcc.Response.AttestationObject.AttStatement.RequireBytes("pubArea")
+		require.NoError(t, err)
+
+		certInfoBytes, err := pcc.Response.AttestationObject.AttStatement.RequireBytes("certInfo")
+		require.NoError(t, err)
+
+		certInfo, err := tpm2.DecodeAttestationData(certInfoBytes)
+		require.NoError(t, err)
+
+		encoded, err := certInfo.AttestedCertifyInfo.Name.Encode()
+		require.NoError(t, err)
+
+		// Strip the size of the TPM2B_NAME.
+		name := encoded[2:]
+
+		matches, err := VerifyTPMName(name, pubAreaBytes)
+		require.NoError(t, err)
+		assert.True(t, matches)
+
+		mismatched := append([]byte{}, name...)
+		mismatched[len(mismatched)-1] ^= 0xFF
+
+		matches, err = VerifyTPMName(mismatched, pubAreaBytes)
+		require.NoError(t, err)
+		assert.False(t, matches)
+	}
+
+	_, err := VerifyTPMName([]byte{0x00, 0x0B}, []byte{0x00})
+	assert.EqualError(t, err, "Unable to decode TPMT_PUBLIC")
+}
+
+func TestAttestationObject_TPMCertInfo(t *testing.T) {
+	pcc := attestationTestUnpackResponse(t, testAttestationTPMResponses[0])
+
+	info, ok, err := pcc.Response.AttestationObject.TPMCertInfo()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, &TPMCertInfo{
+		Clock:           5349858970,
+		ResetCount:      3453143819,
+		RestartCount:    3093891846,
+		Safe:            true,
+		FirmwareVersion: 17237959588088567240,
+		QualifiedSigner: []byte{
+			0x00, 0x0b, 0xd0, 0x34, 0x64, 0xcb, 0x6b, 0x6c, 0x13, 0xea, 0xef, 0x12, 0x28, 0x30, 0xdd, 0xc2, 0x48, 0x1a,
+			0xab, 0x90, 0xa6, 0x87, 0xa8, 0xdc, 0x0f, 0xfe, 0x94, 0x2e, 0xf3, 0x3d, 0x66, 0x6b, 0xdd, 0x6f,
+		},
+	}, info)
+
+	handle := tpmutil.Handle(0x81000001)
+
+	certInfo, err := tpm2.AttestationData{
+		Magic:               0xff544347,
+		Type:                tpm2.TagAttestCertify,
+		QualifiedSigner:     tpm2.Name{Handle: &handle},
+		AttestedCertifyInfo: &tpm2.CertifyInfo{},
+	}.Encode()
+	require.NoError(t, err)
+
+	att := pcc.Response.AttestationObject
+	att.AttStatement = map[string]interface{}{"certInfo": certInfo}
+
+	info, ok, err = att.TPMCertInfo()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x81, 0x00, 0x00, 0x01}, info.QualifiedSigner)
+
+	certInfo, err = tpm2.AttestationData{
+		Magic:               0xff544347,
+		Type:                tpm2.TagAttestCertify,
+		AttestedCertifyInfo: &tpm2.CertifyInfo{},
+	}.Encode()
+	require.NoError(t, err)
+
+	att.AttStatement = map[string]interface{}{"certInfo": certInfo}
+
+	info, ok, err = att.TPMCertInfo()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, info.QualifiedSigner)
+
+	att.AttStatement = map[string]interface{}{"certInfo": []byte{0xff, 0x54}}
+
+	_, ok, err = att.TPMCertInfo()
+	assert.True(t, ok)
+	assert.EqualError(t, err, "Unable to decode TPMS_ATTEST in attestation statement")
+
+	att.Format = "packed"
+
+	info, ok, err = att.TPMCertInfo()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, info)
+}
+
 var testAttestationTPMResponses = []string{
 	// TPM attestation with ECC P256.
 	`{
@@ -98,7 +306,12 @@ func TestTPMAttestationVerificationFailAttStatement(t *testing.T) {
 		{
 			"TPM Negative Test AttStatement ecdaaKeyId present",
 			AttestationObject{AttStatement: map[string]interface{}{"ver": "2.0", "alg": int64(0), "x5c": []interface{}{}, "ecdaaKeyId": []byte{}}},
-			ErrNotImplemented.Details,
+			ErrECDAANotSupported.Details,
+		},
+		{
+			"TPM Negative Test AttStatement ecdaaKeyId present without x5c",
+			AttestationObject{AttStatement: map[string]interface{}{"ver": "2.0", "alg": int64(0), "ecdaaKeyId": []byte{}}},
+			ErrECDAANotSupported.Details,
 		},
 		{
 			"TPM Negative Test AttStatement sig not present",
@@ -578,3 +791,581 @@ func TestTPMAttestationVerificationFailX5c(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSANExtensionErrorDetails(t *testing.T) {
+	testCases := []struct {
+		name string
+		have []byte
+		err  string
+	}{
+		{
+			"ShouldReportGeneralNames",
+			[]byte{0x30, 0x05, 0xa4},
+			"error parsing SAN extension GeneralNames at offset 0: asn1: syntax error: data truncated",
+		},
+		{
+			"ShouldReportGeneralNameOffset",
+			[]byte{0x30, 0x05, 0x82, 0x01, 'a', 0xa4, 0x05},
+			"error parsing SAN extension GeneralName at offset 5: asn1: syntax error: data truncated",
+		},
+		{
+			"ShouldReportDirectoryName",
+			[]byte{0x30, 0x07, 0x82, 0x01, 'a', 0xa4, 0x02, 0x04, 0x00},
+			"error parsing SAN extension GeneralName with tag 4 at offset 5: error parsing directoryName: asn1: structure error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := parseSANExtension(tc.have)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestParseSANExtensionMultipleDirectoryNames(t *testing.T) {
+	directoryName := func(rdns pkix.RDNSequence) asn1.RawValue {
+		data, err := asn1.Marshal(rdns)
+		require.NoError(t, err)
+
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeDN, IsCompound: true, Bytes: data}
+	}
+
+	testCases := []struct {
+		name         string
+		have         []asn1.RawValue
+		manufacturer string
+		model        string
+		version      string
+	}{
+		{
+			"ShouldParseSingleDirectoryName",
+			[]asn1.RawValue{
+				directoryName(pkix.RDNSequence{
+					{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}},
+					{{Type: tcgAtTpmModel, Value: "NPCT6xx"}},
+					{{Type: tcgAtTpmVersion, Value: "id:13"}},
+				}),
+			},
+			"FFFFF1D0", "NPCT6xx", "13",
+		},
+		{
+			"ShouldAccumulateSeparateDirectoryNames",
+			[]asn1.RawValue{
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}}}),
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmModel, Value: "NPCT6xx"}}}),
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmVersion, Value: "id:13"}}}),
+			},
+			"FFFFF1D0", "NPCT6xx", "13",
+		},
+		{
+			"ShouldAccumulateAroundOtherGeneralNames",
+			[]asn1.RawValue{
+				{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("example.com")},
+				directoryName(pkix.RDNSequence{
+					{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}, {Type: tcgAtTpmModel, Value: "NPCT6xx"}},
+				}),
+				{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("example.org")},
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmVersion, Value: "id:13"}}}),
+			},
+			"FFFFF1D0", "NPCT6xx", "13",
+		},
+		{
+			"ShouldNotReplaceWithEmptyValues",
+			[]asn1.RawValue{
+				directoryName(pkix.RDNSequence{
+					{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}},
+					{{Type: tcgAtTpmModel, Value: "NPCT6xx"}},
+					{{Type: tcgAtTpmVersion, Value: "id:13"}},
+				}),
+				directoryName(pkix.RDNSequence{
+					{{Type: tcgAtTpmManufacturer, Value: "id:"}},
+					{{Type: tcgAtTpmModel, Value: ""}},
+					{{Type: tcgAtTpmVersion, Value: "id:"}},
+				}),
+			},
+			"FFFFF1D0", "NPCT6xx", "13",
+		},
+		{
+			"ShouldLeaveMissingAttributesEmpty",
+			[]asn1.RawValue{
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}}}),
+				directoryName(pkix.RDNSequence{{{Type: tcgAtTpmVersion, Value: "id:13"}}}),
+			},
+			"FFFFF1D0", "", "13",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			san, err := asn1.Marshal(tc.have)
+			require.NoError(t, err)
+
+			manufacturer, model, version, err := parseSANExtension(san)
+			require.NoError(t, err)
+			assert.Equal(t, tc.manufacturer, manufacturer)
+			assert.Equal(t, tc.model, model)
+			assert.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func TestTPMAttestationVerificationSelfSignedAIK(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		aikKey          *rsa.PrivateKey
+		attestationType string
+		x5c             int
+	}{
+		{"ShouldClassifySeparateAIKAsAttCA", aikKey, string(metadata.AttCA), 1},
+		{"ShouldClassifyCredentialKeyAsSelf", credKey, string(metadata.SelfAttestation), 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := tpmTestAttestationObject(t, credKey, tc.aikKey)
+
+			attestationType, x5c, err := verifyTPMFormat(att, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.attestationType, attestationType)
+			assert.Len(t, x5c, tc.x5c)
+		})
+	}
+}
+
+func TestTPMAttestationVerificationManufacturerCase(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		manufacturer string
+		err          string
+	}{
+		{"ShouldAcceptUppercaseIBM", "49424D00", ""},
+		{"ShouldAcceptLowercaseIBM", "49424d00", ""},
+		{"ShouldAcceptUppercaseInfineon", "49465800", ""},
+		{"ShouldAcceptLowercaseAMD", "414d4400", ""},
+		{"ShouldAcceptMixedCaseIntel", "494e5443", ""},
+		{"ShouldAcceptMixedCaseFIDO", "FffFf1d0", ""},
+		{"ShouldRejectUnknown", "00000000", "Invalid TPM manufacturer"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+				manufacturer:     tc.manufacturer,
+				exponentRaw:      uint32(credKey.E),
+				exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+				basicConstraints: true,
+			})
+
+			_, _, err := verifyTPMFormat(att, nil)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTPMAttestationVerificationRegisteredManufacturer(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// The vendor ID "PRTO" is not assigned by the TCG, so registering it doesn't affect other tests.
+	att := tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+		manufacturer:     "5052544F",
+		exponentRaw:      uint32(credKey.E),
+		exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+		basicConstraints: true,
+	})
+
+	_, _, err = verifyTPMFormat(att, nil)
+	assert.EqualError(t, err, "Invalid TPM manufacturer")
+
+	metadata.RegisterTPMManufacturer("5052544F", "Protocol Test", "PRTO")
+
+	attestationType, _, err := verifyTPMFormat(att, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, string(metadata.AttCA), attestationType)
+}
+
+func TestTPMAttestationVerificationRSAExponent(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		exponentRaw uint32
+		exponent    []byte
+		err         string
+	}{
+		{"ShouldAcceptDefaultExponent", 0, []byte{0x01, 0x00, 0x01}, ""},
+		{"ShouldAcceptExplicitDefaultExponent", 65537, []byte{0x01, 0x00, 0x01}, ""},
+		{"ShouldAcceptSingleByteExponent", 3, []byte{0x03}, ""},
+		{"ShouldAcceptFourByteExponent", 0x01000001, []byte{0x01, 0x00, 0x00, 0x01}, ""},
+		{"ShouldAcceptLeadingZeroExponent", 65537, []byte{0x00, 0x00, 0x01, 0x00, 0x01}, ""},
+		{"ShouldRejectDefaultExponentMismatch", 0, []byte{0x03}, "Mismatch between RSAParameters in pubArea and credentialPublicKey"},
+		{"ShouldRejectExplicitExponentMismatch", 3, []byte{0x01, 0x00, 0x01}, "Mismatch between RSAParameters in pubArea and credentialPublicKey"},
+		{"ShouldRejectLongExponentMismatch", 65537, []byte{0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01}, "Mismatch between RSAParameters in pubArea and credentialPublicKey"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+				manufacturer:     "FFFFF1D0",
+				exponentRaw:      tc.exponentRaw,
+				exponent:         tc.exponent,
+				basicConstraints: true,
+			})
+
+			_, _, err := verifyTPMFormat(att, nil)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTPMAttestationVerificationBasicConstraints(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		basicConstraints bool
+		isCA             bool
+		err              string
+	}{
+		{"ShouldAcceptPresentWithCAFalse", true, false, ""},
+		{"ShouldRejectPresentWithCATrue", true, true, "AIK certificate basic constraints CA is true"},
+		{"ShouldRejectAbsent", false, false, "AIK certificate missing basic constraints"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			att := tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+				manufacturer:     "FFFFF1D0",
+				exponentRaw:      uint32(credKey.E),
+				exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+				basicConstraints: tc.basicConstraints,
+				isCA:             tc.isCA,
+			})
+
+			_, _, err := verifyTPMFormat(att, nil)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTPMAttestationVerificationCriticalSAN(t *testing.T) {
+	credKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	aikKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "TPM Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	rootBytes, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	root, err := x509.ParseCertificate(rootBytes)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	att := tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+		manufacturer:     "FFFFF1D0",
+		exponentRaw:      uint32(credKey.E),
+		exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+		basicConstraints: true,
+		issuer:           root,
+		issuerKey:        rootKey,
+	})
+
+	aikCert, err := x509.ParseCertificate(att.AttStatement["x5c"].([]interface{})[0].([]byte))
+	require.NoError(t, err)
+	require.Len(t, aikCert.UnhandledCriticalExtensions, 1)
+	assert.True(t, aikCert.UnhandledCriticalExtensions[0].Equal(oidExtensionSubjectAltName))
+
+	attestationType, x5c, err := verifyTPMFormat(att, nil)
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.AttCA), attestationType)
+
+	assert.NoError(t, verifyAttestationChain(roots, x5c))
+
+	// Certificates other than AIK certificates still fail with a critical SAN which isn't handled.
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	for _, ext := range aikCert.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			leafTemplate.ExtraExtensions = append(leafTemplate.ExtraExtensions, ext)
+		}
+	}
+
+	leaf, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &leafKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	var unhandled x509.UnhandledCriticalExtension
+
+	assert.ErrorAs(t, verifyAttestationChain(roots, []interface{}{leaf}), &unhandled)
+}
+
+func TestTPMAttestationVerificationECCPoint(t *testing.T) {
+	// A key which x coordinate has a leading zero byte, which is stripped by big.Int.Bytes.
+	var key *ecdsa.PrivateKey
+
+	for key == nil || len(key.X.Bytes()) == 32 {
+		var err error
+
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	x, y := key.X.FillBytes(make([]byte, 32)), key.Y.FillBytes(make([]byte, 32))
+
+	cpk, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        x,
+		YCoord:        y,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		curveID tpm2.EllipticCurve
+		x, y    []byte
+		match   bool
+	}{
+		{"ShouldMatchPoint", tpm2.CurveNISTP256, x, y, true},
+		{"ShouldMatchUnpaddedCoordinates", tpm2.CurveNISTP256, key.X.Bytes(), key.Y.Bytes(), true},
+		{"ShouldMatchPaddedCoordinates", tpm2.CurveNISTP256, append([]byte{0}, x...), append([]byte{0}, y...), true},
+		{"ShouldNotMatchOtherPoint", tpm2.CurveNISTP256, other.X.FillBytes(make([]byte, 32)), other.Y.FillBytes(make([]byte, 32)), false},
+		{"ShouldNotMatchOtherCurve", tpm2.CurveNISTP384, x, y, false},
+		{"ShouldNotMatchCompressedPoint", tpm2.CurveNISTP256, elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y), nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attStmt := make(map[string]interface{}, len(defaultAttStatement))
+			for id, v := range defaultAttStatement {
+				attStmt[id] = v
+			}
+
+			public := defaultECCPublic
+			public.ECCParameters = &tpm2.ECCParams{
+				Sign:    defaultECCPublic.ECCParameters.Sign,
+				CurveID: tc.curveID,
+				Point:   tpm2.ECPoint{XRaw: tc.x, YRaw: tc.y},
+			}
+
+			pubArea, err := public.Encode()
+			require.NoError(t, err)
+
+			attStmt["pubArea"] = pubArea
+
+			att := AttestationObject{
+				AttStatement: attStmt,
+				AuthData: AuthenticatorData{
+					AttData: AttestedCredentialData{
+						CredentialPublicKey: cpk,
+					},
+				},
+			}
+
+			// The empty certInfo of the default attestation statement fails the verification after the comparison.
+			_, _, err = verifyTPMFormat(att, nil)
+			require.Error(t, err)
+
+			if tc.match {
+				assert.Contains(t, err.Error(), "Unable to decode TPMS_ATTEST in attestation statement")
+			} else {
+				assert.EqualError(t, err, "Mismatch between ECCParameters in pubArea and credentialPublicKey")
+			}
+		})
+	}
+}
+
+// tpmTestAttestationObject returns a tpm attestation object for an RS256 credential with an empty authenticator data
+// and client data hash, which certInfo is signed by an aikCert for the aikKey.
+func tpmTestAttestationObject(t *testing.T, credKey, aikKey *rsa.PrivateKey) AttestationObject {
+	return tpmTestAttestationObjectWith(t, credKey, aikKey, tpmTestAttestationOptions{
+		manufacturer:     "FFFFF1D0",
+		exponentRaw:      uint32(credKey.E),
+		exponent:         big.NewInt(int64(credKey.E)).Bytes(),
+		basicConstraints: true,
+	})
+}
+
+// tpmTestAttestationOptions customizes the attestation object returned by tpmTestAttestationObjectWith.
+type tpmTestAttestationOptions struct {
+	// manufacturer is the TPM manufacturer in the aikCert SAN.
+	manufacturer string
+
+	// exponentRaw is the RSA exponent in the pubArea, where 0 is the TPM default exponent.
+	exponentRaw uint32
+
+	// exponent is the RSA exponent in the credential public key.
+	exponent []byte
+
+	// basicConstraints is the presence of the aikCert basic constraints extension.
+	basicConstraints bool
+
+	// isCA is the CA component of the aikCert basic constraints extension.
+	isCA bool
+
+	// issuer and issuerKey sign the aikCert, which is self-signed by the aikKey if they're nil.
+	issuer    *x509.Certificate
+	issuerKey *rsa.PrivateKey
+
+	// san replaces the aikCert SAN extension value if it's not nil.
+	san []byte
+}
+
+// tpmTestAttestationObjectWith is like tpmTestAttestationObject customized by the opts.
+func tpmTestAttestationObjectWith(t *testing.T, credKey, aikKey *rsa.PrivateKey, opts tpmTestAttestationOptions) AttestationObject {
+	credPublicKey, err := webauthncbor.Marshal(webauthncose.RSAPublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.RSAKey),
+			Algorithm: int64(webauthncose.AlgRS256),
+		},
+		Modulus:  credKey.N.Bytes(),
+		Exponent: opts.exponent,
+	})
+	assert.NoError(t, err)
+
+	public := defaultRSAPublic
+	public.RSAParameters = &tpm2.RSAParams{
+		Sign:        defaultRSAPublic.RSAParameters.Sign,
+		KeyBits:     2048,
+		ExponentRaw: opts.exponentRaw,
+		ModulusRaw:  credKey.N.Bytes(),
+	}
+
+	pubArea, err := public.Encode()
+	assert.NoError(t, err)
+
+	extraData := sha256.Sum256(nil)
+	pubName := sha256.Sum256(pubArea)
+
+	certInfo, err := tpm2.AttestationData{
+		Magic: 0xff544347,
+		Type:  tpm2.TagAttestCertify,
+		AttestedCertifyInfo: &tpm2.CertifyInfo{
+			Name: tpm2.Name{
+				Digest: &tpm2.HashValue{
+					Alg:   tpm2.AlgSHA256,
+					Value: pubName[:],
+				},
+			},
+		},
+		ExtraData: extraData[:],
+	}.Encode()
+	assert.NoError(t, err)
+
+	digest := sha256.Sum256(certInfo)
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, aikKey, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+
+	directoryName, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: tcgAtTpmManufacturer, Value: "id:" + opts.manufacturer}},
+		{{Type: tcgAtTpmModel, Value: "NPCT6xx"}},
+		{{Type: tcgAtTpmVersion, Value: "id:13"}},
+	})
+	assert.NoError(t, err)
+
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: nameTypeDN, IsCompound: true, Bytes: directoryName}})
+	assert.NoError(t, err)
+
+	if opts.san != nil {
+		san = opts.san
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{tcgKpAIKCertificate},
+		BasicConstraintsValid: opts.basicConstraints,
+		IsCA:                  opts.isCA,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Critical: true, Value: san},
+		},
+	}
+
+	issuer, issuerKey := template, aikKey
+	if opts.issuer != nil {
+		issuer, issuerKey = opts.issuer, opts.issuerKey
+	}
+
+	aikCert, err := x509.CreateCertificate(rand.Reader, template, issuer, &aikKey.PublicKey, issuerKey)
+	assert.NoError(t, err)
+
+	return AttestationObject{
+		Format: tpmAttestationKey,
+		AttStatement: map[string]interface{}{
+			"ver":      "2.0",
+			"alg":      int64(webauthncose.AlgRS256),
+			"x5c":      []interface{}{aikCert},
+			"sig":      sig,
+			"certInfo": certInfo,
+			"pubArea":  pubArea,
+		},
+		AuthData: AuthenticatorData{
+			AttData: AttestedCredentialData{
+				CredentialPublicKey: credPublicKey,
+			},
+		},
+	}
+}
@@ -2,9 +2,11 @@ package protocol
 
 import (
 	"bytes"
+	"crypto/ecdh"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/x509"
+	"fmt"
 
 	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
@@ -26,12 +28,19 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	// Signing procedure step - If the credential public key of the given credential is not of
 	// algorithm -7 ("ES256"), stop and return an error.
 	key := webauthncose.EC2PublicKeyData{}
-	webauthncbor.Unmarshal(att.AuthData.AttData.CredentialPublicKey, &key)
+	if err := webauthncbor.Unmarshal(att.AuthData.AttData.CredentialPublicKey, &key); err != nil {
+		return "", nil, ErrAttestationFormat.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+	}
 
 	if webauthncose.COSEAlgorithmIdentifier(key.PublicKeyData.Algorithm) != webauthncose.AlgES256 {
 		return "", nil, ErrUnsupportedAlgorithm.WithDetails("Non-ES256 Public Key algorithm used")
 	}
 
+	// U2F only supports ES256 which requires the credential public key to be an EC2 key on the P-256 curve.
+	if webauthncose.COSEKeyType(key.KeyType) != webauthncose.EllipticKey || webauthncose.COSEEllipticCurve(key.Curve) != webauthncose.P256 {
+		return "", nil, ErrUnsupportedKey.WithDetails("U2F credential public key is not a P-256 key")
+	}
+
 	// U2F Step 1. Verify that attStmt is valid CBOR conforming to the syntax defined above
 	// and perform CBOR decoding on it to extract the contained fields.
 
@@ -64,6 +73,10 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 		return "", nil, ErrAttestationFormat.WithDetails("Received more than one element in x5c values")
 	}
 
+	if len(x5c) == 0 {
+		return "", nil, ErrAttestationFormat.WithDetails("Missing properly formatted x5c data")
+	}
+
 	// Note: Packed Attestation, FIDO U2F Attestation, and Assertion Signatures support ASN.1,but it is recommended
 	// that any new attestation formats defined not use ASN.1 encodings, but instead represent signatures as equivalent
 	// fixed-length byte arrays without internal structure, using the same representations as used by COSE signatures
@@ -82,7 +95,7 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	}
 
 	// Step 2.3
-	if attCert.PublicKeyAlgorithm != x509.ECDSA && attCert.PublicKey.(*ecdsa.PublicKey).Curve != elliptic.P256() {
+	if certPublicKey, ok := attCert.PublicKey.(*ecdsa.PublicKey); !ok || certPublicKey.Curve != elliptic.P256() {
 		return "", nil, ErrAttestationFormat.WithDetails("Attestation certificate is in invalid format")
 	}
 
@@ -107,7 +120,7 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	// its size to be of 32 bytes. If size differs or "-3" key is not found, terminate this algorithm and
 	// return an appropriate error.
 
-	if len(key.XCoord) > 32 || len(key.YCoord) > 32 {
+	if len(key.XCoord) != 32 || len(key.YCoord) != 32 {
 		return "", nil, ErrAttestation.WithDetails("X or Y Coordinate for key is invalid length")
 	}
 
@@ -116,6 +129,11 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	publicKeyU2F.Write(key.XCoord)
 	publicKeyU2F.Write(key.YCoord)
 
+	// NON-NORMATIVE: Verify that publicKeyU2F is an uncompressed point on the P-256 curve.
+	if _, err = ecdh.P256().NewPublicKey(publicKeyU2F.Bytes()); err != nil {
+		return "", nil, ErrUnsupportedKey.WithDetails("U2F credential public key is not a valid P-256 point")
+	}
+
 	// Step 5. Let verificationData be the concatenation of (0x00 || rpIdHash || clientDataHash || credentialId || publicKeyU2F)
 	// (see §4.3 of FIDO-U2F-Message-Formats [https://www.w3.org/TR/webauthn/#biblio-fido-u2f-message-formats]).
 
@@ -126,11 +144,10 @@ func verifyU2FFormat(att AttestationObject, clientDataHash []byte) (string, []in
 	verificationData.Write(publicKeyU2F.Bytes())
 
 	// Step 6. Verify the sig using verificationData and certificate public key per SEC1[https://www.w3.org/TR/webauthn/#biblio-sec1].
-	sigErr := attCert.CheckSignature(x509.ECDSAWithSHA256, verificationData.Bytes(), signature)
-	if sigErr != nil {
-		return "", nil, sigErr
+	if err = attCert.CheckSignature(x509.ECDSAWithSHA256, verificationData.Bytes(), signature); err != nil {
+		return "", nil, ErrInvalidAttestation.WithDetails(fmt.Sprintf("Signature validation error: %+v", err)).WithReason(AttestationFailureSignatureInvalid)
 	}
 
 	// Step 7. If successful, return attestation type Basic with the attestation trust path set to x5c.
-	return string(metadata.BasicFull), x5c, sigErr
+	return string(metadata.BasicFull), x5c, nil
 }
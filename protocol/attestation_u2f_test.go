@@ -1,10 +1,24 @@
 package protocol
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/metadata"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 func TestVerifyU2FFormat(t *testing.T) {
@@ -52,6 +66,147 @@ func TestVerifyU2FFormat(t *testing.T) {
 	}
 }
 
+func TestVerifyU2FFormatCredentialPublicKey(t *testing.T) {
+	clientDataHash := sha256.Sum256([]byte("u2f challenge"))
+
+	testCases := []struct {
+		name  string
+		curve elliptic.Curve
+		crv   webauthncose.COSEEllipticCurve
+		err   string
+	}{
+		{"ShouldVerifyP256", elliptic.P256(), webauthncose.P256, ""},
+		{"ShouldFailP384", elliptic.P384(), webauthncose.P384, "U2F credential public key is not a P-256 key"},
+		{"ShouldFailP384LabeledP256", elliptic.P384(), webauthncose.P256, "X or Y Coordinate for key is invalid length"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credKey, err := ecdsa.GenerateKey(tc.curve, rand.Reader)
+			require.NoError(t, err)
+
+			att := u2fTestAttestationObject(t, credKey, tc.crv, clientDataHash[:])
+
+			attestationType, x5c, err := verifyU2FFormat(att, clientDataHash[:])
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, string(metadata.BasicFull), attestationType)
+			assert.Len(t, x5c, 1)
+		})
+	}
+
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	att := u2fTestAttestationObject(t, credKey, webauthncose.P256, clientDataHash[:])
+
+	tampered := sha256.Sum256([]byte("another challenge"))
+
+	_, _, err = verifyU2FFormat(att, tampered[:])
+	assert.EqualError(t, err, "Signature validation error: x509: ECDSA verification failure")
+}
+
+// u2fTestAttestationObject generates a fido-u2f attestation object for the credential key labeled with the provided
+// curve, signed by a generated P-256 attestation certificate.
+func u2fTestAttestationObject(t *testing.T, credKey *ecdsa.PrivateKey, crv webauthncose.COSEEllipticCurve, clientDataHash []byte) AttestationObject {
+	attKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test U2F Attestation"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &attKey.PublicKey, attKey)
+	require.NoError(t, err)
+
+	size := (credKey.Curve.Params().BitSize + 7) / 8
+	x, y := credKey.X.FillBytes(make([]byte, size)), credKey.Y.FillBytes(make([]byte, size))
+
+	credPublicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(crv),
+		XCoord: x,
+		YCoord: y,
+	})
+	require.NoError(t, err)
+
+	credentialID := []byte("u2f key handle")
+	rpIDHash := RPIDHash("example.com")
+
+	rawAuthData := append([]byte{}, rpIDHash...)
+	rawAuthData = append(rawAuthData, byte(FlagUserPresent|FlagAttestedCredentialData))
+	rawAuthData = append(rawAuthData, 0, 0, 0, 0)
+	rawAuthData = append(rawAuthData, make([]byte, 16)...)
+	rawAuthData = binary.BigEndian.AppendUint16(rawAuthData, uint16(len(credentialID)))
+	rawAuthData = append(rawAuthData, credentialID...)
+	rawAuthData = append(rawAuthData, credPublicKey...)
+
+	verificationData := append([]byte{0x00}, rpIDHash...)
+	verificationData = append(verificationData, clientDataHash...)
+	verificationData = append(verificationData, credentialID...)
+	verificationData = append(append(append(verificationData, 0x04), x...), y...)
+
+	digest := sha256.Sum256(verificationData)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, attKey, digest[:])
+	require.NoError(t, err)
+
+	att := AttestationObject{
+		RawAuthData: rawAuthData,
+		Format:      u2fAttestationKey,
+		AttStatement: map[string]interface{}{
+			"x5c": []interface{}{certBytes},
+			"sig": sig,
+		},
+	}
+
+	require.NoError(t, att.AuthData.Unmarshal(rawAuthData))
+
+	return att
+}
+
+func TestAttestationVerifyU2FMetadataByCertKeyID(t *testing.T) {
+	response := attestationTestUnpackResponse(t, u2fTestResponse["success"])
+	clientDataHash := sha256.Sum256(response.Raw.AttestationResponse.ClientDataJSON)
+
+	att := response.Response.AttestationObject
+
+	leaf, err := x509.ParseCertificate(att.AttStatement["x5c"].([]interface{})[0].([]byte))
+	require.NoError(t, err)
+
+	id, err := metadata.CertificateKeyIdentifier(leaf)
+	require.NoError(t, err)
+
+	key := hex.EncodeToString(id)
+
+	require.NoError(t, att.Verify("localhost", clientDataHash[:], false))
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+		AttestationCertificateKeyIdentifiers: []string{key},
+		StatusReports: []metadata.StatusReport{
+			{Status: metadata.Revoked},
+		},
+	})
+
+	t.Cleanup(func() {
+		delete(metadata.DefaultStore.CertKeyIDs, key)
+	})
+
+	assert.EqualError(t, att.Verify("localhost", clientDataHash[:], false), "Authenticator with undesirable status encountered")
+}
+
 var u2fTestResponse = map[string]string{
 	`success`: `{
 		"rawId": "7nJsttr4dLSsmrWnaHB3espJ0ua9rsJ2ws-93BFcNOP64g_s_4wLFDvklrNYcg0BCN6ddUjJLxDfDSBreKQLAw",
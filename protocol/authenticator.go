@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 
@@ -12,6 +13,10 @@ const (
 	minAuthDataLength     = 37
 	minAttestedAuthLength = 55
 	maxCredentialIDLength = 1023
+
+	// signCountRolloverWindow is the largest number of increments past 0xFFFFFFFF which is still considered a
+	// legitimate wrap-around of the signature counter.
+	signCountRolloverWindow = 1 << 16
 )
 
 // AuthenticatorResponse represents the IDL with the same name.
@@ -27,6 +32,17 @@ type AuthenticatorResponse struct {
 	ClientDataJSON URLEncodedBase64 `json:"clientDataJSON"`
 }
 
+// ClientDataHash returns the SHA-256 hash of the exact clientDataJSON bytes returned by the client, which is the hash
+// signed by the authenticator in both the attestation and assertion signatures. The hash is always computed by the
+// library from these bytes during verification rather than taken from the caller.
+//
+// Specification: §7.1. Registering a New Credential (https://www.w3.org/TR/webauthn/#sctn-registering-a-new-credential)
+func (r AuthenticatorResponse) ClientDataHash() []byte {
+	hash := sha256.Sum256(r.ClientDataJSON)
+
+	return hash[:]
+}
+
 // AuthenticatorData represents the IDL with the same name.
 //
 // The authenticator data structure encodes contextual bindings made by the authenticator. These bindings are controlled
@@ -44,9 +60,12 @@ type AuthenticatorResponse struct {
 type AuthenticatorData struct {
 	RPIDHash []byte                 `json:"rpid"`
 	Flags    AuthenticatorFlags     `json:"flags"`
-	Counter  uint32                 `json:"sign_count"`
+	Counter  uint32                 `json:"sign_count"` // The raw 32-bit big-endian signCount.
 	AttData  AttestedCredentialData `json:"att_data"`
 	ExtData  []byte                 `json:"ext_data"`
+
+	// Extensions are the decoded authenticator extension outputs of ExtData.
+	Extensions AuthenticationExtensionsAuthenticatorOutputs `json:"extensions"`
 }
 
 type AttestedCredentialData struct {
@@ -145,8 +164,24 @@ const (
 	// Internal indicates the respective authenticator is contacted using a client device-specific transport, i.e., it
 	// is a platform authenticator. These authenticators are not removable from the client device.
 	Internal AuthenticatorTransport = "internal"
+
+	// SmartCard indicates the respective authenticator can be contacted over ISO/IEC 7816 smart card with contacts.
+	//
+	// WebAuthn Level 3.
+	SmartCard AuthenticatorTransport = "smart-card"
 )
 
+// ParseTransport returns the AuthenticatorTransport with the provided value, or an error if the value is not one of
+// the known transports. Values are case-sensitive as with the IDL enum.
+func ParseTransport(value string) (AuthenticatorTransport, error) {
+	switch transport := AuthenticatorTransport(value); transport {
+	case USB, NFC, BLE, Hybrid, Internal, SmartCard:
+		return transport, nil
+	default:
+		return "", ErrBadRequest.WithDetails("Invalid transport").WithInfo(fmt.Sprintf("Transport '%s' is not a known authenticator transport", value))
+	}
+}
+
 // UserVerificationRequirement is a representation of the UserVerificationRequirement IDL enum.
 //
 // A WebAuthn Relying Party may require user verification for some of its operations but not for others,
@@ -266,11 +301,12 @@ func (a *AuthenticatorData) Unmarshal(rawAuthData []byte) (err error) {
 
 	if a.Flags.HasAttestedCredentialData() {
 		if len(rawAuthData) > minAttestedAuthLength {
-			if err = a.unmarshalAttestedData(rawAuthData); err != nil {
+			var attDataLen int
+
+			if attDataLen, err = a.decodeAttestedData(rawAuthData); err != nil {
 				return err
 			}
 
-			attDataLen := len(a.AttData.AAGUID) + 2 + len(a.AttData.CredentialID) + len(a.AttData.CredentialPublicKey)
 			remaining = remaining - attDataLen
 		} else {
 			return ErrBadRequest.WithDetails("Attested credential flag set but data is missing")
@@ -283,58 +319,125 @@ func (a *AuthenticatorData) Unmarshal(rawAuthData []byte) (err error) {
 
 	if a.Flags.HasExtensions() {
 		if remaining != 0 {
-			a.ExtData = rawAuthData[len(rawAuthData)-remaining:]
+			offset := len(rawAuthData) - remaining
+
+			a.ExtData = rawAuthData[offset:]
 			remaining -= len(a.ExtData)
+
+			var rest []byte
+
+			if rest, err = webauthncbor.UnmarshalFirst(a.ExtData, &a.Extensions); err != nil {
+				return ErrBadRequest.WithDetails(fmt.Sprintf("Could not unmarshal extensions data at offset %d: %v", offset, err))
+			}
+
+			if len(rest) != 0 {
+				return ErrBadRequest.WithDetails(fmt.Sprintf("Leftover bytes decoding extensions data at offset %d", len(rawAuthData)-len(rest)))
+			}
 		} else {
 			return ErrBadRequest.WithDetails("Extensions flag set but extensions data is missing")
 		}
 	}
 
 	if remaining != 0 {
-		return ErrBadRequest.WithDetails("Leftover bytes decoding AuthenticatorData")
+		return ErrBadRequest.WithDetails(fmt.Sprintf("Leftover bytes decoding AuthenticatorData at offset %d", len(rawAuthData)-remaining))
 	}
 
 	return nil
 }
 
+// UnmarshalCopy is the same as Unmarshal but the authenticator data is decoded from a copy of rawAuthData, so that
+// later modifications of rawAuthData by the caller do not affect the decoded authenticator data. Unmarshal references
+// rawAuthData directly.
+func (a *AuthenticatorData) UnmarshalCopy(rawAuthData []byte) (err error) {
+	return a.Unmarshal(bytes.Clone(rawAuthData))
+}
+
+// Clone returns a deep copy of the authenticator data which does not share any of the backing byte slices.
+func (a *AuthenticatorData) Clone() (clone AuthenticatorData) {
+	clone = AuthenticatorData{
+		RPIDHash: bytes.Clone(a.RPIDHash),
+		Flags:    a.Flags,
+		Counter:  a.Counter,
+		AttData: AttestedCredentialData{
+			AAGUID:              bytes.Clone(a.AttData.AAGUID),
+			CredentialID:        bytes.Clone(a.AttData.CredentialID),
+			CredentialPublicKey: bytes.Clone(a.AttData.CredentialPublicKey),
+		},
+		ExtData: bytes.Clone(a.ExtData),
+	}
+
+	// The extension outputs are decoded again from the copy as they may contain byte slices of ExtData.
+	if a.Extensions != nil {
+		if _, err := webauthncbor.UnmarshalFirst(clone.ExtData, &clone.Extensions); err != nil {
+			clone.Extensions = make(AuthenticationExtensionsAuthenticatorOutputs, len(a.Extensions))
+
+			for k, v := range a.Extensions {
+				clone.Extensions[k] = v
+			}
+		}
+	}
+
+	return clone
+}
+
 // If Attestation Data is present, unmarshall that into the appropriate public key structure.
 func (a *AuthenticatorData) unmarshalAttestedData(rawAuthData []byte) (err error) {
+	_, err = a.decodeAttestedData(rawAuthData)
+
+	return err
+}
+
+// decodeAttestedData decodes the attested credential data and returns its length in rawAuthData, which accounts for
+// the encoded length of the credential public key rather than the length of its canonical encoding.
+func (a *AuthenticatorData) decodeAttestedData(rawAuthData []byte) (length int, err error) {
 	a.AttData.AAGUID = rawAuthData[37:53]
 
 	idLength := binary.BigEndian.Uint16(rawAuthData[53:55])
-	if len(rawAuthData) < int(55+idLength) {
-		return ErrBadRequest.WithDetails("Authenticator attestation data length too short")
+	if len(rawAuthData) < 55+int(idLength) {
+		return 0, ErrBadRequest.
+			WithDetails(fmt.Sprintf("Authenticator attestation data length too short for the credential id at offset 55 with length %d", idLength)).
+			WithInfo(fmt.Sprintf("Expected data greater than %d bytes. Got %d bytes", 55+int(idLength), len(rawAuthData)))
 	}
 
 	if idLength > maxCredentialIDLength {
-		return ErrBadRequest.WithDetails("Authenticator attestation data credential id length too long")
+		return 0, ErrBadRequest.WithDetails(fmt.Sprintf("Authenticator attestation data credential id length too long at offset 53: %d bytes exceeds the maximum of %d bytes", idLength, maxCredentialIDLength))
 	}
 
 	a.AttData.CredentialID = rawAuthData[55 : 55+idLength]
 
-	a.AttData.CredentialPublicKey, err = unmarshalCredentialPublicKey(rawAuthData[55+idLength:])
+	var keyLength int
+
+	a.AttData.CredentialPublicKey, keyLength, err = unmarshalFirstCredentialPublicKey(rawAuthData[55+idLength:])
 	if err != nil {
-		return ErrBadRequest.WithDetails(fmt.Sprintf("Could not unmarshal Credential Public Key: %v", err))
+		return 0, ErrBadRequest.WithDetails(fmt.Sprintf("Could not unmarshal Credential Public Key at offset %d: %v", 55+int(idLength), err))
 	}
 
-	return nil
+	return 16 + 2 + int(idLength) + keyLength, nil
 }
 
 // Unmarshall the credential's Public Key into CBOR encoding.
 func unmarshalCredentialPublicKey(keyBytes []byte) ([]byte, error) {
+	rawBytes, _, err := unmarshalFirstCredentialPublicKey(keyBytes)
+
+	return rawBytes, err
+}
+
+// unmarshalFirstCredentialPublicKey is the same as unmarshalCredentialPublicKey but also returns the number of bytes
+// of keyBytes the credential public key was decoded from.
+func unmarshalFirstCredentialPublicKey(keyBytes []byte) (rawBytes []byte, length int, err error) {
 	var m interface{}
 
-	err := webauthncbor.Unmarshal(keyBytes, &m)
+	// The credential public key may be followed by the extensions data, so only the first data item is decoded.
+	rest, err := webauthncbor.UnmarshalFirst(keyBytes, &m)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	rawBytes, err := webauthncbor.Marshal(m)
-	if err != nil {
-		return nil, err
+	if rawBytes, err = webauthncbor.Marshal(m); err != nil {
+		return nil, 0, err
 	}
 
-	return rawBytes, nil
+	return rawBytes, len(keyBytes) - len(rest), nil
 }
 
 // ResidentKeyRequired - Require that the key be private key resident to the client device.
@@ -355,6 +458,31 @@ func ResidentKeyUnrequired() *bool {
 	return ResidentKeyNotRequired()
 }
 
+// RPIDHash returns the SHA-256 hash of the RP ID, which is the value of the rpIdHash of authenticator data created
+// for the RP ID.
+//
+// Specification: §6.1. Authenticator Data (https://www.w3.org/TR/webauthn/#authenticator-data)
+func RPIDHash(rpID string) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+
+	return hash[:]
+}
+
+// MatchesRPIDHash returns true if the rpIdHash of the authenticator data is either the rpIDHash or the appIDHash. The
+// appIDHash is only compared when it's not empty.
+func (a *AuthenticatorData) MatchesRPIDHash(rpIDHash, appIDHash []byte) bool {
+	return bytes.Equal(a.RPIDHash, rpIDHash) || (len(appIDHash) != 0 && bytes.Equal(a.RPIDHash, appIDHash))
+}
+
+// SignCountRolledOver returns true if the signature counter moved from prev to next by wrapping around 0xFFFFFFFF,
+// i.e. next is less than prev but is at most a small number of increments past prev when counted modulo 2^32. Such a
+// decrease is not a signal that the authenticator has been cloned.
+//
+// Specification: §6.1.1. Signature Counter Considerations (https://www.w3.org/TR/webauthn/#sctn-sign-counter)
+func SignCountRolledOver(prev, next uint32) bool {
+	return next < prev && next-prev <= signCountRolloverWindow
+}
+
 // Verify on AuthenticatorData handles Steps 9 through 12 for Registration
 // and Steps 11 through 14 for Assertion.
 func (a *AuthenticatorData) Verify(rpIdHash []byte, appIDHash []byte, userVerificationRequired bool) error {
@@ -362,8 +490,8 @@ func (a *AuthenticatorData) Verify(rpIdHash []byte, appIDHash []byte, userVerifi
 	// Registration Step 9 & Assertion Step 11
 	// Verify that the RP ID hash in authData is indeed the SHA-256
 	// hash of the RP ID expected by the RP.
-	if !bytes.Equal(a.RPIDHash[:], rpIdHash) && !bytes.Equal(a.RPIDHash[:], appIDHash) {
-		return ErrVerification.WithInfo(fmt.Sprintf("RP Hash mismatch. Expected %x and Received %x", a.RPIDHash, rpIdHash))
+	if !a.MatchesRPIDHash(rpIdHash, appIDHash) {
+		return ErrVerification.WithInfo(fmt.Sprintf("RP Hash mismatch. Expected %x and Received %x", rpIdHash, a.RPIDHash))
 	}
 
 	// Registration Step 10 & Assertion Step 12
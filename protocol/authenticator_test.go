@@ -2,8 +2,12 @@ package protocol
 
 import (
 	"encoding/base64"
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAuthenticatorFlags_UserPresent(t *testing.T) {
@@ -150,6 +154,10 @@ func TestAuthenticatorData_Unmarshal(t *testing.T) {
 	noneAuthData, _ := base64.StdEncoding.DecodeString("pkLSG3xtVeHOI8U5mCjSx0m/am7y/gPMnhDN9O1TCItBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQMAxl6G32ykWaLrv/ouCs5HoGsvONqBtOb7ZmyMs8K8PccnwyyqPzWn/yZuyQmQBguvjYSvH6gDBlFG65quUDCSlAQIDJiABIVggyJGP+ra/u/eVjqN4OeYXUShRWxrEeC6Sb5/bZmJ9q8MiWCCHIkRdg5oRb1RHoFVYUpogcjlObCKFsV1ls1T+uUc6rA==")
 	attAuthData, _ := base64.StdEncoding.DecodeString("lWkIjx7O4yMpVANdvRDXyuORMFonUbVZu4/Xy7IpvdRBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQIniszxcGnhupdPFOHJIm6dscrWCC2h8xHicBMu91THD0kdOdB0QQtkaEn+6KfsfT1o3NmmFT8YfXrG734WfVSmlAQIDJiABIVggyoHHeiUw5aSbt8/GsL9zaqZGRzV26A4y3CnCGUhVXu4iWCBMnc8za5xgPzIygngAv9W+vZTMGJwwZcM4sjiqkcb/1g==")
 
+	extAuthData := append([]byte{}, attAuthData...)
+	extAuthData[32] |= byte(FlagHasExtensions)
+	extAuthData = append(extAuthData, 0xa1, 0x6b, 'c', 'r', 'e', 'd', 'P', 'r', 'o', 't', 'e', 'c', 't', 0x02)
+
 	tests := []struct {
 		name    string
 		fields  fields
@@ -172,6 +180,38 @@ func TestAuthenticatorData_Unmarshal(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Att Data With Extensions Marshall Successfully",
+			fields{},
+			args{
+				extAuthData,
+			},
+			false,
+		},
+		{
+			"Extensions Flag With Invalid Extensions Data",
+			fields{},
+			args{
+				append(append([]byte{}, extAuthData...), 0x00),
+			},
+			true,
+		},
+		{
+			"Att Data With Trailing Bytes",
+			fields{},
+			args{
+				append(append([]byte{}, attAuthData...), 0xde, 0xad),
+			},
+			true,
+		},
+		{
+			"Att Flag With Trailing Bytes Instead Of Att Data",
+			fields{},
+			args{
+				append(append([]byte{}, attAuthData[:37]...), 0xde, 0xad),
+			},
+			true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -292,3 +332,268 @@ func TestAuthenticatorData_Verify(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticatorData_UnmarshalErrorDetails(t *testing.T) {
+	attAuthData, _ := base64.StdEncoding.DecodeString("lWkIjx7O4yMpVANdvRDXyuORMFonUbVZu4/Xy7IpvdRBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQIniszxcGnhupdPFOHJIm6dscrWCC2h8xHicBMu91THD0kdOdB0QQtkaEn+6KfsfT1o3NmmFT8YfXrG734WfVSmlAQIDJiABIVggyoHHeiUw5aSbt8/GsL9zaqZGRzV26A4y3CnCGUhVXu4iWCBMnc8za5xgPzIygngAv9W+vZTMGJwwZcM4sjiqkcb/1g==")
+
+	extAuthData := append([]byte{}, attAuthData...)
+	extAuthData[32] |= byte(FlagHasExtensions)
+	extAuthData = append(extAuthData, 0xa1, 0x6b, 'c', 'r', 'e', 'd', 'P', 'r', 'o', 't', 'e', 'c', 't', 0x02)
+
+	testCases := []struct {
+		name string
+		have func() []byte
+		err  string
+	}{
+		{
+			"ShouldReportCredentialIDLength",
+			func() []byte {
+				return attAuthData[:100]
+			},
+			"Authenticator attestation data length too short for the credential id at offset 55 with length 64",
+		},
+		{
+			"ShouldReportCredentialPublicKeyOffset",
+			func() []byte {
+				return attAuthData[:130]
+			},
+			"Could not unmarshal Credential Public Key at offset 119: unexpected EOF",
+		},
+		{
+			"ShouldReportLeftoverOffset",
+			func() []byte {
+				return append(append([]byte{}, attAuthData...), 0x00, 0x00)
+			},
+			"Leftover bytes decoding AuthenticatorData at offset 196",
+		},
+		{
+			"ShouldReportExtensionsOffset",
+			func() []byte {
+				return extAuthData[:len(extAuthData)-1]
+			},
+			"Could not unmarshal extensions data at offset 196: unexpected EOF",
+		},
+		{
+			"ShouldReportExtensionsLeftoverOffset",
+			func() []byte {
+				return append(append([]byte{}, extAuthData...), 0x00)
+			},
+			"Leftover bytes decoding extensions data at offset 210",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &AuthenticatorData{}
+
+			err := a.Unmarshal(tc.have())
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("AuthenticatorData.Unmarshal() error = %v, want %v", err, tc.err)
+			}
+
+			if e, ok := err.(*Error); !ok || e.Type != ErrBadRequest.Type {
+				t.Errorf("AuthenticatorData.Unmarshal() error type = %T, want %v", err, ErrBadRequest.Type)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorData_Clone(t *testing.T) {
+	attAuthData, _ := base64.StdEncoding.DecodeString("lWkIjx7O4yMpVANdvRDXyuORMFonUbVZu4/Xy7IpvdRBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQIniszxcGnhupdPFOHJIm6dscrWCC2h8xHicBMu91THD0kdOdB0QQtkaEn+6KfsfT1o3NmmFT8YfXrG734WfVSmlAQIDJiABIVggyoHHeiUw5aSbt8/GsL9zaqZGRzV26A4y3CnCGUhVXu4iWCBMnc8za5xgPzIygngAv9W+vZTMGJwwZcM4sjiqkcb/1g==")
+
+	attAuthData[32] |= byte(FlagHasExtensions)
+	attAuthData = append(attAuthData, 0xa1, 0x6b, 'c', 'r', 'e', 'd', 'P', 'r', 'o', 't', 'e', 'c', 't', 0x02)
+
+	buffer := append([]byte{}, attAuthData...)
+
+	var a, copied AuthenticatorData
+
+	if err := a.Unmarshal(buffer); err != nil {
+		t.Fatalf("AuthenticatorData.Unmarshal() error = %v", err)
+	}
+
+	if err := copied.UnmarshalCopy(buffer); err != nil {
+		t.Fatalf("AuthenticatorData.UnmarshalCopy() error = %v", err)
+	}
+
+	clone := a.Clone()
+
+	if !reflect.DeepEqual(a, clone) {
+		t.Fatalf("AuthenticatorData.Clone() = %v, want %v", clone, a)
+	}
+
+	var expected AuthenticatorData
+
+	if err := expected.Unmarshal(attAuthData); err != nil {
+		t.Fatalf("AuthenticatorData.Unmarshal() error = %v", err)
+	}
+
+	for i := range buffer {
+		buffer[i] = 0xff
+	}
+
+	// The authenticator data decoded by Unmarshal references the buffer.
+	if reflect.DeepEqual(a.AttData, expected.AttData) {
+		t.Errorf("AuthenticatorData.Unmarshal() is not expected to copy the buffer")
+	}
+
+	if !reflect.DeepEqual(copied, expected) {
+		t.Errorf("AuthenticatorData.UnmarshalCopy() = %v, want %v", copied, expected)
+	}
+
+	if !reflect.DeepEqual(clone, expected) {
+		t.Errorf("AuthenticatorData.Clone() = %v, want %v", clone, expected)
+	}
+}
+
+func TestRPIDHash(t *testing.T) {
+	// The rpIdHash of the authenticator data of the webauthn.io test responses.
+	expected, _ := base64.RawURLEncoding.DecodeString("dKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvA")
+
+	if got := RPIDHash("webauthn.io"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("RPIDHash() = %x, want %x", got, expected)
+	}
+
+	a := &AuthenticatorData{RPIDHash: expected}
+
+	if !a.MatchesRPIDHash(RPIDHash("webauthn.io"), nil) {
+		t.Errorf("AuthenticatorData.MatchesRPIDHash() = false, want true")
+	}
+
+	if !a.MatchesRPIDHash(RPIDHash("example.com"), RPIDHash("webauthn.io")) {
+		t.Errorf("AuthenticatorData.MatchesRPIDHash() with the app ID = false, want true")
+	}
+
+	if a.MatchesRPIDHash(RPIDHash("example.com"), nil) {
+		t.Errorf("AuthenticatorData.MatchesRPIDHash() = true, want false")
+	}
+}
+
+func TestSignCountRolledOver(t *testing.T) {
+	tests := []struct {
+		name string
+		prev uint32
+		next uint32
+		want bool
+	}{
+		{"Increment", 1, 2, false},
+		{"Equal", 5, 5, false},
+		{"Decrease", 10, 9, false},
+		{"Returned to zero", 1, 0, false},
+		{"Wrap around to zero", 0xFFFFFFFF, 0, true},
+		{"Wrap around", 0xFFFFFFF0, 0x10, true},
+		{"Wrap around past the window", 0xFFFFFFFF, signCountRolloverWindow, false},
+		{"Large decrease from the maximum", 0xFFFFFFFF, 0x7FFFFFFF, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignCountRolledOver(tt.prev, tt.next); got != tt.want {
+				t.Errorf("SignCountRolledOver(%#x, %#x) = %v, want %v", tt.prev, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorData_UnmarshalTrailingBytes(t *testing.T) {
+	attAuthData, _ := base64.StdEncoding.DecodeString("lWkIjx7O4yMpVANdvRDXyuORMFonUbVZu4/Xy7IpvdRBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQIniszxcGnhupdPFOHJIm6dscrWCC2h8xHicBMu91THD0kdOdB0QQtkaEn+6KfsfT1o3NmmFT8YfXrG734WfVSmlAQIDJiABIVggyoHHeiUw5aSbt8/GsL9zaqZGRzV26A4y3CnCGUhVXu4iWCBMnc8za5xgPzIygngAv9W+vZTMGJwwZcM4sjiqkcb/1g==")
+
+	extensions := []byte{0xa1, 0x6b, 'c', 'r', 'e', 'd', 'P', 'r', 'o', 't', 'e', 'c', 't', 0x02}
+
+	// The credential public key starts at offset 119 with the map header followed by the kty label and value, which is
+	// re-encoded with a non-minimal length so the key is one byte longer than its canonical encoding.
+	nonCanonicalAuthData := append([]byte{}, attAuthData[:121]...)
+	nonCanonicalAuthData = append(nonCanonicalAuthData, 0x18, 0x02)
+	nonCanonicalAuthData = append(nonCanonicalAuthData, attAuthData[122:]...)
+	nonCanonicalAuthData[32] |= byte(FlagHasExtensions)
+	nonCanonicalAuthData = append(nonCanonicalAuthData, extensions...)
+
+	a := &AuthenticatorData{}
+
+	if err := a.Unmarshal(nonCanonicalAuthData); err != nil {
+		t.Fatalf("AuthenticatorData.Unmarshal() with a non-canonical key error = %v", err)
+	}
+
+	if !reflect.DeepEqual(a.ExtData, extensions) {
+		t.Errorf("AuthenticatorData.Unmarshal() ExtData = %x, want %x", a.ExtData, extensions)
+	}
+
+	attAuthDataWithExtensions := append([]byte{}, attAuthData...)
+	attAuthDataWithExtensions[32] |= byte(FlagHasExtensions)
+	attAuthDataWithExtensions = append(attAuthDataWithExtensions, extensions...)
+
+	noAttAuthData := append([]byte{}, attAuthData[:37]...)
+	noAttAuthData[32] &^= byte(FlagAttestedCredentialData)
+
+	tests := []struct {
+		name        string
+		rawAuthData []byte
+		details     string
+	}{
+		{
+			"Trailing Bytes After Attested Credential Data",
+			append(append([]byte{}, attAuthData...), 0xde, 0xad),
+			"Leftover bytes decoding AuthenticatorData at offset 196",
+		},
+		{
+			"Trailing Bytes After Extensions",
+			append(append([]byte{}, attAuthDataWithExtensions...), 0xde, 0xad),
+			"Leftover bytes decoding extensions data at offset 210",
+		},
+		{
+			"Trailing Bytes Without Attested Credential Data",
+			append(noAttAuthData, 0xde, 0xad),
+			"Attested credential flag not set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AuthenticatorData{}
+
+			err := a.Unmarshal(tt.rawAuthData)
+
+			var e *Error
+
+			if !errors.As(err, &e) || e.Type != ErrBadRequest.Type || e.Details != tt.details {
+				t.Errorf("AuthenticatorData.Unmarshal() error = %v, want %s with details %q", err, ErrBadRequest.Type, tt.details)
+			}
+		})
+	}
+}
+
+func TestParseTransport(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected AuthenticatorTransport
+		err      string
+	}{
+		{"ShouldParseUSB", "usb", USB, ""},
+		{"ShouldParseNFC", "nfc", NFC, ""},
+		{"ShouldParseBLE", "ble", BLE, ""},
+		{"ShouldParseInternal", "internal", Internal, ""},
+		{"ShouldParseHybrid", "hybrid", Hybrid, ""},
+		{"ShouldParseSmartCard", "smart-card", SmartCard, ""},
+		{"ShouldRejectUnknown", "bluetooth", "", "Transport 'bluetooth' is not a known authenticator transport"},
+		{"ShouldRejectUppercase", "USB", "", "Transport 'USB' is not a known authenticator transport"},
+		{"ShouldRejectEmpty", "", "", "Transport '' is not a known authenticator transport"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transport, err := ParseTransport(tc.value)
+			assert.Equal(t, tc.expected, transport)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, ErrBadRequest.Type, err.(*Error).Type)
+			assert.Equal(t, tc.err, err.(*Error).DevInfo)
+		})
+	}
+}
@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 )
 
+// DefaultMaxClientDataSize is the default maximum size in bytes of the clientDataJSON of a credential creation or
+// assertion response, which is much larger than any client data returned by a client.
+const DefaultMaxClientDataSize = 8 * 1024
+
 // CollectedClientData represents the contextual bindings of both the WebAuthn Relying Party
 // and the client. It is a key-value mapping whose keys are strings. Values can be any type
 // that has a valid encoding in JSON. Its structure is defined by the following Web IDL.
@@ -22,6 +27,12 @@ type CollectedClientData struct {
 	Origin       string        `json:"origin"`
 	TokenBinding *TokenBinding `json:"tokenBinding,omitempty"`
 
+	// CrossOrigin is true if the ceremony was performed within an iframe which is not same-origin with its ancestors.
+	CrossOrigin bool `json:"crossOrigin,omitempty"`
+
+	// TopOrigin is the origin of the top level browsing context, which is only present for cross-origin ceremonies.
+	TopOrigin string `json:"topOrigin,omitempty"`
+
 	// Chromium (Chrome) returns a hint sometimes about how to handle clientDataJSON in a safe manner.
 	Hint string `json:"new_keys_may_be_added_here,omitempty"`
 }
@@ -73,15 +84,110 @@ func FullyQualifiedOrigin(rawOrigin string) (fqOrigin string, err error) {
 	return origin.String(), nil
 }
 
+// originsMatch returns true if the origins have the same scheme, host, and port, where the port is normalized to the
+// default port of the scheme when it's absent. Origins which can't be parsed as a URL such as android:apk-key-hash
+// origins must match exactly apart from case.
+func originsMatch(expected, actual string) bool {
+	if strings.EqualFold(expected, actual) {
+		return true
+	}
+
+	expectedURL, err := url.Parse(expected)
+	if err != nil || expectedURL.Host == "" {
+		return false
+	}
+
+	actualURL, err := url.Parse(actual)
+	if err != nil || actualURL.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(expectedURL.Scheme, actualURL.Scheme) &&
+		strings.EqualFold(expectedURL.Hostname(), actualURL.Hostname()) &&
+		originPort(expectedURL) == originPort(actualURL)
+}
+
+// originPort returns the port of the origin or the default port of its scheme if the port is absent.
+func originPort(origin *url.URL) string {
+	if port := origin.Port(); port != "" {
+		return port
+	}
+
+	switch strings.ToLower(origin.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	default:
+		return ""
+	}
+}
+
+// validateClientDataJSON ensures the clientDataJSON is at most maxSize bytes and is valid UTF-8 before it's decoded,
+// returning the reason it's not valid otherwise. If maxSize is 0 or less the DefaultMaxClientDataSize is used.
+func validateClientDataJSON(clientDataJSON []byte, maxSize int) (reason string, ok bool) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxClientDataSize
+	}
+
+	if len(clientDataJSON) > maxSize {
+		return fmt.Sprintf("clientDataJSON is %d bytes which exceeds the maximum of %d bytes", len(clientDataJSON), maxSize), false
+	}
+
+	if !utf8.Valid(clientDataJSON) {
+		return "clientDataJSON is not valid UTF-8", false
+	}
+
+	return "", true
+}
+
+// VerifyCrossOrigin ensures the ceremony was performed in the same origin as its ancestors unless cross-origin
+// ceremonies are allowed, in which case the topOrigin must match one of the Relying Party origins if it's present.
+//
+// Specification: §7.1. Registering a New Credential (https://www.w3.org/TR/webauthn-3/#sctn-registering-a-new-credential)
+func (c *CollectedClientData) VerifyCrossOrigin(allowCrossOrigin bool, rpOrigins []string) error {
+	if !c.CrossOrigin && c.TopOrigin == "" {
+		return nil
+	}
+
+	if !allowCrossOrigin {
+		return ErrVerification.
+			WithDetails("Error validating cross origin").
+			WithInfo(fmt.Sprintf("Cross-origin ceremonies are not allowed, Received top origin: %s", c.TopOrigin))
+	}
+
+	if c.TopOrigin == "" {
+		return nil
+	}
+
+	fqTopOrigin, err := FullyQualifiedOrigin(c.TopOrigin)
+	if err != nil {
+		return ErrParsingData.WithDetails("Error decoding clientData topOrigin as URL")
+	}
+
+	for _, origin := range rpOrigins {
+		if originsMatch(origin, fqTopOrigin) {
+			return nil
+		}
+	}
+
+	return ErrVerification.
+		WithDetails("Error validating top origin").
+		WithInfo(fmt.Sprintf("Expected Values: %s, Received: %s", rpOrigins, fqTopOrigin))
+}
+
 // Verify handles steps 3 through 6 of verifying the registering client data of a
 // new credential and steps 7 through 10 of verifying an authentication assertion
 // See https://www.w3.org/TR/webauthn/#registering-a-new-credential
 // and https://www.w3.org/TR/webauthn/#verifying-assertion
-func (c *CollectedClientData) Verify(storedChallenge string, ceremony CeremonyType, rpOrigins []string) error {
+//
+// The additionalTypes are accepted as the value of C.type in addition to the ceremony, for profiles which define their
+// own client data types.
+func (c *CollectedClientData) Verify(storedChallenge string, ceremony CeremonyType, rpOrigins []string, additionalTypes ...CeremonyType) error {
 	// Registration Step 3. Verify that the value of C.type is webauthn.create.
 
 	// Assertion Step 7. Verify that the value of C.type is the string webauthn.get.
-	if c.Type != ceremony {
+	if !c.hasType(ceremony, additionalTypes) {
 		return ErrVerification.WithDetails("Error validating ceremony type").WithInfo(fmt.Sprintf("Expected Value: %s, Received: %s", ceremony, c.Type))
 	}
 
@@ -109,7 +215,7 @@ func (c *CollectedClientData) Verify(storedChallenge string, ceremony CeremonyTy
 	found := false
 
 	for _, origin := range rpOrigins {
-		if strings.EqualFold(fqOrigin, origin) {
+		if originsMatch(origin, fqOrigin) {
 			found = true
 			break
 		}
@@ -140,3 +246,18 @@ func (c *CollectedClientData) Verify(storedChallenge string, ceremony CeremonyTy
 
 	return nil
 }
+
+// hasType returns true if the type of the client data is the ceremony or one of the additional types.
+func (c *CollectedClientData) hasType(ceremony CeremonyType, additionalTypes []CeremonyType) bool {
+	if c.Type == ceremony {
+		return true
+	}
+
+	for _, t := range additionalTypes {
+		if c.Type == t {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,9 +1,11 @@
 package protocol
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupCollectedClientData(challenge URLEncodedBase64, origin string) *CollectedClientData {
@@ -81,6 +83,22 @@ func TestVerifyCollectedClientDataWithMultipleExpectedOrigins(t *testing.T) {
 	}
 }
 
+func TestVerifyCollectedClientDataAdditionalTypes(t *testing.T) {
+	challenge, err := CreateChallenge()
+	require.NoError(t, err)
+
+	ccd := setupCollectedClientData(challenge, "https://example.com")
+	ccd.Type = "payment.get"
+
+	assert.EqualError(t, ccd.Verify(challenge.String(), AssertCeremony, []string{ccd.Origin}), "Error validating ceremony type")
+	assert.EqualError(t, ccd.Verify(challenge.String(), AssertCeremony, []string{ccd.Origin}, "other.get"), "Error validating ceremony type")
+	assert.NoError(t, ccd.Verify(challenge.String(), AssertCeremony, []string{ccd.Origin}, "other.get", "payment.get"))
+
+	ccd.Type = AssertCeremony
+
+	assert.NoError(t, ccd.Verify(challenge.String(), AssertCeremony, []string{ccd.Origin}, "payment.get"))
+}
+
 func TestFullyQualifiedOrigin(t *testing.T) {
 	testCases := []struct {
 		name                  string
@@ -113,3 +131,77 @@ func TestFullyQualifiedOrigin(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyCollectedClientDataOriginNormalization(t *testing.T) {
+	testCases := []struct {
+		name     string
+		origin   string
+		expected []string
+		err      bool
+	}{
+		{"ShouldMatchExplicitDefaultPort", "https://example.com:443", []string{"https://example.com"}, false},
+		{"ShouldMatchImplicitDefaultPort", "https://example.com", []string{"https://example.com:443"}, false},
+		{"ShouldMatchExplicitDefaultPortHTTP", "http://localhost:80", []string{"http://localhost"}, false},
+		{"ShouldMatchHostCase", "https://EXAMPLE.com", []string{"https://example.com"}, false},
+		{"ShouldMatchNonDefaultPort", "https://example.com:8443", []string{"https://example.com:8443"}, false},
+		{"ShouldMatchAndroid", "android:apk-key-hash:7d1043473d55bfa90e8530d35801d4e381bc69f0", []string{"android:apk-key-hash:7d1043473d55bfa90e8530d35801d4e381bc69f0"}, false},
+		{"ShouldFailSchemeMismatch", "http://example.com", []string{"https://example.com"}, true},
+		{"ShouldFailSchemeMismatchSamePort", "http://example.com:443", []string{"https://example.com"}, true},
+		{"ShouldFailPortMismatch", "https://example.com:8443", []string{"https://example.com"}, true},
+		{"ShouldFailHostMismatch", "https://app.example.com", []string{"https://example.com"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			challenge, err := CreateChallenge()
+			assert.NoError(t, err)
+
+			ccd := setupCollectedClientData(challenge, tc.origin)
+
+			err = ccd.Verify(challenge.String(), ccd.Type, tc.expected)
+			if tc.err {
+				assert.EqualError(t, err, "Error validating origin")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCollectedClientData_VerifyCrossOrigin(t *testing.T) {
+	origins := []string{"https://example.com"}
+
+	testCases := []struct {
+		name        string
+		clientData  string
+		allow       bool
+		expectedErr string
+	}{
+		{"ShouldPassSameOrigin", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":false}`, false, ""},
+		{"ShouldPassSameOriginOmitted", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com"}`, false, ""},
+		{"ShouldPassAllowedCrossOrigin", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":true,"topOrigin":"https://example.com:443"}`, true, ""},
+		{"ShouldPassAllowedCrossOriginWithoutTopOrigin", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":true}`, true, ""},
+		{"ShouldFailCrossOriginNotAllowed", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":true,"topOrigin":"https://example.com"}`, false, "Error validating cross origin"},
+		{"ShouldFailTopOriginNotAllowed", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","topOrigin":"https://example.com"}`, false, "Error validating cross origin"},
+		{"ShouldFailTopOriginMismatch", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":true,"topOrigin":"https://evil.example"}`, true, "Error validating top origin"},
+		{"ShouldFailTopOriginInvalid", `{"type":"webauthn.get","challenge":"abc","origin":"https://example.com","crossOrigin":true,"topOrigin":"evil"}`, true, "Error decoding clientData topOrigin as URL"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ccd CollectedClientData
+
+			require.NoError(t, json.Unmarshal([]byte(tc.clientData), &ccd))
+
+			err := ccd.VerifyCrossOrigin(tc.allow, origins)
+
+			if tc.expectedErr == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package protocol
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/hex"
 	"io"
 	"net/http"
+	"net/url"
+
+	"github.com/flaviup/webauthn/metadata"
 )
 
 // Credential is the basic credential type from the Credential Management specification that is inherited by WebAuthn's
@@ -58,22 +61,54 @@ type ParsedCredentialCreationData struct {
 	Raw      CredentialCreationResponse
 }
 
+// DefaultMaxAttestationObjectSize is the default maximum size in bytes of the attestation object of a credential
+// creation response, which is large enough for TPM attestations with full certificate chains.
+const DefaultMaxAttestationObjectSize = 64 * 1024
+
 func ParseCredentialCreationResponse(response *http.Request) (*ParsedCredentialCreationData, error) {
+	return ParseCredentialCreationResponseMaxSize(response, DefaultMaxAttestationObjectSize)
+}
+
+// ParseCredentialCreationResponseMaxSize is the same as ParseCredentialCreationResponse but the attestation object
+// must not be larger than maxAttestationObjectSize bytes. If maxAttestationObjectSize is 0 or less the
+// DefaultMaxAttestationObjectSize is used.
+func ParseCredentialCreationResponseMaxSize(response *http.Request, maxAttestationObjectSize int) (*ParsedCredentialCreationData, error) {
+	return ParseCredentialCreationResponseMaxSizes(response, maxAttestationObjectSize, DefaultMaxClientDataSize)
+}
+
+// ParseCredentialCreationResponseMaxSizes is the same as ParseCredentialCreationResponseMaxSize but the clientDataJSON
+// must also not be larger than maxClientDataSize bytes. If maxClientDataSize is 0 or less the DefaultMaxClientDataSize
+// is used.
+func ParseCredentialCreationResponseMaxSizes(response *http.Request, maxAttestationObjectSize, maxClientDataSize int) (*ParsedCredentialCreationData, error) {
 	if response == nil || response.Body == nil {
 		return nil, ErrBadRequest.WithDetails("No response given")
 	}
 
-	return ParseCredentialCreationResponseBody(response.Body)
+	return ParseCredentialCreationResponseBodyMaxSizes(response.Body, maxAttestationObjectSize, maxClientDataSize)
 }
 
 func ParseCredentialCreationResponseBody(body io.Reader) (pcc *ParsedCredentialCreationData, err error) {
+	return ParseCredentialCreationResponseBodyMaxSize(body, DefaultMaxAttestationObjectSize)
+}
+
+// ParseCredentialCreationResponseBodyMaxSize is the same as ParseCredentialCreationResponseBody but the attestation
+// object must not be larger than maxAttestationObjectSize bytes. If maxAttestationObjectSize is 0 or less the
+// DefaultMaxAttestationObjectSize is used.
+func ParseCredentialCreationResponseBodyMaxSize(body io.Reader, maxAttestationObjectSize int) (pcc *ParsedCredentialCreationData, err error) {
+	return ParseCredentialCreationResponseBodyMaxSizes(body, maxAttestationObjectSize, DefaultMaxClientDataSize)
+}
+
+// ParseCredentialCreationResponseBodyMaxSizes is the same as ParseCredentialCreationResponseBodyMaxSize but the
+// clientDataJSON must also not be larger than maxClientDataSize bytes. If maxClientDataSize is 0 or less the
+// DefaultMaxClientDataSize is used.
+func ParseCredentialCreationResponseBodyMaxSizes(body io.Reader, maxAttestationObjectSize, maxClientDataSize int) (pcc *ParsedCredentialCreationData, err error) {
 	var ccr CredentialCreationResponse
 
 	if err = json.NewDecoder(body).Decode(&ccr); err != nil {
 		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo(err.Error())
 	}
 
-	return ccr.Parse()
+	return ccr.ParseMaxSizes(maxAttestationObjectSize, maxClientDataSize)
 }
 
 func ParseCredentialCreationResponseString(str []byte) (pcc *ParsedCredentialCreationData, err error) {
@@ -86,11 +121,48 @@ func ParseCredentialCreationResponseString(str []byte) (pcc *ParsedCredentialCre
 	return ccr.Parse()
 }
 
+// ParseCredentialCreationResponseForm parses the credential creation response from form fields, for frontends which
+// submit the response as a form rather than a JSON body. The fields are named after the members of the JSON response:
+// the base64url encoded rawId, attestationObject, and clientDataJSON fields, the id, type, and authenticatorAttachment
+// fields, the clientExtensionResults field containing the JSON encoded client extension results, and a transports
+// field for each transport.
+func ParseCredentialCreationResponseForm(values url.Values) (pcc *ParsedCredentialCreationData, err error) {
+	var ccr CredentialCreationResponse
+
+	if ccr.PublicKeyCredential, err = parsePublicKeyCredentialForm(values); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo(err.Error())
+	}
+
+	if ccr.AttestationResponse.ClientDataJSON, err = parseFormBase64(values, "clientDataJSON"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo(err.Error())
+	}
+
+	if ccr.AttestationResponse.AttestationObject, err = parseFormBase64(values, "attestationObject"); err != nil {
+		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo(err.Error())
+	}
+
+	ccr.AttestationResponse.Transports = values["transports"]
+
+	return ccr.Parse()
+}
+
 // Parse validates and parses the CredentialCreationResponse into a ParsedCredentialCreationData. This receiver
 // is unlikely to be expressly guaranteed under the versioning policy. Users looking for this guarantee should see
 // ParseCredentialCreationResponseBody instead, and this receiver should only be used if that function is inadequate
 // for their use case.
 func (ccr CredentialCreationResponse) Parse() (pcc *ParsedCredentialCreationData, err error) {
+	return ccr.ParseMaxSize(DefaultMaxAttestationObjectSize)
+}
+
+// ParseMaxSize is the same as Parse but the attestation object must not be larger than maxAttestationObjectSize bytes.
+// If maxAttestationObjectSize is 0 or less the DefaultMaxAttestationObjectSize is used.
+func (ccr CredentialCreationResponse) ParseMaxSize(maxAttestationObjectSize int) (pcc *ParsedCredentialCreationData, err error) {
+	return ccr.ParseMaxSizes(maxAttestationObjectSize, DefaultMaxClientDataSize)
+}
+
+// ParseMaxSizes is the same as ParseMaxSize but the clientDataJSON must also not be larger than maxClientDataSize
+// bytes, and must be valid UTF-8. If maxClientDataSize is 0 or less the DefaultMaxClientDataSize is used.
+func (ccr CredentialCreationResponse) ParseMaxSizes(maxAttestationObjectSize, maxClientDataSize int) (pcc *ParsedCredentialCreationData, err error) {
 	if ccr.ID == "" {
 		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo("Missing ID")
 	}
@@ -108,17 +180,29 @@ func (ccr CredentialCreationResponse) Parse() (pcc *ParsedCredentialCreationData
 		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo("Type not public-key")
 	}
 
+	if maxAttestationObjectSize <= 0 {
+		maxAttestationObjectSize = DefaultMaxAttestationObjectSize
+	}
+
+	// NON-NORMATIVE: Limit the size of the attestation object before it's decoded.
+	if len(ccr.AttestationResponse.AttestationObject) > maxAttestationObjectSize {
+		return nil, ErrBadRequest.
+			WithDetails("Parse error for Registration").
+			WithInfo(fmt.Sprintf("Attestation object is %d bytes which exceeds the maximum of %d bytes", len(ccr.AttestationResponse.AttestationObject), maxAttestationObjectSize))
+	}
+
+	// NON-NORMATIVE: Limit the size and ensure the encoding of the client data before it's decoded.
+	if reason, ok := validateClientDataJSON(ccr.AttestationResponse.ClientDataJSON, maxClientDataSize); !ok {
+		return nil, ErrBadRequest.WithDetails("Parse error for Registration").WithInfo(reason)
+	}
+
 	response, err := ccr.AttestationResponse.Parse()
 	if err != nil {
-		return nil, ErrParsingData.WithDetails("Error parsing attestation response")
+		return nil, ErrParsingData.WithDetails(fmt.Sprintf("Error parsing attestation response: %v", err))
 	}
 
-	// TODO: Remove this as it's a backwards compatibility layer.
-	if len(response.Transports) == 0 && len(ccr.Transports) != 0 {
-		for _, t := range ccr.Transports {
-			response.Transports = append(response.Transports, AuthenticatorTransport(t))
-		}
-	}
+	// TODO: Remove the deprecated top-level transports as it's a backwards compatibility layer.
+	response.Transports, response.TransportsConflict = mergeTransports(response.Transports, parseTransports(ccr.Transports))
 
 	var attachment AuthenticatorAttachment
 
@@ -142,17 +226,27 @@ func (ccr CredentialCreationResponse) Parse() (pcc *ParsedCredentialCreationData
 //
 // Specification: §7.1. Registering a New Credential (https://www.w3.org/TR/webauthn/#sctn-registering-a-new-credential)
 func (pcc *ParsedCredentialCreationData) Verify(storedChallenge string, verifyUser bool, relyingPartyID string, relyingPartyOrigins []string) error {
+	return pcc.VerifyCtx(context.Background(), storedChallenge, verifyUser, relyingPartyID, relyingPartyOrigins)
+}
+
+// VerifyCtx is the same as Verify but the provided context is used to cancel any remaining verification steps, such
+// as the attestation statement and metadata checks. The additionalTypes are accepted as the client data type in
+// addition to webauthn.create.
+func (pcc *ParsedCredentialCreationData) VerifyCtx(ctx context.Context, storedChallenge string, verifyUser bool, relyingPartyID string, relyingPartyOrigins []string, additionalTypes ...CeremonyType) error {
 	// Handles steps 3 through 6 - Verifying the Client Data against the Relying Party's stored data
-	verifyError := pcc.Response.CollectedClientData.Verify(storedChallenge, CreateCeremony, relyingPartyOrigins)
+	verifyError := pcc.Response.CollectedClientData.Verify(storedChallenge, CreateCeremony, relyingPartyOrigins, additionalTypes...)
 	if verifyError != nil {
 		return verifyError
 	}
 
-	fmt.Printf("CDJ: %s\n", string(pcc.Raw.AttestationResponse.ClientDataJSON))
-	fmt.Printf("CDJ DATA: %s\n", hex.EncodeToString(pcc.Raw.AttestationResponse.ClientDataJSON))
+	// NON-NORMATIVE: Verify that the credential ID the authenticator attested to in the authenticator data is the same
+	// credential ID the client returned as the id and rawId of the credential.
+	if err := pcc.verifyCredentialID(); err != nil {
+		return err
+	}
+
 	// Step 7. Compute the hash of response.clientDataJSON using SHA-256.
-	clientDataHash := sha256.Sum256(pcc.Raw.AttestationResponse.ClientDataJSON)
-	fmt.Printf("CDH: %s\n", hex.EncodeToString(clientDataHash[:]))
+	clientDataHash := pcc.Raw.AttestationResponse.ClientDataHash()
 
 	// Step 8. Perform CBOR decoding on the attestationObject field of the AuthenticatorAttestationResponse
 	// structure to obtain the attestation statement format fmt, the authenticator data authData, and the
@@ -160,7 +254,7 @@ func (pcc *ParsedCredentialCreationData) Verify(storedChallenge string, verifyUs
 
 	// We do the above step while parsing and decoding the CredentialCreationResponse
 	// Handle steps 9 through 14 - This verifies the attestation object.
-	verifyError = pcc.Response.AttestationObject.Verify(relyingPartyID, clientDataHash[:], verifyUser)
+	pcc.Response.AttestationType, pcc.Response.trustPath, verifyError = pcc.Response.AttestationObject.verify(ctx, metadata.StoreFromContext(ctx), relyingPartyID, clientDataHash, verifyUser)
 	if verifyError != nil {
 		return verifyError
 	}
@@ -204,6 +298,18 @@ func (pcc *ParsedCredentialCreationData) Verify(storedChallenge string, verifyUs
 	return nil
 }
 
+func (pcc *ParsedCredentialCreationData) verifyCredentialID() error {
+	if !bytes.Equal(pcc.RawID, pcc.Response.AttestationObject.AuthData.AttData.CredentialID) {
+		return ErrAttestation.WithDetails("Credential ID in the authenticator data does not match the credential raw ID")
+	}
+
+	if id, err := base64.RawURLEncoding.DecodeString(pcc.ID); err != nil || !bytes.Equal(id, pcc.RawID) {
+		return ErrAttestation.WithDetails("Credential ID does not match the credential raw ID")
+	}
+
+	return nil
+}
+
 // GetAppID takes a AuthenticationExtensions object or nil. It then performs the following checks in order:
 //
 // 1. Check that the Session Data's AuthenticationExtensions has been provided and if it hasn't return an error.
@@ -261,3 +367,35 @@ func (ppkc ParsedPublicKeyCredential) GetAppID(authExt AuthenticationExtensions,
 const (
 	CredentialTypeFIDOU2F = "fido-u2f"
 )
+
+// parsePublicKeyCredentialForm parses the members of the PublicKeyCredential from the form fields of the same name.
+func parsePublicKeyCredentialForm(values url.Values) (credential PublicKeyCredential, err error) {
+	credential.ID = values.Get("id")
+	credential.Type = values.Get("type")
+	credential.AuthenticatorAttachment = values.Get("authenticatorAttachment")
+
+	if credential.RawID, err = parseFormBase64(values, "rawId"); err != nil {
+		return credential, err
+	}
+
+	if results := values.Get("clientExtensionResults"); results != "" {
+		if err = json.Unmarshal([]byte(results), &credential.ClientExtensionResults); err != nil {
+			return credential, fmt.Errorf("error decoding form field 'clientExtensionResults': %w", err)
+		}
+	}
+
+	return credential, nil
+}
+
+// parseFormBase64 decodes the base64url encoded form field with the provided name.
+func parseFormBase64(values url.Values, name string) (value URLEncodedBase64, err error) {
+	if !values.Has(name) {
+		return nil, nil
+	}
+
+	if err = value.UnmarshalJSON([]byte(values.Get(name))); err != nil {
+		return nil, fmt.Errorf("error decoding form field '%s': %w", name, err)
+	}
+
+	return value, nil
+}
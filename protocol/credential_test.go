@@ -3,10 +3,14 @@ package protocol
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
 )
@@ -355,6 +359,209 @@ func TestParsedCredentialCreationData_Verify(t *testing.T) {
 	}
 }
 
+func TestParsedCredentialCreationData_VerifyCredentialIDMismatch(t *testing.T) {
+	testCases := []struct {
+		name   string
+		mutate func(pcc *ParsedCredentialCreationData)
+		err    string
+	}{
+		{
+			"ShouldFailRawIDMismatch",
+			func(pcc *ParsedCredentialCreationData) {
+				pcc.RawID = append(URLEncodedBase64{}, pcc.RawID[1:]...)
+			},
+			"Credential ID in the authenticator data does not match the credential raw ID",
+		},
+		{
+			"ShouldFailAuthDataCredentialIDMismatch",
+			func(pcc *ParsedCredentialCreationData) {
+				pcc.Response.AttestationObject.AuthData.AttData.CredentialID = []byte("mismatched")
+			},
+			"Credential ID in the authenticator data does not match the credential raw ID",
+		},
+		{
+			"ShouldFailIDMismatch",
+			func(pcc *ParsedCredentialCreationData) {
+				pcc.ID = base64.RawURLEncoding.EncodeToString([]byte("mismatched"))
+			},
+			"Credential ID does not match the credential raw ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pcc, err := ParseCredentialCreationResponseBody(bytes.NewReader([]byte(testCredentialRequestResponses["success"])))
+			require.NoError(t, err)
+
+			require.NoError(t, pcc.Verify("W8GzFU8pGjhoRbWrLDlamAfq_y4S1CZG1VuoeRLARrE", false, "webauthn.io", []string{"https://webauthn.io"}))
+
+			tc.mutate(pcc)
+
+			err = pcc.Verify("W8GzFU8pGjhoRbWrLDlamAfq_y4S1CZG1VuoeRLARrE", false, "webauthn.io", []string{"https://webauthn.io"})
+			assert.EqualError(t, err, tc.err)
+
+			var e *Error
+
+			require.ErrorAs(t, err, &e)
+			assert.Equal(t, ErrAttestation.Type, e.Type)
+		})
+	}
+}
+
+func TestParseCredentialCreationResponseForm(t *testing.T) {
+	values := url.Values{
+		"id":                      {"6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g"},
+		"rawId":                   {"6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g"},
+		"type":                    {"public-key"},
+		"authenticatorAttachment": {"platform"},
+		"clientExtensionResults":  {`{"appid":true}`},
+		"attestationObject":       {"o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YVjEdKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBBAAAAAAAAAAAAAAAAAAAAAAAAAAAAQOsa7QYSUFukFOLTmgeK6x2ktirNMgwy_6vIwwtegxI2flS1X-JAkZL5dsadg-9bEz2J7PnsbB0B08txvsyUSvKlAQIDJiABIVggLKF5xS0_BntttUIrm2Z2tgZ4uQDwllbdIfrrBMABCNciWCDHwin8Zdkr56iSIh0MrB5qZiEzYLQpEOREhMUkY6q4Vw"},
+		"clientDataJSON":          {"eyJjaGFsbGVuZ2UiOiJXOEd6RlU4cEdqaG9SYldyTERsYW1BZnFfeTRTMUNaRzFWdW9lUkxBUnJFIiwib3JpZ2luIjoiaHR0cHM6Ly93ZWJhdXRobi5pbyIsInR5cGUiOiJ3ZWJhdXRobi5jcmVhdGUifQ"},
+		"transports":              {"usb", "nfc", "fake"},
+	}
+
+	// The form is submitted as application/x-www-form-urlencoded.
+	values, err := url.ParseQuery(values.Encode())
+	require.NoError(t, err)
+
+	expected, err := ParseCredentialCreationResponseBody(bytes.NewReader([]byte(testCredentialRequestResponses["success"])))
+	require.NoError(t, err)
+
+	actual, err := ParseCredentialCreationResponseForm(values)
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, actual)
+	assert.NoError(t, actual.Verify("W8GzFU8pGjhoRbWrLDlamAfq_y4S1CZG1VuoeRLARrE", false, "webauthn.io", []string{"https://webauthn.io"}))
+
+	values.Set("attestationObject", "not base64!")
+
+	_, err = ParseCredentialCreationResponseForm(values)
+	require.Error(t, err)
+	assert.Equal(t, "Parse error for Registration", err.Error())
+	assert.Equal(t, "error decoding form field 'attestationObject': illegal base64 data at input byte 3", err.(*Error).DevInfo)
+}
+
+func TestCredentialCreationResponse_ParseMaxSize(t *testing.T) {
+	var ccr CredentialCreationResponse
+
+	require.NoError(t, json.Unmarshal([]byte(testCredentialRequestResponses["success"]), &ccr))
+
+	size := len(ccr.AttestationResponse.AttestationObject)
+
+	_, err := ccr.ParseMaxSize(size)
+	assert.NoError(t, err)
+
+	_, err = ccr.ParseMaxSize(size - 1)
+	require.Error(t, err)
+	assert.Equal(t, ErrBadRequest.Type, err.(*Error).Type)
+	assert.Equal(t, fmt.Sprintf("Attestation object is %d bytes which exceeds the maximum of %d bytes", size, size-1), err.(*Error).DevInfo)
+
+	// A synthetic attestation object with a large attestation statement which would otherwise fail CBOR decoding.
+	ccr.AttestationResponse.AttestationObject = append(URLEncodedBase64{0xa3, 0x63, 'f', 'm', 't', 0x63, 't', 'p', 'm'}, make([]byte, DefaultMaxAttestationObjectSize)...)
+
+	body, err := json.Marshal(ccr)
+	require.NoError(t, err)
+
+	_, err = ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	require.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("Attestation object is %d bytes which exceeds the maximum of %d bytes", DefaultMaxAttestationObjectSize+9, DefaultMaxAttestationObjectSize), err.(*Error).DevInfo)
+}
+
+func TestCredentialCreationResponse_ParseMaxSizesClientData(t *testing.T) {
+	var ccr CredentialCreationResponse
+
+	require.NoError(t, json.Unmarshal([]byte(testCredentialRequestResponses["success"]), &ccr))
+
+	size := len(ccr.AttestationResponse.ClientDataJSON)
+
+	_, err := ccr.ParseMaxSizes(0, size)
+	assert.NoError(t, err)
+
+	_, err = ccr.ParseMaxSizes(0, size-1)
+	require.Error(t, err)
+	assert.Equal(t, ErrBadRequest.Type, err.(*Error).Type)
+	assert.Equal(t, fmt.Sprintf("clientDataJSON is %d bytes which exceeds the maximum of %d bytes", size, size-1), err.(*Error).DevInfo)
+
+	oversized := ccr
+	oversized.AttestationResponse.ClientDataJSON = append(URLEncodedBase64(`{"type":"webauthn.create","pad":"`), make([]byte, DefaultMaxClientDataSize)...)
+
+	_, err = oversized.Parse()
+	require.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("clientDataJSON is %d bytes which exceeds the maximum of %d bytes", DefaultMaxClientDataSize+33, DefaultMaxClientDataSize), err.(*Error).DevInfo)
+
+	invalid := ccr
+	invalid.AttestationResponse.ClientDataJSON = URLEncodedBase64("{\"type\":\"webauthn.create\",\"origin\":\"\xff\"}")
+
+	_, err = invalid.Parse()
+	require.Error(t, err)
+	assert.Equal(t, "Parse error for Registration", err.Error())
+	assert.Equal(t, "clientDataJSON is not valid UTF-8", err.(*Error).DevInfo)
+}
+
+func TestCredentialCreationResponse_ParseTransports(t *testing.T) {
+	testCases := []struct {
+		name       string
+		response   []string
+		deprecated []string
+		expected   []AuthenticatorTransport
+		conflict   bool
+	}{
+		{
+			name:     "ShouldDeduplicateResponseTransports",
+			response: []string{"usb", "nfc", "usb", "", "USB", " nfc "},
+			expected: []AuthenticatorTransport{USB, NFC},
+		},
+		{
+			name:       "ShouldUseDeprecatedTransports",
+			deprecated: []string{"internal", "hybrid", "internal"},
+			expected:   []AuthenticatorTransport{Internal, Hybrid},
+		},
+		{
+			name:       "ShouldNotConflictWithOverlappingTransports",
+			response:   []string{"usb", "nfc"},
+			deprecated: []string{"nfc", "usb", "nfc"},
+			expected:   []AuthenticatorTransport{USB, NFC},
+		},
+		{
+			name:       "ShouldConflictWithDifferentTransports",
+			response:   []string{"usb", "nfc", "usb"},
+			deprecated: []string{"usb", "ble"},
+			expected:   []AuthenticatorTransport{USB, NFC},
+			conflict:   true,
+		},
+		{
+			name:       "ShouldConflictWithSubsetTransports",
+			response:   []string{"usb"},
+			deprecated: []string{"usb", "nfc"},
+			expected:   []AuthenticatorTransport{USB},
+			conflict:   true,
+		},
+		{
+			name:       "ShouldIgnoreEmptyDeprecatedTransports",
+			response:   []string{"hybrid"},
+			deprecated: []string{""},
+			expected:   []AuthenticatorTransport{Hybrid},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ccr CredentialCreationResponse
+
+			require.NoError(t, json.Unmarshal([]byte(testCredentialRequestResponses["success"]), &ccr))
+
+			ccr.AttestationResponse.Transports = tc.response
+			ccr.Transports = tc.deprecated
+
+			parsed, err := ccr.Parse()
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, parsed.Response.Transports)
+			assert.Equal(t, tc.conflict, parsed.Response.TransportsConflict)
+		})
+	}
+}
+
 var testCredentialRequestResponses = map[string]string{
 	`success`: `
 {
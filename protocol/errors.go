@@ -1,5 +1,7 @@
 package protocol
 
+import "errors"
+
 type Error struct {
 	// Short name for the type of error that has occurred.
 	Type string `json:"type"`
@@ -9,6 +11,48 @@ type Error struct {
 
 	// Information to help debug the error.
 	DevInfo string `json:"debug"`
+
+	// Reason is the reason an attestation was rejected, which is empty for other errors and for attestation errors
+	// which don't fall in one of the AttestationFailureReason values. It's available from the error returned by a
+	// registration with errors.As, or with AttestationFailure.
+	Reason AttestationFailureReason `json:"reason,omitempty"`
+}
+
+// AttestationFailureReason is a coarse reason an attestation was rejected, intended to be mapped to user messages and
+// metrics rather than to describe the exact verification failure which is described by the Details of the Error.
+type AttestationFailureReason string
+
+const (
+	// AttestationFailureUntrustedRoot is the reason of an attestation certificate chain which does not lead to a
+	// trusted root certificate.
+	AttestationFailureUntrustedRoot AttestationFailureReason = "untrusted_root"
+
+	// AttestationFailureSignatureInvalid is the reason of an attestation statement signature which is not valid.
+	AttestationFailureSignatureInvalid AttestationFailureReason = "signature_invalid"
+
+	// AttestationFailureFormatUnsupported is the reason of an attestation statement format or variant of a format
+	// which is not supported.
+	AttestationFailureFormatUnsupported AttestationFailureReason = "format_unsupported"
+
+	// AttestationFailureAAGUIDDenied is the reason of an authenticator model which is rejected by its AAGUID, such
+	// as an authenticator with an undesired status in its metadata or which does not meet the metadata policies.
+	AttestationFailureAAGUIDDenied AttestationFailureReason = "aaguid_denied"
+
+	// AttestationFailureCertificateExpired is the reason of an attestation certificate chain with a certificate
+	// outside its validity period.
+	AttestationFailureCertificateExpired AttestationFailureReason = "certificate_expired"
+)
+
+// AttestationFailure returns the AttestationFailureReason of the error, and false if the error is not an *Error or
+// has no reason.
+func AttestationFailure(err error) (reason AttestationFailureReason, ok bool) {
+	var e *Error
+
+	if !errors.As(err, &e) || e.Reason == "" {
+		return "", false
+	}
+
+	return e.Reason, true
 }
 
 var (
@@ -48,10 +92,20 @@ var (
 		Type:    "invalid_certificate",
 		Details: "Invalid attestation certificate",
 	}
+	ErrAttestationTrust = &Error{
+		Type:    "attestation_trust",
+		Details: "Attestation certificate chain is not trusted",
+	}
 	ErrAssertionSignature = &Error{
 		Type:    "invalid_signature",
 		Details: "Assertion Signature against auth data and client hash is not valid",
 	}
+	// ErrDevicePublicKey is returned when the device-bound key signature of the devicePubKey extension is missing or
+	// not valid.
+	ErrDevicePublicKey = &Error{
+		Type:    "invalid_device_public_key",
+		Details: "Device public key signature against auth data and client hash is not valid",
+	}
 	ErrUnsupportedKey = &Error{
 		Type:    "invalid_key_type",
 		Details: "Unsupported Public Key Type",
@@ -60,6 +114,42 @@ var (
 		Type:    "unsupported_key_algorithm",
 		Details: "Unsupported public key algorithm",
 	}
+	// ErrECDAANotSupported is returned for attestation statements using ECDAA, which was removed in WebAuthn Level 3.
+	//
+	// Specification: §8.2. Packed Attestation Statement Format (https://www.w3.org/TR/webauthn-3/#sctn-packed-attestation)
+	ErrECDAANotSupported = &Error{
+		Type:    "ecdaa_not_supported",
+		Details: "ECDAA attestation is not supported as it has been removed from the WebAuthn specification",
+	}
+	// ErrMetadataUserVerification is returned when the authenticator data reports user verification by an
+	// authenticator which its metadata statement declares is not capable of user verification.
+	ErrMetadataUserVerification = &Error{
+		Type:    "metadata_user_verification",
+		Details: "User verification is inconsistent with the authenticator metadata",
+	}
+	// ErrBackupFlags is returned when the backup flags of a credential changed between logins in a way which is not
+	// expected of a legitimate authenticator.
+	ErrBackupFlags = &Error{
+		Type:    "backup_flags",
+		Details: "Backup flags of the credential changed unexpectedly",
+	}
+	// ErrMetadataCertificationLevel is returned when the metadata of the authenticator does not report the minimum
+	// required FIDO Authenticator certification level.
+	ErrMetadataCertificationLevel = &Error{
+		Type:    "metadata_certification_level",
+		Details: "Authenticator does not meet the minimum certification level",
+	}
+	// ErrCredentialExists is returned when a registration is for a credential the user has already registered.
+	ErrCredentialExists = &Error{
+		Type:    "credential_exists",
+		Details: "Credential is already registered to the user",
+	}
+	// ErrUserVerificationCapability is returned when the metadata statement of the authenticator declares it's not
+	// capable of user verification while such authenticators are required.
+	ErrUserVerificationCapability = &Error{
+		Type:    "user_verification_capability",
+		Details: "Authenticator is not capable of user verification",
+	}
 	ErrNotSpecImplemented = &Error{
 		Type:    "spec_unimplemented",
 		Details: "This field is not yet supported by the WebAuthn spec",
@@ -87,3 +177,11 @@ func (e *Error) WithInfo(info string) *Error {
 
 	return &err
 }
+
+// WithReason returns a copy of the error with the AttestationFailureReason.
+func (e *Error) WithReason(reason AttestationFailureReason) *Error {
+	err := *e
+	err.Reason = reason
+
+	return &err
+}
@@ -1,5 +1,13 @@
 package protocol
 
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+)
+
 // Extensions are discussed in §9. WebAuthn Extensions (https://www.w3.org/TR/webauthn/#extensions).
 
 // For a list of commonly supported extensions, see §10. Defined Extensions
@@ -7,7 +15,201 @@ package protocol
 
 type AuthenticationExtensionsClientOutputs map[string]interface{}
 
+// AuthenticationExtensionsAuthenticatorOutputs are the authenticator extension outputs contained in the extensions of
+// the authenticator data, keyed by their extension identifier.
+//
+// Specification: §9. WebAuthn Extensions (https://www.w3.org/TR/webauthn/#authenticator-extension-output)
+type AuthenticationExtensionsAuthenticatorOutputs map[string]interface{}
+
 const (
 	ExtensionAppID        = "appid"
 	ExtensionAppIDExclude = "appidExclude"
+	ExtensionUVM          = "uvm"
+	ExtensionCredBlob     = "credBlob"
+	ExtensionGetCredBlob  = "getCredBlob"
+
+	ExtensionDevicePublicKey = "devicePubKey"
+	ExtensionLargeBlob       = "largeBlob"
+
+	ExtensionRemainingDiscoverableCredentials = "remainingDiscoverableCredentials"
 )
+
+// MaxCredBlobLength is the maximum length of the credBlob extension input, which is the minimum maxCredBlobLength
+// all authenticators supporting the extension must support.
+//
+// Specification: CTAP2.1 §12.2. Credential Blob (credBlob) (https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#sctn-credBlob-extension)
+const MaxCredBlobLength = 32
+
+// ValidateCredBlobExtension ensures the credBlob extension input if present is at most MaxCredBlobLength bytes.
+func ValidateCredBlobExtension(extensions AuthenticationExtensions) error {
+	value, ok := extensions[ExtensionCredBlob]
+	if !ok {
+		return nil
+	}
+
+	var length int
+
+	switch blob := value.(type) {
+	case URLEncodedBase64:
+		length = len(blob)
+	case []byte:
+		length = len(blob)
+	default:
+		return ErrBadRequest.WithDetails(fmt.Sprintf("Extension '%s' input has invalid type %T", ExtensionCredBlob, value))
+	}
+
+	if length > MaxCredBlobLength {
+		return ErrBadRequest.WithDetails(fmt.Sprintf("Extension '%s' input is %d bytes which exceeds the maximum of %d bytes", ExtensionCredBlob, length, MaxCredBlobLength))
+	}
+
+	return nil
+}
+
+// CredBlobStored returns whether the authenticator stored the credBlob during registration, and false for ok if the
+// output is absent.
+func (e AuthenticationExtensionsAuthenticatorOutputs) CredBlobStored() (stored, ok bool) {
+	stored, ok = e[ExtensionCredBlob].(bool)
+
+	return stored, ok
+}
+
+// CredBlob returns the credBlob returned by the authenticator during an assertion requested with the getCredBlob
+// extension, and false for ok if the output is absent.
+func (e AuthenticationExtensionsAuthenticatorOutputs) CredBlob() (blob []byte, ok bool) {
+	blob, ok = e[ExtensionCredBlob].([]byte)
+
+	return blob, ok
+}
+
+// DevicePublicKey is the attestation object for the device-bound key of the devicePubKey extension, which the
+// authenticator returns as its extension output so the Relying Party can recognize the physical device a multi-device
+// credential is used from.
+//
+// Specification: §10.2.2. Device-bound public key extension (https://www.w3.org/TR/2023/WD-webauthn-3-20230927/#sctn-device-publickey-extension)
+type DevicePublicKey struct {
+	AAGUID       []byte                 `cbor:"aaguid" json:"aaguid"`
+	PublicKey    []byte                 `cbor:"dpk" json:"dpk"`
+	Scope        uint64                 `cbor:"scope" json:"scope"`
+	Nonce        []byte                 `cbor:"nonce,omitempty" json:"nonce,omitempty"`
+	Format       string                 `cbor:"fmt" json:"fmt"`
+	AttStatement map[string]interface{} `cbor:"attStmt,omitempty" json:"attStmt,omitempty"`
+}
+
+// DevicePublicKey returns the decoded devicePubKey extension output, and false for ok if the output is absent.
+func (e AuthenticationExtensionsAuthenticatorOutputs) DevicePublicKey() (dpk *DevicePublicKey, ok bool, err error) {
+	value, ok := e[ExtensionDevicePublicKey]
+	if !ok {
+		return nil, false, nil
+	}
+
+	raw, valid := value.([]byte)
+	if !valid {
+		return nil, true, ErrBadRequest.WithDetails(fmt.Sprintf("Extension '%s' output has invalid type %T", ExtensionDevicePublicKey, value))
+	}
+
+	dpk = &DevicePublicKey{}
+
+	if err = webauthncbor.Unmarshal(raw, dpk); err != nil {
+		return nil, true, ErrBadRequest.WithDetails(fmt.Sprintf("Error decoding extension '%s' output", ExtensionDevicePublicKey)).WithInfo(err.Error())
+	}
+
+	return dpk, true, nil
+}
+
+// DevicePublicKeySignature returns the signature of the device-bound key from the devicePubKey client extension output,
+// and false for ok if the signature is absent or is not a base64url encoded string.
+func (e AuthenticationExtensionsClientOutputs) DevicePublicKeySignature() (signature []byte, ok bool) {
+	output, ok := e[ExtensionDevicePublicKey].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	value, ok := output["signature"].(string)
+	if !ok {
+		return nil, false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, false
+	}
+
+	return signature, true
+}
+
+// LargeBlobWritten returns whether the large blob requested to be written with the write input of the largeBlob
+// extension was successfully written, and false for ok if the written member of the client extension output is absent.
+//
+// Specification: §10.1.5. Large blob storage extension (largeBlob) (https://www.w3.org/TR/webauthn-3/#sctn-large-blob-extension)
+func (e AuthenticationExtensionsClientOutputs) LargeBlobWritten() (written, ok bool) {
+	output, ok := e[ExtensionLargeBlob].(map[string]interface{})
+	if !ok {
+		return false, false
+	}
+
+	written, ok = output["written"].(bool)
+
+	return written, ok
+}
+
+// RemainingDiscoverableCredentials returns the estimated number of additional discoverable credentials the authenticator
+// can store as reported in the remainingDiscoverableCredentials authenticator or client extension output, and false for
+// ok if neither is present. This mirrors the remainingDiscoverableCredentials member of the CTAP2.1 authenticatorGetInfo
+// response, which is not part of any standard extension, so only some authenticators and clients report it.
+//
+// Specification: CTAP2.1 §6.4. authenticatorGetInfo (https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorGetInfo)
+func (pcc *ParsedCredentialCreationData) RemainingDiscoverableCredentials() (remaining uint64, ok bool) {
+	if remaining, ok = pcc.Response.AttestationObject.AuthData.Extensions[ExtensionRemainingDiscoverableCredentials].(uint64); ok {
+		return remaining, true
+	}
+
+	// Client extension outputs are decoded from JSON in which case the count is a float64.
+	if value, valid := pcc.ClientExtensionResults[ExtensionRemainingDiscoverableCredentials].(float64); valid && value >= 0 && value == float64(uint64(value)) {
+		return uint64(value), true
+	}
+
+	return 0, false
+}
+
+type extensionParser func(input, clientOutput, authenticatorOutput interface{}) (interface{}, error)
+
+var extensionRegistry = make(map[string]extensionParser)
+
+// RegisterExtension is a method to register a parser for an extension with the library, which allows handling new or
+// custom extensions in the same way as RegisterAttestationFormat allows for attestation formats. The parser receives the
+// extension input requested in the options and the client and authenticator extension outputs of the response, any of
+// which is nil when absent, and its result is returned by ParseExtensions.
+func RegisterExtension(name string, parser extensionParser) {
+	extensionRegistry[name] = parser
+}
+
+// ParseExtensions invokes the parsers registered with RegisterExtension for each registered extension which was
+// requested or has a client or authenticator output, and returns their results keyed by the extension identifier.
+func ParseExtensions(inputs AuthenticationExtensions, clientOutputs AuthenticationExtensionsClientOutputs, authenticatorOutputs AuthenticationExtensionsAuthenticatorOutputs) (results map[string]interface{}, err error) {
+	for name, parser := range extensionRegistry {
+		input, hasInput := inputs[name]
+		clientOutput, hasClientOutput := clientOutputs[name]
+		authenticatorOutput, hasAuthenticatorOutput := authenticatorOutputs[name]
+
+		if !hasInput && !hasClientOutput && !hasAuthenticatorOutput {
+			continue
+		}
+
+		result, err := parser(input, clientOutput, authenticatorOutput)
+		if err != nil {
+			if _, ok := err.(*Error); ok {
+				return nil, err
+			}
+
+			return nil, ErrBadRequest.WithDetails(fmt.Sprintf("Error parsing extension '%s'", name)).WithInfo(err.Error())
+		}
+
+		if results == nil {
+			results = map[string]interface{}{}
+		}
+
+		results[name] = result
+	}
+
+	return results, nil
+}
@@ -0,0 +1,146 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+)
+
+func TestCredBlobRoundTrip(t *testing.T) {
+	blob := []byte("0123456789abcdef0123456789abcdef")
+
+	inputs := AuthenticationExtensions{ExtensionCredBlob: URLEncodedBase64(blob)}
+
+	require.NoError(t, ValidateCredBlobExtension(inputs))
+
+	data, err := json.Marshal(inputs)
+	require.NoError(t, err)
+	assert.Equal(t, `{"credBlob":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY"}`, string(data))
+
+	registration, err := webauthncbor.Marshal(map[string]interface{}{ExtensionCredBlob: true})
+	require.NoError(t, err)
+
+	var registrationOutputs AuthenticationExtensionsAuthenticatorOutputs
+
+	require.NoError(t, webauthncbor.Unmarshal(registration, &registrationOutputs))
+
+	stored, ok := registrationOutputs.CredBlobStored()
+	assert.True(t, ok)
+	assert.True(t, stored)
+
+	assertion, err := webauthncbor.Marshal(map[string]interface{}{ExtensionCredBlob: blob})
+	require.NoError(t, err)
+
+	var assertionOutputs AuthenticationExtensionsAuthenticatorOutputs
+
+	require.NoError(t, webauthncbor.Unmarshal(assertion, &assertionOutputs))
+
+	actual, ok := assertionOutputs.CredBlob()
+	assert.True(t, ok)
+	assert.Equal(t, blob, actual)
+
+	_, ok = registrationOutputs.CredBlob()
+	assert.False(t, ok)
+
+	_, ok = AuthenticationExtensionsAuthenticatorOutputs(nil).CredBlobStored()
+	assert.False(t, ok)
+}
+
+func TestValidateCredBlobExtension(t *testing.T) {
+	testCases := []struct {
+		name       string
+		extensions AuthenticationExtensions
+		err        string
+	}{
+		{"ShouldPassAbsent", nil, ""},
+		{"ShouldPassMaximum", AuthenticationExtensions{ExtensionCredBlob: make([]byte, MaxCredBlobLength)}, ""},
+		{"ShouldFailTooLong", AuthenticationExtensions{ExtensionCredBlob: URLEncodedBase64(make([]byte, MaxCredBlobLength+1))}, "Extension 'credBlob' input is 33 bytes which exceeds the maximum of 32 bytes"},
+		{"ShouldFailInvalidType", AuthenticationExtensions{ExtensionCredBlob: "blob"}, "Extension 'credBlob' input has invalid type string"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCredBlobExtension(tc.extensions)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestParsedCredentialCreationData_RemainingDiscoverableCredentials(t *testing.T) {
+	testCases := []struct {
+		name          string
+		authenticator AuthenticationExtensionsAuthenticatorOutputs
+		client        string
+		remaining     uint64
+		ok            bool
+	}{
+		{"ShouldParseAuthenticatorOutput", AuthenticationExtensionsAuthenticatorOutputs{ExtensionRemainingDiscoverableCredentials: uint64(3)}, "", 3, true},
+		{"ShouldParseClientOutput", nil, `{"remainingDiscoverableCredentials":7}`, 7, true},
+		{"ShouldPreferAuthenticatorOutput", AuthenticationExtensionsAuthenticatorOutputs{ExtensionRemainingDiscoverableCredentials: uint64(0)}, `{"remainingDiscoverableCredentials":7}`, 0, true},
+		{"ShouldIgnoreFractionalClientOutput", nil, `{"remainingDiscoverableCredentials":1.5}`, 0, false},
+		{"ShouldIgnoreNegativeClientOutput", nil, `{"remainingDiscoverableCredentials":-1}`, 0, false},
+		{"ShouldReportAbsence", nil, `{"credProps":{"rk":true}}`, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pcc := &ParsedCredentialCreationData{}
+			pcc.Response.AttestationObject.AuthData.Extensions = tc.authenticator
+
+			if tc.client != "" {
+				require.NoError(t, json.Unmarshal([]byte(tc.client), &pcc.ClientExtensionResults))
+			}
+
+			remaining, ok := pcc.RemainingDiscoverableCredentials()
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.remaining, remaining)
+		})
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	RegisterExtension("exampleParse", func(input, clientOutput, authenticatorOutput interface{}) (interface{}, error) {
+		if clientOutput == "invalid" {
+			return nil, errors.New("invalid output")
+		}
+
+		return []interface{}{input, clientOutput, authenticatorOutput}, nil
+	})
+
+	t.Cleanup(func() {
+		delete(extensionRegistry, "exampleParse")
+	})
+
+	results, err := ParseExtensions(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, results)
+
+	results, err = ParseExtensions(
+		AuthenticationExtensions{"exampleParse": true, ExtensionCredBlob: URLEncodedBase64("blob")},
+		AuthenticationExtensionsClientOutputs{"exampleParse": "output"},
+		nil,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"exampleParse": []interface{}{true, "output", nil}}, results)
+
+	results, err = ParseExtensions(nil, nil, AuthenticationExtensionsAuthenticatorOutputs{"exampleParse": uint64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"exampleParse": []interface{}{nil, nil, uint64(1)}}, results)
+
+	_, err = ParseExtensions(nil, AuthenticationExtensionsClientOutputs{"exampleParse": "invalid"}, nil)
+	assert.EqualError(t, err, "Error parsing extension 'exampleParse'")
+	assert.Equal(t, "invalid output", err.(*Error).DevInfo)
+}
@@ -1,17 +1,36 @@
 package protocol
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 type CredentialCreation struct {
 	Response PublicKeyCredentialCreationOptions `json:"publicKey"`
+
+	// Mediation is the mediation requirement the client must pass to navigator.credentials.create() alongside the
+	// public key options, which is set from the Mediation of the public key options.
+	Mediation CredentialMediationRequirement `json:"mediation,omitempty"`
 }
 
 type CredentialAssertion struct {
 	Response PublicKeyCredentialRequestOptions `json:"publicKey"`
 }
 
+// RequestedExtensions returns the sorted identifiers of the extensions requested in the creation options, which are the
+// extensions the client must pass to navigator.credentials.create().
+func (c *CredentialCreation) RequestedExtensions() []string {
+	return c.Response.Extensions.identifiers()
+}
+
+// RequestedExtensions returns the sorted identifiers of the extensions requested in the request options, which are the
+// extensions the client must pass to navigator.credentials.get().
+func (c *CredentialAssertion) RequestedExtensions() []string {
+	return c.Response.Extensions.identifiers()
+}
+
 // PublicKeyCredentialCreationOptions represents the IDL of the same name.
 //
 // In order to create a Credential via create(), the caller specifies a few parameters in a
@@ -30,6 +49,15 @@ type PublicKeyCredentialCreationOptions struct {
 	AuthenticatorSelection AuthenticatorSelection   `json:"authenticatorSelection,omitempty"`
 	Attestation            ConveyancePreference     `json:"attestation,omitempty"`
 	Extensions             AuthenticationExtensions `json:"extensions,omitempty"`
+	Hints                  []Hint                   `json:"hints,omitempty"`
+
+	// Mediation is not a member of the IDL but of the CredentialCreationOptions wrapping it, and is marshaled as the
+	// Mediation of the CredentialCreation instead.
+	Mediation CredentialMediationRequirement `json:"-"`
+
+	// OmitTimeout is not a member of the IDL, and omits the timeout from the options regardless of Timeout so the
+	// client uses its own default.
+	OmitTimeout bool `json:"-"`
 }
 
 // The PublicKeyCredentialRequestOptions dictionary supplies get() with the data it needs to generate an assertion.
@@ -46,6 +74,11 @@ type PublicKeyCredentialRequestOptions struct {
 	AllowedCredentials []CredentialDescriptor      `json:"allowCredentials,omitempty"`
 	UserVerification   UserVerificationRequirement `json:"userVerification,omitempty"`
 	Extensions         AuthenticationExtensions    `json:"extensions,omitempty"`
+	Hints              []Hint                      `json:"hints,omitempty"`
+
+	// Reauth is not a member of the IDL, and requests a re-authentication which requires user verification regardless
+	// of UserVerification and uses a short timeout unless Timeout is set.
+	Reauth bool `json:"-"`
 }
 
 // CredentialDescriptor represents the PublicKeyCredentialDescriptor IDL.
@@ -76,6 +109,36 @@ type CredentialParameter struct {
 	Algorithm webauthncose.COSEAlgorithmIdentifier `json:"alg"`
 }
 
+// NormalizeCredentialParameters returns the credential parameters with the duplicate entries removed, keeping the first
+// occurrence of each so the order of preference of the Relying Party is preserved. Entries without a type are given
+// the "public-key" type.
+//
+// Specification: §5.4. Options for Credential Creation (https://www.w3.org/TR/webauthn/#dom-publickeycredentialcreationoptions-pubkeycredparams)
+func NormalizeCredentialParameters(params []CredentialParameter) []CredentialParameter {
+	if params == nil {
+		return nil
+	}
+
+	normalized := make([]CredentialParameter, 0, len(params))
+	seen := make(map[CredentialParameter]bool, len(params))
+
+	for _, param := range params {
+		if param.Type == "" {
+			param.Type = PublicKeyCredentialType
+		}
+
+		if seen[param] {
+			continue
+		}
+
+		seen[param] = true
+
+		normalized = append(normalized, param)
+	}
+
+	return normalized
+}
+
 // CredentialType represents the PublicKeyCredentialType IDL and is used with the CredentialDescriptor IDL.
 //
 // This enumeration defines the valid credential types. It is an extension point; values can be added to it in the
@@ -100,6 +163,18 @@ const (
 // Specification: §5.7.1. Authentication Extensions Client Inputs (https://www.w3.org/TR/webauthn/#iface-authentication-extensions-client-inputs)
 type AuthenticationExtensions map[string]interface{}
 
+func (e AuthenticationExtensions) identifiers() []string {
+	identifiers := make([]string, 0, len(e))
+
+	for identifier := range e {
+		identifiers = append(identifiers, identifier)
+	}
+
+	sort.Strings(identifiers)
+
+	return identifiers
+}
+
 // AuthenticatorSelection represents the AuthenticatorSelectionCriteria IDL.
 //
 // WebAuthn Relying Parties may use the AuthenticatorSelectionCriteria dictionary to specify their requirements
@@ -183,6 +258,90 @@ const (
 	PreferEnterpriseAttestation ConveyancePreference = "enterprise"
 )
 
+// Hint is the type representing the PublicKeyCredentialHints IDL.
+//
+// WebAuthn Relying Parties may use this enumeration to communicate hints to the user-agent about how a request may be
+// best completed. These hints are not requirements, and do not bind the user-agent, but may guide it in providing the
+// best experience by using contextual information that the Relying Party has about the request. Hints are provided in
+// order of decreasing preference. When hints and the authenticatorAttachment are both set, user-agents give
+// precedence to the hints.
+//
+// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#enumdef-publickeycredentialhints)
+type Hint string
+
+const (
+	// HintSecurityKey is a Hint value.
+	//
+	// Indicates that the Relying Party believes that users will satisfy this request with a physical security key.
+	//
+	// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#dom-publickeycredentialhints-security-key)
+	HintSecurityKey Hint = "security-key"
+
+	// HintClientDevice is a Hint value.
+	//
+	// Indicates that the Relying Party believes that users will satisfy this request with a platform authenticator
+	// attached to the client device.
+	//
+	// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#dom-publickeycredentialhints-client-device)
+	HintClientDevice Hint = "client-device"
+
+	// HintHybrid is a Hint value.
+	//
+	// Indicates that the Relying Party believes that users will satisfy this request with general-purpose
+	// authenticators such as smartphones.
+	//
+	// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#dom-publickeycredentialhints-hybrid)
+	HintHybrid Hint = "hybrid"
+)
+
+// CredentialMediationRequirement is the type representing the CredentialMediationRequirement IDL.
+//
+// The mediation requirement of a ceremony determines whether the user is prompted. Conditional creation lets the
+// client create a passkey without a modal prompt, for example right after the user signed in with a password, in which
+// case the authenticator data of the registration does not have the user present flag set.
+//
+// Specification: Credential Management Level 1 §2.3.2. Mediation Requirements (https://w3c.github.io/webappsec-credential-management/#enumdef-credentialmediationrequirement)
+type CredentialMediationRequirement string
+
+const (
+	// MediationSilent is a CredentialMediationRequirement value which prevents the user from being prompted.
+	MediationSilent CredentialMediationRequirement = "silent"
+
+	// MediationOptional is a CredentialMediationRequirement value which prompts the user only if required by the
+	// client, which is the client default.
+	MediationOptional CredentialMediationRequirement = "optional"
+
+	// MediationConditional is a CredentialMediationRequirement value which completes the ceremony without a modal
+	// prompt, such as conditional creation.
+	//
+	// Specification: §5.1.3. Create a New Credential (https://www.w3.org/TR/webauthn-3/#sctn-createCredential)
+	MediationConditional CredentialMediationRequirement = "conditional"
+
+	// MediationRequired is a CredentialMediationRequirement value which always prompts the user.
+	MediationRequired CredentialMediationRequirement = "required"
+)
+
+// ValidateHints ensures each of the hints is a known Hint value and is only provided once.
+func ValidateHints(hints []Hint) error {
+	seen := make(map[Hint]bool, len(hints))
+
+	for _, hint := range hints {
+		switch hint {
+		case HintSecurityKey, HintClientDevice, HintHybrid:
+		default:
+			return ErrBadRequest.WithDetails(fmt.Sprintf("Unknown hint '%s'", hint))
+		}
+
+		if seen[hint] {
+			return ErrBadRequest.WithDetails(fmt.Sprintf("Duplicate hint '%s'", hint))
+		}
+
+		seen[hint] = true
+	}
+
+	return nil
+}
+
 func (a *PublicKeyCredentialRequestOptions) GetAllowedCredentialIDs() [][]byte {
 	var allowedCredentialIDs = make([][]byte, len(a.AllowedCredentials))
 
@@ -1,8 +1,14 @@
 package protocol
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 func TestPublicKeyCredentialRequestOptions_GetAllowedCredentialIDs(t *testing.T) {
@@ -57,3 +63,108 @@ func TestPublicKeyCredentialRequestOptions_GetAllowedCredentialIDs(t *testing.T)
 		})
 	}
 }
+
+func TestHintsSerialization(t *testing.T) {
+	creation := PublicKeyCredentialCreationOptions{
+		Challenge: URLEncodedBase64("challenge"),
+		AuthenticatorSelection: AuthenticatorSelection{
+			AuthenticatorAttachment: CrossPlatform,
+		},
+		Hints: []Hint{HintSecurityKey, HintHybrid},
+	}
+
+	data, err := json.Marshal(creation)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), `"authenticatorSelection":{"authenticatorAttachment":"cross-platform"}`)
+	assert.Contains(t, string(data), `"hints":["security-key","hybrid"]`)
+
+	request := PublicKeyCredentialRequestOptions{
+		Challenge: URLEncodedBase64("challenge"),
+		Hints:     []Hint{HintClientDevice},
+	}
+
+	data, err = json.Marshal(request)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"challenge":"Y2hhbGxlbmdl","hints":["client-device"]}`, string(data))
+
+	request.Hints = nil
+
+	data, err = json.Marshal(request)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"challenge":"Y2hhbGxlbmdl"}`, string(data))
+}
+
+func TestValidateHints(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hints []Hint
+		err   string
+	}{
+		{"ShouldPassNone", nil, ""},
+		{"ShouldPassAll", []Hint{HintHybrid, HintClientDevice, HintSecurityKey}, ""},
+		{"ShouldFailUnknown", []Hint{HintHybrid, "usb"}, "Unknown hint 'usb'"},
+		{"ShouldFailDuplicate", []Hint{HintHybrid, HintSecurityKey, HintHybrid}, "Duplicate hint 'hybrid'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateHints(tc.hints)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestNormalizeCredentialParameters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		have     []CredentialParameter
+		expected []CredentialParameter
+	}{
+		{
+			"ShouldCollapseDuplicatesInPreferenceOrder",
+			[]CredentialParameter{
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+			},
+			[]CredentialParameter{
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256},
+			},
+		},
+		{
+			"ShouldSetMissingType",
+			[]CredentialParameter{
+				{Algorithm: webauthncose.AlgES256},
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+			},
+			[]CredentialParameter{
+				{Type: PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+			},
+		},
+		{
+			"ShouldKeepNil",
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, NormalizeCredentialParameters(tc.have))
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package webauthncbor
 
-import "github.com/fxamacker/cbor/v2"
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
 
 const nestedLevelsAllowed = 4
 
@@ -22,6 +28,23 @@ func Unmarshal(data []byte, v interface{}) error {
 	return ctap2CBORDecMode.Unmarshal(data, v)
 }
 
+// UnmarshalFirst parses the first CBOR data item of the data into the value pointed to by v following the CTAP2
+// canonical CBOR encoding form, and returns the bytes which follow the data item.
+func UnmarshalFirst(data []byte, v interface{}) (rest []byte, err error) {
+	dec := ctap2CBORDecMode.NewDecoder(bytes.NewReader(data))
+
+	if err = dec.Decode(v); err != nil {
+		// The decoder reports truncated data as the end of the stream, but a data item is always expected.
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return data[dec.NumBytesRead():], nil
+}
+
 // Marshal encodes the value pointed to by v
 // following the CTAP2 canonical CBOR encoding form.
 // (https://fidoalliance.org/specs/fido-v2.0-ps-20190130/fido-client-to-authenticator-protocol-v2.0-ps-20190130.html#message-encoding)
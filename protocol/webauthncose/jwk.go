@@ -0,0 +1,255 @@
+package webauthncose
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// jwkCurves maps the COSE elliptic curves to their JSON Web Key curve names.
+//
+// Specification: RFC 7518 §6.2.1.1. "crv" (Curve) Parameter (https://www.rfc-editor.org/rfc/rfc7518#section-6.2.1.1)
+//
+// Specification: RFC 8037 §2. Key Type "OKP" (https://www.rfc-editor.org/rfc/rfc8037#section-2)
+var jwkCurves = map[COSEEllipticCurve]string{
+	P256:      "P-256",
+	P384:      "P-384",
+	P521:      "P-521",
+	Secp256k1: "secp256k1",
+	Ed25519:   "Ed25519",
+	Ed448:     "Ed448",
+	X25519:    "X25519",
+	X448:      "X448",
+}
+
+// jwkCurveSizes are the sizes in bytes of the coordinates of the EC2 curves, which the JSON Web Key coordinates must
+// be padded to.
+var jwkCurveSizes = map[COSEEllipticCurve]int{
+	P256:      32,
+	P384:      48,
+	P521:      66,
+	Secp256k1: 32,
+}
+
+// jwkAlgorithms maps the COSE algorithms to their JSON Web Algorithms names. AlgRS1 has no registered name.
+//
+// Specification: RFC 7518 §3.1. "alg" (Algorithm) Header Parameter Values for JWS (https://www.rfc-editor.org/rfc/rfc7518#section-3.1)
+var jwkAlgorithms = map[COSEAlgorithmIdentifier]string{
+	AlgES256:  "ES256",
+	AlgES384:  "ES384",
+	AlgES512:  "ES512",
+	AlgRS256:  "RS256",
+	AlgRS384:  "RS384",
+	AlgRS512:  "RS512",
+	AlgPS256:  "PS256",
+	AlgPS384:  "PS384",
+	AlgPS512:  "PS512",
+	AlgEdDSA:  "EdDSA",
+	AlgES256K: "ES256K",
+}
+
+// JWK returns the JSON Web Key of the EC2 public key with the coordinates padded to the size of the curve.
+//
+// Specification: RFC 7518 §6.2.1. Parameters for Elliptic Curve Public Keys (https://www.rfc-editor.org/rfc/rfc7518#section-6.2.1)
+func (k *EC2PublicKeyData) JWK() (map[string]interface{}, error) {
+	crv, ok := jwkCurves[COSEEllipticCurve(k.Curve)]
+	size := jwkCurveSizes[COSEEllipticCurve(k.Curve)]
+
+	if !ok || size == 0 {
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported EC2 public key curve '%d'", k.Curve))
+	}
+
+	if len(k.XCoord) > size || len(k.YCoord) > size {
+		return nil, ErrUnsupportedKey.WithDetails("EC2 public key coordinates are larger than the curve")
+	}
+
+	jwk := map[string]interface{}{
+		"kty": "EC",
+		"crv": crv,
+		"x":   jwkEncode(jwkPad(k.XCoord, size)),
+		"y":   jwkEncode(jwkPad(k.YCoord, size)),
+	}
+
+	k.PublicKeyData.jwkAlgorithm(jwk)
+
+	return jwk, nil
+}
+
+// JWK returns the JSON Web Key of the RSA public key.
+//
+// Specification: RFC 7518 §6.3.1. Parameters for RSA Public Keys (https://www.rfc-editor.org/rfc/rfc7518#section-6.3.1)
+func (k *RSAPublicKeyData) JWK() (map[string]interface{}, error) {
+	if len(k.Modulus) == 0 || len(k.Exponent) == 0 {
+		return nil, ErrUnsupportedKey.WithDetails("RSA public key is missing the modulus or exponent")
+	}
+
+	jwk := map[string]interface{}{
+		"kty": "RSA",
+		"n":   jwkEncode(k.Modulus),
+		"e":   jwkEncode(k.Exponent),
+	}
+
+	k.PublicKeyData.jwkAlgorithm(jwk)
+
+	return jwk, nil
+}
+
+// JWK returns the JSON Web Key of the OKP public key. A key without a curve is assumed to be an Ed25519 key as it's
+// the only curve used with EdDSA by authenticators.
+//
+// Specification: RFC 8037 §2. Key Type "OKP" (https://www.rfc-editor.org/rfc/rfc8037#section-2)
+func (k *OKPPublicKeyData) JWK() (map[string]interface{}, error) {
+	curve := COSEEllipticCurve(k.Curve)
+	if curve == EllipticCurveReserved {
+		curve = Ed25519
+	}
+
+	crv, ok := jwkCurves[curve]
+	if !ok || jwkCurveSizes[curve] != 0 {
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported OKP public key curve '%d'", k.Curve))
+	}
+
+	jwk := map[string]interface{}{
+		"kty": "OKP",
+		"crv": crv,
+		"x":   jwkEncode(k.XCoord),
+	}
+
+	k.PublicKeyData.jwkAlgorithm(jwk)
+
+	return jwk, nil
+}
+
+// jwkAlgorithm sets the alg parameter of the JSON Web Key if the algorithm of the key has a JSON Web Algorithms name.
+func (k *PublicKeyData) jwkAlgorithm(jwk map[string]interface{}) {
+	if alg, ok := jwkAlgorithms[COSEAlgorithmIdentifier(k.Algorithm)]; ok {
+		jwk["alg"] = alg
+	}
+}
+
+// ParseJWK converts a JSON Web Key public key to the COSE key of the same type, which is the reverse of the JWK
+// methods of the key types. It returns an OKPPublicKeyData, EC2PublicKeyData, or RSAPublicKeyData like
+// ParsePublicKey, which can be marshaled with webauthncbor to obtain the COSE_Key bytes. The alg parameter is optional
+// but the COSE key has no algorithm if it's omitted.
+func ParseJWK(jwk map[string]interface{}) (interface{}, error) {
+	kty, _ := jwk["kty"].(string)
+
+	var pk PublicKeyData
+
+	if alg, ok := jwk["alg"].(string); ok {
+		for coseAlg, name := range jwkAlgorithms {
+			if name == alg {
+				pk.Algorithm = int64(coseAlg)
+			}
+		}
+
+		if pk.Algorithm == 0 {
+			return nil, ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Unsupported JSON Web Key algorithm '%s'", alg))
+		}
+	}
+
+	switch kty {
+	case "EC":
+		curve, err := jwkCurve(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		if jwkCurveSizes[curve] == 0 {
+			return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported JSON Web Key EC curve '%v'", jwk["crv"]))
+		}
+
+		x, err := jwkDecode(jwk, "x")
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := jwkDecode(jwk, "y")
+		if err != nil {
+			return nil, err
+		}
+
+		pk.KeyType = int64(EllipticKey)
+
+		return EC2PublicKeyData{PublicKeyData: pk, Curve: int64(curve), XCoord: x, YCoord: y}, nil
+	case "RSA":
+		n, err := jwkDecode(jwk, "n")
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := jwkDecode(jwk, "e")
+		if err != nil {
+			return nil, err
+		}
+
+		pk.KeyType = int64(RSAKey)
+
+		return RSAPublicKeyData{PublicKeyData: pk, Modulus: n, Exponent: e}, nil
+	case "OKP":
+		curve, err := jwkCurve(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		if jwkCurveSizes[curve] != 0 {
+			return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported JSON Web Key OKP curve '%v'", jwk["crv"]))
+		}
+
+		x, err := jwkDecode(jwk, "x")
+		if err != nil {
+			return nil, err
+		}
+
+		pk.KeyType = int64(OctetKey)
+
+		return OKPPublicKeyData{PublicKeyData: pk, Curve: int64(curve), XCoord: x}, nil
+	default:
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported JSON Web Key type '%v'", jwk["kty"]))
+	}
+}
+
+// jwkCurve returns the COSE elliptic curve of the crv parameter of the JSON Web Key.
+func jwkCurve(jwk map[string]interface{}) (COSEEllipticCurve, error) {
+	crv, _ := jwk["crv"].(string)
+
+	for curve, name := range jwkCurves {
+		if name == crv {
+			return curve, nil
+		}
+	}
+
+	return EllipticCurveReserved, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unsupported JSON Web Key curve '%v'", jwk["crv"]))
+}
+
+// jwkDecode decodes the base64url encoded parameter of the JSON Web Key.
+func jwkDecode(jwk map[string]interface{}, name string) ([]byte, error) {
+	value, ok := jwk[name].(string)
+	if !ok || value == "" {
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("JSON Web Key parameter '%s' is missing", name))
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("JSON Web Key parameter '%s' is not base64url encoded", name))
+	}
+
+	return data, nil
+}
+
+// jwkEncode base64url encodes a parameter of a JSON Web Key without padding.
+func jwkEncode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwkPad left pads the coordinate with zeros to the size.
+func jwkPad(coord []byte, size int) []byte {
+	if len(coord) >= size {
+		return coord
+	}
+
+	padded := make([]byte, size)
+
+	copy(padded[size-len(coord):], coord)
+
+	return padded
+}
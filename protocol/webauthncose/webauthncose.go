@@ -8,10 +8,11 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/pem"
-	"encoding/hex"
 	"fmt"
 	"hash"
+	"math"
 	"math/big"
+	"strconv"
 
 	"github.com/google/go-tpm/tpm2"
 	"golang.org/x/crypto/ed25519"
@@ -36,6 +37,39 @@ type PublicKeyData struct {
 	// A COSEAlgorithmIdentifier for the algorithm used to derive the key signature.
 	Algorithm int64 `cbor:"3,keyasint" json:"alg"`
 }
+
+// PublicKey is implemented by pointers to each of the key types returned by ParsePublicKey, i.e. *OKPPublicKeyData,
+// *EC2PublicKeyData, and *RSAPublicKeyData.
+type PublicKey interface {
+	// Verify the signature of the provided data with the key using its stored Algorithm. The data must already be the
+	// concatenation of the authenticator data and the client data hash.
+	Verify(data []byte, sig []byte) (bool, error)
+
+	// JWK returns the JSON Web Key of the key.
+	JWK() (map[string]interface{}, error)
+}
+
+// ToPublicKey returns any of the key types returned by ParsePublicKey, including pointers to them, as a PublicKey. It
+// works for keys parsed from a COSE key as well as keys built by hand or decoded from JSON.
+func ToPublicKey(key interface{}) (PublicKey, error) {
+	switch k := key.(type) {
+	case OKPPublicKeyData:
+		return &k, nil
+	case *OKPPublicKeyData:
+		return k, nil
+	case EC2PublicKeyData:
+		return &k, nil
+	case *EC2PublicKeyData:
+		return k, nil
+	case RSAPublicKeyData:
+		return &k, nil
+	case *RSAPublicKeyData:
+		return k, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
 type EC2PublicKeyData struct {
 	PublicKeyData
 
@@ -62,7 +96,8 @@ type RSAPublicKeyData struct {
 type OKPPublicKeyData struct {
 	PublicKeyData
 
-	Curve int64
+	// The curve of the key, which is Ed25519 for EdDSA.
+	Curve int64 `cbor:"-1,keyasint,omitempty" json:"crv"`
 
 	// A byte string that holds the x coordinate of the key.
 	XCoord []byte `cbor:"-2,keyasint,omitempty" json:"x"`
@@ -112,27 +147,20 @@ func (k *EC2PublicKeyData) Verify(data []byte, sig []byte) (bool, error) {
 	if err != nil {
 		return false, ErrSigNotProvidedOrInvalid
 	}
-	encodedStrX := hex.EncodeToString(k.XCoord)
-	encodedStrY := hex.EncodeToString(k.YCoord)
-	encodedStrData := hex.EncodeToString(data)
-	encodedStrHash := hex.EncodeToString(h.Sum(nil))
-	encodedStrSig := hex.EncodeToString(sig)
-	fmt.Printf("XCoord: %s\n", encodedStrX)
-	fmt.Printf("YCoord: %s\n", encodedStrY)
-	fmt.Printf("DATA: %s\n", encodedStrData)
-	fmt.Printf("HASHED DATA: %s\n", encodedStrHash)
-	fmt.Printf("SIG: %s\n", encodedStrSig)
-	fmt.Printf("R: %x\n", e.R)
-	fmt.Printf("S: %x\n", e.S)
 
 	return ecdsa.Verify(pubkey, h.Sum(nil), e.R, e.S), nil
 }
 
 // Verify RSA Public Key Signature.
 func (k *RSAPublicKeyData) Verify(data []byte, sig []byte) (bool, error) {
+	e, err := k.exponent()
+	if err != nil {
+		return false, err
+	}
+
 	pubkey := &rsa.PublicKey{
 		N: big.NewInt(0).SetBytes(k.Modulus),
-		E: int(uint(k.Exponent[2]) | uint(k.Exponent[1])<<8 | uint(k.Exponent[0])<<16),
+		E: e,
 	}
 
 	f := HasherFromCOSEAlg(COSEAlgorithmIdentifier(k.PublicKeyData.Algorithm))
@@ -168,6 +196,17 @@ func (k *RSAPublicKeyData) Verify(data []byte, sig []byte) (bool, error) {
 	}
 }
 
+// exponent returns the public exponent of the key, which COSE encodes as a big-endian unsigned integer of any length.
+// Exponents which can't be represented by rsa.PublicKey are rejected.
+func (k *RSAPublicKeyData) exponent() (int, error) {
+	e := new(big.Int).SetBytes(k.Exponent)
+	if e.Sign() == 0 || e.Cmp(big.NewInt(math.MaxInt32)) > 0 {
+		return 0, ErrUnsupportedKey.WithDetails("RSA public key exponent is out of range")
+	}
+
+	return int(e.Int64()), nil
+}
+
 // SigAlgFromCOSEAlg return which signature algorithm is being used from the COSE Key.
 func SigAlgFromCOSEAlg(coseAlg COSEAlgorithmIdentifier) SignatureAlgorithm {
 	for _, details := range SignatureAlgorithmDetails {
@@ -190,8 +229,142 @@ func HasherFromCOSEAlg(coseAlg COSEAlgorithmIdentifier) func() hash.Hash {
 	return crypto.SHA256.New
 }
 
+// ParsePublicKeyOptions customizes the parsing of COSE keys by ParsePublicKeyWithOptions.
+type ParsePublicKeyOptions struct {
+	// AllowStringLabels accepts COSE keys which use text string labels such as "kty" or "-2" instead of the integer
+	// labels, as encoded by some non-conformant authenticators. The labels are mapped to the standard integer labels
+	// before the key is parsed.
+	AllowStringLabels bool
+}
+
+// coseKeyCommonLabels are the labels shared by all key types.
+//
+// Specification: RFC8152 §7.1. COSE Key Common Parameters (https://www.rfc-editor.org/rfc/rfc8152#section-7.1)
+var coseKeyCommonLabels = map[string]int64{
+	"kty":     1,
+	"kid":     2,
+	"alg":     3,
+	"key_ops": 4,
+	"Base IV": 5,
+}
+
+// coseKeyTypeLabels are the labels specific to each key type.
+//
+// Specification: RFC8152 §13. Key Object Parameters (https://www.rfc-editor.org/rfc/rfc8152#section-13) and
+// RFC8230 §4. COSE Key Type Parameters (https://www.rfc-editor.org/rfc/rfc8230#section-4)
+var coseKeyTypeLabels = map[COSEKeyType]map[string]int64{
+	EllipticKey: {"crv": -1, "x": -2, "y": -3, "d": -4},
+	OctetKey:    {"crv": -1, "x": -2, "d": -4},
+	RSAKey:      {"n": -1, "e": -2},
+}
+
+// NormalizeStringLabels re-encodes a COSE key which uses text string labels with the integer labels. The key bytes are
+// returned unchanged if all labels are integers.
+func NormalizeStringLabels(keyBytes []byte) ([]byte, error) {
+	var raw map[interface{}]interface{}
+
+	if err := webauthncbor.Unmarshal(keyBytes, &raw); err != nil {
+		return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error decoding COSE key: %+v", err))
+	}
+
+	hasStringLabels := false
+
+	for label := range raw {
+		if _, ok := label.(string); ok {
+			hasStringLabels = true
+
+			break
+		}
+	}
+
+	if !hasStringLabels {
+		return keyBytes, nil
+	}
+
+	var kty interface{}
+
+	for label, value := range raw {
+		if n, ok := coseKeyLabelInt(label, nil); ok && n == 1 {
+			kty = value
+		}
+	}
+
+	keyType, ok := coseKeyInt(kty)
+	if !ok {
+		return nil, ErrUnsupportedKey.WithDetails("COSE key type label is missing or not an integer")
+	}
+
+	normalized := make(map[int64]interface{}, len(raw))
+
+	for label, value := range raw {
+		n, ok := coseKeyLabelInt(label, coseKeyTypeLabels[COSEKeyType(keyType)])
+		if !ok {
+			return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Unknown COSE key label '%v'", label))
+		}
+
+		if _, duplicate := normalized[n]; duplicate {
+			return nil, ErrUnsupportedKey.WithDetails(fmt.Sprintf("Duplicate COSE key label '%v'", label))
+		}
+
+		normalized[n] = value
+	}
+
+	return webauthncbor.Marshal(normalized)
+}
+
+// coseKeyLabelInt returns the integer label of a COSE key label which is either an integer, the decimal text string
+// of an integer, or the name of a common or key type specific label.
+func coseKeyLabelInt(label interface{}, typeLabels map[string]int64) (int64, bool) {
+	name, ok := label.(string)
+	if !ok {
+		return coseKeyInt(label)
+	}
+
+	if n, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return n, true
+	}
+
+	if n, ok := coseKeyCommonLabels[name]; ok {
+		return n, true
+	}
+
+	n, ok := typeLabels[name]
+
+	return n, ok
+}
+
+// coseKeyInt returns the value of a decoded CBOR integer.
+func coseKeyInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
 // ParsePublicKey figures out what kind of COSE material was provided and create the data for the new key.
 func ParsePublicKey(keyBytes []byte) (interface{}, error) {
+	return ParsePublicKeyWithOptions(keyBytes, ParsePublicKeyOptions{})
+}
+
+// ParsePublicKeyWithOptions is the same as ParsePublicKey but customized by the opts.
+func ParsePublicKeyWithOptions(keyBytes []byte, opts ParsePublicKeyOptions) (interface{}, error) {
+	if opts.AllowStringLabels {
+		normalized, err := NormalizeStringLabels(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		keyBytes = normalized
+	}
+
 	pk := PublicKeyData{}
 	webauthncbor.Unmarshal(keyBytes, &pk)
 
@@ -209,6 +382,12 @@ func ParsePublicKey(keyBytes []byte) (interface{}, error) {
 		webauthncbor.Unmarshal(keyBytes, &e)
 		e.PublicKeyData = pk
 
+		// Reject points which are not on the named curve to prevent invalid curve attacks. Curves which are not
+		// implemented by the standard library can't be checked here.
+		if curve := ellipticCurve(COSEEllipticCurve(e.Curve)); curve != nil && !curve.IsOnCurve(new(big.Int).SetBytes(e.XCoord), new(big.Int).SetBytes(e.YCoord)) {
+			return nil, ErrUnsupportedKey.WithDetails("EC2 public key point is not on the curve")
+		}
+
 		return e, nil
 	case RSAKey:
 		var r RSAPublicKeyData
@@ -222,6 +401,20 @@ func ParsePublicKey(keyBytes []byte) (interface{}, error) {
 	}
 }
 
+// ellipticCurve returns the elliptic.Curve for the COSE elliptic curve, or nil if the curve is not a NIST curve.
+func ellipticCurve(crv COSEEllipticCurve) elliptic.Curve {
+	switch crv {
+	case P256:
+		return elliptic.P256()
+	case P384:
+		return elliptic.P384()
+	case P521:
+		return elliptic.P521()
+	default:
+		return nil
+	}
+}
+
 // ParseFIDOPublicKey is only used when the appID extension is configured by the assertion response.
 func ParseFIDOPublicKey(keyBytes []byte) (data EC2PublicKeyData, err error) {
 	x, y := elliptic.Unmarshal(elliptic.P256(), keyBytes)
@@ -284,6 +477,23 @@ const (
 	AlgES256K COSEAlgorithmIdentifier = -47
 )
 
+// supportedAlgorithms are the algorithms which the Verify methods of the key types verify signatures with, and must be
+// kept in sync with them. AlgES256K is not supported as secp256k1 is not implemented by the standard library.
+var supportedAlgorithms = []COSEAlgorithmIdentifier{
+	AlgES256, AlgES384, AlgES512,
+	AlgRS256, AlgRS384, AlgRS512,
+	AlgPS256, AlgPS384, AlgPS512,
+	AlgEdDSA,
+	AlgRS1,
+}
+
+// SupportedAlgorithms returns every algorithm the library can verify signatures with. It includes AlgRS1, which is
+// only intended for the TPM attestation statements of older authenticators and should not be requested in the
+// credential parameters.
+func SupportedAlgorithms() []COSEAlgorithmIdentifier {
+	return append([]COSEAlgorithmIdentifier{}, supportedAlgorithms...)
+}
+
 // COSEKeyType is The Key type derived from the IANA COSE AuthData.
 type COSEKeyType int
 
@@ -354,16 +564,81 @@ func (k *EC2PublicKeyData) TPMCurveID() tpm2.EllipticCurve {
 	}
 }
 
+// VerifySignature verifies the signature of the provided data with any of the key types returned by ParsePublicKey,
+// including pointers to them.
 func VerifySignature(key interface{}, data []byte, sig []byte) (bool, error) {
+	pk, err := ToPublicKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	return pk.Verify(data, sig)
+}
+
+// VerifyKeyAlgorithm ensures the algorithm declared by the alg parameter of any of the key types returned by
+// ParsePublicKey, including pointers to them, is consistent with the key type and curve of the key. The Verify methods
+// select the signature algorithm from the declared algorithm, so an inconsistent key would otherwise be used with an
+// algorithm it wasn't generated for.
+func VerifyKeyAlgorithm(key interface{}) error {
 	switch k := key.(type) {
 	case OKPPublicKeyData:
-		return k.Verify(data, sig)
+		return verifyOKPKeyAlgorithm(&k)
+	case *OKPPublicKeyData:
+		return verifyOKPKeyAlgorithm(k)
 	case EC2PublicKeyData:
-		return k.Verify(data, sig)
+		return verifyEC2KeyAlgorithm(&k)
+	case *EC2PublicKeyData:
+		return verifyEC2KeyAlgorithm(k)
 	case RSAPublicKeyData:
-		return k.Verify(data, sig)
+		return verifyRSAKeyAlgorithm(&k)
+	case *RSAPublicKeyData:
+		return verifyRSAKeyAlgorithm(k)
 	default:
-		return false, ErrUnsupportedKey
+		return ErrUnsupportedKey
+	}
+}
+
+func verifyOKPKeyAlgorithm(k *OKPPublicKeyData) error {
+	if COSEAlgorithmIdentifier(k.Algorithm) != AlgEdDSA {
+		return ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Key algorithm %d is not consistent with the key type %d", k.Algorithm, k.KeyType))
+	}
+
+	if COSEEllipticCurve(k.Curve) != Ed25519 {
+		return ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Key algorithm %d is not consistent with the curve %d", k.Algorithm, k.Curve))
+	}
+
+	return nil
+}
+
+func verifyEC2KeyAlgorithm(k *EC2PublicKeyData) error {
+	var curve COSEEllipticCurve
+
+	switch COSEAlgorithmIdentifier(k.Algorithm) {
+	case AlgES256:
+		curve = P256
+	case AlgES384:
+		curve = P384
+	case AlgES512:
+		curve = P521
+	case AlgES256K:
+		curve = Secp256k1
+	default:
+		return ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Key algorithm %d is not consistent with the key type %d", k.Algorithm, k.KeyType))
+	}
+
+	if COSEEllipticCurve(k.Curve) != curve {
+		return ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Key algorithm %d is not consistent with the curve %d", k.Algorithm, k.Curve))
+	}
+
+	return nil
+}
+
+func verifyRSAKeyAlgorithm(k *RSAPublicKeyData) error {
+	switch COSEAlgorithmIdentifier(k.Algorithm) {
+	case AlgRS1, AlgRS256, AlgRS384, AlgRS512, AlgPS256, AlgPS384, AlgPS512:
+		return nil
+	default:
+		return ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Key algorithm %d is not consistent with the key type %d", k.Algorithm, k.KeyType))
 	}
 }
 
@@ -375,9 +650,14 @@ func DisplayPublicKey(cpk []byte) string {
 
 	switch k := parsedKey.(type) {
 	case RSAPublicKeyData:
+		e, err := k.exponent()
+		if err != nil {
+			return keyCannotDisplay
+		}
+
 		rKey := &rsa.PublicKey{
 			N: big.NewInt(0).SetBytes(k.Modulus),
-			E: int(uint(k.Exponent[2]) | uint(k.Exponent[1])<<8 | uint(k.Exponent[0])<<16),
+			E: e,
 		}
 
 		data, err := x509.MarshalPKIXPublicKey(rKey)
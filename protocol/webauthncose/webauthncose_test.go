@@ -1,11 +1,20 @@
 package webauthncose
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ed25519"
 
 	"github.com/flaviup/webauthn/protocol/webauthncbor"
@@ -128,3 +137,622 @@ MCowBQYDK2VwAyEAe4gQJK3JgtOAuHceO5v45LOZi8fQWDBmAs5NDy/kt4E=
 		t.Fatalf("incorrect PEM format received for ed25519 public key. expected\n%#v\n got \n%#v\n", expected, got)
 	}
 }
+
+func TestPublicKeyVerify(t *testing.T) {
+	ec2X, err := hex.DecodeString("f739f8c77b32f4d5f13265861febd76e7a9c61a1140d296b8c16302508870316")
+	assert.Nil(t, err)
+	ec2Y, err := hex.DecodeString("c24970ad7811ccd9da7f1b88f202bebac770663ef58ba68346186dd778200dd4")
+	assert.Nil(t, err)
+	ec2Sig, err := hex.DecodeString("3045022053584980793ee4ec01d583f303604c4f85a7e87df3fe9551962c5ab69a5ce27b022100c801fd6186ca4681e87fbbb97c5cb659f039473995a75a9a9dffea2708d6f8fb")
+	assert.Nil(t, err)
+
+	rsaN, err := hex.DecodeString("d0776203bf58d04655d69decd5370b518ea2a0e0fa5fa5c3961aee40c5a7e3c665affa01fac40d7b402167e7c49b02180a192239175143b0f20a7d8d9f4660f9d5c8d575dca67621a6641eddda3adcc08c812c3809d4abeb76d8dff43ea5d91d33840a5264d11a700be36cf5e4c57eda08e4d08d771710c526498c77d3d2e24aaa767741a43ef6ee80e0633a98412265a98a6b83c58db5291f9be54cd16e2ab6febd7114e7c0c91537cb071af2dc4ffc0039bc9dd523ac806870e30780c9b7687a2d5e62a1e30fbf012f0ce14360ed57b06db8937245ff9883c56e1b04bd5db323072fd29737b84f45ae8436bdc6d9006cb0fae4d48e1e9339b31926f48b1bb1")
+	assert.Nil(t, err)
+	rsaSig, err := hex.DecodeString("c78befff238e63f8012bfe06135bb425d0188e29f8c60116fe3131c216ddbad68455c5b9f962cbd3a463db0f3c11bd642006c8ca3204c4ab99eae744250e273a2884a4fcc38a41f438902e4318188c67af998a102ae70d9fb45a9d6628cb3cd6e1c56180966f84301b9842ae4cf5a3c650bd4932e410923ef81fb75cc1cc6b2951e596d23cf75754efd3eaa90220f005a1472d5e1857e6361a8e976fc593016e57234b15aa8b2ad12827c58e428a5757505b093478c0a777485d152ee0759f0842f9b558684b23d468c0fca5f4306552e0a956572def577e408638c3c9e2694239b84e3ff871f50c824d4847a58837ee100ee0199f0414bee0f9e0ef1aee0f70")
+	assert.Nil(t, err)
+
+	// Test vector 1 from RFC 8032 §7.1 (empty message).
+	okpX, err := hex.DecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	assert.Nil(t, err)
+	okpSig, err := hex.DecodeString("e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b")
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name string
+		key  interface{}
+		data []byte
+		sig  []byte
+	}{
+		{
+			"EC2",
+			EC2PublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)},
+				Curve:         int64(P256),
+				XCoord:        ec2X,
+				YCoord:        ec2Y,
+			},
+			[]byte("webauthnFTW"),
+			ec2Sig,
+		},
+		{
+			"RSA",
+			RSAPublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgRS256)},
+				Modulus:       rsaN,
+				Exponent:      []byte{0x01, 0x00, 0x01},
+			},
+			[]byte("webauthnFTW"),
+			rsaSig,
+		},
+		{
+			"OKP",
+			OKPPublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(AlgEdDSA)},
+				Curve:         int64(Ed25519),
+				XCoord:        okpX,
+			},
+			[]byte{},
+			okpSig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyBytes, err := webauthncbor.Marshal(tc.key)
+			require.NoError(t, err)
+
+			parsed, err := ParsePublicKey(keyBytes)
+			require.NoError(t, err)
+
+			jsonBytes, err := json.Marshal(tc.key)
+			require.NoError(t, err)
+
+			decoded := reflect.New(reflect.TypeOf(tc.key)).Interface()
+			require.NoError(t, json.Unmarshal(jsonBytes, decoded))
+
+			keys := map[string]interface{}{
+				"Parsed":  parsed,
+				"Literal": tc.key,
+				"JSON":    decoded,
+			}
+
+			for name, key := range keys {
+				pk, err := ToPublicKey(key)
+				require.NoError(t, err, name)
+
+				ok, err := pk.Verify(tc.data, tc.sig)
+				assert.Nil(t, err, name)
+				assert.True(t, ok, "valid signature wasn't properly verified for the %s key", name)
+
+				ok, _ = pk.Verify(append([]byte("tampered"), tc.data...), tc.sig)
+				assert.False(t, ok, "verification against bad data is successful for the %s key", name)
+			}
+		})
+	}
+
+	_, err = ToPublicKey(PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)})
+	assert.Error(t, err)
+
+	ok, err := VerifySignature(&PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)}, []byte("webauthnFTW"), ec2Sig)
+	assert.False(t, ok)
+	assert.Error(t, err)
+}
+
+func TestParsePublicKeyStringLabels(t *testing.T) {
+	x, err := hex.DecodeString("f739f8c77b32f4d5f13265861febd76e7a9c61a1140d296b8c16302508870316")
+	assert.Nil(t, err)
+	y, err := hex.DecodeString("c24970ad7811ccd9da7f1b88f202bebac770663ef58ba68346186dd778200dd4")
+	assert.Nil(t, err)
+
+	expected := EC2PublicKeyData{
+		PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)},
+		Curve:         int64(P256),
+		XCoord:        x,
+		YCoord:        y,
+	}
+
+	intLabels, err := webauthncbor.Marshal(expected)
+	assert.Nil(t, err)
+
+	stringLabels, err := webauthncbor.Marshal(map[string]interface{}{
+		"kty": int64(EllipticKey),
+		"alg": int64(AlgES256),
+		"crv": int64(P256),
+		"-2":  x,
+		"y":   y,
+	})
+	assert.Nil(t, err)
+
+	_, err = ParsePublicKey(stringLabels)
+	assert.Equal(t, ErrUnsupportedKey, err)
+
+	_, err = ParsePublicKeyWithOptions(stringLabels, ParsePublicKeyOptions{})
+	assert.Equal(t, ErrUnsupportedKey, err)
+
+	opts := ParsePublicKeyOptions{AllowStringLabels: true}
+
+	for name, keyBytes := range map[string][]byte{"Integer": intLabels, "String": stringLabels} {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParsePublicKeyWithOptions(keyBytes, opts)
+			assert.Nil(t, err)
+
+			key, ok := parsed.(EC2PublicKeyData)
+			assert.True(t, ok)
+			assert.Equal(t, expected.KeyType, key.KeyType)
+			assert.Equal(t, expected.Algorithm, key.Algorithm)
+			assert.Equal(t, expected.Curve, key.Curve)
+			assert.Equal(t, expected.XCoord, key.XCoord)
+			assert.Equal(t, expected.YCoord, key.YCoord)
+		})
+	}
+
+	normalized, err := NormalizeStringLabels(stringLabels)
+	assert.Nil(t, err)
+
+	parsed, err := ParsePublicKey(normalized)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, parsed)
+
+	normalized, err = NormalizeStringLabels(intLabels)
+	assert.Nil(t, err)
+	assert.Equal(t, intLabels, normalized)
+
+	_, err = ParsePublicKeyWithOptions(func() []byte {
+		keyBytes, err := webauthncbor.Marshal(map[string]interface{}{"kty": int64(EllipticKey), "unknown": x})
+		assert.Nil(t, err)
+
+		return keyBytes
+	}(), opts)
+	assert.EqualError(t, err, "Unknown COSE key label 'unknown'")
+}
+
+func TestParsePublicKeyPointOnCurve(t *testing.T) {
+	x, err := hex.DecodeString("f739f8c77b32f4d5f13265861febd76e7a9c61a1140d296b8c16302508870316")
+	require.NoError(t, err)
+
+	y, err := hex.DecodeString("c24970ad7811ccd9da7f1b88f202bebac770663ef58ba68346186dd778200dd4")
+	require.NoError(t, err)
+
+	offCurveY := append([]byte{}, y...)
+	offCurveY[len(offCurveY)-1] ^= 0x01
+
+	testCases := []struct {
+		name  string
+		curve COSEEllipticCurve
+		y     []byte
+		err   string
+	}{
+		{"ShouldParsePointOnCurve", P256, y, ""},
+		{"ShouldRejectPointOffCurve", P256, offCurveY, "EC2 public key point is not on the curve"},
+		{"ShouldRejectPointOnOtherCurve", P384, y, "EC2 public key point is not on the curve"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyBytes, err := webauthncbor.Marshal(EC2PublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)},
+				Curve:         int64(tc.curve),
+				XCoord:        x,
+				YCoord:        tc.y,
+			})
+			require.NoError(t, err)
+
+			key, err := ParsePublicKey(keyBytes)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, ErrUnsupportedKey.Type, err.(*Error).Type)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.y, key.(EC2PublicKeyData).YCoord)
+		})
+	}
+}
+
+func TestVerifyKeyAlgorithm(t *testing.T) {
+	ec2 := func(alg COSEAlgorithmIdentifier, crv COSEEllipticCurve) EC2PublicKeyData {
+		return EC2PublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(alg)}, Curve: int64(crv)}
+	}
+
+	testCases := []struct {
+		name string
+		key  interface{}
+		err  string
+	}{
+		{"ShouldAcceptES256", ec2(AlgES256, P256), ""},
+		{"ShouldAcceptES384", ec2(AlgES384, P384), ""},
+		{"ShouldAcceptES512Pointer", &EC2PublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES512)}, Curve: int64(P521)}, ""},
+		{"ShouldAcceptES256K", ec2(AlgES256K, Secp256k1), ""},
+		{"ShouldAcceptRS256", RSAPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgRS256)}}, ""},
+		{"ShouldAcceptPS256", RSAPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgPS256)}}, ""},
+		{"ShouldAcceptEdDSA", OKPPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(AlgEdDSA)}, Curve: int64(Ed25519)}, ""},
+		{"ShouldRejectES256WithP384", ec2(AlgES256, P384), "Key algorithm -7 is not consistent with the curve 2"},
+		{"ShouldRejectES384WithP256", ec2(AlgES384, P256), "Key algorithm -35 is not consistent with the curve 1"},
+		{"ShouldRejectEC2WithRSAAlgorithm", ec2(AlgRS256, P256), "Key algorithm -257 is not consistent with the key type 2"},
+		{"ShouldRejectEC2WithoutAlgorithm", ec2(0, P256), "Key algorithm 0 is not consistent with the key type 2"},
+		{"ShouldRejectRSAWithECDSAAlgorithm", RSAPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgES256)}}, "Key algorithm -7 is not consistent with the key type 3"},
+		{"ShouldRejectOKPWithECDSAAlgorithm", OKPPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(AlgES256)}, Curve: int64(Ed25519)}, "Key algorithm -7 is not consistent with the key type 1"},
+		{"ShouldRejectOKPWithX25519", OKPPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(AlgEdDSA)}, Curve: int64(X25519)}, "Key algorithm -8 is not consistent with the curve 4"},
+		{"ShouldRejectUnknownKey", PublicKeyData{}, "Unsupported Public Key Type"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyKeyAlgorithm(tc.key)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestSupportedAlgorithms(t *testing.T) {
+	data := []byte("signed data")
+
+	ec2Keys := map[COSEAlgorithmIdentifier]elliptic.Curve{
+		AlgES256: elliptic.P256(),
+		AlgES384: elliptic.P384(),
+		AlgES512: elliptic.P521(),
+	}
+
+	rsaHashes := map[COSEAlgorithmIdentifier]crypto.Hash{
+		AlgRS1:   crypto.SHA1,
+		AlgRS256: crypto.SHA256,
+		AlgRS384: crypto.SHA384,
+		AlgRS512: crypto.SHA512,
+		AlgPS256: crypto.SHA256,
+		AlgPS384: crypto.SHA384,
+		AlgPS512: crypto.SHA512,
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	algorithms := SupportedAlgorithms()
+
+	assert.Len(t, algorithms, len(ec2Keys)+len(rsaHashes)+1)
+
+	for _, alg := range algorithms {
+		t.Run(strconv.Itoa(int(alg)), func(t *testing.T) {
+			var (
+				key interface{}
+				sig []byte
+			)
+
+			switch {
+			case ec2Keys[alg] != nil:
+				ecKey, err := ecdsa.GenerateKey(ec2Keys[alg], rand.Reader)
+				require.NoError(t, err)
+
+				h := HasherFromCOSEAlg(alg)()
+				h.Write(data)
+
+				sig, err = ecdsa.SignASN1(rand.Reader, ecKey, h.Sum(nil))
+				require.NoError(t, err)
+
+				key = EC2PublicKeyData{
+					PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(alg)},
+					XCoord:        ecKey.X.Bytes(),
+					YCoord:        ecKey.Y.Bytes(),
+				}
+			case rsaHashes[alg] != 0:
+				h := rsaHashes[alg].New()
+				h.Write(data)
+
+				if alg == AlgPS256 || alg == AlgPS384 || alg == AlgPS512 {
+					sig, err = rsa.SignPSS(rand.Reader, rsaKey, rsaHashes[alg], h.Sum(nil), nil)
+				} else {
+					sig, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, rsaHashes[alg], h.Sum(nil))
+				}
+
+				require.NoError(t, err)
+
+				key = RSAPublicKeyData{
+					PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(alg)},
+					Modulus:       rsaKey.N.Bytes(),
+					Exponent:      big.NewInt(int64(rsaKey.E)).FillBytes(make([]byte, 3)),
+				}
+			case alg == AlgEdDSA:
+				public, private, err := ed25519.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+
+				sig = ed25519.Sign(private, data)
+
+				key = OKPPublicKeyData{
+					PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(alg)},
+					XCoord:        public,
+				}
+			default:
+				t.Fatalf("algorithm %d has no test key", alg)
+			}
+
+			valid, err := VerifySignature(key, data, sig)
+			require.NoError(t, err)
+			assert.True(t, valid)
+		})
+	}
+
+	for _, alg := range []COSEAlgorithmIdentifier{AlgES256K, -260, 0} {
+		assert.NotContains(t, algorithms, alg)
+
+		_, err = VerifySignature(EC2PublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(alg)}}, data, nil)
+		assert.Equal(t, ErrUnsupportedAlgorithm, err)
+
+		_, err = VerifySignature(RSAPublicKeyData{PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(alg)}, Exponent: []byte{1, 0, 1}}, data, nil)
+		assert.Equal(t, ErrUnsupportedAlgorithm, err)
+	}
+}
+
+func TestRSAPublicKeyExponent(t *testing.T) {
+	data := []byte("webauthn")
+
+	h := crypto.SHA256.New()
+	h.Write(data)
+
+	testCases := []struct {
+		name     string
+		e        int
+		exponent func(e int) []byte
+		err      string
+	}{
+		{
+			"ShouldVerifyOneByteExponent",
+			3,
+			func(e int) []byte { return big.NewInt(int64(e)).Bytes() },
+			"",
+		},
+		{
+			"ShouldVerifyThreeByteExponent",
+			65537,
+			func(e int) []byte { return big.NewInt(int64(e)).Bytes() },
+			"",
+		},
+		{
+			"ShouldVerifyFourByteExponent",
+			0x01000193,
+			func(e int) []byte { return big.NewInt(int64(e)).Bytes() },
+			"",
+		},
+		{
+			"ShouldVerifyPaddedExponent",
+			65537,
+			func(e int) []byte { return big.NewInt(int64(e)).FillBytes(make([]byte, 4)) },
+			"",
+		},
+		{
+			"ShouldFailZeroExponent",
+			65537,
+			func(e int) []byte { return []byte{0} },
+			"RSA public key exponent is out of range",
+		},
+		{
+			"ShouldFailOversizedExponent",
+			65537,
+			func(e int) []byte { return []byte{1, 0, 0, 0, 1} },
+			"RSA public key exponent is out of range",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rsaKey := rsaTestKey(t, tc.e)
+
+			sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, h.Sum(nil))
+			require.NoError(t, err)
+
+			key := RSAPublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgRS256)},
+				Modulus:       rsaKey.N.Bytes(),
+				Exponent:      tc.exponent(tc.e),
+			}
+
+			buf, err := webauthncbor.Marshal(key)
+			require.NoError(t, err)
+
+			valid, err := VerifySignature(key, data, sig)
+			display := DisplayPublicKey(buf)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.False(t, valid)
+				assert.Equal(t, keyCannotDisplay, display)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.True(t, valid)
+			assert.Contains(t, display, "RSA PUBLIC KEY")
+		})
+	}
+}
+
+// rsaTestKey generates an RSA key with the public exponent e, which rsa.GenerateKey doesn't allow choosing.
+func rsaTestKey(t *testing.T, e int) *rsa.PrivateKey {
+	t.Helper()
+
+	for {
+		p, err := rand.Prime(rand.Reader, 1024)
+		require.NoError(t, err)
+
+		q, err := rand.Prime(rand.Reader, 1024)
+		require.NoError(t, err)
+
+		one := big.NewInt(1)
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+
+		d := new(big.Int).ModInverse(big.NewInt(int64(e)), phi)
+		if p.Cmp(q) == 0 || d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: e},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+
+		require.NoError(t, key.Validate())
+
+		key.Precompute()
+
+		return key
+	}
+}
+
+func TestJWK(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	okpKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		key  interface{}
+		kty  string
+		crv  string
+		alg  string
+	}{
+		{
+			"ShouldConvertEC2",
+			EC2PublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)},
+				Curve:         int64(P256),
+				XCoord:        p256.X.FillBytes(make([]byte, 32)),
+				YCoord:        p256.Y.FillBytes(make([]byte, 32)),
+			},
+			"EC", "P-256", "ES256",
+		},
+		{
+			"ShouldConvertEC2P521",
+			EC2PublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES512)},
+				Curve:         int64(P521),
+				XCoord:        p521.X.FillBytes(make([]byte, 66)),
+				YCoord:        p521.Y.FillBytes(make([]byte, 66)),
+			},
+			"EC", "P-521", "ES512",
+		},
+		{
+			"ShouldConvertRSA",
+			RSAPublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(RSAKey), Algorithm: int64(AlgPS256)},
+				Modulus:       rsaKey.N.Bytes(),
+				Exponent:      big.NewInt(int64(rsaKey.E)).Bytes(),
+			},
+			"RSA", "", "PS256",
+		},
+		{
+			"ShouldConvertOKP",
+			OKPPublicKeyData{
+				PublicKeyData: PublicKeyData{KeyType: int64(OctetKey), Algorithm: int64(AlgEdDSA)},
+				Curve:         int64(Ed25519),
+				XCoord:        okpKey,
+			},
+			"OKP", "Ed25519", "EdDSA",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := webauthncbor.Marshal(tc.key)
+			require.NoError(t, err)
+
+			parsed, err := ParsePublicKey(raw)
+			require.NoError(t, err)
+
+			var jwk map[string]interface{}
+
+			switch key := parsed.(type) {
+			case EC2PublicKeyData:
+				jwk, err = key.JWK()
+			case RSAPublicKeyData:
+				jwk, err = key.JWK()
+			case OKPPublicKeyData:
+				jwk, err = key.JWK()
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.kty, jwk["kty"])
+			assert.Equal(t, tc.alg, jwk["alg"])
+
+			if tc.crv != "" {
+				assert.Equal(t, tc.crv, jwk["crv"])
+			}
+
+			pk, err := ToPublicKey(tc.key)
+			require.NoError(t, err)
+
+			fromKey, err := pk.JWK()
+			require.NoError(t, err)
+			assert.Equal(t, jwk, fromKey)
+
+			key, err := ParseJWK(jwk)
+			require.NoError(t, err)
+			assert.Equal(t, tc.key, key)
+
+			roundTrip, err := webauthncbor.Marshal(key)
+			require.NoError(t, err)
+			assert.Equal(t, raw, roundTrip)
+		})
+	}
+}
+
+func TestJWKPadsCoordinates(t *testing.T) {
+	key := EC2PublicKeyData{
+		PublicKeyData: PublicKeyData{KeyType: int64(EllipticKey), Algorithm: int64(AlgES256)},
+		Curve:         int64(P256),
+		XCoord:        []byte{0x01},
+		YCoord:        make([]byte, 32),
+	}
+
+	jwk, err := key.JWK()
+	require.NoError(t, err)
+
+	assert.Equal(t, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE", jwk["x"])
+	assert.Equal(t, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", jwk["y"])
+
+	key.XCoord = make([]byte, 33)
+
+	_, err = key.JWK()
+	assert.EqualError(t, err, "EC2 public key coordinates are larger than the curve")
+}
+
+func TestParseJWKErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		jwk  map[string]interface{}
+		err  string
+	}{
+		{"ShouldFailUnknownType", map[string]interface{}{"kty": "oct"}, "Unsupported JSON Web Key type 'oct'"},
+		{"ShouldFailUnknownAlgorithm", map[string]interface{}{"kty": "EC", "alg": "HS256"}, "Unsupported JSON Web Key algorithm 'HS256'"},
+		{"ShouldFailUnknownCurve", map[string]interface{}{"kty": "EC", "crv": "P-192"}, "Unsupported JSON Web Key curve 'P-192'"},
+		{"ShouldFailOKPCurveForEC", map[string]interface{}{"kty": "EC", "crv": "Ed25519"}, "Unsupported JSON Web Key EC curve 'Ed25519'"},
+		{"ShouldFailECCurveForOKP", map[string]interface{}{"kty": "OKP", "crv": "P-256"}, "Unsupported JSON Web Key OKP curve 'P-256'"},
+		{"ShouldFailMissingCoordinate", map[string]interface{}{"kty": "EC", "crv": "P-256", "x": "AQ"}, "JSON Web Key parameter 'y' is missing"},
+		{"ShouldFailInvalidEncoding", map[string]interface{}{"kty": "RSA", "n": "AQ==", "e": "AQAB"}, "JSON Web Key parameter 'n' is not base64url encoded"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseJWK(tc.jwk)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package webauthn
 
 import (
+	"github.com/google/uuid"
+
 	"github.com/flaviup/webauthn/protocol"
 )
 
@@ -21,6 +23,11 @@ type Authenticator struct {
 	// counter value in this case, or not, or fails the authentication ceremony or not, is Relying Party-specific.
 	CloneWarning bool
 
+	// SignCountUnsupported - This is a signal that the authenticator is known to not implement a signature counter,
+	// i.e. it reported a sign count of 0 at registration and always will. Clone detection is skipped for these
+	// authenticators as a sign count of 0 on every login is expected.
+	SignCountUnsupported bool
+
 	// Attachment is the authenticatorAttachment value returned by the request.
 	Attachment protocol.AuthenticatorAttachment
 }
@@ -48,8 +55,19 @@ func SelectAuthenticator(att string, rrk *bool, uv string) protocol.Authenticato
 //
 //	→ Less than or equal to the signature counter value stored in conjunction with credential’s id attribute.
 //	This is a signal that the authenticator may be cloned, see CloneWarning above for more information.
+//
+// If the authenticator is flagged with SignCountUnsupported the clone warning is never set. A counter which wrapped
+// around 0xFFFFFFFF is treated as an increase, see protocol.SignCountRolledOver.
 func (a *Authenticator) UpdateCounter(authDataCount uint32) {
-	if authDataCount <= a.SignCount && (authDataCount != 0 || a.SignCount != 0) {
+	if a.SignCountUnsupported {
+		if authDataCount > a.SignCount {
+			a.SignCount = authDataCount
+		}
+
+		return
+	}
+
+	if authDataCount <= a.SignCount && (authDataCount != 0 || a.SignCount != 0) && !protocol.SignCountRolledOver(a.SignCount, authDataCount) {
 		a.CloneWarning = true
 
 		return
@@ -57,3 +75,37 @@ func (a *Authenticator) UpdateCounter(authDataCount uint32) {
 
 	a.SignCount = authDataCount
 }
+
+// SignCountUnsupportedAAGUIDs are the AAGUIDs of the authenticators which are known to always report a sign count of
+// 0, such as the platform authenticators which synchronize credentials between devices.
+var SignCountUnsupportedAAGUIDs = map[uuid.UUID]bool{
+	// iCloud Keychain.
+	uuid.MustParse("fbfc3007-154e-4ecc-8c0b-6e020557d7bd"): true,
+	// iCloud Keychain (Managed).
+	uuid.MustParse("dd4ec289-e01d-41c9-bb89-70fa845d4bf2"): true,
+	// Google Password Manager.
+	uuid.MustParse("ea9b8d66-4d01-1d21-3ce4-b6b48cb575d4"): true,
+	// Windows Hello.
+	uuid.MustParse("08987058-cadc-4b81-b6e1-30de50dcbe96"): true,
+	uuid.MustParse("9ddd1817-af5a-4672-a2b9-3e3dd95000a9"): true,
+	uuid.MustParse("6028b017-b1d4-4c02-b4b3-afcdafc96bb2"): true,
+}
+
+// isSignCountUnsupported returns true if the initial sign count is 0 and the authenticator is known to not increment
+// it, either by its AAGUID or by its attestation format.
+func isSignCountUnsupported(signCount uint32, aaguid []byte, attestationType string) bool {
+	if signCount != 0 {
+		return false
+	}
+
+	if attestationType == "apple" {
+		return true
+	}
+
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		return false
+	}
+
+	return SignCountUnsupportedAAGUIDs[id]
+}
@@ -84,6 +84,30 @@ func TestAuthenticator_UpdateCounter(t *testing.T) {
 			},
 			true,
 		},
+		{
+			"Counter wrapped around",
+			fields{
+				AAGUID:       make([]byte, 16),
+				SignCount:    0xFFFFFFFE,
+				CloneWarning: false,
+			},
+			args{
+				authDataCount: 3,
+			},
+			false,
+		},
+		{
+			"Counter decreased from the maximum",
+			fields{
+				AAGUID:       make([]byte, 16),
+				SignCount:    0xFFFFFFFF,
+				CloneWarning: false,
+			},
+			args{
+				authDataCount: 0x7FFFFFFF,
+			},
+			true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -116,6 +140,22 @@ func TestAuthenticator_UpdateCounter(t *testing.T) {
 	}
 }
 
+func TestAuthenticator_UpdateCounterSignCountUnsupported(t *testing.T) {
+	a := &Authenticator{SignCountUnsupported: true}
+
+	a.UpdateCounter(0)
+
+	if a.CloneWarning {
+		t.Errorf("Clone warning set for an authenticator which does not support a sign count")
+	}
+
+	a.UpdateCounter(3)
+
+	if a.CloneWarning || a.SignCount != 3 {
+		t.Errorf("Sign Count value [%v] does not match expectation [%v]", a.SignCount, 3)
+	}
+}
+
 func TestSelectAuthenticator(t *testing.T) {
 	type args struct {
 		att string
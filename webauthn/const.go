@@ -5,12 +5,28 @@ import (
 )
 
 const (
-	errFmtFieldEmpty       = "the field '%s' must be configured but it is empty"
-	errFmtFieldNotValidURI = "field '%s' is not a valid URI: %w"
-	errFmtConfigValidate   = "error occurred validating the configuration: %w"
+	errFmtFieldEmpty           = "the field '%s' must be configured but it is empty"
+	errFmtFieldNotValidURI     = "field '%s' is not a valid URI: %w"
+	errFmtConfigValidate       = "error occurred validating the configuration: %w"
+	errFmtFieldNotSecureOrigin = "field '%s' contains the origin '%s' which does not use the https scheme"
+	errFmtFieldRPIDNotSuffix   = "field '%s' contains the origin '%s' for which the RP ID '%s' is not valid: %s"
 )
 
 const (
 	defaultTimeoutUVD = time.Millisecond * 120000
 	defaultTimeout    = time.Millisecond * 300000
+
+	// defaultTimeoutReauth is the timeout used for re-authentication logins initiated with WithReauth.
+	defaultTimeoutReauth = time.Millisecond * 60000
 )
+
+const (
+	// defaultMinRSAKeyBits is the default minimum modulus length of RSA credential public keys.
+	defaultMinRSAKeyBits = 2048
+)
+
+// defaultStrictAttestationFormats are the attestation statement formats defined by the specification which are accepted
+// when Config.Strict is enabled and Config.AllowedAttestationFormats is empty.
+//
+// Specification: §8. Defined Attestation Statement Formats (https://www.w3.org/TR/webauthn/#sctn-defined-attestation-formats)
+var defaultStrictAttestationFormats = []string{"packed", "tpm", "android-key", "android-safetynet", "fido-u2f", "apple", "none"}
@@ -1,7 +1,12 @@
 package webauthn
 
 import (
+	"bytes"
+	"crypto/sha256"
+
 	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 // Credential contains all needed information about a WebAuthn credential for storage.
@@ -26,6 +31,14 @@ type Credential struct {
 
 	// The Authenticator information for a given certificate.
 	Authenticator Authenticator
+
+	// The RP ID the credential was registered for, which the credential remains bound to even if the RP ID of the
+	// Relying Party changes. This is empty for credentials registered before the RP ID was recorded.
+	RPID string
+
+	// DevicePublicKeys are the verified device-bound keys returned by the devicePubKey extension during logins, which
+	// identify each of the physical devices a synced credential has been used from.
+	DevicePublicKeys []protocol.DevicePublicKey
 }
 
 type CredentialFlags struct {
@@ -53,6 +66,59 @@ func (c Credential) Descriptor() (descriptor protocol.CredentialDescriptor) {
 	}
 }
 
+// AddDevicePublicKey appends the device-bound key to the DevicePublicKeys unless a key with the same public key was
+// already seen, and returns true if it was appended. The DevicePublicKeys are copied before appending so credentials
+// sharing the same backing array are not affected.
+func (c *Credential) AddDevicePublicKey(dpk protocol.DevicePublicKey) bool {
+	for _, existing := range c.DevicePublicKeys {
+		if bytes.Equal(existing.PublicKey, dpk.PublicKey) {
+			return false
+		}
+	}
+
+	c.DevicePublicKeys = append(c.DevicePublicKeys[:len(c.DevicePublicKeys):len(c.DevicePublicKeys)], dpk)
+
+	return true
+}
+
+// PublicKeyThumbprint returns the SHA-256 hash of the canonical CBOR encoding of the decoded credential public key,
+// which is the same for equal keys regardless of how the authenticator encoded them.
+func (c Credential) PublicKeyThumbprint() ([]byte, error) {
+	return publicKeyThumbprint(c.PublicKey, webauthncose.ParsePublicKeyOptions{})
+}
+
+// publicKeyThumbprint returns the thumbprint of a credential public key parsed with the opts.
+func publicKeyThumbprint(keyBytes []byte, opts webauthncose.ParsePublicKeyOptions) ([]byte, error) {
+	key, err := webauthncose.ParsePublicKeyWithOptions(keyBytes, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := webauthncbor.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint := sha256.Sum256(data)
+
+	return thumbprint[:], nil
+}
+
+// CredentialDescriptorsFromUser returns the descriptors of each of the credentials of the user including their
+// transports, which is suitable for both the allowed credentials of a login and the excluded credentials of a
+// registration.
+func CredentialDescriptorsFromUser(user User) []protocol.CredentialDescriptor {
+	credentials := user.WebAuthnCredentials()
+
+	descriptors := make([]protocol.CredentialDescriptor, len(credentials))
+
+	for i, credential := range credentials {
+		descriptors[i] = credential.Descriptor()
+	}
+
+	return descriptors
+}
+
 // MakeNewCredential will return a credential pointer on successful validation of a registration response.
 func MakeNewCredential(c *protocol.ParsedCredentialCreationData) (*Credential, error) {
 	newCredential := &Credential{
@@ -73,5 +139,8 @@ func MakeNewCredential(c *protocol.ParsedCredentialCreationData) (*Credential, e
 		},
 	}
 
+	newCredential.Authenticator.SignCountUnsupported = isSignCountUnsupported(newCredential.Authenticator.SignCount,
+		newCredential.Authenticator.AAGUID, newCredential.AttestationType)
+
 	return newCredential, nil
 }
@@ -1,9 +1,16 @@
 package webauthn
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"reflect"
 	"testing"
 
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/flaviup/webauthn/protocol"
 )
 
@@ -32,3 +39,94 @@ func TestMakeNewCredential(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeNewCredentialSignCountUnsupported(t *testing.T) {
+	platform := uuid.MustParse("fbfc3007-154e-4ecc-8c0b-6e020557d7bd")
+
+	testCases := []struct {
+		name         string
+		aaguid       []byte
+		format       string
+		count        uint32
+		expected     bool
+		cloneWarning bool
+	}{
+		{"ShouldFlagZeroCountPlatformAuthenticator", platform[:], "none", 0, true, false},
+		{"ShouldFlagZeroCountAppleAttestation", make([]byte, 16), "apple", 0, true, false},
+		{"ShouldNotFlagNonZeroCountPlatformAuthenticator", platform[:], "none", 5, false, true},
+		{"ShouldNotFlagZeroCountUnknownAuthenticator", make([]byte, 16), "packed", 0, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &protocol.ParsedCredentialCreationData{}
+			c.Response.AttestationObject.Format = tc.format
+			c.Response.AttestationObject.AuthData.Counter = tc.count
+			c.Response.AttestationObject.AuthData.AttData.AAGUID = tc.aaguid
+
+			credential, err := MakeNewCredential(c)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, credential.Authenticator.SignCountUnsupported)
+
+			credential.Authenticator.UpdateCounter(0)
+			assert.Equal(t, tc.cloneWarning, credential.Authenticator.CloneWarning)
+		})
+	}
+}
+
+func TestCredentialDescriptorsFromUser(t *testing.T) {
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{
+		{
+			ID:              []byte("usb"),
+			AttestationType: "packed",
+			Transport:       []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC},
+		},
+		{
+			ID:              []byte("internal"),
+			AttestationType: "none",
+			Transport:       []protocol.AuthenticatorTransport{protocol.Internal},
+		},
+	}}
+
+	assert.Equal(t, []protocol.CredentialDescriptor{
+		{
+			Type:            protocol.PublicKeyCredentialType,
+			CredentialID:    []byte("usb"),
+			Transport:       []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC},
+			AttestationType: "packed",
+		},
+		{
+			Type:            protocol.PublicKeyCredentialType,
+			CredentialID:    []byte("internal"),
+			Transport:       []protocol.AuthenticatorTransport{protocol.Internal},
+			AttestationType: "none",
+		},
+	}, CredentialDescriptorsFromUser(user))
+
+	assert.Empty(t, CredentialDescriptorsFromUser(&defaultUser{id: []byte("123")}))
+}
+
+func TestCredential_PublicKeyThumbprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credential := loginTestCredential(t, key)
+
+	thumbprint, err := credential.PublicKeyThumbprint()
+	require.NoError(t, err)
+	assert.Len(t, thumbprint, 32)
+
+	same, err := loginTestCredential(t, key).PublicKeyThumbprint()
+	require.NoError(t, err)
+	assert.Equal(t, thumbprint, same)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	other, err := loginTestCredential(t, otherKey).PublicKeyThumbprint()
+	require.NoError(t, err)
+	assert.NotEqual(t, thumbprint, other)
+
+	_, err = Credential{PublicKey: []byte("invalid")}.PublicKeyThumbprint()
+	assert.Error(t, err)
+}
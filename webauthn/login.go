@@ -19,6 +19,20 @@ type LoginOption func(*protocol.PublicKeyCredentialRequestOptions)
 // DiscoverableUserHandler returns a *User given the provided userHandle.
 type DiscoverableUserHandler func(rawID, userHandle []byte) (user User, err error)
 
+// UserResolver resolves the User of a discoverable login given the userHandle returned by the authenticator, which is
+// the User's WebAuthnID. Implementations may carry any state needed to look up the User such as a database handle.
+type UserResolver interface {
+	GetUser(handle []byte) (User, error)
+}
+
+// UserResolverFunc is an adapter to allow the use of ordinary functions as a UserResolver.
+type UserResolverFunc func(handle []byte) (User, error)
+
+// GetUser calls f(handle).
+func (f UserResolverFunc) GetUser(handle []byte) (User, error) {
+	return f(handle)
+}
+
 // BeginLogin creates the *protocol.CredentialAssertion data payload that should be sent to the user agent for beginning
 // the login/assertion process. The format of this data can be seen in §5.5 of the WebAuthn specification. These default
 // values can be amended by providing additional LoginOption parameters. This function also returns sessionData, that
@@ -27,18 +41,12 @@ type DiscoverableUserHandler func(rawID, userHandle []byte) (user User, err erro
 //
 // Specification: §5.5. Options for Assertion Generation (https://www.w3.org/TR/webauthn/#dictionary-assertion-options)
 func (webauthn *WebAuthn) BeginLogin(user User, opts ...LoginOption) (*protocol.CredentialAssertion, *SessionData, error) {
-	credentials := user.WebAuthnCredentials()
+	allowedCredentials := CredentialDescriptorsFromUser(user)
 
-	if len(credentials) == 0 { // If the user does not have any credentials, we cannot perform an assertion.
+	if len(allowedCredentials) == 0 { // If the user does not have any credentials, we cannot perform an assertion.
 		return nil, nil, protocol.ErrBadRequest.WithDetails("Found no credentials for user")
 	}
 
-	var allowedCredentials = make([]protocol.CredentialDescriptor, len(credentials))
-
-	for i, credential := range credentials {
-		allowedCredentials[i] = credential.Descriptor()
-	}
-
 	return webauthn.beginLogin(user.WebAuthnID(), allowedCredentials, opts...)
 }
 
@@ -70,6 +78,20 @@ func (webauthn *WebAuthn) beginLogin(userID []byte, allowedCredentials []protoco
 		opt(&assertion.Response)
 	}
 
+	if err = protocol.ValidateHints(assertion.Response.Hints); err != nil {
+		return nil, nil, err
+	}
+
+	reauth := assertion.Response.Reauth
+
+	if reauth {
+		assertion.Response.UserVerification = protocol.VerificationRequired
+
+		if assertion.Response.Timeout == 0 {
+			assertion.Response.Timeout = int(defaultTimeoutReauth.Milliseconds())
+		}
+	}
+
 	if assertion.Response.Timeout == 0 {
 		switch {
 		case assertion.Response.UserVerification == protocol.VerificationDiscouraged:
@@ -85,6 +107,7 @@ func (webauthn *WebAuthn) beginLogin(userID []byte, allowedCredentials []protoco
 		AllowedCredentialIDs: assertion.Response.GetAllowedCredentialIDs(),
 		UserVerification:     assertion.Response.UserVerification,
 		Extensions:           assertion.Response.Extensions,
+		Reauth:               reauth,
 	}
 
 	if webauthn.Config.Timeouts.Login.Enforce {
@@ -115,6 +138,15 @@ func WithUserVerification(userVerification protocol.UserVerificationRequirement)
 	}
 }
 
+// WithReauth forces a re-authentication, for example before a high-security operation, by requiring user verification
+// regardless of the options which adjust it, and using a short timeout unless an option adjusts the timeout. The
+// returned session is flagged so that the login is rejected unless the user was verified.
+func WithReauth() LoginOption {
+	return func(cco *protocol.PublicKeyCredentialRequestOptions) {
+		cco.Reauth = true
+	}
+}
+
 // WithAssertionExtensions adjusts the requested extensions.
 func WithAssertionExtensions(extensions protocol.AuthenticationExtensions) LoginOption {
 	return func(cco *protocol.PublicKeyCredentialRequestOptions) {
@@ -122,6 +154,47 @@ func WithAssertionExtensions(extensions protocol.AuthenticationExtensions) Login
 	}
 }
 
+// WithAssertionHints adjusts the hints in the login options which guide the client towards the expected kind of
+// authenticator, in order of decreasing preference.
+//
+// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#enumdef-publickeycredentialhints)
+func WithAssertionHints(hints ...protocol.Hint) LoginOption {
+	return func(cco *protocol.PublicKeyCredentialRequestOptions) {
+		cco.Hints = hints
+	}
+}
+
+// WithGetCredBlob requests the authenticator to return the blob stored with the credential using the credBlob
+// extension, which is available from the authenticator data extensions of the assertion. This option must be provided
+// after WithAssertionExtensions if both are used.
+//
+// Specification: CTAP2.1 §12.2. Credential Blob (credBlob) (https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#sctn-credBlob-extension)
+func WithGetCredBlob() LoginOption {
+	return func(cco *protocol.PublicKeyCredentialRequestOptions) {
+		if cco.Extensions == nil {
+			cco.Extensions = map[string]interface{}{}
+		}
+
+		cco.Extensions[protocol.ExtensionGetCredBlob] = true
+	}
+}
+
+// WithLargeBlobWrite requests the authenticator to write the blob to the large blob storage of the credential using
+// the largeBlob extension. The result of the write is reported by LoginResult.LargeBlobWrite. This option must be
+// provided after WithAssertionExtensions if both are used, and the allowed credentials should be limited to the single
+// credential the blob is written for.
+//
+// Specification: §10.1.5. Large blob storage extension (largeBlob) (https://www.w3.org/TR/webauthn-3/#sctn-large-blob-extension)
+func WithLargeBlobWrite(blob []byte) LoginOption {
+	return func(cco *protocol.PublicKeyCredentialRequestOptions) {
+		if cco.Extensions == nil {
+			cco.Extensions = map[string]interface{}{}
+		}
+
+		cco.Extensions[protocol.ExtensionLargeBlob] = map[string]interface{}{"write": protocol.URLEncodedBase64(blob)}
+	}
+}
+
 // WithAppIdExtension automatically includes the specified appid if the AllowedCredentials contains a credential
 // with the type `fido-u2f`.
 func WithAppIdExtension(appid string) LoginOption {
@@ -139,8 +212,11 @@ func WithAppIdExtension(appid string) LoginOption {
 }
 
 // FinishLogin takes the response from the client and validate it against the user credentials and stored session data.
+// If the assertion is valid but the devicePubKey extension signature is not, the error is a *DevicePublicKeyError, and
+// if the backup flags changed unexpectedly while VerifyBackupFlagTransitions is enabled, the error is a
+// *BackupFlagsError.
 func (webauthn *WebAuthn) FinishLogin(user User, session SessionData, response *http.Request) (*Credential, error) {
-	parsedResponse, err := protocol.ParseCredentialRequestResponse(response)
+	parsedResponse, err := webauthn.parseCredentialRequestResponse(response)
 	if err != nil {
 		return nil, err
 	}
@@ -148,8 +224,177 @@ func (webauthn *WebAuthn) FinishLogin(user User, session SessionData, response *
 	return webauthn.ValidateLogin(user, session, parsedResponse)
 }
 
+// LoginResult is the result of a successful login.
+//
+// The library does not persist the credential. Deployments where multiple instances may finish logins for the same
+// credential concurrently should store the updated credential with a compare-and-swap of the stored sign count from
+// SignCountBefore to SignCountAfter, and treat a failed swap as a concurrent use of the credential.
+type LoginResult struct {
+	// Credential is the updated credential used for the login. When credentials were offered via the allowCredentials
+	// of the login, its ID is the ID of the offered credential which was used.
+	Credential *Credential
+
+	// SignCountBefore is the sign count stored for the credential before the login, which is the value expected to be
+	// stored when the updated credential is persisted.
+	SignCountBefore uint32
+
+	// SignCountAfter is the sign count of the updated credential, which is unchanged from SignCountBefore if the
+	// login raised the clone warning.
+	SignCountAfter uint32
+
+	// SignCountEnabled is true if the login cleared the SignCountUnsupported flag of the credential as the
+	// authenticator reported a nonzero sign count while EnableSignCountWhenReported is enabled.
+	SignCountEnabled bool
+
+	// DevicePublicKey is the device-bound key returned by the devicePubKey extension, which is nil if the
+	// authenticator did not return the extension output.
+	DevicePublicKey *protocol.DevicePublicKey
+
+	// DevicePublicKeyVerified is true if the DevicePublicKey signature was verified.
+	DevicePublicKeyVerified bool
+
+	// DevicePublicKeyAdded is true if the verified DevicePublicKey was not yet known and was added to the
+	// DevicePublicKeys of the Credential, which means the credential was used from a new device.
+	DevicePublicKeyAdded bool
+
+	// AuthenticatorAttachment is the attachment of the authenticator used for the login as reported by the client,
+	// such as cross-platform when a passkey of another device is used via hybrid. It's empty if the client did not
+	// report it.
+	AuthenticatorAttachment protocol.AuthenticatorAttachment
+
+	// Extensions are the results of the parsers registered with protocol.RegisterExtension, keyed by the extension
+	// identifier.
+	Extensions map[string]interface{}
+
+	// LargeBlobWrite is the result of the large blob write requested with WithLargeBlobWrite.
+	LargeBlobWrite LargeBlobWriteResult
+}
+
+// LargeBlobWriteResult is the result of a large blob write requested during a login with the largeBlob extension.
+type LargeBlobWriteResult int
+
+const (
+	// LargeBlobWriteNotRequested is the result of a login for which no large blob write was requested.
+	LargeBlobWriteNotRequested LargeBlobWriteResult = iota
+
+	// LargeBlobWriteSucceeded is the result of a login for which the client reported the large blob was written.
+	LargeBlobWriteSucceeded
+
+	// LargeBlobWriteFailed is the result of a login for which the client reported the large blob was not written,
+	// such as when the large blob storage of the authenticator is full or the authenticator does not support it.
+	LargeBlobWriteFailed
+
+	// LargeBlobWriteUnknown is the result of a login for which a large blob write was requested but the client did not
+	// report the outcome, such as a client which does not support the largeBlob extension.
+	LargeBlobWriteUnknown
+)
+
+// String returns the name of the large blob write result.
+func (r LargeBlobWriteResult) String() string {
+	switch r {
+	case LargeBlobWriteNotRequested:
+		return "not_requested"
+	case LargeBlobWriteSucceeded:
+		return "succeeded"
+	case LargeBlobWriteFailed:
+		return "failed"
+	case LargeBlobWriteUnknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("LargeBlobWriteResult(%d)", int(r))
+	}
+}
+
+// largeBlobWriteResult returns the result of the large blob write requested in the extension inputs of the session.
+func largeBlobWriteResult(inputs protocol.AuthenticationExtensions, outputs protocol.AuthenticationExtensionsClientOutputs) LargeBlobWriteResult {
+	input, ok := inputs[protocol.ExtensionLargeBlob].(map[string]interface{})
+	if !ok {
+		return LargeBlobWriteNotRequested
+	}
+
+	if _, ok = input["write"]; !ok {
+		return LargeBlobWriteNotRequested
+	}
+
+	written, ok := outputs.LargeBlobWritten()
+
+	switch {
+	case !ok:
+		return LargeBlobWriteUnknown
+	case written:
+		return LargeBlobWriteSucceeded
+	default:
+		return LargeBlobWriteFailed
+	}
+}
+
+// DevicePublicKeyError is returned when the assertion is valid but the devicePubKey extension signature is not. The
+// caller decides whether to accept the login, in which case the Result must be handled like the result of a successful
+// login as the challenge has been used and the credential updated.
+type DevicePublicKeyError struct {
+	// Result is the result of the login with DevicePublicKeyVerified set to false.
+	Result *LoginResult
+
+	// Err is the *protocol.Error describing the device public key verification failure.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DevicePublicKeyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the device public key verification error.
+func (e *DevicePublicKeyError) Unwrap() error {
+	return e.Err
+}
+
+// BackupFlagsError is returned when the assertion is valid but the backup flags of the credential changed unexpectedly
+// from the flags stored for the credential while VerifyBackupFlagTransitions is enabled. The caller decides whether to
+// accept the login, in which case the Result must be handled like the result of a successful login as the challenge
+// has been used and the credential updated.
+type BackupFlagsError struct {
+	// Result is the result of the login with the credential flags updated to the flags of the assertion.
+	Result *LoginResult
+
+	// Err is the *protocol.Error describing the unexpected transition.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *BackupFlagsError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the backup flags transition error.
+func (e *BackupFlagsError) Unwrap() error {
+	return e.Err
+}
+
+// FinishLoginResult is the same as FinishLogin but returns the LoginResult which includes the sign counts alongside the
+// credential.
+func (webauthn *WebAuthn) FinishLoginResult(user User, session SessionData, response *http.Request) (*LoginResult, error) {
+	parsedResponse, err := webauthn.parseCredentialRequestResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return webauthn.ValidateLoginResult(user, session, parsedResponse)
+}
+
 // ValidateLogin takes a parsed response and validates it against the user credentials and session data.
 func (webauthn *WebAuthn) ValidateLogin(user User, session SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*Credential, error) {
+	result, err := webauthn.ValidateLoginResult(user, session, parsedResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Credential, nil
+}
+
+// ValidateLoginResult is the same as ValidateLogin but returns the LoginResult which includes the sign counts alongside
+// the credential.
+func (webauthn *WebAuthn) ValidateLoginResult(user User, session SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*LoginResult, error) {
 	if !bytes.Equal(user.WebAuthnID(), session.UserID) {
 		return nil, protocol.ErrBadRequest.WithDetails("ID mismatch for User and Session")
 	}
@@ -161,6 +406,19 @@ func (webauthn *WebAuthn) ValidateLogin(user User, session SessionData, parsedRe
 	return webauthn.validateLogin(user, session, parsedResponse)
 }
 
+// FinishDiscoverableLogin takes the response from the client and validates it against the stored session data and the
+// credentials of the User resolved from the userHandle of the response.
+func (webauthn *WebAuthn) FinishDiscoverableLogin(resolver UserResolver, session SessionData, response *http.Request) (*Credential, error) {
+	parsedResponse, err := webauthn.parseCredentialRequestResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return webauthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (User, error) {
+		return resolver.GetUser(userHandle)
+	}, session, parsedResponse)
+}
+
 // ValidateDiscoverableLogin is an overloaded version of ValidateLogin that allows for discoverable credentials.
 func (webauthn *WebAuthn) ValidateDiscoverableLogin(handler DiscoverableUserHandler, session SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*Credential, error) {
 	if session.UserID != nil {
@@ -172,15 +430,20 @@ func (webauthn *WebAuthn) ValidateDiscoverableLogin(handler DiscoverableUserHand
 	}
 
 	user, err := handler(parsedResponse.RawID, parsedResponse.Response.UserHandle)
-	if err != nil {
+	if err != nil || user == nil {
 		return nil, protocol.ErrBadRequest.WithDetails("Failed to lookup Client-side Discoverable Credential")
 	}
 
-	return webauthn.validateLogin(user, session, parsedResponse)
+	result, err := webauthn.validateLogin(user, session, parsedResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Credential, nil
 }
 
 // ValidateLogin takes a parsed response and validates it against the user credentials and session data.
-func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*Credential, error) {
+func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedResponse *protocol.ParsedCredentialAssertionData) (*LoginResult, error) {
 	// Step 1. If the allowCredentials option was given when this authentication ceremony was initiated,
 	// verify that credential.id identifies one of the public key credentials that were listed in
 	// allowCredentials.
@@ -191,24 +454,16 @@ func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedRe
 	var credentialFound bool
 
 	if len(session.AllowedCredentialIDs) > 0 {
-		var credentialsOwned bool
-
-		for _, allowedCredentialID := range session.AllowedCredentialIDs {
-			for _, userCredential := range userCredentials {
-				if bytes.Equal(userCredential.ID, allowedCredentialID) {
-					credentialsOwned = true
-
-					break
+		// The credentials offered for a discoverable login may belong to several users, such as when a batch of
+		// credentials is offered with a single challenge, in which case only the returned credential must be owned.
+		if session.UserID != nil {
+			for _, allowedCredentialID := range session.AllowedCredentialIDs {
+				if !userOwnsCredential(userCredentials, allowedCredentialID) {
+					return nil, protocol.ErrBadRequest.WithDetails("User does not own all credentials from the allowedCredentialList")
 				}
-
-				credentialsOwned = false
 			}
 		}
 
-		if !credentialsOwned {
-			return nil, protocol.ErrBadRequest.WithDetails("User does not own all credentials from the allowedCredentialList")
-		}
-
 		for _, allowedCredentialID := range session.AllowedCredentialIDs {
 			if bytes.Equal(parsedResponse.RawID, allowedCredentialID) {
 				credentialFound = true
@@ -226,12 +481,8 @@ func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedRe
 	// the owner of the public key credential identified by credential.id.
 
 	// This is in part handled by our Step 1.
-
-	userHandle := parsedResponse.Response.UserHandle
-	if len(userHandle) > 0 {
-		if !bytes.Equal(userHandle, user.WebAuthnID()) {
-			return nil, protocol.ErrBadRequest.WithDetails("userHandle and User ID do not match")
-		}
+	if err := verifyUserHandle(parsedResponse, user.WebAuthnID()); err != nil {
+		return nil, err
 	}
 
 	// Step 3. Using credential’s id attribute (or the corresponding rawId, if base64url encoding is inappropriate
@@ -253,7 +504,59 @@ func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedRe
 		return nil, protocol.ErrBadRequest.WithDetails("Unable to find the credential for the returned credential ID")
 	}
 
-	shouldVerifyUser := session.UserVerification == protocol.VerificationRequired
+	return webauthn.verifyLoginCredential(session, loginCredential, parsedResponse)
+}
+
+// VerifyStoredAssertion validates the assertion against a credential the caller already looked up by the credential
+// ID of the assertion, without the User abstraction. The caller is responsible for the credential belonging to the
+// user the login was started for, as only the userHandle of the assertion is compared to the UserID of the session.
+// The returned LoginResult is the same as the result of ValidateLoginResult, and its Credential must be stored.
+func (webauthn *WebAuthn) VerifyStoredAssertion(credential Credential, assertion *protocol.CredentialAssertionResponse, session SessionData) (*LoginResult, error) {
+	var maxClientDataSize int
+
+	if webauthn.Config != nil {
+		maxClientDataSize = webauthn.Config.MaxClientDataSize
+	}
+
+	parsedResponse, err := assertion.ParseMaxSize(maxClientDataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.Expires.IsZero() && session.Expires.Before(time.Now()) {
+		return nil, protocol.ErrBadRequest.WithDetails("Session has Expired")
+	}
+
+	if !bytes.Equal(credential.ID, parsedResponse.RawID) {
+		return nil, protocol.ErrBadRequest.WithDetails("Stored credential ID does not match the returned credential ID")
+	}
+
+	if len(session.AllowedCredentialIDs) > 0 && !containsCredentialID(session.AllowedCredentialIDs, parsedResponse.RawID) {
+		return nil, protocol.ErrBadRequest.WithDetails("User does not own the credential returned")
+	}
+
+	if session.UserID != nil {
+		if err = verifyUserHandle(parsedResponse, session.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return webauthn.verifyLoginCredential(session, credential, parsedResponse)
+}
+
+// verifyUserHandle ensures the userHandle of the response is the ID of the user the login is for. The userHandle is
+// optional for non-discoverable credentials.
+func verifyUserHandle(parsedResponse *protocol.ParsedCredentialAssertionData, userID []byte) error {
+	if userHandle := parsedResponse.Response.UserHandle; len(userHandle) > 0 && !bytes.Equal(userHandle, userID) {
+		return protocol.ErrBadRequest.WithDetails("userHandle and User ID do not match")
+	}
+
+	return nil
+}
+
+// verifyLoginCredential performs the verification steps of a login once the credential of the assertion was found.
+func (webauthn *WebAuthn) verifyLoginCredential(session SessionData, loginCredential Credential, parsedResponse *protocol.ParsedCredentialAssertionData) (*LoginResult, error) {
+	shouldVerifyUser := session.UserVerification == protocol.VerificationRequired || session.Reauth
 
 	rpID := webauthn.Config.RPID
 	rpOrigins := webauthn.Config.RPOrigins
@@ -263,21 +566,146 @@ func (webauthn *WebAuthn) validateLogin(user User, session SessionData, parsedRe
 		return nil, err
 	}
 
+	log := webauthn.logger()
+
+	if err = webauthn.Config.verifyCrossOrigin(&parsedResponse.Response.CollectedClientData); err != nil {
+		log.Debug("login cross origin rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
 	// Handle steps 4 through 16.
-	validError := parsedResponse.Verify(session.Challenge, rpID, rpOrigins, appID, shouldVerifyUser, loginCredential.PublicKey)
+	validError := parsedResponse.Verify(session.Challenge, rpID, rpOrigins, appID, shouldVerifyUser, loginCredential.PublicKey, ceremonyTypes(webauthn.Config.AdditionalGetTypes)...)
 	if validError != nil {
+		log.Debug("login verification failed", "error_type", errorType(validError), "appid", appID != "")
+
 		return nil, validError
 	}
 
+	signCountBefore := loginCredential.Authenticator.SignCount
+
+	// An authenticator which reported no sign count at registration may start reporting one, for example after a
+	// firmware update, in which case the counter is enforced from this login on.
+	signCountEnabled := webauthn.Config.EnableSignCountWhenReported && loginCredential.Authenticator.SignCountUnsupported &&
+		parsedResponse.Response.AuthenticatorData.Counter != 0
+	if signCountEnabled {
+		loginCredential.Authenticator.SignCountUnsupported = false
+	}
+
 	// Handle step 17.
 	loginCredential.Authenticator.UpdateCounter(parsedResponse.Response.AuthenticatorData.Counter)
 
-	// TODO: The backup eligible flag shouldn't change. Should decide if we want to error if it does.
+	log.Debug("login assertion verified",
+		"user_present", parsedResponse.Response.AuthenticatorData.Flags.HasUserPresent(),
+		"user_verified", parsedResponse.Response.AuthenticatorData.Flags.HasUserVerified(),
+		"user_verification_required", shouldVerifyUser,
+		"reauth", session.Reauth,
+		"appid", appID != "",
+		"sign_count", parsedResponse.Response.AuthenticatorData.Counter,
+		"clone_warning", loginCredential.Authenticator.CloneWarning,
+		"sign_count_enabled", signCountEnabled,
+	)
+
+	extensions, err := protocol.ParseExtensions(session.Extensions, parsedResponse.ClientExtensionResults, parsedResponse.Response.AuthenticatorData.Extensions)
+	if err != nil {
+		log.Debug("login extension parsing failed", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	if err = webauthn.consumeChallenge(session); err != nil {
+		return nil, err
+	}
+
+	storedFlags := loginCredential.Flags
+
 	// Update flags from response data.
 	loginCredential.Flags.UserPresent = parsedResponse.Response.AuthenticatorData.Flags.HasUserPresent()
 	loginCredential.Flags.UserVerified = parsedResponse.Response.AuthenticatorData.Flags.HasUserVerified()
 	loginCredential.Flags.BackupEligible = parsedResponse.Response.AuthenticatorData.Flags.HasBackupEligible()
 	loginCredential.Flags.BackupState = parsedResponse.Response.AuthenticatorData.Flags.HasBackupState()
 
-	return &loginCredential, nil
+	result := &LoginResult{
+		Credential:              &loginCredential,
+		SignCountBefore:         signCountBefore,
+		SignCountAfter:          loginCredential.Authenticator.SignCount,
+		SignCountEnabled:        signCountEnabled,
+		AuthenticatorAttachment: parsedResponse.AuthenticatorAttachment,
+		Extensions:              extensions,
+		LargeBlobWrite:          largeBlobWriteResult(session.Extensions, parsedResponse.ClientExtensionResults),
+	}
+
+	// The devicePubKey extension signature is verified in addition to the assertion signature, and its failure is
+	// reported separately as the assertion itself is valid.
+	if result.DevicePublicKey, err = parsedResponse.VerifyDevicePublicKey(); err != nil {
+		log.Debug("login device public key verification failed", "error_type", errorType(err))
+
+		return nil, &DevicePublicKeyError{Result: result, Err: err}
+	}
+
+	result.DevicePublicKeyVerified = result.DevicePublicKey != nil
+
+	if result.DevicePublicKeyVerified {
+		result.DevicePublicKeyAdded = loginCredential.AddDevicePublicKey(*result.DevicePublicKey)
+
+		log.Debug("login device public key verified", "device_public_key_added", result.DevicePublicKeyAdded)
+	}
+
+	if webauthn.Config.VerifyBackupFlagTransitions {
+		if err = verifyBackupFlagTransition(storedFlags, loginCredential.Flags); err != nil {
+			log.Debug("login backup flags transition rejected", "error_type", errorType(err), "reason", err.Error())
+
+			return nil, &BackupFlagsError{Result: result, Err: err}
+		}
+	}
+
+	return result, nil
+}
+
+// verifyBackupFlagTransition ensures the credential did not lose its backup eligibility and did not go from backed up
+// to not backed up. The backup eligibility becoming set is not reported as credentials stored before the flags were
+// recorded have it unset.
+func verifyBackupFlagTransition(stored, current CredentialFlags) error {
+	if stored.BackupEligible && !current.BackupEligible {
+		return protocol.ErrBackupFlags.WithDetails("Credential is no longer backup eligible")
+	}
+
+	if stored.BackupState && !current.BackupState {
+		return protocol.ErrBackupFlags.WithDetails("Credential is no longer backed up")
+	}
+
+	return nil
+}
+
+// containsCredentialID returns true if the credential IDs include the credential ID.
+func containsCredentialID(credentialIDs [][]byte, credentialID []byte) bool {
+	for _, id := range credentialIDs {
+		if bytes.Equal(id, credentialID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// userOwnsCredential returns true if one of the credentials has the credential ID.
+func userOwnsCredential(credentials []Credential, credentialID []byte) bool {
+	for _, credential := range credentials {
+		if bytes.Equal(credential.ID, credentialID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseCredentialRequestResponse parses the response limiting the client data to the configured size.
+func (webauthn *WebAuthn) parseCredentialRequestResponse(response *http.Request) (*protocol.ParsedCredentialAssertionData, error) {
+	var maxClientDataSize int
+
+	if webauthn.Config != nil {
+		maxClientDataSize = webauthn.Config.MaxClientDataSize
+	}
+
+	return protocol.ParseCredentialRequestResponseMaxSize(response, maxClientDataSize)
 }
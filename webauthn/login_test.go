@@ -1,9 +1,27 @@
 package webauthn
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 func TestLogin_FinishLoginFailure(t *testing.T) {
@@ -26,3 +44,1275 @@ func TestLogin_FinishLoginFailure(t *testing.T) {
 		t.Errorf("FinishLogin() credential = %v, want nil", credential)
 	}
 }
+
+func TestLogin_ReauthRequiresUserVerification(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	assertion, session, err := w.BeginLogin(user, WithReauth())
+	require.NoError(t, err)
+
+	assert.Equal(t, protocol.VerificationRequired, assertion.Response.UserVerification)
+	assert.Equal(t, int(defaultTimeoutReauth.Milliseconds()), assertion.Response.Timeout)
+	assert.True(t, session.Reauth)
+
+	// Demonstrate the flag is enforced independently of the stored user verification requirement.
+	session.UserVerification = protocol.VerificationPreferred
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	require.Error(t, err)
+	assert.Equal(t, "User verification required but flag not set by authenticator\n", err.(*protocol.Error).DevInfo)
+
+	credential, err := w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagUserVerified))
+	require.NoError(t, err)
+	assert.True(t, credential.Flags.UserVerified)
+
+	session.Reauth = false
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.NoError(t, err)
+
+	withTimeout := func(cco *protocol.PublicKeyCredentialRequestOptions) {
+		cco.Timeout = 30000
+	}
+
+	for _, opts := range [][]LoginOption{
+		{WithReauth(), withTimeout, WithUserVerification(protocol.VerificationDiscouraged)},
+		{withTimeout, WithUserVerification(protocol.VerificationDiscouraged), WithReauth()},
+	} {
+		assertion, session, err = w.BeginLogin(user, opts...)
+		require.NoError(t, err)
+
+		assert.Equal(t, protocol.VerificationRequired, assertion.Response.UserVerification)
+		assert.Equal(t, 30000, assertion.Response.Timeout)
+		assert.True(t, session.Reauth)
+	}
+}
+
+func TestLogin_ValidateLoginUserHandle(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	testCases := []struct {
+		name       string
+		userHandle []byte
+		err        string
+	}{
+		{"ShouldAcceptMatchingUserHandle", []byte("123"), ""},
+		{"ShouldAcceptAbsentUserHandle", nil, ""},
+		{"ShouldRejectMismatchedUserHandle", []byte("456"), "userHandle and User ID do not match"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			_, err = w.ValidateLogin(user, *session, loginTestAssertionWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: tc.userHandle}))
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, protocol.ErrBadRequest.Type, err.(*protocol.Error).Type)
+		})
+	}
+}
+
+func TestLogin_ValidateLoginResultSignCounts(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		stored       uint32
+		before       uint32
+		after        uint32
+		cloneWarning bool
+	}{
+		{"ShouldReportIncrementedSignCount", 0, 0, 1, false},
+		{"ShouldReportUnchangedSignCountOnCloneWarning", 5, 5, 5, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credential := loginTestCredential(t, key)
+			credential.Authenticator.SignCount = tc.stored
+
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			result, err := w.ValidateLoginResult(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.before, result.SignCountBefore)
+			assert.Equal(t, tc.after, result.SignCountAfter)
+			assert.Equal(t, tc.after, result.Credential.Authenticator.SignCount)
+			assert.Equal(t, tc.cloneWarning, result.Credential.Authenticator.CloneWarning)
+		})
+	}
+}
+
+func TestLogin_RegisteredExtension(t *testing.T) {
+	protocol.RegisterExtension("exampleLogin", func(input, clientOutput, _ interface{}) (interface{}, error) {
+		if clientOutput != true {
+			return nil, protocol.ErrVerification.WithDetails("Extension output is missing")
+		}
+
+		return input, nil
+	})
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	_, session, err := w.BeginLogin(user, WithAssertionExtensions(protocol.AuthenticationExtensions{"exampleLogin": "input"}))
+	require.NoError(t, err)
+
+	_, err = w.ValidateLoginResult(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.EqualError(t, err, "Extension output is missing")
+
+	assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+	assertion.ClientExtensionResults = protocol.AuthenticationExtensionsClientOutputs{"exampleLogin": true}
+
+	result, err := w.ValidateLoginResult(user, *session, assertion)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"exampleLogin": "input"}, result.Extensions)
+}
+
+func TestLogin_ValidateLoginResultAuthenticatorAttachment(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		field      string
+		attachment protocol.AuthenticatorAttachment
+	}{
+		{"ShouldParsePlatform", `,"authenticatorAttachment":"platform"`, protocol.Platform},
+		{"ShouldParseCrossPlatform", `,"authenticatorAttachment":"cross-platform"`, protocol.CrossPlatform},
+		{"ShouldTolerateAbsence", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			body := loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent})
+			body = strings.TrimSuffix(body, "}") + tc.field + "}"
+
+			par, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(body))
+			require.NoError(t, err)
+
+			result, err := w.ValidateLoginResult(user, *session, par)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.attachment, result.AuthenticatorAttachment)
+		})
+	}
+}
+
+func TestLogin_CredentialAlgorithm(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credential := loginTestCredential(t, key)
+
+	// The P-256 key declares secp256k1 which would otherwise be verified as P-256 as the curve of the signature is
+	// derived from the ES256 algorithm.
+	credential.PublicKey, err = webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.Secp256k1),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+	_, session, err := w.BeginLogin(user)
+	require.NoError(t, err)
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	require.Error(t, err)
+	assert.Equal(t, protocol.ErrAssertionSignature.Type, err.(*protocol.Error).Type)
+	assert.Equal(t, "Error validating the assertion public key algorithm: Key algorithm -7 is not consistent with the curve 8", err.Error())
+
+	user.credentials[0] = loginTestCredential(t, key)
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.NoError(t, err)
+}
+
+func TestLogin_DevicePublicKeys(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	laptop, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	phone, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	login := func(dpkKey *ecdsa.PrivateKey) *LoginResult {
+		_, session, err := w.BeginLogin(user)
+		require.NoError(t, err)
+
+		par, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, dpkKey: dpkKey})))
+		require.NoError(t, err)
+
+		result, err := w.ValidateLoginResult(user, *session, par)
+		require.NoError(t, err)
+
+		user.credentials[0] = *result.Credential
+
+		return result
+	}
+
+	result := login(laptop)
+	assert.True(t, result.DevicePublicKeyAdded)
+	require.Len(t, result.Credential.DevicePublicKeys, 1)
+	assert.Equal(t, registrationTestEC2PublicKey(t, &laptop.PublicKey), result.Credential.DevicePublicKeys[0].PublicKey)
+
+	first := result.Credential.DevicePublicKeys
+
+	result = login(phone)
+	assert.True(t, result.DevicePublicKeyAdded)
+	require.Len(t, result.Credential.DevicePublicKeys, 2)
+	assert.Equal(t, registrationTestEC2PublicKey(t, &laptop.PublicKey), result.Credential.DevicePublicKeys[0].PublicKey)
+	assert.Equal(t, registrationTestEC2PublicKey(t, &phone.PublicKey), result.Credential.DevicePublicKeys[1].PublicKey)
+	assert.Len(t, first, 1)
+
+	result = login(laptop)
+	assert.False(t, result.DevicePublicKeyAdded)
+	assert.Len(t, result.Credential.DevicePublicKeys, 2)
+}
+
+func TestLogin_ValidateLoginResultDevicePublicKey(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dpkKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		tamper bool
+		err    string
+	}{
+		{"ShouldVerifyDevicePublicKey", false, ""},
+		{"ShouldReportTamperedDevicePublicKeySignature", true, "Error validating the device public key signature: <nil>"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			body := loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, dpkKey: dpkKey, dpkTamper: tc.tamper})
+
+			par, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(body))
+			require.NoError(t, err)
+
+			result, err := w.ValidateLoginResult(user, *session, par)
+
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.NotNil(t, result.DevicePublicKey)
+
+				assert.True(t, result.DevicePublicKeyVerified)
+				assert.Equal(t, registrationTestEC2PublicKey(t, &dpkKey.PublicKey), result.DevicePublicKey.PublicKey)
+
+				return
+			}
+
+			assert.Nil(t, result)
+			assert.EqualError(t, err, tc.err)
+
+			var dpkErr *DevicePublicKeyError
+
+			require.ErrorAs(t, err, &dpkErr)
+			assert.Equal(t, protocol.ErrDevicePublicKey.Type, dpkErr.Err.(*protocol.Error).Type)
+			assert.False(t, dpkErr.Result.DevicePublicKeyVerified)
+			assert.NotNil(t, dpkErr.Result.DevicePublicKey)
+			assert.Equal(t, uint32(1), dpkErr.Result.Credential.Authenticator.SignCount)
+		})
+	}
+}
+
+func TestLogin_VerifyBackupFlagTransitions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		stored CredentialFlags
+		flags  protocol.AuthenticatorFlags
+		err    string
+	}{
+		{"ShouldAcceptUnchangedBackedUp", CredentialFlags{BackupEligible: true, BackupState: true}, protocol.FlagBackupEligible | protocol.FlagBackupState, ""},
+		{"ShouldAcceptBecomingBackedUp", CredentialFlags{BackupEligible: true}, protocol.FlagBackupEligible | protocol.FlagBackupState, ""},
+		{"ShouldAcceptBecomingBackupEligible", CredentialFlags{}, protocol.FlagBackupEligible, ""},
+		{"ShouldRejectNoLongerBackedUp", CredentialFlags{BackupEligible: true, BackupState: true}, protocol.FlagBackupEligible, "Credential is no longer backed up"},
+		{"ShouldRejectNoLongerBackupEligible", CredentialFlags{BackupEligible: true}, 0, "Credential is no longer backup eligible"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                        "example.com",
+				RPDisplayName:               "Example",
+				RPOrigins:                   []string{"https://example.com"},
+				VerifyBackupFlagTransitions: true,
+			})
+			require.NoError(t, err)
+
+			credential := loginTestCredential(t, key)
+			credential.Flags = tc.stored
+
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			result, err := w.ValidateLoginResult(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent|tc.flags))
+
+			if tc.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tc.flags.HasBackupState(), result.Credential.Flags.BackupState)
+
+				return
+			}
+
+			var flagsErr *BackupFlagsError
+
+			require.ErrorAs(t, err, &flagsErr)
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, protocol.ErrBackupFlags.Type, flagsErr.Err.(*protocol.Error).Type)
+			require.NotNil(t, flagsErr.Result)
+			assert.Equal(t, tc.flags.HasBackupEligible(), flagsErr.Result.Credential.Flags.BackupEligible)
+		})
+	}
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	credential := loginTestCredential(t, key)
+	credential.Flags = CredentialFlags{BackupEligible: true, BackupState: true}
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+	_, session, err := w.BeginLogin(user)
+	require.NoError(t, err)
+
+	_, err = w.ValidateLoginResult(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.NoError(t, err)
+}
+
+func TestLogin_AppID(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	const appID = "https://example.com/u2f/app-id.json"
+
+	testCases := []struct {
+		name          string
+		signedRPID    string
+		appIDExtended bool
+		valid         bool
+	}{
+		{"ShouldVerifyAppIDHashWhenAppIDUsed", appID, true, true},
+		{"ShouldVerifyRPIDHashWhenAppIDAbsent", "example.com", false, true},
+		{"ShouldRejectRPIDHashWhenAppIDUsed", "example.com", true, false},
+		{"ShouldRejectAppIDHashWhenAppIDAbsent", appID, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credential := loginTestCredential(t, key)
+			credential.AttestationType = protocol.CredentialTypeFIDOU2F
+
+			if tc.appIDExtended {
+				// Credentials registered with the FIDO U2F JavaScript API have an uncompressed point public key.
+				credential.PublicKey = elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+			}
+
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+			_, session, err := w.BeginLogin(user, WithAppIdExtension(appID))
+			require.NoError(t, err)
+
+			par, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, rpID: tc.signedRPID, appID: &tc.appIDExtended})))
+			require.NoError(t, err)
+
+			_, err = w.ValidateLogin(user, *session, par)
+			if tc.valid {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, protocol.ErrVerification.Type, err.(*protocol.Error).Type)
+		})
+	}
+}
+
+func TestBeginLoginHints(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	assertion, _, err := w.BeginDiscoverableLogin(WithAssertionHints(protocol.HintSecurityKey))
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.Hint{protocol.HintSecurityKey}, assertion.Response.Hints)
+
+	_, _, err = w.BeginDiscoverableLogin(WithAssertionHints(protocol.HintSecurityKey, protocol.HintSecurityKey))
+	assert.EqualError(t, err, "Duplicate hint 'security-key'")
+}
+
+func TestLogin_ChallengeStoreRejectsReplay(t *testing.T) {
+	store := &testChallengeStore{used: map[string]bool{}}
+
+	w, err := New(&Config{
+		RPID:           "example.com",
+		RPDisplayName:  "Example",
+		RPOrigins:      []string{"https://example.com"},
+		ChallengeStore: store,
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	_, session, err := w.BeginLogin(user)
+	require.NoError(t, err)
+
+	assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+
+	_, err = w.ValidateLogin(user, *session, assertion)
+	require.NoError(t, err)
+	assert.True(t, store.used[session.Challenge])
+
+	_, err = w.ValidateLogin(user, *session, assertion)
+	assert.EqualError(t, err, "Session challenge has already been used")
+}
+
+func TestLogin_ChallengeStoreRejectsConcurrentReplay(t *testing.T) {
+	store := &testChallengeStore{used: map[string]bool{}}
+
+	w, err := New(&Config{
+		RPID:           "example.com",
+		RPDisplayName:  "Example",
+		RPOrigins:      []string{"https://example.com"},
+		ChallengeStore: store,
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	_, session, err := w.BeginLogin(user)
+	require.NoError(t, err)
+
+	assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+
+	const submissions = 16
+
+	var (
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+		errs      = make(chan error, submissions)
+		succeeded int
+	)
+
+	for i := 0; i < submissions; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			_, err := w.ValidateLogin(user, *session, assertion)
+			errs <- err
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.EqualError(t, err, "Session challenge has already been used")
+		}
+	}
+
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestLogin_AllowCrossOrigin(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	testCases := []struct {
+		name        string
+		allow       bool
+		crossOrigin bool
+		topOrigin   string
+		err         string
+	}{
+		{"ShouldAcceptSameOrigin", false, false, "", ""},
+		{"ShouldAcceptAllowedCrossOrigin", true, true, "https://example.com", ""},
+		{"ShouldRejectCrossOrigin", false, true, "https://example.com", "Error validating cross origin"},
+		{"ShouldRejectUnexpectedTopOrigin", true, true, "https://other.example", "Error validating top origin"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:             "example.com",
+				RPDisplayName:    "Example",
+				RPOrigins:        []string{"https://example.com"},
+				AllowCrossOrigin: tc.allow,
+			})
+			require.NoError(t, err)
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+			assertion.Response.CollectedClientData.CrossOrigin = tc.crossOrigin
+			assertion.Response.CollectedClientData.TopOrigin = tc.topOrigin
+
+			_, err = w.ValidateLogin(user, *session, assertion)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestLogin_AllowedTopOrigins(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	testCases := []struct {
+		name        string
+		crossOrigin bool
+		topOrigin   string
+		err         string
+	}{
+		{"ShouldAcceptSameOrigin", false, "", ""},
+		{"ShouldAcceptAllowedTopOrigin", true, "https://widgets.example.org", ""},
+		{"ShouldRejectDisallowedTopOrigin", true, "https://evil.example.net", "Error validating top origin"},
+		{"ShouldRejectRPOriginNotInTopOrigins", true, "https://example.com", "Error validating top origin"},
+		{"ShouldRejectMissingTopOrigin", true, "", "Error validating top origin"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:              "example.com",
+				RPDisplayName:     "Example",
+				RPOrigins:         []string{"https://example.com"},
+				AllowCrossOrigin:  true,
+				AllowedTopOrigins: []string{"https://widgets.example.org"},
+			})
+			require.NoError(t, err)
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+			assertion.Response.CollectedClientData.CrossOrigin = tc.crossOrigin
+			assertion.Response.CollectedClientData.TopOrigin = tc.topOrigin
+
+			_, err = w.ValidateLogin(user, *session, assertion)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestLogin_AdditionalGetTypes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+	testCases := []struct {
+		name       string
+		additional []string
+		clientType protocol.CeremonyType
+		err        string
+	}{
+		{"ShouldAcceptDefaultType", nil, protocol.AssertCeremony, ""},
+		{"ShouldRejectCustomTypeByDefault", nil, "payment.get", "Error validating ceremony type"},
+		{"ShouldAcceptConfiguredCustomType", []string{"payment.get"}, "payment.get", ""},
+		{"ShouldAcceptDefaultTypeWithCustomType", []string{"payment.get"}, protocol.AssertCeremony, ""},
+		{"ShouldRejectCreateType", []string{"payment.get"}, protocol.CreateCeremony, "Error validating ceremony type"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:               "example.com",
+				RPDisplayName:      "Example",
+				RPOrigins:          []string{"https://example.com"},
+				AdditionalGetTypes: tc.additional,
+			})
+			require.NoError(t, err)
+
+			_, session, err := w.BeginLogin(user)
+			require.NoError(t, err)
+
+			assertion := loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent)
+			assertion.Response.CollectedClientData.Type = tc.clientType
+
+			_, err = w.ValidateLogin(user, *session, assertion)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestLogin_OfferedCredentials(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credential := loginTestCredential(t, key)
+	other := Credential{ID: []byte("other")}
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential, other}}
+
+	_, session, err := w.BeginLogin(user, WithAllowedCredentials([]protocol.CredentialDescriptor{other.Descriptor()}))
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]byte{other.ID}, session.AllowedCredentialIDs)
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.EqualError(t, err, "User does not own the credential returned")
+
+	_, session, err = w.BeginLogin(user, WithAllowedCredentials([]protocol.CredentialDescriptor{Credential{ID: []byte("unknown")}.Descriptor(), credential.Descriptor()}))
+	require.NoError(t, err)
+
+	_, err = w.ValidateLogin(user, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+	assert.EqualError(t, err, "User does not own all credentials from the allowedCredentialList")
+}
+
+func TestLogin_DiscoverableOfferedCredentials(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credential := loginTestCredential(t, key)
+	other := Credential{ID: []byte("other")}
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+	handler := func(_, _ []byte) (User, error) {
+		return user, nil
+	}
+
+	// The offered credentials belong to several users.
+	_, session, err := w.BeginDiscoverableLogin(WithAllowedCredentials([]protocol.CredentialDescriptor{other.Descriptor(), credential.Descriptor()}))
+	require.NoError(t, err)
+
+	used, err := w.ValidateDiscoverableLogin(handler, *session, loginTestAssertionWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: user.id}))
+	require.NoError(t, err)
+
+	assert.Equal(t, credential.ID, used.ID)
+
+	_, session, err = w.BeginDiscoverableLogin(WithAllowedCredentials([]protocol.CredentialDescriptor{other.Descriptor()}))
+	require.NoError(t, err)
+
+	_, err = w.ValidateDiscoverableLogin(handler, *session, loginTestAssertionWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: user.id}))
+	assert.EqualError(t, err, "User does not own the credential returned")
+}
+
+func TestLogin_FinishDiscoverableLoginUserResolver(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	resolver := loginTestUserResolver{
+		"123": &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}},
+	}
+
+	testCases := []struct {
+		name       string
+		userHandle []byte
+		err        string
+	}{
+		{"ShouldResolveMatchingHandle", []byte("123"), ""},
+		{"ShouldFailMissingHandle", []byte("456"), "Failed to lookup Client-side Discoverable Credential"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, session, err := w.BeginDiscoverableLogin()
+			require.NoError(t, err)
+
+			body := loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: tc.userHandle})
+
+			credential, err := w.FinishDiscoverableLogin(resolver, *session, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, loginTestCredentialID, credential.ID)
+		})
+	}
+
+	_, session, err := w.BeginDiscoverableLogin()
+	require.NoError(t, err)
+
+	var resolved []byte
+
+	adapter := UserResolverFunc(func(handle []byte) (User, error) {
+		resolved = handle
+
+		return resolver.GetUser(handle)
+	})
+
+	body := loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: []byte("123")})
+
+	_, err = w.FinishDiscoverableLogin(adapter, *session, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("123"), resolved)
+}
+
+// loginTestUserResolver is a UserResolver backed by a map of the users indexed by their WebAuthnID.
+type loginTestUserResolver map[string]User
+
+func (r loginTestUserResolver) GetUser(handle []byte) (User, error) {
+	user, ok := r[string(handle)]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return user, nil
+}
+
+// testChallengeStore is an in-memory ChallengeStore.
+type testChallengeStore struct {
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func (s *testChallengeStore) Consume(challenge string, _ time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.used[challenge] {
+		return false, nil
+	}
+
+	s.used[challenge] = true
+
+	return true, nil
+}
+
+type loginTestUser struct {
+	defaultUser
+
+	credentials []Credential
+}
+
+func (user *loginTestUser) WebAuthnCredentials() []Credential {
+	return user.credentials
+}
+
+// loginTestCredential returns a credential with the ID loginTestCredentialID for the public key.
+func TestLogin_EnableSignCountWhenReported(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	type login struct {
+		counter      uint32
+		enabled      bool
+		unsupported  bool
+		signCount    uint32
+		cloneWarning bool
+	}
+
+	testCases := []struct {
+		name   string
+		enable bool
+		logins []login
+	}{
+		{
+			"ShouldEnforceAfterFirstNonzeroCount",
+			true,
+			[]login{
+				{0, false, true, 0, false},
+				{0, false, true, 0, false},
+				{5, true, false, 5, false},
+				{6, false, false, 6, false},
+				{6, false, false, 6, true},
+			},
+		},
+		{
+			"ShouldNotEnforceWhenDisabled",
+			false,
+			[]login{
+				{0, false, true, 0, false},
+				{5, false, true, 5, false},
+				{5, false, true, 5, false},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                        "example.com",
+				RPDisplayName:               "Example",
+				RPOrigins:                   []string{"https://example.com"},
+				EnableSignCountWhenReported: tc.enable,
+			})
+			require.NoError(t, err)
+
+			credential := loginTestCredential(t, key)
+			credential.Authenticator.SignCountUnsupported = true
+
+			for i, l := range tc.logins {
+				user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+				_, session, err := w.BeginLogin(user)
+				require.NoError(t, err)
+
+				response, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(loginTestAssertionBodyWith(t, key, session.Challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, counter: &l.counter})))
+				require.NoError(t, err)
+
+				result, err := w.ValidateLoginResult(user, *session, response)
+				require.NoError(t, err, "login %d", i)
+
+				assert.Equal(t, l.enabled, result.SignCountEnabled, "login %d", i)
+				assert.Equal(t, l.unsupported, result.Credential.Authenticator.SignCountUnsupported, "login %d", i)
+				assert.Equal(t, l.signCount, result.SignCountAfter, "login %d", i)
+				assert.Equal(t, l.cloneWarning, result.Credential.Authenticator.CloneWarning, "login %d", i)
+
+				credential = *result.Credential
+			}
+		})
+	}
+}
+
+func TestLogin_VerifyStoredAssertion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	assertion := func(t *testing.T, challenge string, userHandle []byte) *protocol.CredentialAssertionResponse {
+		var car protocol.CredentialAssertionResponse
+
+		require.NoError(t, json.Unmarshal([]byte(loginTestAssertionBodyWith(t, key, challenge, loginTestAssertionOptions{flags: protocol.FlagUserPresent, userHandle: userHandle})), &car))
+
+		return &car
+	}
+
+	credential := loginTestCredential(t, key)
+	credential.Authenticator.AAGUID = make([]byte, 16)
+
+	t.Run("ShouldVerifyAgainstStoredCredential", func(t *testing.T) {
+		user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+		_, session, err := w.BeginLogin(user)
+		require.NoError(t, err)
+
+		result, err := w.VerifyStoredAssertion(credential, assertion(t, session.Challenge, []byte("123")), *session)
+		require.NoError(t, err)
+
+		assert.Equal(t, loginTestCredentialID, result.Credential.ID)
+		assert.Equal(t, uint32(0), result.SignCountBefore)
+		assert.Equal(t, uint32(1), result.SignCountAfter)
+		assert.True(t, result.Credential.Flags.UserPresent)
+	})
+
+	t.Run("ShouldVerifyDiscoverableLogin", func(t *testing.T) {
+		_, session, err := w.BeginDiscoverableLogin()
+		require.NoError(t, err)
+
+		result, err := w.VerifyStoredAssertion(credential, assertion(t, session.Challenge, []byte("123")), *session)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint32(1), result.SignCountAfter)
+	})
+
+	t.Run("ShouldFailOtherCredential", func(t *testing.T) {
+		_, session, err := w.BeginDiscoverableLogin()
+		require.NoError(t, err)
+
+		other := credential
+		other.ID = []byte("other")
+
+		_, err = w.VerifyStoredAssertion(other, assertion(t, session.Challenge, nil), *session)
+		assert.EqualError(t, err, "Stored credential ID does not match the returned credential ID")
+	})
+
+	t.Run("ShouldFailCredentialNotAllowed", func(t *testing.T) {
+		user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{{ID: []byte("other")}}}
+
+		_, session, err := w.BeginLogin(user)
+		require.NoError(t, err)
+
+		_, err = w.VerifyStoredAssertion(credential, assertion(t, session.Challenge, nil), *session)
+		assert.EqualError(t, err, "User does not own the credential returned")
+	})
+
+	t.Run("ShouldFailUserHandleMismatch", func(t *testing.T) {
+		user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{credential}}
+
+		_, session, err := w.BeginLogin(user)
+		require.NoError(t, err)
+
+		_, err = w.VerifyStoredAssertion(credential, assertion(t, session.Challenge, []byte("456")), *session)
+		assert.EqualError(t, err, "userHandle and User ID do not match")
+	})
+
+	t.Run("ShouldFailWrongChallenge", func(t *testing.T) {
+		_, session, err := w.BeginDiscoverableLogin()
+		require.NoError(t, err)
+
+		_, err = w.VerifyStoredAssertion(credential, assertion(t, "E4PTcIH_HfX1pC6Sigk1SC9NAlgeztN0439vi8z_c9k", nil), *session)
+		assert.EqualError(t, err, "Error validating challenge")
+	})
+}
+
+func TestLogin_LargeBlobWrite(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		write    bool
+		outputs  protocol.AuthenticationExtensionsClientOutputs
+		expected LargeBlobWriteResult
+	}{
+		{"ShouldReportSucceeded", true, protocol.AuthenticationExtensionsClientOutputs{"largeBlob": map[string]interface{}{"written": true}}, LargeBlobWriteSucceeded},
+		{"ShouldReportFailed", true, protocol.AuthenticationExtensionsClientOutputs{"largeBlob": map[string]interface{}{"written": false}}, LargeBlobWriteFailed},
+		{"ShouldReportUnknownWithoutOutput", true, nil, LargeBlobWriteUnknown},
+		{"ShouldReportUnknownWithoutWritten", true, protocol.AuthenticationExtensionsClientOutputs{"largeBlob": map[string]interface{}{}}, LargeBlobWriteUnknown},
+		{"ShouldReportNotRequested", false, protocol.AuthenticationExtensionsClientOutputs{"largeBlob": map[string]interface{}{"written": true}}, LargeBlobWriteNotRequested},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{loginTestCredential(t, key)}}
+
+			var opts []LoginOption
+
+			if tc.write {
+				opts = append(opts, WithLargeBlobWrite([]byte("blob")))
+			}
+
+			assertion, session, err := w.BeginLogin(user, opts...)
+			require.NoError(t, err)
+
+			if tc.write {
+				data, err := json.Marshal(assertion.Response.Extensions)
+				require.NoError(t, err)
+
+				assert.JSONEq(t, `{"largeBlob":{"write":"YmxvYg"}}`, string(data))
+			}
+
+			// The session is stored between the ceremonies, so the result must be determined from the decoded session.
+			data, err := json.Marshal(session)
+			require.NoError(t, err)
+
+			var stored SessionData
+
+			require.NoError(t, json.Unmarshal(data, &stored))
+
+			response := loginTestAssertion(t, key, stored.Challenge, protocol.FlagUserPresent)
+			response.ClientExtensionResults = tc.outputs
+
+			result, err := w.ValidateLoginResult(user, stored, response)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, result.LargeBlobWrite)
+		})
+	}
+}
+
+func loginTestCredential(t *testing.T, key *ecdsa.PrivateKey) Credential {
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	return Credential{
+		ID:        loginTestCredentialID,
+		PublicKey: publicKey,
+	}
+}
+
+var loginTestCredentialID = []byte("credential")
+
+// loginTestAssertionOptions adjusts the assertions returned by loginTestAssertionWith and loginTestAssertionBodyWith.
+type loginTestAssertionOptions struct {
+	flags      protocol.AuthenticatorFlags
+	userHandle []byte
+
+	// counter is the sign count reported by the assertion, which is 1 when nil.
+	counter *uint32
+
+	// rpID is the RP ID the authenticator data is signed for, which is example.com when empty.
+	rpID string
+
+	// appID is the appid extension output when not nil.
+	appID *bool
+
+	// dpkKey includes the devicePubKey extension output for the key when not nil, whose signature is made over the
+	// client data hash rather than the assertion if dpkTamper is true.
+	dpkKey    *ecdsa.PrivateKey
+	dpkTamper bool
+}
+
+// loginTestAssertion returns an assertion for the credential with the ID loginTestCredentialID signed by the key for
+// the example.com relying party.
+func loginTestAssertion(t *testing.T, key *ecdsa.PrivateKey, challenge string, flags protocol.AuthenticatorFlags) *protocol.ParsedCredentialAssertionData {
+	return loginTestAssertionWith(t, key, challenge, loginTestAssertionOptions{flags: flags})
+}
+
+// loginTestAssertionWith is the same as loginTestAssertion but the assertion is adjusted by the options.
+func loginTestAssertionWith(t *testing.T, key *ecdsa.PrivateKey, challenge string, opts loginTestAssertionOptions) *protocol.ParsedCredentialAssertionData {
+	par, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(loginTestAssertionBodyWith(t, key, challenge, opts)))
+	require.NoError(t, err)
+
+	return par
+}
+
+// loginTestAssertionBodyWith returns the JSON body of the assertion returned by loginTestAssertionWith.
+func loginTestAssertionBodyWith(t *testing.T, key *ecdsa.PrivateKey, challenge string, opts loginTestAssertionOptions) string {
+	rpID, counter := "example.com", uint32(1)
+
+	if opts.rpID != "" {
+		rpID = opts.rpID
+	}
+
+	if opts.counter != nil {
+		counter = *opts.counter
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+
+	if opts.dpkKey == nil {
+		authData = append(authData, byte(opts.flags))
+		authData = binary.BigEndian.AppendUint32(authData, counter)
+	} else {
+		dpk, err := webauthncbor.Marshal(protocol.DevicePublicKey{
+			AAGUID:    make([]byte, 16),
+			PublicKey: registrationTestEC2PublicKey(t, &opts.dpkKey.PublicKey),
+			Nonce:     []byte("nonce"),
+			Format:    "none",
+		})
+		require.NoError(t, err)
+
+		extensions, err := webauthncbor.Marshal(map[string]interface{}{protocol.ExtensionDevicePublicKey: dpk})
+		require.NoError(t, err)
+
+		authData = append(authData, byte(opts.flags|protocol.FlagHasExtensions))
+		authData = binary.BigEndian.AppendUint32(authData, counter)
+		authData = append(authData, extensions...)
+	}
+
+	clientDataJSON := []byte(fmt.Sprintf(`{"type":"webauthn.get","challenge":"%s","origin":"https://example.com"}`, challenge))
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	results := map[string]interface{}{}
+
+	if opts.appID != nil {
+		results["appid"] = *opts.appID
+	}
+
+	if opts.dpkKey != nil {
+		signed := digest[:]
+		if opts.dpkTamper {
+			signed = clientDataHash[:]
+		}
+
+		dpkSignature, err := ecdsa.SignASN1(rand.Reader, opts.dpkKey, signed)
+		require.NoError(t, err)
+
+		results["devicePubKey"] = map[string]string{"signature": encode(dpkSignature)}
+	}
+
+	clientExtensionResults, err := json.Marshal(results)
+	require.NoError(t, err)
+
+	return fmt.Sprintf(`{"id":"%[1]s","rawId":"%[1]s","type":"public-key","response":{"authenticatorData":"%[2]s","clientDataJSON":"%[3]s","signature":"%[4]s","userHandle":"%[5]s"},"clientExtensionResults":%[6]s}`,
+		encode(loginTestCredentialID), encode(authData), encode(clientDataJSON), encode(signature), encode(opts.userHandle), clientExtensionResults)
+}
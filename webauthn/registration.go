@@ -2,10 +2,15 @@ package webauthn
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math/big"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol"
 	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
@@ -71,7 +76,32 @@ func (webauthn *WebAuthn) BeginRegistration(user User, opts ...RegistrationOptio
 		opt(&creation.Response)
 	}
 
-	if creation.Response.Timeout == 0 {
+	creation.Response.Parameters = protocol.NormalizeCredentialParameters(creation.Response.Parameters)
+
+	if creation.Response.Mediation == protocol.MediationConditional && len(creation.Response.CredentialExcludeList) == 0 {
+		// Conditional creation upgrades the user silently, and must not create a second passkey on an authenticator
+		// which already holds one of the user.
+		creation.Response.CredentialExcludeList = CredentialDescriptorsFromUser(user)
+	}
+
+	creation.Mediation = creation.Response.Mediation
+
+	if err = protocol.ValidateHints(creation.Response.Hints); err != nil {
+		return nil, nil, err
+	}
+
+	if err = protocol.ValidateCredBlobExtension(creation.Response.Extensions); err != nil {
+		return nil, nil, err
+	}
+
+	if id := creation.Response.RelyingParty.ID; id != webauthn.Config.RPID && !rpIDMatchesOrigins(id, webauthn.Config.RPOrigins) {
+		return nil, nil, protocol.ErrBadRequest.WithDetails(fmt.Sprintf("RP ID '%s' is not valid for any of the configured origins", id))
+	}
+
+	switch {
+	case creation.Response.OmitTimeout:
+		creation.Response.Timeout = 0
+	case creation.Response.Timeout == 0:
 		switch {
 		case creation.Response.AuthenticatorSelection.UserVerification == protocol.VerificationDiscouraged:
 			creation.Response.Timeout = int(webauthn.Config.Timeouts.Registration.Timeout.Milliseconds())
@@ -81,12 +111,20 @@ func (webauthn *WebAuthn) BeginRegistration(user User, opts ...RegistrationOptio
 	}
 
 	session = &SessionData{
-		Challenge:        challenge.String(),
-		UserID:           user.WebAuthnID(),
-		UserVerification: creation.Response.AuthenticatorSelection.UserVerification,
+		Challenge:            challenge.String(),
+		UserID:               user.WebAuthnID(),
+		UserVerification:     creation.Response.AuthenticatorSelection.UserVerification,
+		CredentialParameters: creation.Response.Parameters,
+		Extensions:           creation.Response.Extensions,
+		Attestation:          creation.Response.Attestation,
+		Mediation:            creation.Mediation,
+	}
+
+	if creation.Response.RelyingParty.ID != webauthn.Config.RPID {
+		session.RelyingPartyID = creation.Response.RelyingParty.ID
 	}
 
-	if webauthn.Config.Timeouts.Registration.Enforce {
+	if webauthn.Config.Timeouts.Registration.Enforce && creation.Response.Timeout != 0 {
 		session.Expires = time.Now().Add(time.Millisecond * time.Duration(creation.Response.Timeout))
 	}
 
@@ -101,6 +139,25 @@ func WithAuthenticatorSelection(authenticatorSelection protocol.AuthenticatorSel
 	}
 }
 
+// WithRPEntity overrides the configured display name, RP ID, and icon of the Relying Party for the registration, such
+// as for multi-tenant applications. Empty values keep the configured value. The RP ID must be valid for one of the
+// configured origins by the same rules as Config.RPID, and is stored in the session so the registration is finished for the same RP ID.
+func WithRPEntity(name, id, icon string) RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		if name != "" {
+			cco.RelyingParty.Name = name
+		}
+
+		if id != "" {
+			cco.RelyingParty.ID = id
+		}
+
+		if icon != "" {
+			cco.RelyingParty.Icon = icon
+		}
+	}
+}
+
 // WithExclusions adjusts the non-default parameters regarding credentials to exclude from registration.
 func WithExclusions(excludeList []protocol.CredentialDescriptor) RegistrationOption {
 	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
@@ -108,6 +165,52 @@ func WithExclusions(excludeList []protocol.CredentialDescriptor) RegistrationOpt
 	}
 }
 
+// WithAdditionalExclusions merges the provided credentials into the credentials to exclude from registration, such as
+// the credentials of other users to prevent a single authenticator from being shared between accounts. Credentials
+// already excluded are not repeated. This option must be provided after WithExclusions if both are used.
+func WithAdditionalExclusions(descriptors ...protocol.CredentialDescriptor) RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		// Copy the excluded credentials so the slice provided to WithExclusions is not modified.
+		exclusions := make([]protocol.CredentialDescriptor, len(cco.CredentialExcludeList), len(cco.CredentialExcludeList)+len(descriptors))
+
+		copy(exclusions, cco.CredentialExcludeList)
+
+	descriptors:
+		for _, descriptor := range descriptors {
+			for _, credential := range exclusions {
+				if bytes.Equal(credential.CredentialID, descriptor.CredentialID) {
+					continue descriptors
+				}
+			}
+
+			exclusions = append(exclusions, descriptor)
+		}
+
+		cco.CredentialExcludeList = exclusions
+	}
+}
+
+// WithExclusionTransports overrides the transports of the excluded credential with the provided credential ID, so
+// the client only checks the authenticators reachable over these transports. The excluded credentials carry the
+// transports of the Credential they were created from by default via Credential.Descriptor. This option must be
+// provided after the excluded credentials are set with WithExclusions.
+func WithExclusionTransports(credentialID []byte, transports ...protocol.AuthenticatorTransport) RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		// Copy the excluded credentials so the slice provided to WithExclusions is not modified.
+		exclusions := make([]protocol.CredentialDescriptor, len(cco.CredentialExcludeList))
+
+		for i, credential := range cco.CredentialExcludeList {
+			if bytes.Equal(credential.CredentialID, credentialID) {
+				credential.Transport = transports
+			}
+
+			exclusions[i] = credential
+		}
+
+		cco.CredentialExcludeList = exclusions
+	}
+}
+
 // WithConveyancePreference adjusts the non-default parameters regarding whether the authenticator should attest to the
 // credential.
 func WithConveyancePreference(preference protocol.ConveyancePreference) RegistrationOption {
@@ -123,6 +226,20 @@ func WithExtensions(extension protocol.AuthenticationExtensions) RegistrationOpt
 	}
 }
 
+// WithCredBlob requests the authenticator to store the blob with the credential using the credBlob extension. The blob
+// must be at most protocol.MaxCredBlobLength bytes. This option must be provided after WithExtensions if both are used.
+//
+// Specification: CTAP2.1 §12.2. Credential Blob (credBlob) (https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#sctn-credBlob-extension)
+func WithCredBlob(blob []byte) RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		if cco.Extensions == nil {
+			cco.Extensions = map[string]interface{}{}
+		}
+
+		cco.Extensions[protocol.ExtensionCredBlob] = protocol.URLEncodedBase64(blob)
+	}
+}
+
 // WithCredentialParameters adjusts the credential parameters in the registration options.
 func WithCredentialParameters(credentialParams []protocol.CredentialParameter) RegistrationOption {
 	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
@@ -130,6 +247,25 @@ func WithCredentialParameters(credentialParams []protocol.CredentialParameter) R
 	}
 }
 
+// WithHints adjusts the hints in the registration options which guide the client towards the expected kind of
+// authenticator, in order of decreasing preference.
+//
+// Specification: §5.8.7. User-agent Hints Enumeration (https://www.w3.org/TR/webauthn-3/#enumdef-publickeycredentialhints)
+func WithHints(hints ...protocol.Hint) RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		cco.Hints = hints
+	}
+}
+
+// WithoutTimeout omits the timeout from the registration options so the client uses its own default, which is useful
+// for slow flows such as cross-device registrations. As the timeout is unknown the session does not expire even when
+// the registration timeout is enforced. The timeout is omitted regardless of the options which adjust it.
+func WithoutTimeout() RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		cco.OmitTimeout = true
+	}
+}
+
 // WithAppIdExcludeExtension automatically includes the specified appid if the CredentialExcludeList contains a credential
 // with the type `fido-u2f`.
 func WithAppIdExcludeExtension(appid string) RegistrationOption {
@@ -160,19 +296,114 @@ func WithResidentKeyRequirement(requirement protocol.ResidentKeyRequirement) Reg
 	}
 }
 
+// WithConditionalCreate marks the registration for conditional mediation, which the client uses to create a passkey
+// without a modal prompt such as when upgrading a user who just signed in with a password. The credential is required
+// to be a discoverable credential of a platform authenticator, and the existing credentials of the user are excluded
+// unless exclusions were provided with WithExclusions. As the user present flag is not set for conditional creation
+// it's not verified when the registration is finished.
+//
+// Specification: §5.1.3. Create a New Credential (https://www.w3.org/TR/webauthn-3/#sctn-createCredential)
+func WithConditionalCreate() RegistrationOption {
+	return func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		cco.Mediation = protocol.MediationConditional
+		cco.AuthenticatorSelection.AuthenticatorAttachment = protocol.Platform
+		cco.AuthenticatorSelection.ResidentKey = protocol.ResidentKeyRequirementRequired
+		cco.AuthenticatorSelection.RequireResidentKey = protocol.ResidentKeyRequired()
+	}
+}
+
 // FinishRegistration takes the response from the authenticator and client and verify the credential against the user's
 // credentials and session data.
 func (webauthn *WebAuthn) FinishRegistration(user User, session SessionData, response *http.Request) (*Credential, error) {
-	parsedResponse, err := protocol.ParseCredentialCreationResponse(response)
+	return webauthn.FinishRegistrationCtx(context.Background(), user, session, response)
+}
+
+// FinishRegistrationCtx is the same as FinishRegistration but the provided context is used to abort the verification,
+// for example when a metadata or revocation lookup takes longer than the request deadline. A context from
+// metadata.WithStore pins the verification to a specific metadata snapshot instead of metadata.DefaultStore.
+func (webauthn *WebAuthn) FinishRegistrationCtx(ctx context.Context, user User, session SessionData, response *http.Request) (*Credential, error) {
+	parsedResponse, err := webauthn.parseCredentialCreationResponse(response)
 	if err != nil {
 		return nil, err
 	}
 
-	return webauthn.CreateCredential(user, session, parsedResponse)
+	return webauthn.CreateCredentialCtx(ctx, user, session, parsedResponse)
+}
+
+// parseCredentialCreationResponse parses the response limiting the attestation object and client data to the
+// configured sizes.
+func (webauthn *WebAuthn) parseCredentialCreationResponse(response *http.Request) (*protocol.ParsedCredentialCreationData, error) {
+	var maxAttestationObjectSize, maxClientDataSize int
+
+	if webauthn.Config != nil {
+		maxAttestationObjectSize = webauthn.Config.MaxAttestationObjectSize
+		maxClientDataSize = webauthn.Config.MaxClientDataSize
+	}
+
+	return protocol.ParseCredentialCreationResponseMaxSizes(response, maxAttestationObjectSize, maxClientDataSize)
+}
+
+// RegistrationResult is the result of a successful registration.
+type RegistrationResult struct {
+	// Credential is the newly registered credential.
+	Credential *Credential
+
+	// AttestationType is the attestation type determined by the attestation statement format verifier.
+	AttestationType string
+
+	// RemainingDiscoverableCredentials is the estimated number of additional discoverable credentials the
+	// authenticator can store, which is nil unless the authenticator or client reported it in the
+	// remainingDiscoverableCredentials extension output. It can be used to warn users their authenticator is nearly
+	// full.
+	RemainingDiscoverableCredentials *uint64
+
+	// Extensions are the results of the parsers registered with protocol.RegisterExtension, keyed by the extension
+	// identifier.
+	Extensions map[string]interface{}
+
+	// TPMCertInfo is the clock, firmware and signer information of the TPM for the tpm attestation statement format,
+	// which is nil for the other formats. It's not verified but may be used as an input to risk engines.
+	TPMCertInfo *protocol.TPMCertInfo
+}
+
+// IsSelfAttested returns true if the credential was attested using self attestation, where the attestation statement
+// is signed by the credential private key itself. Self attestation does not provide any provenance of the
+// authenticator.
+//
+// Specification: §6.5.4. Attestation Types (https://www.w3.org/TR/webauthn/#self-attestation)
+func (r *RegistrationResult) IsSelfAttested() bool {
+	return r.AttestationType == string(metadata.SelfAttestation)
+}
+
+// FinishRegistrationResult is the same as FinishRegistration but returns the RegistrationResult which includes the
+// attestation type alongside the credential.
+func (webauthn *WebAuthn) FinishRegistrationResult(user User, session SessionData, response *http.Request) (*RegistrationResult, error) {
+	parsedResponse, err := webauthn.parseCredentialCreationResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return webauthn.CreateCredentialResult(context.Background(), user, session, parsedResponse)
 }
 
 // CreateCredential verifies a parsed response against the user's credentials and session data.
 func (webauthn *WebAuthn) CreateCredential(user User, session SessionData, parsedResponse *protocol.ParsedCredentialCreationData) (*Credential, error) {
+	return webauthn.CreateCredentialCtx(context.Background(), user, session, parsedResponse)
+}
+
+// CreateCredentialCtx is the same as CreateCredential but the provided context is used to abort the verification.
+func (webauthn *WebAuthn) CreateCredentialCtx(ctx context.Context, user User, session SessionData, parsedResponse *protocol.ParsedCredentialCreationData) (*Credential, error) {
+	result, err := webauthn.CreateCredentialResult(ctx, user, session, parsedResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Credential, nil
+}
+
+// CreateCredentialResult is the same as CreateCredentialCtx but returns the RegistrationResult which includes the
+// attestation type alongside the credential.
+func (webauthn *WebAuthn) CreateCredentialResult(ctx context.Context, user User, session SessionData, parsedResponse *protocol.ParsedCredentialCreationData) (*RegistrationResult, error) {
 	if !bytes.Equal(user.WebAuthnID(), session.UserID) {
 		return nil, protocol.ErrBadRequest.WithDetails("ID mismatch for User and Session")
 	}
@@ -183,12 +414,571 @@ func (webauthn *WebAuthn) CreateCredential(user User, session SessionData, parse
 
 	shouldVerifyUser := session.UserVerification == protocol.VerificationRequired
 
-	invalidErr := parsedResponse.Verify(session.Challenge, shouldVerifyUser, webauthn.Config.RPID, webauthn.Config.RPOrigins)
+	log := webauthn.logger()
+
+	if err := webauthn.Config.verifyCrossOrigin(&parsedResponse.Response.CollectedClientData); err != nil {
+		log.Debug("registration cross origin rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	rpID := webauthn.Config.RPID
+	if session.RelyingPartyID != "" {
+		rpID = session.RelyingPartyID
+	}
+
+	invalidErr := webauthn.verifyCredentialCreation(ctx, session, parsedResponse, shouldVerifyUser, rpID)
 	if invalidErr != nil {
+		log.Debug("registration verification failed", "format", parsedResponse.Response.AttestationObject.Format, "error_type", errorType(invalidErr))
+
 		return nil, invalidErr
 	}
 
-	return MakeNewCredential(parsedResponse)
+	if pool := webauthn.Config.AttestationRootPool; pool != nil {
+		if err := parsedResponse.Response.VerifyAttestationRoots(pool); err != nil {
+			log.Debug("registration attestation root verification failed", "format", parsedResponse.Response.AttestationObject.Format, "error_type", errorType(err))
+
+			return nil, err
+		}
+	}
+
+	if parsedResponse.Response.TransportsConflict {
+		log.Debug("registration transports conflicting",
+			"reported", parsedResponse.Response.Transports,
+			"deprecated", parsedResponse.Raw.Transports,
+		)
+	}
+
+	if webauthn.Config.CompareAttestationTransports {
+		webauthn.compareAttestationTransports(&parsedResponse.Response)
+	}
+
+	flags := parsedResponse.Response.AttestationObject.AuthData.Flags
+
+	log.Debug("registration attestation verified",
+		"format", parsedResponse.Response.AttestationObject.Format,
+		"attestation_type", parsedResponse.Response.AttestationType,
+		"user_present", flags.HasUserPresent(),
+		"user_verified", flags.HasUserVerified(),
+		"user_verification_required", shouldVerifyUser,
+		"backup_eligible", flags.HasBackupEligible(),
+		"backup_state", flags.HasBackupState(),
+		"aaguid", fmt.Sprintf("%x", parsedResponse.Response.AttestationObject.AuthData.AttData.AAGUID),
+	)
+
+	if err := webauthn.Config.verifyAttestationConveyance(session, parsedResponse.Response.AttestationObject); err != nil {
+		log.Debug("registration attestation downgrade rejected", "error_type", errorType(err), "attestation", session.Attestation)
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.validateNoneAAGUID(parsedResponse.Response.AttestationObject); err != nil {
+		log.Debug("registration none attestation AAGUID rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	store := metadata.StoreFromContext(ctx)
+
+	if err := webauthn.Config.verifyMetadataUserVerification(store, parsedResponse.Response.AttestationObject.AuthData); err != nil {
+		log.Debug("registration user verification inconsistent with metadata", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.verifyUserVerificationCapable(store, parsedResponse.Response.AttestationObject.AuthData); err != nil {
+		log.Debug("registration authenticator without user verification capability rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.verifyMetadataCertificationLevel(store, parsedResponse.Response.AttestationObject.AuthData); err != nil {
+		log.Debug("registration authenticator certification level rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.verifyCredentialAlgorithm(parsedResponse.Response.AttestationObject.AuthData); err != nil {
+		log.Debug("registration credential algorithm rejected", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.verifyStrictRegistration(session, parsedResponse); err != nil {
+		log.Debug("registration strict check failed", "error_type", errorType(err), "reason", err.Error())
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.validateCredentialPublicKey(parsedResponse.Response.AttestationObject.AuthData.AttData.CredentialPublicKey); err != nil {
+		log.Debug("registration credential public key rejected", "error_type", errorType(err), "reason", err.Error())
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.validateTransports(parsedResponse.Response.Transports); err != nil {
+		log.Debug("registration credential transports rejected", "error_type", errorType(err), "reason", err.Error())
+
+		return nil, err
+	}
+
+	if err := webauthn.Config.verifyCredentialNotExists(user, parsedResponse.Response.AttestationObject.AuthData.AttData); err != nil {
+		log.Debug("registration credential already exists", "error_type", errorType(err), "reason", err.Error())
+
+		return nil, err
+	}
+
+	extensions, err := protocol.ParseExtensions(session.Extensions, parsedResponse.ClientExtensionResults, parsedResponse.Response.AttestationObject.AuthData.Extensions)
+	if err != nil {
+		log.Debug("registration extension parsing failed", "error_type", errorType(err))
+
+		return nil, err
+	}
+
+	credential, err := MakeNewCredential(parsedResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.RPID = rpID
+
+	if webauthn.Config.AllowCOSEStringLabels {
+		if credential.PublicKey, err = webauthncose.NormalizeStringLabels(credential.PublicKey); err != nil {
+			return nil, protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+		}
+	}
+
+	if err = webauthn.consumeChallenge(session); err != nil {
+		return nil, err
+	}
+
+	result := &RegistrationResult{
+		Credential:      credential,
+		AttestationType: parsedResponse.Response.AttestationType,
+		Extensions:      extensions,
+	}
+
+	// The certInfo has already been decoded by the verification of the tpm attestation statement.
+	if info, ok, err := parsedResponse.Response.AttestationObject.TPMCertInfo(); ok && err == nil {
+		result.TPMCertInfo = info
+	}
+
+	if remaining, ok := parsedResponse.RemainingDiscoverableCredentials(); ok {
+		result.RemainingDiscoverableCredentials = &remaining
+	}
+
+	return result, nil
+}
+
+// verifyCredentialCreation verifies the parsed response, treating an unsupported attestation statement format as the
+// none attestation statement format when UnknownFormatAsNone is enabled, and accepting a registration without user
+// presence when the session is for conditional creation. The attestation object of the parsed response
+// itself is left unchanged in that case so it still reflects the original format. The credential public key is parsed
+// according to AllowCOSEStringLabels.
+func (webauthn *WebAuthn) verifyCredentialCreation(ctx context.Context, session SessionData, parsedResponse *protocol.ParsedCredentialCreationData, shouldVerifyUser bool, rpID string) error {
+	additionalTypes := ceremonyTypes(webauthn.Config.AdditionalCreateTypes)
+
+	parsedResponse.Response.AttestationObject.PublicKeyOptions = webauthn.Config.publicKeyOptions()
+
+	// The user present flag is not verified for conditional creation. It's only set for the duration of the
+	// verification as the signature covers the raw authenticator data rather than the parsed flags.
+	if flags := &parsedResponse.Response.AttestationObject.AuthData.Flags; session.Mediation == protocol.MediationConditional && !flags.HasUserPresent() {
+		*flags |= protocol.FlagUserPresent
+
+		defer func() {
+			*flags &^= protocol.FlagUserPresent
+		}()
+	}
+
+	if !webauthn.Config.UnknownFormatAsNone || protocol.IsAttestationFormatSupported(parsedResponse.Response.AttestationObject.Format) {
+		return parsedResponse.VerifyCtx(ctx, session.Challenge, shouldVerifyUser, rpID, webauthn.Config.RPOrigins, additionalTypes...)
+	}
+
+	none := *parsedResponse
+	none.Response.AttestationObject.Format = "none"
+	none.Response.AttestationObject.AttStatement = nil
+
+	if err := none.VerifyCtx(ctx, session.Challenge, shouldVerifyUser, rpID, webauthn.Config.RPOrigins, additionalTypes...); err != nil {
+		return err
+	}
+
+	parsedResponse.Response.AttestationType = none.Response.AttestationType
+
+	return nil
+}
+
+// verifyCredentialNotExists ensures the credential is not one of the existing credentials of the user when
+// RejectExistingCredentials is enabled, comparing the public key thumbprints too when RejectExistingPublicKeys is enabled.
+func (config *Config) verifyCredentialNotExists(user User, attData protocol.AttestedCredentialData) error {
+	if !config.RejectExistingCredentials {
+		return nil
+	}
+
+	var thumbprint []byte
+
+	for _, credential := range user.WebAuthnCredentials() {
+		if bytes.Equal(credential.ID, attData.CredentialID) {
+			return protocol.ErrCredentialExists.WithInfo("Credential ID matches an existing credential")
+		}
+
+		if !config.RejectExistingPublicKeys {
+			continue
+		}
+
+		if thumbprint == nil {
+			var err error
+
+			if thumbprint, err = publicKeyThumbprint(attData.CredentialPublicKey, config.publicKeyOptions()); err != nil {
+				return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+			}
+		}
+
+		// Existing credentials with a key which can't be parsed can't match the new credential.
+		if existing, err := credential.PublicKeyThumbprint(); err == nil && bytes.Equal(existing, thumbprint) {
+			return protocol.ErrCredentialExists.WithInfo("Credential public key matches an existing credential")
+		}
+	}
+
+	return nil
+}
+
+// compareAttestationTransports emits a debug event when the transports reported by the client differ from the
+// transports of the attestation certificate.
+func (webauthn *WebAuthn) compareAttestationTransports(response *protocol.ParsedAttestationResponse) {
+	log := webauthn.logger()
+
+	attested, ok, err := response.AttestationTransports()
+	if err != nil {
+		log.Debug("registration attestation transports parsing failed", "error_type", errorType(err), "reason", err.Error())
+
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	if !sameTransports(attested, response.Transports) {
+		log.Debug("registration transports differ from attestation certificate",
+			"reported", response.Transports,
+			"attested", attested,
+		)
+	}
+}
+
+// sameTransports returns true if both lists contain the same transports regardless of their order and duplicates.
+func sameTransports(a, b []protocol.AuthenticatorTransport) bool {
+	for _, transport := range a {
+		if !containsTransport(b, transport) {
+			return false
+		}
+	}
+
+	for _, transport := range b {
+		if !containsTransport(a, transport) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsTransport returns true if the transport is one of the transports.
+func containsTransport(transports []protocol.AuthenticatorTransport, transport protocol.AuthenticatorTransport) bool {
+	for _, t := range transports {
+		if t == transport {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publicKeyOptions returns the options the credential public keys of registrations are parsed with.
+func (config *Config) publicKeyOptions() webauthncose.ParsePublicKeyOptions {
+	return webauthncose.ParsePublicKeyOptions{AllowStringLabels: config.AllowCOSEStringLabels}
+}
+
+// validateCredentialPublicKey ensures the credential public key meets the configured minimum RSA modulus length and
+// uses one of the configured allowed curves.
+func (config *Config) validateCredentialPublicKey(keyBytes []byte) error {
+	key, err := webauthncose.ParsePublicKeyWithOptions(keyBytes, config.publicKeyOptions())
+	if err != nil {
+		return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+	}
+
+	switch k := key.(type) {
+	case webauthncose.RSAPublicKeyData:
+		minBits := config.MinRSAKeyBits
+		if minBits <= 0 {
+			minBits = defaultMinRSAKeyBits
+		}
+
+		if bits := new(big.Int).SetBytes(k.Modulus).BitLen(); bits < minBits {
+			return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("RSA credential public key is %d bits which is less than the minimum of %d bits", bits, minBits))
+		}
+	case webauthncose.EC2PublicKeyData:
+		if len(config.AllowedCurves) == 0 {
+			return nil
+		}
+
+		for _, curve := range config.AllowedCurves {
+			if int64(curve) == k.Curve {
+				return nil
+			}
+		}
+
+		return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("EC2 credential public key curve %d is not allowed", k.Curve))
+	}
+
+	return nil
+}
+
+// verifyAttestationConveyance ensures the client did not return the none attestation statement format for a
+// registration which requested direct or enterprise attestation, unless AllowAttestationDowngrade is enabled.
+func (config *Config) verifyAttestationConveyance(session SessionData, att protocol.AttestationObject) error {
+	if config.AllowAttestationDowngrade || att.Format != "none" {
+		return nil
+	}
+
+	switch session.Attestation {
+	case protocol.PreferDirectAttestation, protocol.PreferEnterpriseAttestation:
+		return protocol.ErrInvalidAttestation.WithDetails("Attestation was requested but the client returned none attestation").
+			WithInfo(fmt.Sprintf("Registration requested %s attestation", session.Attestation))
+	default:
+		return nil
+	}
+}
+
+// validateNoneAAGUID ensures the AAGUID is zero when the attestation object uses the none attestation statement format
+// and RequireZeroAAGUIDForNone is enabled. A non-zero AAGUID is otherwise accepted under none attestation, though as it
+// isn't attested it only identifies the authenticator model as claimed by the authenticator itself.
+func (config *Config) validateNoneAAGUID(att protocol.AttestationObject) error {
+	if !config.RequireZeroAAGUIDForNone || att.Format != "none" {
+		return nil
+	}
+
+	for _, b := range att.AuthData.AttData.AAGUID {
+		if b != 0 {
+			return protocol.ErrVerification.WithDetails("Credential AAGUID must be zero for none attestation").
+				WithInfo(fmt.Sprintf("Credential AAGUID is %x", att.AuthData.AttData.AAGUID)).
+				WithReason(protocol.AttestationFailureAAGUIDDenied)
+		}
+	}
+
+	return nil
+}
+
+// verifyMetadataUserVerification ensures the user verified flag is consistent with the userVerificationDetails of the
+// metadata statement of the authenticator when VerifyMetadataUserVerification is enabled.
+func (config *Config) verifyMetadataUserVerification(store *metadata.Store, authData protocol.AuthenticatorData) error {
+	if !config.VerifyMetadataUserVerification || !authData.Flags.HasUserVerified() {
+		return nil
+	}
+
+	aaguid, err := uuid.FromBytes(authData.AttData.AAGUID)
+	if err != nil {
+		return nil
+	}
+
+	entry, ok := store.Lookup(aaguid)
+	if !ok || len(entry.MetadataStatement.UserVerificationDetails) == 0 {
+		return nil
+	}
+
+	if !entry.MetadataStatement.IsUserVerificationCapable() {
+		return protocol.ErrMetadataUserVerification.WithInfo(fmt.Sprintf("Authenticator %s reported user verification but its metadata declares no user verification method", aaguid))
+	}
+
+	return nil
+}
+
+// verifyUserVerificationCapable ensures the metadata statement of the authenticator declares a user verification
+// method when RequireUserVerificationCapable is enabled.
+func (config *Config) verifyUserVerificationCapable(store *metadata.Store, authData protocol.AuthenticatorData) error {
+	if !config.RequireUserVerificationCapable {
+		return nil
+	}
+
+	aaguid, err := uuid.FromBytes(authData.AttData.AAGUID)
+	if err != nil {
+		return nil
+	}
+
+	entry, ok := store.Lookup(aaguid)
+	if !ok || len(entry.MetadataStatement.UserVerificationDetails) == 0 {
+		return nil
+	}
+
+	if !entry.MetadataStatement.IsUserVerificationCapable() {
+		return protocol.ErrUserVerificationCapability.WithInfo(fmt.Sprintf("Authenticator %s declares no user verification method in its metadata", aaguid)).
+			WithReason(protocol.AttestationFailureAAGUIDDenied)
+	}
+
+	return nil
+}
+
+// verifyMetadataCertificationLevel ensures the metadata statement of the authenticator reports at least the
+// MinimumCertificationLevel when it's configured.
+func (config *Config) verifyMetadataCertificationLevel(store *metadata.Store, authData protocol.AuthenticatorData) error {
+	if config.MinimumCertificationLevel == metadata.CertificationLevelNone {
+		return nil
+	}
+
+	aaguid, err := uuid.FromBytes(authData.AttData.AAGUID)
+	if err != nil {
+		return protocol.ErrMetadataCertificationLevel.WithInfo("Authenticator AAGUID is not valid").WithReason(protocol.AttestationFailureAAGUIDDenied)
+	}
+
+	entry, ok := store.Lookup(aaguid)
+	if !ok {
+		return protocol.ErrMetadataCertificationLevel.WithInfo(fmt.Sprintf("Authenticator %s has no metadata statement", aaguid)).WithReason(protocol.AttestationFailureAAGUIDDenied)
+	}
+
+	if level := entry.CertificationLevel(); level < config.MinimumCertificationLevel {
+		return protocol.ErrMetadataCertificationLevel.WithInfo(fmt.Sprintf("Authenticator %s is certified %s which is below %s", aaguid, level, config.MinimumCertificationLevel)).
+			WithReason(protocol.AttestationFailureAAGUIDDenied)
+	}
+
+	return nil
+}
+
+// verifyStrictRegistration performs the registration checks enabled by Strict which were not disabled by StrictChecks,
+// as well as the checks enabled individually by RequireOfferedAlgorithm and AllowedAttestationFormats.
+func (config *Config) verifyStrictRegistration(session SessionData, parsedResponse *protocol.ParsedCredentialCreationData) error {
+	authData := parsedResponse.Response.AttestationObject.AuthData
+
+	if config.Strict && !config.StrictChecks.SkipAttestedCredentialData && !authData.Flags.HasAttestedCredentialData() {
+		return protocol.ErrVerification.WithDetails("Attested credential data flag not set by authenticator")
+	}
+
+	if config.RequireOfferedAlgorithm || (config.Strict && !config.StrictChecks.SkipCredentialAlgorithm) {
+		if err := config.verifyOfferedAlgorithm(session, authData); err != nil {
+			return err
+		}
+	}
+
+	formats := config.AllowedAttestationFormats
+	if len(formats) == 0 && config.Strict {
+		formats = defaultStrictAttestationFormats
+	}
+
+	if len(formats) != 0 && !(config.Strict && config.StrictChecks.SkipAttestationFormat) {
+		format := parsedResponse.Response.AttestationObject.Format
+
+		for _, allowed := range formats {
+			if format == allowed {
+				return nil
+			}
+		}
+
+		return protocol.ErrAttestationFormat.WithDetails(fmt.Sprintf("Attestation format '%s' is not allowed", format)).
+			WithReason(protocol.AttestationFailureFormatUnsupported)
+	}
+
+	return nil
+}
+
+// verifyCredentialAlgorithm ensures the algorithm declared by the credential public key is consistent with the key.
+//
+// Specification: §7.1. Registering a New Credential, Step 16 (https://www.w3.org/TR/webauthn/#sctn-registering-a-new-credential)
+func (config *Config) verifyCredentialAlgorithm(authData protocol.AuthenticatorData) error {
+	if !authData.Flags.HasAttestedCredentialData() {
+		return nil
+	}
+
+	key, err := webauthncose.ParsePublicKeyWithOptions(authData.AttData.CredentialPublicKey, config.publicKeyOptions())
+	if err != nil {
+		return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+	}
+
+	if err = webauthncose.VerifyKeyAlgorithm(key); err != nil {
+		return protocol.ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Credential public key algorithm is not consistent with the key: %+v", err))
+	}
+
+	return nil
+}
+
+// verifyOfferedAlgorithm ensures the algorithm declared by the credential public key is one of the credential
+// parameters offered in the options.
+//
+// Specification: §7.1. Registering a New Credential, Step 16 (https://www.w3.org/TR/webauthn/#sctn-registering-a-new-credential)
+func (config *Config) verifyOfferedAlgorithm(session SessionData, authData protocol.AuthenticatorData) error {
+	if !authData.Flags.HasAttestedCredentialData() {
+		return nil
+	}
+
+	key, err := webauthncose.ParsePublicKeyWithOptions(authData.AttData.CredentialPublicKey, config.publicKeyOptions())
+	if err != nil {
+		return protocol.ErrUnsupportedKey.WithDetails(fmt.Sprintf("Error parsing the credential public key: %+v", err))
+	}
+
+	params := session.CredentialParameters
+	if len(params) == 0 {
+		params = defaultRegistrationCredentialParameters()
+	}
+
+	if alg := credentialPublicKeyAlgorithm(key); !credentialParametersContain(params, alg) {
+		return protocol.ErrUnsupportedAlgorithm.WithDetails(fmt.Sprintf("Credential public key algorithm %d was not offered in the credential parameters", alg))
+	}
+
+	return nil
+}
+
+func credentialPublicKeyAlgorithm(key interface{}) webauthncose.COSEAlgorithmIdentifier {
+	switch k := key.(type) {
+	case webauthncose.OKPPublicKeyData:
+		return webauthncose.COSEAlgorithmIdentifier(k.Algorithm)
+	case webauthncose.EC2PublicKeyData:
+		return webauthncose.COSEAlgorithmIdentifier(k.Algorithm)
+	case webauthncose.RSAPublicKeyData:
+		return webauthncose.COSEAlgorithmIdentifier(k.Algorithm)
+	default:
+		return 0
+	}
+}
+
+func credentialParametersContain(params []protocol.CredentialParameter, alg webauthncose.COSEAlgorithmIdentifier) bool {
+	for _, param := range params {
+		if param.Type == protocol.PublicKeyCredentialType && param.Algorithm == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateTransports ensures every transport reported for the credential is one of the configured allowed transports.
+func (config *Config) validateTransports(transports []protocol.AuthenticatorTransport) error {
+	if len(config.AllowedTransports) == 0 {
+		return nil
+	}
+
+	if len(transports) == 0 {
+		if config.AllowMissingTransports {
+			return nil
+		}
+
+		return protocol.ErrVerification.WithDetails("Credential transports were not reported")
+	}
+
+	for _, transport := range transports {
+		allowed := false
+
+		for _, allowedTransport := range config.AllowedTransports {
+			if transport == allowedTransport {
+				allowed = true
+
+				break
+			}
+		}
+
+		if !allowed {
+			return protocol.ErrVerification.WithDetails(fmt.Sprintf("Credential transport '%s' is not allowed", transport))
+		}
+	}
+
+	return nil
 }
 
 func defaultRegistrationCredentialParameters() []protocol.CredentialParameter {
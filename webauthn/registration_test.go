@@ -1,11 +1,32 @@
 package webauthn
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRegistration_FinishRegistrationFailure(t *testing.T) {
@@ -57,3 +78,2099 @@ func TestEntityEncoding(t *testing.T) {
 		})
 	}
 }
+
+func TestBeginRegistrationWithoutTimeout(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+		Timeouts: TimeoutsConfig{
+			Registration: TimeoutConfig{
+				Enforce: true,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(creation.Response)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "\"timeout\":")
+	assert.False(t, session.Expires.IsZero())
+
+	withTimeout := func(cco *protocol.PublicKeyCredentialCreationOptions) {
+		cco.Timeout = 30000
+	}
+
+	for _, opts := range [][]RegistrationOption{{WithoutTimeout()}, {WithoutTimeout(), withTimeout}, {withTimeout, WithoutTimeout()}} {
+		creation, session, err = w.BeginRegistration(user, opts...)
+		require.NoError(t, err)
+
+		data, err = json.Marshal(creation.Response)
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(data), "\"timeout\"")
+		assert.True(t, session.Expires.IsZero())
+	}
+}
+
+func TestBeginRegistrationExclusionTransports(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	credentials := []Credential{
+		{ID: []byte("usb"), Transport: []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC}},
+		{ID: []byte("internal"), Transport: []protocol.AuthenticatorTransport{protocol.Internal}},
+	}
+
+	exclusions := []protocol.CredentialDescriptor{credentials[0].Descriptor(), credentials[1].Descriptor()}
+
+	creation, _, err := w.BeginRegistration(&defaultUser{id: []byte("123")}, WithExclusions(exclusions))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(creation.Response.CredentialExcludeList)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"public-key","id":"dXNi","transports":["usb","nfc"]},{"type":"public-key","id":"aW50ZXJuYWw","transports":["internal"]}]`, string(data))
+
+	creation, _, err = w.BeginRegistration(&defaultUser{id: []byte("123")}, WithExclusions(exclusions), WithExclusionTransports([]byte("usb"), protocol.USB))
+	require.NoError(t, err)
+
+	data, err = json.Marshal(creation.Response.CredentialExcludeList)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"public-key","id":"dXNi","transports":["usb"]},{"type":"public-key","id":"aW50ZXJuYWw","transports":["internal"]}]`, string(data))
+	assert.Equal(t, []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC}, exclusions[0].Transport)
+}
+
+func TestConfig_validateCredentialPublicKey(t *testing.T) {
+	rsaKey1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	rsaKey2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		config *Config
+		key    []byte
+		err    string
+	}{
+		{
+			"ShouldRejectRSA1024",
+			&Config{},
+			registrationTestRSAPublicKey(t, &rsaKey1024.PublicKey),
+			"RSA credential public key is 1024 bits which is less than the minimum of 2048 bits",
+		},
+		{
+			"ShouldAcceptRSA1024WithLowerMinimum",
+			&Config{MinRSAKeyBits: 1024},
+			registrationTestRSAPublicKey(t, &rsaKey1024.PublicKey),
+			"",
+		},
+		{
+			"ShouldAcceptRSA2048",
+			&Config{},
+			registrationTestRSAPublicKey(t, &rsaKey2048.PublicKey),
+			"",
+		},
+		{
+			"ShouldAcceptP256",
+			&Config{},
+			registrationTestEC2PublicKey(t, &ecKey.PublicKey),
+			"",
+		},
+		{
+			"ShouldAcceptP256WhenAllowed",
+			&Config{AllowedCurves: []webauthncose.COSEEllipticCurve{webauthncose.P384, webauthncose.P256}},
+			registrationTestEC2PublicKey(t, &ecKey.PublicKey),
+			"",
+		},
+		{
+			"ShouldRejectP256WhenNotAllowed",
+			&Config{AllowedCurves: []webauthncose.COSEEllipticCurve{webauthncose.P384}},
+			registrationTestEC2PublicKey(t, &ecKey.PublicKey),
+			"EC2 credential public key curve 1 is not allowed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validateCredentialPublicKey(tc.key)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestRegistration_AllowedTransports(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		missing    bool
+		transports []protocol.AuthenticatorTransport
+		err        string
+	}{
+		{
+			"ShouldAllowPlatformKey",
+			false,
+			[]protocol.AuthenticatorTransport{protocol.Internal},
+			"",
+		},
+		{
+			"ShouldRejectUSBKey",
+			false,
+			[]protocol.AuthenticatorTransport{protocol.USB},
+			"Credential transport 'usb' is not allowed",
+		},
+		{
+			"ShouldRejectMixedTransports",
+			false,
+			[]protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid},
+			"Credential transport 'hybrid' is not allowed",
+		},
+		{
+			"ShouldRejectMissingTransports",
+			false,
+			nil,
+			"Credential transports were not reported",
+		},
+		{
+			"ShouldAllowMissingTransports",
+			true,
+			nil,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                   "example.com",
+				RPDisplayName:          "Example",
+				RPOrigins:              []string{"https://example.com"},
+				AllowedTransports:      []protocol.AuthenticatorTransport{protocol.Internal},
+				AllowMissingTransports: tc.missing,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+			response.Response.Transports = tc.transports
+
+			credential, err := w.CreateCredential(user, *session, response)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.transports, credential.Transport)
+		})
+	}
+}
+
+func TestRegistration_Strict(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		checks  StrictChecks
+		formats []string
+		opts    []RegistrationOption
+		tamper  func(response *protocol.ParsedCredentialCreationData, session *SessionData)
+		err     string
+	}{
+		{
+			"ShouldAcceptValidPayload",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {},
+			"",
+		},
+		{
+			"ShouldFailUserPresence",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.AttestationObject.AuthData.Flags &^= protocol.FlagUserPresent
+			},
+			"Error validating the authenticator response",
+		},
+		{
+			"ShouldFailType",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.CollectedClientData.Type = protocol.AssertCeremony
+			},
+			"Error validating ceremony type",
+		},
+		{
+			"ShouldFailChallenge",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				session.Challenge = "another-challenge"
+			},
+			"Error validating challenge",
+		},
+		{
+			"ShouldFailOrigin",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.CollectedClientData.Origin = "https://evil.example.com"
+			},
+			"Error validating origin",
+		},
+		{
+			"ShouldFailRPIDHash",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.AttestationObject.AuthData.RPIDHash = protocol.RPIDHash("evil.example.com")
+			},
+			"Error validating the authenticator response",
+		},
+		{
+			"ShouldFailAttestedCredentialData",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.AttestationObject.AuthData.Flags &^= protocol.FlagAttestedCredentialData
+			},
+			"Attested credential data flag not set by authenticator",
+		},
+		{
+			"ShouldFailCredentialID",
+			StrictChecks{},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.RawID = []byte("another credential")
+			},
+			"Credential ID in the authenticator data does not match the credential raw ID",
+		},
+		{
+			"ShouldFailCredentialAlgorithm",
+			StrictChecks{},
+			nil,
+			[]RegistrationOption{WithCredentialParameters([]protocol.CredentialParameter{{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256}})},
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {},
+			"Credential public key algorithm -7 was not offered in the credential parameters",
+		},
+		{
+			"ShouldFailAttestationFormat",
+			StrictChecks{},
+			[]string{"packed"},
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {},
+			"Attestation format 'none' is not allowed",
+		},
+		{
+			"ShouldSkipAttestedCredentialData",
+			StrictChecks{SkipAttestedCredentialData: true},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.AttestationObject.AuthData.Flags &^= protocol.FlagAttestedCredentialData
+			},
+			"",
+		},
+		{
+			"ShouldSkipCredentialAlgorithm",
+			StrictChecks{SkipCredentialAlgorithm: true},
+			nil,
+			[]RegistrationOption{WithCredentialParameters([]protocol.CredentialParameter{{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256}})},
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {},
+			"",
+		},
+		{
+			"ShouldSkipAttestationFormat",
+			StrictChecks{SkipAttestationFormat: true},
+			[]string{"packed"},
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {},
+			"",
+		},
+		{
+			"ShouldFailOriginWithEveryCheckSkipped",
+			StrictChecks{SkipAttestedCredentialData: true, SkipCredentialAlgorithm: true, SkipAttestationFormat: true},
+			nil,
+			nil,
+			func(response *protocol.ParsedCredentialCreationData, session *SessionData) {
+				response.Response.CollectedClientData.Origin = "https://evil.example.com"
+			},
+			"Error validating origin",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                      "example.com",
+				RPDisplayName:             "Example",
+				RPOrigins:                 []string{"https://example.com"},
+				Strict:                    true,
+				StrictChecks:              tc.checks,
+				AllowedAttestationFormats: tc.formats,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user, tc.opts...)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+
+			tc.tamper(response, session)
+
+			_, err = w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestRegistration_CredentialAlgorithm(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		require   bool
+		params    []protocol.CredentialParameter
+		algorithm webauthncose.COSEAlgorithmIdentifier
+		curve     webauthncose.COSEEllipticCurve
+		err       string
+	}{
+		{
+			name:      "ShouldAcceptOfferedAlgorithm",
+			require:   true,
+			algorithm: webauthncose.AlgES256,
+			curve:     webauthncose.P256,
+		},
+		{
+			name:      "ShouldAcceptAlgorithmNotOfferedByDefault",
+			params:    []protocol.CredentialParameter{{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256}},
+			algorithm: webauthncose.AlgES256,
+			curve:     webauthncose.P256,
+		},
+		{
+			name:      "ShouldRejectAlgorithmNotOffered",
+			require:   true,
+			params:    []protocol.CredentialParameter{{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256}},
+			algorithm: webauthncose.AlgES256,
+			curve:     webauthncose.P256,
+			err:       "Credential public key algorithm -7 was not offered in the credential parameters",
+		},
+		{
+			name:      "ShouldRejectAlgorithmInconsistentWithKeyType",
+			params:    []protocol.CredentialParameter{{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256}},
+			algorithm: webauthncose.AlgRS256,
+			curve:     webauthncose.P256,
+			err:       "Credential public key algorithm is not consistent with the key: Key algorithm -257 is not consistent with the key type 2",
+		},
+		{
+			name:      "ShouldRejectAlgorithmInconsistentWithCurve",
+			algorithm: webauthncose.AlgES256,
+			curve:     webauthncose.Secp256k1,
+			err:       "Credential public key algorithm is not consistent with the key: Key algorithm -7 is not consistent with the curve 8",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                    "example.com",
+				RPDisplayName:           "Example",
+				RPOrigins:               []string{"https://example.com"},
+				RequireOfferedAlgorithm: tc.require,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			var opts []RegistrationOption
+
+			if tc.params != nil {
+				opts = append(opts, WithCredentialParameters(tc.params))
+			}
+
+			_, session, err := w.BeginRegistration(user, opts...)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+
+			response.Response.AttestationObject.AuthData.AttData.CredentialPublicKey, err = webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+				PublicKeyData: webauthncose.PublicKeyData{
+					KeyType:   int64(webauthncose.EllipticKey),
+					Algorithm: int64(tc.algorithm),
+				},
+				Curve:  int64(tc.curve),
+				XCoord: key.X.FillBytes(make([]byte, 32)),
+				YCoord: key.Y.FillBytes(make([]byte, 32)),
+			})
+			require.NoError(t, err)
+
+			_, err = w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, protocol.ErrUnsupportedAlgorithm.Type, err.(*protocol.Error).Type)
+			assert.Equal(t, tc.err, err.Error())
+		})
+	}
+}
+
+func registrationTestRSAPublicKey(t *testing.T, key *rsa.PublicKey) []byte {
+	data, err := webauthncbor.Marshal(webauthncose.RSAPublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.RSAKey),
+			Algorithm: int64(webauthncose.AlgRS256),
+		},
+		Modulus:  key.N.Bytes(),
+		Exponent: big.NewInt(int64(key.E)).Bytes(),
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+func registrationTestEC2PublicKey(t *testing.T, key *ecdsa.PublicKey) []byte {
+	data, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: key.X.FillBytes(make([]byte, 32)),
+		YCoord: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestRegistration_Logger(t *testing.T) {
+	logger := &registrationTestLogger{}
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+		Logger:        logger,
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	_, err = w.CreateCredential(user, *session, registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+	require.NoError(t, err)
+
+	require.Len(t, logger.events, 1)
+	assert.Equal(t, "registration attestation verified", logger.events[0].msg)
+	assert.Equal(t, []interface{}{
+		"format", "none",
+		"attestation_type", "none",
+		"user_present", true,
+		"user_verified", false,
+		"user_verification_required", false,
+		"backup_eligible", false,
+		"backup_state", false,
+		"aaguid", "00000000000000000000000000000000",
+	}, logger.events[0].keysAndValues)
+
+	for _, kv := range logger.events[0].keysAndValues {
+		assert.NotEqual(t, session.Challenge, kv)
+	}
+
+	_, err = w.CreateCredential(user, *session, registrationTestResponse(t, key, "invalid", protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+	require.Error(t, err)
+
+	require.Len(t, logger.events, 2)
+	assert.Equal(t, "registration verification failed", logger.events[1].msg)
+	assert.Equal(t, []interface{}{"format", "none", "error_type", protocol.ErrVerification.Type}, logger.events[1].keysAndValues)
+}
+
+func TestRegistration_CreateCredentialResultSelfAttestation(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	testCases := []struct {
+		name            string
+		format          string
+		attestationType string
+		selfAttested    bool
+	}{
+		{"ShouldClassifyPackedSelfAttestation", "packed", string(metadata.BasicSurrogate), true},
+		{"ShouldClassifyNoneAttestation", "none", string(metadata.None), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			result, err := w.CreateCredentialResult(context.Background(), user, *session, registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, tc.format))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.attestationType, result.AttestationType)
+			assert.Equal(t, tc.selfAttested, result.IsSelfAttested())
+			assert.Equal(t, loginTestCredentialID, result.Credential.ID)
+			assert.Equal(t, tc.format, result.Credential.AttestationType)
+		})
+	}
+}
+
+func TestRegistration_AllowCOSEStringLabels(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	stringLabels, err := webauthncbor.Marshal(map[string]interface{}{
+		"kty": int64(webauthncose.EllipticKey),
+		"alg": int64(webauthncose.AlgES256),
+		"crv": int64(webauthncose.P256),
+		"x":   key.X.FillBytes(make([]byte, 32)),
+		"y":   key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	expected, err := webauthncose.ParsePublicKey(registrationTestEC2PublicKey(t, &key.PublicKey))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		format string
+		allow  bool
+	}{
+		{"ShouldAcceptNoneWhenAllowed", "none", true},
+		{"ShouldAcceptPackedSelfAttestationWhenAllowed", "packed", true},
+		{"ShouldRejectNoneByDefault", "none", false},
+		{"ShouldRejectPackedSelfAttestationByDefault", "packed", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                  "example.com",
+				RPDisplayName:         "Example",
+				RPOrigins:             []string{"https://example.com"},
+				AllowCOSEStringLabels: tc.allow,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			credential, err := w.CreateCredential(user, *session, registrationTestResponsePublicKey(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, tc.format, stringLabels))
+
+			if !tc.allow {
+				assert.ErrorContains(t, err, "Unsupported Public Key Type")
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			// The credential public key is stored with the integer labels.
+			parsed, err := webauthncose.ParsePublicKey(credential.PublicKey)
+			require.NoError(t, err)
+			assert.Equal(t, expected, parsed)
+
+			loginUser := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{*credential}}
+
+			_, session, err = w.BeginLogin(loginUser)
+			require.NoError(t, err)
+
+			_, err = w.ValidateLogin(loginUser, *session, loginTestAssertion(t, key, session.Challenge, protocol.FlagUserPresent))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRegistration_CreateCredentialRPID(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	credential, err := w.CreateCredential(user, *session, registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+	require.NoError(t, err)
+
+	assert.Equal(t, w.Config.RPID, credential.RPID)
+}
+
+func TestBeginRegistrationAdditionalExclusions(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	exclusions := []protocol.CredentialDescriptor{
+		Credential{ID: []byte("own"), Transport: []protocol.AuthenticatorTransport{protocol.Internal}}.Descriptor(),
+	}
+
+	others := []protocol.CredentialDescriptor{
+		Credential{ID: []byte("other"), Transport: []protocol.AuthenticatorTransport{protocol.USB}}.Descriptor(),
+		Credential{ID: []byte("own")}.Descriptor(),
+	}
+
+	creation, _, err := w.BeginRegistration(&defaultUser{id: []byte("123")}, WithExclusions(exclusions), WithAdditionalExclusions(others...))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(creation.Response.CredentialExcludeList)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"public-key","id":"b3du","transports":["internal"]},{"type":"public-key","id":"b3RoZXI","transports":["usb"]}]`, string(data))
+	assert.Len(t, exclusions, 1)
+
+	creation, _, err = w.BeginRegistration(&defaultUser{id: []byte("123")}, WithAdditionalExclusions(others[0]))
+	require.NoError(t, err)
+
+	data, err = json.Marshal(creation.Response.CredentialExcludeList)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"public-key","id":"b3RoZXI","transports":["usb"]}]`, string(data))
+}
+
+func TestBeginRegistrationHints(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, _, err := w.BeginRegistration(user,
+		WithAuthenticatorSelection(protocol.AuthenticatorSelection{AuthenticatorAttachment: protocol.Platform}),
+		WithHints(protocol.HintClientDevice, protocol.HintHybrid),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.Hint{protocol.HintClientDevice, protocol.HintHybrid}, creation.Response.Hints)
+	assert.Equal(t, protocol.Platform, creation.Response.AuthenticatorSelection.AuthenticatorAttachment)
+
+	_, _, err = w.BeginRegistration(user, WithHints("usb"))
+	assert.EqualError(t, err, "Unknown hint 'usb'")
+}
+
+func TestBeginRegistrationConditionalCreate(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &loginTestUser{defaultUser{id: []byte("123")}, []Credential{
+		{ID: []byte("passkey"), Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid}},
+	}}
+
+	creation, session, err := w.BeginRegistration(user, WithConditionalCreate())
+	require.NoError(t, err)
+
+	assert.Equal(t, protocol.MediationConditional, creation.Mediation)
+	assert.Equal(t, protocol.MediationConditional, session.Mediation)
+	assert.Equal(t, protocol.Platform, creation.Response.AuthenticatorSelection.AuthenticatorAttachment)
+	assert.Equal(t, protocol.ResidentKeyRequirementRequired, creation.Response.AuthenticatorSelection.ResidentKey)
+	assert.Equal(t, protocol.ResidentKeyRequired(), creation.Response.AuthenticatorSelection.RequireResidentKey)
+
+	data, err := json.Marshal(creation)
+	require.NoError(t, err)
+
+	var options struct {
+		Mediation string          `json:"mediation"`
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+
+	require.NoError(t, json.Unmarshal(data, &options))
+
+	assert.Equal(t, "conditional", options.Mediation)
+	assert.NotContains(t, string(options.PublicKey), "mediation")
+
+	data, err = json.Marshal(creation.Response.CredentialExcludeList)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"public-key","id":"cGFzc2tleQ","transports":["internal","hybrid"]}]`, string(data))
+
+	exclusions := []protocol.CredentialDescriptor{Credential{ID: []byte("other")}.Descriptor()}
+
+	creation, _, err = w.BeginRegistration(user, WithExclusions(exclusions), WithConditionalCreate())
+	require.NoError(t, err)
+
+	assert.Equal(t, exclusions, creation.Response.CredentialExcludeList)
+
+	creation, session, err = w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	assert.Empty(t, creation.Mediation)
+	assert.Empty(t, session.Mediation)
+	assert.Empty(t, creation.Response.CredentialExcludeList)
+
+	data, err = json.Marshal(creation)
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(data), "mediation")
+}
+
+func TestRegistration_ConditionalCreate(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user, WithConditionalCreate())
+	require.NoError(t, err)
+
+	credential, err := w.CreateCredential(user, *session, registrationTestResponse(t, key, session.Challenge, protocol.FlagAttestedCredentialData))
+	require.NoError(t, err)
+
+	assert.False(t, credential.Flags.UserPresent)
+
+	_, session, err = w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	_, err = w.CreateCredential(user, *session, registrationTestResponse(t, key, session.Challenge, protocol.FlagAttestedCredentialData))
+	require.Error(t, err)
+	assert.Equal(t, "User presence flag not set by authenticator\n", err.(*protocol.Error).DevInfo)
+}
+
+func TestRegistration_ChallengeStoreRejectsReplay(t *testing.T) {
+	store := &testChallengeStore{used: map[string]bool{}}
+
+	w, err := New(&Config{
+		RPID:           "example.com",
+		RPDisplayName:  "Example",
+		RPOrigins:      []string{"https://example.com"},
+		ChallengeStore: store,
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	response := registrationTestResponse(t, key, "invalid", protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+
+	// A failed registration does not consume the challenge.
+	_, err = w.CreateCredential(user, *session, response)
+	require.Error(t, err)
+	assert.False(t, store.used[session.Challenge])
+
+	response = registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+
+	_, err = w.CreateCredential(user, *session, response)
+	require.NoError(t, err)
+
+	_, err = w.CreateCredential(user, *session, response)
+	assert.EqualError(t, err, "Session challenge has already been used")
+}
+
+func TestBeginRegistrationCredBlob(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, _, err := w.BeginRegistration(user, WithCredBlob([]byte("blob")))
+	require.NoError(t, err)
+
+	assert.Equal(t, protocol.URLEncodedBase64("blob"), creation.Response.Extensions[protocol.ExtensionCredBlob])
+
+	_, _, err = w.BeginRegistration(user, WithCredBlob(make([]byte, protocol.MaxCredBlobLength+1)))
+	assert.EqualError(t, err, "Extension 'credBlob' input is 33 bytes which exceeds the maximum of 32 bytes")
+
+	assertion, _, err := w.BeginDiscoverableLogin(WithGetCredBlob())
+	require.NoError(t, err)
+
+	assert.Equal(t, true, assertion.Response.Extensions[protocol.ExtensionGetCredBlob])
+}
+
+func TestBeginRegistrationRequestedExtensions(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, _, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	assert.Empty(t, creation.RequestedExtensions())
+
+	creation, _, err = w.BeginRegistration(user, WithExtensions(protocol.AuthenticationExtensions{"credProps": true}), WithCredBlob([]byte("blob")))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{protocol.ExtensionCredBlob, "credProps"}, creation.RequestedExtensions())
+
+	assertion, _, err := w.BeginDiscoverableLogin(WithAssertionExtensions(protocol.AuthenticationExtensions{"largeBlob": map[string]interface{}{"read": true}}), WithGetCredBlob())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{protocol.ExtensionGetCredBlob, "largeBlob"}, assertion.RequestedExtensions())
+}
+
+func TestBeginRegistrationDuplicateCredentialParameters(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, session, err := w.BeginRegistration(user, WithCredentialParameters([]protocol.CredentialParameter{
+		{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+		{Algorithm: webauthncose.AlgEdDSA},
+		{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+	}))
+	require.NoError(t, err)
+
+	expected := []protocol.CredentialParameter{
+		{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+		{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+	}
+
+	assert.Equal(t, expected, creation.Response.Parameters)
+	assert.Equal(t, expected, session.CredentialParameters)
+}
+
+func TestBeginRegistrationRPEntity(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://tenant.example.com"},
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	creation, session, err := w.BeginRegistration(user, WithRPEntity("Tenant", "tenant.example.com", "https://tenant.example.com/icon.png"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Tenant", creation.Response.RelyingParty.Name)
+	assert.Equal(t, "tenant.example.com", creation.Response.RelyingParty.ID)
+	assert.Equal(t, "https://tenant.example.com/icon.png", creation.Response.RelyingParty.Icon)
+	assert.Equal(t, "tenant.example.com", session.RelyingPartyID)
+
+	creation, session, err = w.BeginRegistration(user, WithRPEntity("Tenant", "", ""))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Tenant", creation.Response.RelyingParty.Name)
+	assert.Equal(t, "example.com", creation.Response.RelyingParty.ID)
+	assert.Empty(t, session.RelyingPartyID)
+
+	_, _, err = w.BeginRegistration(user, WithRPEntity("Other", "other.com", ""))
+	assert.EqualError(t, err, "RP ID 'other.com' is not valid for any of the configured origins")
+
+	_, _, err = w.BeginRegistration(user, WithRPEntity("Other", "ant.example.com", ""))
+	assert.EqualError(t, err, "RP ID 'ant.example.com' is not valid for any of the configured origins")
+
+	_, _, err = w.BeginRegistration(user, WithRPEntity("Other", "com", ""))
+	assert.EqualError(t, err, "RP ID 'com' is not valid for any of the configured origins")
+}
+
+func TestRegistration_RemainingDiscoverableCredentials(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+
+	result, err := w.CreateCredentialResult(context.Background(), user, *session, response)
+	require.NoError(t, err)
+	assert.Nil(t, result.RemainingDiscoverableCredentials)
+
+	_, session, err = w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	response = registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+	require.NoError(t, json.Unmarshal([]byte(`{"remainingDiscoverableCredentials":2}`), &response.ClientExtensionResults))
+
+	result, err = w.CreateCredentialResult(context.Background(), user, *session, response)
+	require.NoError(t, err)
+	require.NotNil(t, result.RemainingDiscoverableCredentials)
+	assert.Equal(t, uint64(2), *result.RemainingDiscoverableCredentials)
+}
+
+func TestRegistration_RegisteredExtension(t *testing.T) {
+	protocol.RegisterExtension("exampleRegistration", func(input, clientOutput, _ interface{}) (interface{}, error) {
+		return fmt.Sprintf("%v:%v", input, clientOutput), nil
+	})
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user, WithExtensions(protocol.AuthenticationExtensions{"exampleRegistration": "input"}))
+	require.NoError(t, err)
+
+	response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+	require.NoError(t, json.Unmarshal([]byte(`{"exampleRegistration":"output"}`), &response.ClientExtensionResults))
+
+	result, err := w.CreateCredentialResult(context.Background(), user, *session, response)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"exampleRegistration": "input:output"}, result.Extensions)
+}
+
+func TestRegistration_ClientDataHash(t *testing.T) {
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	response := registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, "packed")
+
+	clientDataHash := sha256.Sum256(response.Raw.AttestationResponse.ClientDataJSON)
+	assert.Equal(t, clientDataHash[:], response.Raw.AttestationResponse.ClientDataHash())
+
+	// The modified clientDataJSON decodes to the same client data but its hash is no longer the one signed by the
+	// authenticator.
+	response.Raw.AttestationResponse.ClientDataJSON = append(response.Raw.AttestationResponse.ClientDataJSON, ' ')
+	assert.NotEqual(t, clientDataHash[:], response.Raw.AttestationResponse.ClientDataHash())
+
+	_, err = w.CreateCredential(user, *session, response)
+	require.Error(t, err)
+	assert.Equal(t, protocol.ErrInvalidAttestation.Type, err.(*protocol.Error).Type)
+}
+
+func TestRegistration_AttestationRootPool(t *testing.T) {
+	root, rootKey := registrationTestCertificateAuthority(t, "Test Conformance Root")
+	other, _ := registrationTestCertificateAuthority(t, "Test Other Root")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		root   *x509.Certificate
+		format string
+		err    string
+	}{
+		{"ShouldVerifyAgainstCustomRoot", root, "packed", ""},
+		{"ShouldFailAgainstOtherRoot", other, "packed", "Error validating the attestation certificate chain against the attestation root pool: x509: certificate signed by unknown authority"},
+		{"ShouldRejectSelfAttestation", root, "self", "Attestation of type basic_surrogate has no certificate chain to verify against the attestation root pool"},
+		{"ShouldRejectNoneAttestation", root, "none", "Attestation of type none has no certificate chain to verify against the attestation root pool"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := x509.NewCertPool()
+			pool.AddCert(tc.root)
+
+			w, err := New(&Config{
+				RPID:                "example.com",
+				RPDisplayName:       "Example",
+				RPOrigins:           []string{"https://example.com"},
+				AttestationRootPool: pool,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			var response *protocol.ParsedCredentialCreationData
+
+			switch tc.format {
+			case "self":
+				response = registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, "packed")
+			case "none":
+				response = registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+			default:
+				response = registrationTestPackedFullResponse(t, key, session.Challenge, root, rootKey)
+			}
+
+			credential, err := w.CreateCredential(user, *session, response)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, protocol.ErrAttestationTrust.Type, err.(*protocol.Error).Type)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, loginTestCredentialID, credential.ID)
+		})
+	}
+}
+
+func TestRegistration_AttestationFailureReason(t *testing.T) {
+	root, rootKey := registrationTestCertificateAuthority(t, "Test Failure Reason Root")
+	other, _ := registrationTestCertificateAuthority(t, "Test Failure Reason Other Root")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		config func(config *Config)
+		tamper func(response *protocol.ParsedCredentialCreationData)
+		reason protocol.AttestationFailureReason
+	}{
+		{
+			"ShouldReportUntrustedRoot",
+			func(config *Config) {
+				config.AttestationRootPool = x509.NewCertPool()
+				config.AttestationRootPool.AddCert(other)
+			},
+			nil,
+			protocol.AttestationFailureUntrustedRoot,
+		},
+		{
+			"ShouldReportCertificateExpired",
+			func(config *Config) {
+				protocol.VerificationTime = func() time.Time {
+					return time.Now().Add(2 * time.Hour)
+				}
+			},
+			nil,
+			protocol.AttestationFailureCertificateExpired,
+		},
+		{
+			"ShouldReportSignatureInvalid",
+			nil,
+			func(response *protocol.ParsedCredentialCreationData) {
+				sig := append([]byte{}, response.Response.AttestationObject.AttStatement["sig"].([]byte)...)
+				sig[len(sig)-1] ^= 0xff
+
+				response.Response.AttestationObject.AttStatement["sig"] = sig
+			},
+			protocol.AttestationFailureSignatureInvalid,
+		},
+		{
+			"ShouldReportFormatUnsupported",
+			nil,
+			func(response *protocol.ParsedCredentialCreationData) {
+				response.Response.AttestationObject.Format = "unknown"
+			},
+			protocol.AttestationFailureFormatUnsupported,
+		},
+		{
+			"ShouldReportFormatNotAllowed",
+			func(config *Config) {
+				config.AllowedAttestationFormats = []string{"tpm"}
+			},
+			nil,
+			protocol.AttestationFailureFormatUnsupported,
+		},
+		{
+			"ShouldReportAAGUIDDenied",
+			func(config *Config) {
+				config.MinimumCertificationLevel = metadata.CertificationLevelL1
+			},
+			nil,
+			protocol.AttestationFailureAAGUIDDenied,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				protocol.VerificationTime = time.Now
+			})
+
+			config := &Config{
+				RPID:          "example.com",
+				RPDisplayName: "Example",
+				RPOrigins:     []string{"https://example.com"},
+			}
+
+			if tc.config != nil {
+				tc.config(config)
+			}
+
+			w, err := New(config)
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestPackedFullResponse(t, key, session.Challenge, root, rootKey)
+
+			if tc.tamper != nil {
+				tc.tamper(response)
+			}
+
+			_, err = w.CreateCredential(user, *session, response)
+			require.Error(t, err)
+
+			var protocolErr *protocol.Error
+
+			require.ErrorAs(t, err, &protocolErr)
+			assert.Equal(t, tc.reason, protocolErr.Reason)
+
+			reason, ok := protocol.AttestationFailure(err)
+			assert.True(t, ok)
+			assert.Equal(t, tc.reason, reason)
+		})
+	}
+
+	_, ok := protocol.AttestationFailure(protocol.ErrBadRequest)
+	assert.False(t, ok)
+}
+
+func TestRegistration_AllowAttestationDowngrade(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		preference protocol.ConveyancePreference
+		format     string
+		allow      bool
+		err        string
+	}{
+		{"ShouldRejectDirectDowngrade", protocol.PreferDirectAttestation, "none", false, "Attestation was requested but the client returned none attestation"},
+		{"ShouldRejectEnterpriseDowngrade", protocol.PreferEnterpriseAttestation, "none", false, "Attestation was requested but the client returned none attestation"},
+		{"ShouldAllowDirectDowngrade", protocol.PreferDirectAttestation, "none", true, ""},
+		{"ShouldAcceptDirectAttestation", protocol.PreferDirectAttestation, "packed", false, ""},
+		{"ShouldAcceptIndirectNone", protocol.PreferIndirectAttestation, "none", false, ""},
+		{"ShouldAcceptNoPreferenceNone", protocol.PreferNoAttestation, "none", false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                      "example.com",
+				RPDisplayName:             "Example",
+				RPOrigins:                 []string{"https://example.com"},
+				AllowAttestationDowngrade: tc.allow,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user, WithConveyancePreference(tc.preference))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.preference, session.Attestation)
+
+			credential, err := w.CreateCredential(user, *session, registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, tc.format))
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, fmt.Sprintf("Registration requested %s attestation", tc.preference), err.(*protocol.Error).DevInfo)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tc.format == "none" {
+				assert.Equal(t, "none", credential.AttestationType)
+			}
+		})
+	}
+}
+
+func TestRegistration_CompareAttestationTransports(t *testing.T) {
+	root, rootKey := registrationTestCertificateAuthority(t, "Test Transports Root")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// The uSB and nFC bits of the FIDO U2F certificate transports extension.
+	value, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x30}, BitLength: 4})
+	require.NoError(t, err)
+
+	extension := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 2, 1, 1}, Value: value}
+
+	testCases := []struct {
+		name       string
+		transports []protocol.AuthenticatorTransport
+		discrepant bool
+	}{
+		{"ShouldNotLogMatchingTransports", []protocol.AuthenticatorTransport{protocol.NFC, protocol.USB}, false},
+		{"ShouldLogUnattestedTransport", []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC, protocol.BLE}, true},
+		{"ShouldLogMissingTransport", []protocol.AuthenticatorTransport{protocol.USB}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &registrationTestLogger{}
+
+			w, err := New(&Config{
+				RPID:                         "example.com",
+				RPDisplayName:                "Example",
+				RPOrigins:                    []string{"https://example.com"},
+				CompareAttestationTransports: true,
+				Logger:                       logger,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestPackedFullResponse(t, key, session.Challenge, root, rootKey, extension)
+			response.Response.Transports = tc.transports
+
+			_, err = w.CreateCredential(user, *session, response)
+			require.NoError(t, err)
+
+			var logged *registrationTestLogEvent
+
+			for i, event := range logger.events {
+				if event.msg == "registration transports differ from attestation certificate" {
+					logged = &logger.events[i]
+				}
+			}
+
+			if !tc.discrepant {
+				assert.Nil(t, logged)
+
+				return
+			}
+
+			require.NotNil(t, logged)
+			assert.Equal(t, []interface{}{
+				"reported", tc.transports,
+				"attested", []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC},
+			}, logged.keysAndValues)
+		})
+	}
+}
+
+// registrationTestCertificateAuthority generates a self-signed root certificate authority.
+func registrationTestCertificateAuthority(t *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(data)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+// registrationTestPackedFullResponse is the same as registrationTestResponseFormat but uses packed basic attestation
+// with an attestation certificate issued by the root.
+func registrationTestPackedFullResponse(t *testing.T, key *ecdsa.PrivateKey, challenge string, root *x509.Certificate, rootKey *ecdsa.PrivateKey, extensions ...pkix.Extension) *protocol.ParsedCredentialCreationData {
+	attestationKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Example Vendor"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "Example Authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       extensions,
+	}
+
+	attestationCert, err := x509.CreateCertificate(rand.Reader, template, root, &attestationKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, byte(protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+	authData = binary.BigEndian.AppendUint32(authData, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(loginTestCredentialID)))
+	authData = append(authData, loginTestCredentialID...)
+	authData = append(authData, registrationTestEC2PublicKey(t, &key.PublicKey)...)
+
+	clientDataJSON := []byte(fmt.Sprintf(`{"type":"webauthn.create","challenge":"%s","origin":"https://example.com"}`, challenge))
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, attestationKey, digest[:])
+	require.NoError(t, err)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt": "packed",
+		"attStmt": map[string]interface{}{
+			"alg": int64(webauthncose.AlgES256),
+			"sig": signature,
+			"x5c": []interface{}{attestationCert},
+		},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	body := fmt.Sprintf(`{"id":"%[1]s","rawId":"%[1]s","type":"public-key","response":{"attestationObject":"%[2]s","clientDataJSON":"%[3]s"}}`,
+		encode(loginTestCredentialID), encode(attestationObject), encode(clientDataJSON))
+
+	pcc, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+
+	return pcc
+}
+
+func TestRegistration_RequireZeroAAGUIDForNone(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	aaguid := uuid.MustParse("ee882879-721c-4913-9775-3dfcce97072a")
+
+	testCases := []struct {
+		name    string
+		require bool
+		format  string
+		aaguid  []byte
+		err     string
+	}{
+		{"ShouldAcceptZeroAAGUID", true, "none", make([]byte, 16), ""},
+		{"ShouldRejectNonZeroAAGUID", true, "none", aaguid[:], "Credential AAGUID must be zero for none attestation"},
+		{"ShouldAcceptNonZeroAAGUIDWhenNotRequired", false, "none", aaguid[:], ""},
+		{"ShouldAcceptNonZeroAAGUIDForPacked", true, "packed", aaguid[:], ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                     "example.com",
+				RPDisplayName:            "Example",
+				RPOrigins:                []string{"https://example.com"},
+				RequireZeroAAGUIDForNone: tc.require,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, tc.format)
+			response.Response.AttestationObject.AuthData.AttData.AAGUID = tc.aaguid
+
+			credential, err := w.CreateCredential(user, *session, response)
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, protocol.ErrVerification.Type, err.(*protocol.Error).Type)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.aaguid, credential.Authenticator.AAGUID)
+		})
+	}
+}
+
+func TestRegistration_RejectExistingCredentials(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		publicKeys bool
+		existingID []byte
+		key        *ecdsa.PrivateKey
+		err        string
+	}{
+		{"ShouldRejectExistingID", false, loginTestCredentialID, otherKey, "Credential ID matches an existing credential"},
+		{"ShouldAcceptExistingPublicKeyWithoutThumbprints", false, []byte("other"), key, ""},
+		{"ShouldRejectExistingPublicKey", true, []byte("other"), key, "Credential public key matches an existing credential"},
+		{"ShouldAcceptNewCredential", true, []byte("other"), otherKey, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                      "example.com",
+				RPDisplayName:             "Example",
+				RPOrigins:                 []string{"https://example.com"},
+				RejectExistingCredentials: true,
+				RejectExistingPublicKeys:  tc.publicKeys,
+			})
+			require.NoError(t, err)
+
+			user := &loginTestUser{defaultUser: defaultUser{id: []byte("123")}}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			credential, err := w.CreateCredential(user, *session, registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+			require.NoError(t, err)
+
+			credential.ID = tc.existingID
+			user.credentials = append(user.credentials, *credential)
+
+			_, session, err = w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			_, err = w.CreateCredential(user, *session, registrationTestResponse(t, tc.key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData))
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, protocol.ErrCredentialExists.Type, err.(*protocol.Error).Type)
+			assert.Equal(t, tc.err, err.(*protocol.Error).DevInfo)
+		})
+	}
+}
+
+func TestRegistration_UnknownFormatAsNone(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		enabled bool
+		format  string
+		valid   bool
+	}{
+		{"ShouldAcceptUnknownFormatWhenEnabled", true, "example-vendor", true},
+		{"ShouldRejectUnknownFormatWhenDisabled", false, "example-vendor", false},
+		{"ShouldVerifyKnownFormatWhenEnabled", true, "packed", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                "example.com",
+				RPDisplayName:       "Example",
+				RPOrigins:           []string{"https://example.com"},
+				UnknownFormatAsNone: tc.enabled,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponseFormat(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData, tc.format)
+
+			result, err := w.CreateCredentialResult(context.Background(), user, *session, response)
+
+			if !tc.valid {
+				require.Error(t, err)
+				assert.Equal(t, protocol.ErrAttestationFormat.Type, err.(*protocol.Error).Type)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.format, response.Response.AttestationObject.Format)
+			assert.Equal(t, tc.format, result.Credential.AttestationType)
+			assert.Equal(t, response.Response.AttestationObject.AuthData.AttData.CredentialPublicKey, result.Credential.PublicKey)
+
+			if tc.format == "packed" {
+				assert.Equal(t, string(metadata.SelfAttestation), result.AttestationType)
+			} else {
+				assert.Equal(t, string(metadata.None), result.AttestationType)
+			}
+		})
+	}
+}
+
+func TestRegistration_VerifyMetadataUserVerification(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	noUV := uuid.MustParse("4c0cf95d-2f40-43b5-ba42-4c83a11c04ba")
+	fingerprint := uuid.MustParse("0a20bc58-c479-4e46-9b3c-d4fdb74b4bb9")
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+		AaGUID: noUV.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			UserVerificationDetails: [][]metadata.VerificationMethodDescriptor{
+				{{UserVerificationMethod: metadata.UserVerificationMethodPresenceInternal}},
+			},
+		},
+	})
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+		AaGUID: fingerprint.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			UserVerificationDetails: [][]metadata.VerificationMethodDescriptor{
+				{{UserVerificationMethod: metadata.UserVerificationMethodPresenceInternal}},
+				{{UserVerificationMethod: "fingerprint_internal"}},
+			},
+		},
+	})
+
+	t.Cleanup(func() {
+		delete(metadata.DefaultStore.AAGUIDs, noUV)
+		delete(metadata.DefaultStore.AAGUIDs, fingerprint)
+	})
+
+	testCases := []struct {
+		name   string
+		aaguid uuid.UUID
+		flags  protocol.AuthenticatorFlags
+		err    string
+	}{
+		{"ShouldRejectUserVerifiedWithoutCapability", noUV, protocol.FlagUserVerified, "User verification is inconsistent with the authenticator metadata"},
+		{"ShouldAcceptUserPresentWithoutCapability", noUV, 0, ""},
+		{"ShouldAcceptUserVerifiedWithCapability", fingerprint, protocol.FlagUserVerified, ""},
+		{"ShouldAcceptUserVerifiedWithoutMetadata", uuid.Nil, protocol.FlagUserVerified, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                           "example.com",
+				RPDisplayName:                  "Example",
+				RPOrigins:                      []string{"https://example.com"},
+				VerifyMetadataUserVerification: true,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData|tc.flags)
+			response.Response.AttestationObject.AuthData.AttData.AAGUID = tc.aaguid[:]
+
+			_, err = w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, protocol.ErrMetadataUserVerification.Type, err.(*protocol.Error).Type)
+		})
+	}
+}
+
+func TestRegistration_RequireUserVerificationCapable(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	presenceOnly := uuid.MustParse("7d1351a6-e097-4852-b8bf-c9ac5c9ce4a3")
+	pin := uuid.MustParse("c5ef55ff-ad9a-4b9f-b580-adebafe026d0")
+	undeclared := uuid.MustParse("d41f5a69-b817-4144-a13c-9ebd6d9254d6")
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+		AaGUID: presenceOnly.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			UserVerificationDetails: [][]metadata.VerificationMethodDescriptor{
+				{{UserVerificationMethod: metadata.UserVerificationMethodPresenceInternal}},
+				{{UserVerificationMethod: metadata.UserVerificationMethodNone}},
+			},
+		},
+	})
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+		AaGUID: pin.String(),
+		MetadataStatement: metadata.MetadataStatement{
+			UserVerificationDetails: [][]metadata.VerificationMethodDescriptor{
+				{{UserVerificationMethod: metadata.UserVerificationMethodPresenceInternal}},
+				{{UserVerificationMethod: metadata.UserVerificationMethodPresenceInternal}, {UserVerificationMethod: "passcode_internal"}},
+			},
+		},
+	})
+
+	metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{AaGUID: undeclared.String()})
+
+	t.Cleanup(func() {
+		delete(metadata.DefaultStore.AAGUIDs, presenceOnly)
+		delete(metadata.DefaultStore.AAGUIDs, pin)
+		delete(metadata.DefaultStore.AAGUIDs, undeclared)
+	})
+
+	testCases := []struct {
+		name    string
+		aaguid  uuid.UUID
+		require bool
+		err     string
+	}{
+		{"ShouldRejectWithoutCapability", presenceOnly, true, "Authenticator is not capable of user verification"},
+		{"ShouldAcceptWithoutCapabilityWhenNotRequired", presenceOnly, false, ""},
+		{"ShouldAcceptWithCapability", pin, true, ""},
+		{"ShouldAcceptWithoutUserVerificationDetails", undeclared, true, ""},
+		{"ShouldAcceptWithoutMetadata", uuid.Nil, true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                           "example.com",
+				RPDisplayName:                  "Example",
+				RPOrigins:                      []string{"https://example.com"},
+				RequireUserVerificationCapable: tc.require,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+			response.Response.AttestationObject.AuthData.AttData.AAGUID = tc.aaguid[:]
+
+			_, err = w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, protocol.ErrUserVerificationCapability.Type, err.(*protocol.Error).Type)
+			assert.Equal(t, fmt.Sprintf("Authenticator %s declares no user verification method in its metadata", tc.aaguid), err.(*protocol.Error).DevInfo)
+		})
+	}
+}
+
+func TestRegistration_MinimumCertificationLevel(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	l1 := uuid.MustParse("b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a01")
+	l2 := uuid.MustParse("b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a02")
+	l3 := uuid.MustParse("b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a03")
+
+	for aaguid, status := range map[uuid.UUID]metadata.AuthenticatorStatus{
+		l1: metadata.FidoCertifiedL1,
+		l2: metadata.FidoCertifiedL2,
+		l3: metadata.FidoCertifiedL3,
+	} {
+		metadata.DefaultStore.Add(metadata.MetadataBLOBPayloadEntry{
+			AaGUID:        aaguid.String(),
+			StatusReports: []metadata.StatusReport{{Status: status}},
+		})
+	}
+
+	t.Cleanup(func() {
+		delete(metadata.DefaultStore.AAGUIDs, l1)
+		delete(metadata.DefaultStore.AAGUIDs, l2)
+		delete(metadata.DefaultStore.AAGUIDs, l3)
+	})
+
+	testCases := []struct {
+		name    string
+		minimum metadata.CertificationLevel
+		aaguid  uuid.UUID
+		err     string
+	}{
+		{"ShouldAcceptWithoutMinimum", metadata.CertificationLevelNone, uuid.Nil, ""},
+		{"ShouldRejectL1BelowL2", metadata.CertificationLevelL2, l1, "Authenticator b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a01 is certified FIDO_CERTIFIED_L1 which is below FIDO_CERTIFIED_L2"},
+		{"ShouldAcceptL2AtL2", metadata.CertificationLevelL2, l2, ""},
+		{"ShouldAcceptL3AboveL2", metadata.CertificationLevelL2, l3, ""},
+		{"ShouldRejectL2BelowL2plus", metadata.CertificationLevelL2plus, l2, "Authenticator b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a02 is certified FIDO_CERTIFIED_L2 which is below FIDO_CERTIFIED_L2plus"},
+		{"ShouldRejectWithoutMetadata", metadata.CertificationLevelL1, uuid.Nil, "Authenticator 00000000-0000-0000-0000-000000000000 has no metadata statement"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := New(&Config{
+				RPID:                      "example.com",
+				RPDisplayName:             "Example",
+				RPOrigins:                 []string{"https://example.com"},
+				MinimumCertificationLevel: tc.minimum,
+			})
+			require.NoError(t, err)
+
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, protocol.FlagUserPresent|protocol.FlagAttestedCredentialData)
+			response.Response.AttestationObject.AuthData.AttData.AAGUID = tc.aaguid[:]
+
+			_, err = w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, protocol.ErrMetadataCertificationLevel.Type, err.(*protocol.Error).Type)
+			assert.Equal(t, tc.err, err.(*protocol.Error).DevInfo)
+		})
+	}
+}
+
+func TestRegistration_NoneAttestationCeremonyChecks(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	w, err := New(&Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		flags  protocol.AuthenticatorFlags
+		mutate func(session *SessionData, response *protocol.ParsedCredentialCreationData)
+		err    string
+	}{
+		{
+			name:  "ShouldAcceptValidCeremony",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+		},
+		{
+			name:  "ShouldRejectWrongType",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+			mutate: func(_ *SessionData, response *protocol.ParsedCredentialCreationData) {
+				response.Response.CollectedClientData.Type = protocol.AssertCeremony
+			},
+			err: "Error validating ceremony type",
+		},
+		{
+			name:  "ShouldRejectWrongChallenge",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+			mutate: func(_ *SessionData, response *protocol.ParsedCredentialCreationData) {
+				response.Response.CollectedClientData.Challenge = "d3Jvbmc"
+			},
+			err: "Error validating challenge",
+		},
+		{
+			name:  "ShouldRejectWrongOrigin",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+			mutate: func(_ *SessionData, response *protocol.ParsedCredentialCreationData) {
+				response.Response.CollectedClientData.Origin = "https://evil.example"
+			},
+			err: "Error validating origin",
+		},
+		{
+			name:  "ShouldRejectWrongRPIDHash",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+			mutate: func(_ *SessionData, response *protocol.ParsedCredentialCreationData) {
+				response.Response.AttestationObject.AuthData.RPIDHash = protocol.RPIDHash("evil.example")
+			},
+			err: "Error validating the authenticator response",
+		},
+		{
+			name:  "ShouldRejectMissingUserPresent",
+			flags: protocol.FlagAttestedCredentialData,
+			err:   "Error validating the authenticator response",
+		},
+		{
+			name:  "ShouldRejectMissingRequiredUserVerification",
+			flags: protocol.FlagUserPresent | protocol.FlagAttestedCredentialData,
+			mutate: func(session *SessionData, _ *protocol.ParsedCredentialCreationData) {
+				session.UserVerification = protocol.VerificationRequired
+			},
+			err: "Error validating the authenticator response",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := &defaultUser{id: []byte("123")}
+
+			_, session, err := w.BeginRegistration(user)
+			require.NoError(t, err)
+
+			response := registrationTestResponse(t, key, session.Challenge, tc.flags)
+			require.Equal(t, "none", response.Response.AttestationObject.Format)
+
+			if tc.mutate != nil {
+				tc.mutate(session, response)
+			}
+
+			credential, err := w.CreateCredential(user, *session, response)
+
+			if tc.err == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "none", credential.AttestationType)
+
+				return
+			}
+
+			assert.Nil(t, credential)
+			require.Error(t, err)
+			assert.Equal(t, protocol.ErrVerification.Type, err.(*protocol.Error).Type)
+			assert.Equal(t, tc.err, err.Error())
+		})
+	}
+}
+
+func TestRegistration_MetadataSnapshot(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	root, rootKey := registrationTestCertificateAuthority(t, "Test Snapshot Root")
+
+	w, err := New(&Config{
+		RPID:                      "example.com",
+		RPDisplayName:             "Example",
+		RPOrigins:                 []string{"https://example.com"},
+		MinimumCertificationLevel: metadata.CertificationLevelL1,
+	})
+	require.NoError(t, err)
+
+	user := &defaultUser{id: []byte("123")}
+
+	_, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+
+	aaguid := uuid.MustParse("b3e4c1f4-62a4-4d4b-9a59-6f1e6dbb0a10")
+
+	response := registrationTestPackedFullResponse(t, key, session.Challenge, root, rootKey)
+	response.Response.AttestationObject.AuthData.AttData.AAGUID = aaguid[:]
+
+	snapshot := func(number int, status metadata.AuthenticatorStatus) *metadata.MetadataBLOBPayload {
+		return &metadata.MetadataBLOBPayload{
+			Number: number,
+			Entries: []metadata.MetadataBLOBPayloadEntry{
+				{
+					AaGUID:        aaguid.String(),
+					StatusReports: []metadata.StatusReport{{Status: status}},
+					MetadataStatement: metadata.MetadataStatement{
+						AttestationTypes: []metadata.AuthenticatorAttestationType{metadata.BasicFull},
+					},
+				},
+			},
+		}
+	}
+
+	certified := metadata.WithStore(context.Background(), metadata.NewStoreFromPayload(snapshot(1, metadata.FidoCertifiedL1)))
+	revoked := metadata.WithStore(context.Background(), metadata.NewStoreFromPayload(snapshot(2, metadata.Revoked)))
+
+	result, err := w.CreateCredentialResult(certified, user, *session, response)
+	require.NoError(t, err)
+	assert.Equal(t, string(metadata.BasicFull), result.AttestationType)
+
+	_, err = w.CreateCredentialResult(revoked, user, *session, response)
+	require.Error(t, err)
+	assert.Equal(t, "Authenticator with undesirable status encountered", err.Error())
+
+	reason, ok := protocol.AttestationFailure(err)
+	assert.True(t, ok)
+	assert.Equal(t, protocol.AttestationFailureAAGUIDDenied, reason)
+
+	// The live store doesn't contain the authenticator so it fails the minimum certification level.
+	_, err = w.CreateCredentialResult(context.Background(), user, *session, response)
+	require.Error(t, err)
+	assert.Equal(t, protocol.ErrMetadataCertificationLevel.Type, err.(*protocol.Error).Type)
+}
+
+type registrationTestLogger struct {
+	events []registrationTestLogEvent
+}
+
+type registrationTestLogEvent struct {
+	msg           string
+	keysAndValues []interface{}
+}
+
+func (l *registrationTestLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.events = append(l.events, registrationTestLogEvent{msg, keysAndValues})
+}
+
+// registrationTestResponse returns a response with the none attestation format for a credential with the ID
+// loginTestCredentialID and the public key for the example.com relying party.
+func registrationTestResponse(t *testing.T, key *ecdsa.PrivateKey, challenge string, flags protocol.AuthenticatorFlags) *protocol.ParsedCredentialCreationData {
+	return registrationTestResponseFormat(t, key, challenge, flags, "none")
+}
+
+// registrationTestResponseFormat is the same as registrationTestResponse but uses the provided attestation format,
+// which is either none or packed in which case the response uses packed self attestation.
+func registrationTestResponseFormat(t *testing.T, key *ecdsa.PrivateKey, challenge string, flags protocol.AuthenticatorFlags, format string) *protocol.ParsedCredentialCreationData {
+	return registrationTestResponsePublicKey(t, key, challenge, flags, format, registrationTestEC2PublicKey(t, &key.PublicKey))
+}
+
+// registrationTestResponsePublicKey is the same as registrationTestResponseFormat but the attested credential data
+// carries the provided COSE encoded credential public key of the key.
+func registrationTestResponsePublicKey(t *testing.T, key *ecdsa.PrivateKey, challenge string, flags protocol.AuthenticatorFlags, format string, publicKey []byte) *protocol.ParsedCredentialCreationData {
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, byte(flags))
+	authData = binary.BigEndian.AppendUint32(authData, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(loginTestCredentialID)))
+	authData = append(authData, loginTestCredentialID...)
+	authData = append(authData, publicKey...)
+
+	clientDataJSON := []byte(fmt.Sprintf(`{"type":"webauthn.create","challenge":"%s","origin":"https://example.com"}`, challenge))
+
+	attStmt := map[string]interface{}{}
+
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+
+		attStmt["alg"] = int64(webauthncose.AlgES256)
+		attStmt["sig"] = signature
+	}
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      format,
+		"attStmt":  attStmt,
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	body := fmt.Sprintf(`{"id":"%[1]s","rawId":"%[1]s","type":"public-key","response":{"attestationObject":"%[2]s","clientDataJSON":"%[3]s"}}`,
+		encode(loginTestCredentialID), encode(attestationObject), encode(clientDataJSON))
+
+	pcc, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+
+	return pcc
+}
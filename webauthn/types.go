@@ -1,11 +1,19 @@
 package webauthn
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"strings"
 	"time"
 
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/flaviup/webauthn/metadata"
 	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
 )
 
 // New creates a new WebAuthn object given the proper Config.
@@ -42,6 +50,15 @@ type Config struct {
 	// AuthenticatorSelection sets the default authenticator selection options.
 	AuthenticatorSelection protocol.AuthenticatorSelection
 
+	// AllowCrossOrigin allows ceremonies performed within an iframe which is not same-origin with its ancestors, in
+	// which case the topOrigin of the client data must match one of the RPOrigins if it's present.
+	AllowCrossOrigin bool
+
+	// AllowedTopOrigins are the origins of the top level browsing contexts permitted for the cross-origin ceremonies
+	// allowed by AllowCrossOrigin, such as the pages embedding the Relying Party in an iframe. When set, the topOrigin of
+	// the client data of cross-origin ceremonies must be present and match one of these instead of the RPOrigins.
+	AllowedTopOrigins []string
+
 	// Debug enables various debug options.
 	Debug bool
 
@@ -53,6 +70,135 @@ type Config struct {
 	// Timeouts configures various timeouts.
 	Timeouts TimeoutsConfig
 
+	// MaxAttestationObjectSize configures the maximum size in bytes of the attestation object of registration
+	// responses. Defaults to protocol.DefaultMaxAttestationObjectSize.
+	MaxAttestationObjectSize int
+
+	// MaxClientDataSize configures the maximum size in bytes of the clientDataJSON of registration and login responses,
+	// which must also be valid UTF-8. Defaults to protocol.DefaultMaxClientDataSize.
+	MaxClientDataSize int
+
+	// MinRSAKeyBits configures the minimum modulus length in bits of RSA credential public keys accepted during
+	// registration. Defaults to 2048.
+	MinRSAKeyBits int
+
+	// AllowedCurves restricts the curves of EC2 credential public keys accepted during registration. All curves are
+	// accepted when empty.
+	AllowedCurves []webauthncose.COSEEllipticCurve
+
+	// AllowCOSEStringLabels accepts registrations of credentials which public key is a COSE key with text string labels
+	// such as "kty" or "-2" instead of the integer labels, as encoded by some non-conformant authenticators. The
+	// credential public key is stored with the integer labels, so logins don't depend on this option.
+	AllowCOSEStringLabels bool
+
+	// AllowedTransports restricts the transports of the credentials accepted during registration, such that every
+	// transport reported by the client must be one of these. All transports are accepted when empty.
+	AllowedTransports []protocol.AuthenticatorTransport
+
+	// CompareAttestationTransports compares the transports reported by the client during registration to the
+	// transports of the FIDO U2F certificate transports extension of the attestation certificate when present, and
+	// emits a debug event to the Logger when they differ. The registration is not rejected in either case.
+	CompareAttestationTransports bool
+
+	// AllowMissingTransports accepts credentials for which the client reported no transports when AllowedTransports
+	// is configured. Such credentials are rejected otherwise.
+	AllowMissingTransports bool
+
+	// Strict enables the registration checks mandated by the specification which are not performed by default, which
+	// are the checks that the attested credential data flag is set, that the credential algorithm is one of the offered
+	// credential parameters, and that the attestation format is allowed. Each of these can be disabled with
+	// StrictChecks. The checks of the user presence flag, the client data type, challenge, and origin, the RP ID hash,
+	// the credential ID, and the consistency of the credential algorithm with the key are always performed.
+	Strict bool
+
+	// StrictChecks disables individual checks enabled by Strict.
+	StrictChecks StrictChecks
+
+	// RequireOfferedAlgorithm rejects registrations of a credential which public key algorithm is not one of the
+	// credential parameters offered in the options, with a protocol.ErrUnsupportedAlgorithm error. The check is also
+	// enabled by Strict unless StrictChecks.SkipCredentialAlgorithm is set, which has no effect when this is enabled.
+	RequireOfferedAlgorithm bool
+
+	// AllowedAttestationFormats restricts the attestation statement formats accepted during registration. When empty
+	// all registered formats are accepted, unless Strict is enabled in which case only the formats defined by the
+	// specification are accepted.
+	AllowedAttestationFormats []string
+
+	// VerifyMetadataUserVerification rejects registrations which report user verification from an authenticator
+	// which its metadata statement in metadata.DefaultStore declares is not capable of user verification, with a
+	// protocol.ErrMetadataUserVerification error.
+	VerifyMetadataUserVerification bool
+
+	// RequireUserVerificationCapable rejects registrations from authenticators which their metadata statement in
+	// metadata.DefaultStore declares have no user verification method at all in the userVerificationDetails, such as
+	// security keys which only test for user presence, with a protocol.ErrUserVerificationCapability error. Unlike
+	// VerifyMetadataUserVerification the check applies whether the registration reports user verification or not.
+	// Authenticators without a metadata statement or without userVerificationDetails are accepted.
+	RequireUserVerificationCapable bool
+
+	// MinimumCertificationLevel rejects registrations from authenticators which their metadata statement in
+	// metadata.DefaultStore does not report at least this FIDO Authenticator certification level, with a
+	// protocol.ErrMetadataCertificationLevel error. Authenticators without a metadata statement are rejected too. The
+	// certification level is not checked when it's metadata.CertificationLevelNone.
+	MinimumCertificationLevel metadata.CertificationLevel
+
+	// VerifyBackupFlagTransitions compares the backup flags of a login to the flags stored for the credential, and
+	// returns a *BackupFlagsError when the credential lost its backup eligibility or went from backed up to not backed
+	// up. A credential becoming backed up is expected and is always accepted.
+	VerifyBackupFlagTransitions bool
+
+	// EnableSignCountWhenReported clears the SignCountUnsupported flag of a credential on the first login which reports
+	// a nonzero sign count, so that the clone detection of Authenticator.UpdateCounter is enforced from that login on.
+	// The transition is reported by LoginResult.SignCountEnabled and the updated credential must be stored.
+	EnableSignCountWhenReported bool
+
+	// AllowAttestationDowngrade accepts registrations which requested direct or enterprise attestation but for which
+	// the client returned the none attestation statement format, as some clients remove the attestation regardless of
+	// the preference for privacy reasons. The attestation type of the credential is none in that case. Such
+	// registrations are rejected by default.
+	AllowAttestationDowngrade bool
+
+	// RequireZeroAAGUIDForNone rejects registrations using the none attestation statement format which report a
+	// non-zero AAGUID, matching the clients which replace the AAGUID with zeros when they remove the attestation.
+	RequireZeroAAGUIDForNone bool
+
+	// RejectExistingCredentials rejects registrations of a credential which has the same ID as one of the existing
+	// credentials of the user with a protocol.ErrCredentialExists error, instead of returning a duplicate credential.
+	RejectExistingCredentials bool
+
+	// RejectExistingPublicKeys extends RejectExistingCredentials to also reject registrations of a credential which has
+	// the same public key thumbprint as one of the existing credentials of the user.
+	RejectExistingPublicKeys bool
+
+	// UnknownFormatAsNone treats registrations using an attestation statement format which has not been registered
+	// with protocol.RegisterAttestationFormat as if they used the none attestation statement format, such that the
+	// credential is registered without verifying the attestation statement. These registrations are rejected otherwise.
+	// The attestation format checks of Strict and AllowedAttestationFormats still apply to the original format.
+	UnknownFormatAsNone bool
+
+	// AttestationRootPool are the trusted attestation root certificates, such as the FIDO conformance or staging
+	// roots, which the attestation certificate chain of a registration must lead to when set. They are used instead of
+	// the attestation root certificates of the metadata, and are only used to verify attestation statements and never
+	// for TLS. Attestations without a certificate chain such as self and none attestations are rejected when set,
+	// including packed and tpm attestations which certificate was signed by the credential key.
+	AttestationRootPool *x509.CertPool
+
+	// AdditionalCreateTypes are the client data types accepted during registration in addition to webauthn.create,
+	// for specialized integrations which use their own client data types. Only webauthn.create is accepted when empty.
+	AdditionalCreateTypes []string
+
+	// AdditionalGetTypes are the client data types accepted during login in addition to webauthn.get, for specialized
+	// integrations which use their own client data types. Only webauthn.get is accepted when empty.
+	AdditionalGetTypes []string
+
+	// Logger receives structured debug events about the verification steps of the finish methods. It's a no-op when
+	// nil.
+	Logger Logger
+
+	// ChallengeStore records the challenges of the sessions which were successfully finished so each challenge can only
+	// be used once, which protects against replayed responses. The challenges are not tracked when nil.
+	ChallengeStore ChallengeStore
+
 	validated bool
 
 	// RPIcon sets the icon URL for the Relying Party Server.
@@ -71,6 +217,96 @@ type Config struct {
 	Timeout int
 }
 
+// StrictChecks disables the individual registration checks enabled by Config.Strict. The checks which are performed
+// regardless of Strict can't be disabled.
+type StrictChecks struct {
+	// SkipAttestedCredentialData disables the check that the attested credential data flag of the authenticator data
+	// is set.
+	SkipAttestedCredentialData bool
+
+	// SkipCredentialAlgorithm disables the check that the algorithm of the credential public key is one of the
+	// credential parameters offered in the options.
+	SkipCredentialAlgorithm bool
+
+	// SkipAttestationFormat disables the check that the attestation statement format is allowed.
+	SkipAttestationFormat bool
+}
+
+// Logger is the interface used to emit structured debug events. Each event is a message followed by alternating keys
+// and values. The events never contain secrets such as the challenge or key material.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+}
+
+// ChallengeStore is the interface used to detect the reuse of session challenges. Implementations shared between
+// multiple instances of the Relying Party should use a shared backend such as a database or cache.
+type ChallengeStore interface {
+	// Consume marks the challenge as used and returns true for firstUse if it was not already marked. The check and
+	// the mark must be a single atomic operation, such as a Redis SETNX or an SQL INSERT ... ON CONFLICT DO NOTHING,
+	// so concurrent submissions of the same response can't both consume the challenge. The challenge only needs to be
+	// retained until the expiration of the session which is zero if the session does not expire.
+	Consume(challenge string, expires time.Time) (firstUse bool, err error)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...interface{}) {}
+
+// logger returns the configured Logger or a no-op Logger if none is configured.
+func (webauthn *WebAuthn) logger() Logger {
+	if webauthn.Config == nil || webauthn.Config.Logger == nil {
+		return noopLogger{}
+	}
+
+	return webauthn.Config.Logger
+}
+
+// verifyCrossOrigin ensures the cross-origin ceremony is allowed, and that its topOrigin is one of the AllowedTopOrigins
+// if configured or one of the RPOrigins otherwise.
+func (config *Config) verifyCrossOrigin(c *protocol.CollectedClientData) error {
+	if len(config.AllowedTopOrigins) == 0 {
+		return c.VerifyCrossOrigin(config.AllowCrossOrigin, config.RPOrigins)
+	}
+
+	if config.AllowCrossOrigin && c.CrossOrigin && c.TopOrigin == "" {
+		return protocol.ErrVerification.
+			WithDetails("Error validating top origin").
+			WithInfo(fmt.Sprintf("Expected Values: %s, Received no top origin", config.AllowedTopOrigins))
+	}
+
+	return c.VerifyCrossOrigin(config.AllowCrossOrigin, config.AllowedTopOrigins)
+}
+
+// consumeChallenge consumes the session challenge if a ChallengeStore is configured, ensuring it has not already been
+// used. It's called once the response has been verified so a failed ceremony does not consume the challenge.
+func (webauthn *WebAuthn) consumeChallenge(session SessionData) error {
+	if webauthn.Config == nil || webauthn.Config.ChallengeStore == nil {
+		return nil
+	}
+
+	firstUse, err := webauthn.Config.ChallengeStore.Consume(session.Challenge, session.Expires)
+	if err != nil {
+		return protocol.ErrBadRequest.WithDetails("Error consuming the session challenge").WithInfo(err.Error())
+	}
+
+	if !firstUse {
+		return protocol.ErrBadRequest.WithDetails("Session challenge has already been used")
+	}
+
+	return nil
+}
+
+// errorType returns the type of the protocol error for logging purposes.
+func errorType(err error) string {
+	var e *protocol.Error
+
+	if errors.As(err, &e) {
+		return e.Type
+	}
+
+	return "unknown"
+}
+
 // TimeoutsConfig represents the WebAuthn timeouts configuration.
 type TimeoutsConfig struct {
 	Login        TimeoutConfig
@@ -141,6 +377,18 @@ func (config *Config) validate() error {
 		config.Timeouts.Registration.TimeoutUVD = defaultTimeoutUVDConfig
 	}
 
+	if config.MaxAttestationObjectSize <= 0 {
+		config.MaxAttestationObjectSize = protocol.DefaultMaxAttestationObjectSize
+	}
+
+	if config.MaxClientDataSize <= 0 {
+		config.MaxClientDataSize = protocol.DefaultMaxClientDataSize
+	}
+
+	if config.MinRSAKeyBits <= 0 {
+		config.MinRSAKeyBits = defaultMinRSAKeyBits
+	}
+
 	if len(config.RPOrigin) > 0 {
 		if len(config.RPOrigins) != 0 {
 			return fmt.Errorf("deprecated field 'RPOrigin' can't be defined at the same tme as the replacement field 'RPOrigins'")
@@ -153,6 +401,30 @@ func (config *Config) validate() error {
 		return fmt.Errorf("must provide at least one value to the 'RPOrigins' field")
 	}
 
+	for _, origin := range config.RPOrigins {
+		if err = validateOrigin(origin, config.Debug); err != nil {
+			return err
+		}
+
+		if err = validateRPIDOrigin(config.RPID, origin); err != nil {
+			return err
+		}
+	}
+
+	if err = validateAdditionalTypes("AdditionalCreateTypes", config.AdditionalCreateTypes, protocol.AssertCeremony); err != nil {
+		return err
+	}
+
+	if err = validateAdditionalTypes("AdditionalGetTypes", config.AdditionalGetTypes, protocol.CreateCeremony); err != nil {
+		return err
+	}
+
+	for _, transport := range config.AllowedTransports {
+		if _, err = protocol.ParseTransport(string(transport)); err != nil {
+			return fmt.Errorf("field 'AllowedTransports' contains the unknown transport '%s'", transport)
+		}
+	}
+
 	if config.AuthenticatorSelection.RequireResidentKey == nil {
 		config.AuthenticatorSelection.RequireResidentKey = protocol.ResidentKeyNotRequired()
 	}
@@ -166,6 +438,92 @@ func (config *Config) validate() error {
 	return nil
 }
 
+// validateOrigin ensures origins use the https scheme unless the host is a loopback host as browsers consider these
+// potentially trustworthy, or debug is enabled to allow testing over http.
+func validateOrigin(origin string, debug bool) error {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Scheme, "http") || debug {
+		return nil
+	}
+
+	switch host := strings.ToLower(u.Hostname()); {
+	case host == "localhost", strings.HasSuffix(host, ".localhost"):
+		return nil
+	default:
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(errFmtFieldNotSecureOrigin, "RPOrigins", origin)
+}
+
+// validateRPIDOrigin ensures the RP ID is valid for the origin as per rpIDOriginMismatch, as otherwise browsers reject
+// every ceremony for the origin. Origins which don't use the http or https scheme, such as the origins of Android
+// applications, are not checked.
+func validateRPIDOrigin(rpID, origin string) error {
+	host, ok := webOriginHost(origin)
+	if !ok {
+		return nil
+	}
+
+	if reason := rpIDOriginMismatch(rpID, host); reason != "" {
+		return fmt.Errorf(errFmtFieldRPIDNotSuffix, "RPOrigins", origin, rpID, reason)
+	}
+
+	return nil
+}
+
+// rpIDMatchesOrigins returns true if the RP ID is valid for one of the origins which use the http or https scheme as
+// per rpIDOriginMismatch.
+func rpIDMatchesOrigins(rpID string, origins []string) bool {
+	for _, origin := range origins {
+		if host, ok := webOriginHost(origin); ok && rpIDOriginMismatch(rpID, host) == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webOriginHost returns the lowercase host of the origin, and false for ok if the origin doesn't use the http or https
+// scheme.
+func webOriginHost(origin string) (host string, ok bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || (!strings.EqualFold(u.Scheme, "https") && !strings.EqualFold(u.Scheme, "http")) {
+		return "", false
+	}
+
+	return strings.ToLower(u.Hostname()), true
+}
+
+// rpIDOriginMismatch returns the reason the RP ID is not valid for the host of a web origin, or an empty string if the
+// RP ID is the host or a registrable domain suffix of it. Hosts which are IP addresses must use the IP address as the
+// RP ID, and an RP ID which is a public suffix such as com or co.uk is only valid for itself, with the exception of
+// localhost which is a valid suffix of its subdomains.
+//
+// Specification: §5.1.3. Create a New Credential, Step 8 (https://www.w3.org/TR/webauthn/#CreateCred-DetermineRpId)
+func rpIDOriginMismatch(rpID, host string) (reason string) {
+	rpID = strings.ToLower(rpID)
+
+	switch {
+	case host == rpID:
+		return ""
+	case net.ParseIP(host) != nil:
+		return "an IP address origin requires the IP address as the RP ID"
+	case !strings.HasSuffix(host, "."+rpID):
+		return "the RP ID must be the host of the origin or a domain suffix of it"
+	case rpID == "localhost":
+		return ""
+	}
+
+	if suffix, _ := publicsuffix.PublicSuffix(rpID); suffix == rpID {
+		return "the RP ID is a public suffix"
+	}
+
+	return ""
+}
+
 // User is am interface with the Relying Party's User entry and provides the fields and methods needed for WebAuthn
 // registration operations.
 type User interface {
@@ -213,4 +571,52 @@ type SessionData struct {
 
 	UserVerification protocol.UserVerificationRequirement `json:"userVerification"`
 	Extensions       protocol.AuthenticationExtensions    `json:"extensions,omitempty"`
+
+	// RelyingPartyID is the RP ID of the ceremony when it was overridden with WithRPEntity.
+	RelyingPartyID string `json:"rp_id,omitempty"`
+
+	// CredentialParameters are the credential parameters offered in the registration options.
+	CredentialParameters []protocol.CredentialParameter `json:"credential_parameters,omitempty"`
+
+	// Reauth indicates the login was initiated as a re-authentication with WithReauth, and that the assertion must
+	// have been user verified.
+	Reauth bool `json:"reauth,omitempty"`
+
+	// Attestation is the attestation conveyance preference of the registration.
+	Attestation protocol.ConveyancePreference `json:"attestation,omitempty"`
+
+	// Mediation is the mediation requirement of the registration, which is protocol.MediationConditional when it
+	// was initiated with WithConditionalCreate.
+	Mediation protocol.CredentialMediationRequirement `json:"mediation,omitempty"`
+}
+
+// validateAdditionalTypes ensures the additional client data types of a ceremony are not empty and don't include the
+// client data type of the other ceremony.
+func validateAdditionalTypes(field string, types []string, other protocol.CeremonyType) error {
+	for _, t := range types {
+		if t == "" {
+			return fmt.Errorf("field '%s' must not contain an empty client data type", field)
+		}
+
+		if protocol.CeremonyType(t) == other {
+			return fmt.Errorf("field '%s' must not contain the client data type '%s'", field, t)
+		}
+	}
+
+	return nil
+}
+
+// ceremonyTypes converts the configured additional client data types to protocol.CeremonyType values.
+func ceremonyTypes(types []string) []protocol.CeremonyType {
+	if len(types) == 0 {
+		return nil
+	}
+
+	ceremonies := make([]protocol.CeremonyType, len(types))
+
+	for i, t := range types {
+		ceremonies[i] = protocol.CeremonyType(t)
+	}
+
+	return ceremonies
 }
@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flaviup/webauthn/protocol"
+)
+
+func TestConfig_validateOrigins(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rpID    string
+		origins []string
+		debug   bool
+		err     string
+	}{
+		{"ShouldAllowHTTPS", "example.com", []string{"https://example.com"}, false, ""},
+		{"ShouldAllowLocalhostHTTP", "localhost", []string{"http://localhost:8080"}, false, ""},
+		{"ShouldAllowLoopbackHTTP", "127.0.0.1", []string{"http://127.0.0.1:8080"}, false, ""},
+		{"ShouldAllowAndroid", "example.com", []string{"android:apk-key-hash:7d1043473d55bfa90e8530d35801d4e381bc69f0"}, false, ""},
+		{"ShouldAllowHTTPWithDebug", "example.com", []string{"http://example.com"}, true, ""},
+		{"ShouldRejectHTTP", "example.com", []string{"https://example.com", "http://example.com"}, false, "field 'RPOrigins' contains the origin 'http://example.com' which does not use the https scheme"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{
+				RPID:          tc.rpID,
+				RPDisplayName: "Example",
+				RPOrigins:     tc.origins,
+				Debug:         tc.debug,
+			}
+
+			err := config.validate()
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestConfig_validateRPIDOrigins(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rpID    string
+		origins []string
+		err     string
+	}{
+		{"ShouldAllowSameHost", "example.com", []string{"https://example.com:8443"}, ""},
+		{"ShouldAllowSubdomains", "example.com", []string{"https://login.example.com", "https://a.b.example.com"}, ""},
+		{"ShouldAllowCaseInsensitive", "Example.COM", []string{"https://LOGIN.example.com"}, ""},
+		{"ShouldAllowLocalhostSubdomain", "localhost", []string{"http://app.localhost:3000"}, ""},
+		{"ShouldAllowSingleLabelHost", "intranet", []string{"https://intranet"}, ""},
+		{"ShouldAllowIP", "192.0.2.1", []string{"https://192.0.2.1:8443"}, ""},
+		{"ShouldAllowNonWebOrigin", "example.com", []string{"https://example.com", "ios:bundle-id:com.example.app"}, ""},
+		{"ShouldRejectDifferentDomain", "example.com", []string{"https://example.com", "https://example.org"}, "field 'RPOrigins' contains the origin 'https://example.org' for which the RP ID 'example.com' is not valid: the RP ID must be the host of the origin or a domain suffix of it"},
+		{"ShouldRejectPartialLabel", "example.com", []string{"https://badexample.com"}, "field 'RPOrigins' contains the origin 'https://badexample.com' for which the RP ID 'example.com' is not valid: the RP ID must be the host of the origin or a domain suffix of it"},
+		{"ShouldRejectSubdomainRPID", "login.example.com", []string{"https://example.com"}, "field 'RPOrigins' contains the origin 'https://example.com' for which the RP ID 'login.example.com' is not valid: the RP ID must be the host of the origin or a domain suffix of it"},
+		{"ShouldRejectTopLevelDomain", "com", []string{"https://example.com"}, "field 'RPOrigins' contains the origin 'https://example.com' for which the RP ID 'com' is not valid: the RP ID is a public suffix"},
+		{"ShouldRejectPublicSuffix", "co.uk", []string{"https://example.co.uk"}, "field 'RPOrigins' contains the origin 'https://example.co.uk' for which the RP ID 'co.uk' is not valid: the RP ID is a public suffix"},
+		{"ShouldRejectPrivatePublicSuffix", "github.io", []string{"https://example.github.io"}, "field 'RPOrigins' contains the origin 'https://example.github.io' for which the RP ID 'github.io' is not valid: the RP ID is a public suffix"},
+		{"ShouldRejectSingleLabelSuffix", "intranet", []string{"https://app.intranet"}, "field 'RPOrigins' contains the origin 'https://app.intranet' for which the RP ID 'intranet' is not valid: the RP ID is a public suffix"},
+		{"ShouldAllowRegistrableDomainOfPublicSuffix", "example.co.uk", []string{"https://login.example.co.uk"}, ""},
+		{"ShouldRejectIPSuffix", "2.1", []string{"https://192.0.2.1"}, "field 'RPOrigins' contains the origin 'https://192.0.2.1' for which the RP ID '2.1' is not valid: an IP address origin requires the IP address as the RP ID"},
+		{"ShouldRejectDomainForLocalhost", "example.com", []string{"http://localhost:8080"}, "field 'RPOrigins' contains the origin 'http://localhost:8080' for which the RP ID 'example.com' is not valid: the RP ID must be the host of the origin or a domain suffix of it"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(&Config{
+				RPID:          tc.rpID,
+				RPDisplayName: "Example",
+				RPOrigins:     tc.origins,
+			})
+
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, "error occurred validating the configuration: "+tc.err)
+			}
+		})
+	}
+}
+
+func TestConfig_validateAdditionalTypes(t *testing.T) {
+	_, err := New(&Config{
+		RPID:                  "example.com",
+		RPDisplayName:         "Example",
+		RPOrigins:             []string{"https://example.com"},
+		AdditionalCreateTypes: []string{"webauthn.get"},
+	})
+	assert.EqualError(t, err, "error occurred validating the configuration: field 'AdditionalCreateTypes' must not contain the client data type 'webauthn.get'")
+
+	_, err = New(&Config{
+		RPID:               "example.com",
+		RPDisplayName:      "Example",
+		RPOrigins:          []string{"https://example.com"},
+		AdditionalGetTypes: []string{""},
+	})
+	assert.EqualError(t, err, "error occurred validating the configuration: field 'AdditionalGetTypes' must not contain an empty client data type")
+}
+
+func TestConfig_validateAllowedTransports(t *testing.T) {
+	_, err := New(&Config{
+		RPID:              "example.com",
+		RPDisplayName:     "Example",
+		RPOrigins:         []string{"https://example.com"},
+		AllowedTransports: []protocol.AuthenticatorTransport{protocol.USB, protocol.SmartCard},
+	})
+	assert.NoError(t, err)
+
+	_, err = New(&Config{
+		RPID:              "example.com",
+		RPDisplayName:     "Example",
+		RPOrigins:         []string{"https://example.com"},
+		AllowedTransports: []protocol.AuthenticatorTransport{protocol.USB, "bluetooth"},
+	})
+	assert.EqualError(t, err, "error occurred validating the configuration: field 'AllowedTransports' contains the unknown transport 'bluetooth'")
+}
@@ -0,0 +1,73 @@
+package webauthntest_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/webauthn"
+	"github.com/flaviup/webauthn/webauthntest"
+)
+
+type exampleUser struct{}
+
+func (exampleUser) WebAuthnID() []byte                         { return []byte("1234") }
+func (exampleUser) WebAuthnName() string                       { return "example" }
+func (exampleUser) WebAuthnDisplayName() string                { return "Example User" }
+func (exampleUser) WebAuthnIcon() string                       { return "" }
+func (exampleUser) WebAuthnCredentials() []webauthn.Credential { return nil }
+
+func ExampleCredential_Attestation() {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          "example.com",
+		RPDisplayName: "Example",
+		RPOrigins:     []string{"https://example.com"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	creation, session, err := w.BeginRegistration(exampleUser{})
+	if err != nil {
+		panic(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	credential, err := webauthntest.NewCredential(key)
+	if err != nil {
+		panic(err)
+	}
+
+	attestation, err := credential.Attestation(webauthntest.AttestationOptions{
+		RPID:      "example.com",
+		Origin:    "https://example.com",
+		Challenge: creation.Response.Challenge.String(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	body, err := attestation.ResponseJSON()
+	if err != nil {
+		panic(err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+
+	registered, err := w.CreateCredential(exampleUser{}, *session, parsed)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(registered.AttestationType, bytes.Equal(registered.ID, credential.ID))
+}
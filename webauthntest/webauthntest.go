@@ -0,0 +1,301 @@
+// Package webauthntest contains helpers which generate authenticator responses from software keys, allowing users of
+// the library to test their registration handlers without a real authenticator. It is not intended to be used outside
+// of tests.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncbor"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
+)
+
+const (
+	// FormatNone is the none attestation statement format.
+	FormatNone = "none"
+
+	// FormatPacked is the packed attestation statement format, which is generated as a self attestation.
+	FormatPacked = "packed"
+)
+
+// Credential is a software credential which signs with its private key.
+type Credential struct {
+	// ID is the credential ID.
+	ID []byte
+
+	// Key is the private key of the credential, which is either an *ecdsa.PrivateKey, an *rsa.PrivateKey, or an
+	// ed25519.PrivateKey.
+	Key crypto.Signer
+
+	// Algorithm is the COSE algorithm the credential signs with.
+	Algorithm webauthncose.COSEAlgorithmIdentifier
+
+	// AAGUID is the AAGUID of the authenticator the credential claims to be from. It's all zeros when empty.
+	AAGUID []byte
+}
+
+// NewCredential creates a Credential with a random credential ID for the provided key. The algorithm is ES256, ES384,
+// or ES512 for an ECDSA key depending on its curve, RS256 for an RSA key, and EdDSA for an Ed25519 key.
+func NewCredential(key crypto.Signer) (credential *Credential, err error) {
+	credential = &Credential{
+		ID:  make([]byte, 32),
+		Key: key,
+	}
+
+	if _, err = rand.Read(credential.ID); err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			credential.Algorithm = webauthncose.AlgES256
+		case elliptic.P384():
+			credential.Algorithm = webauthncose.AlgES384
+		case elliptic.P521():
+			credential.Algorithm = webauthncose.AlgES512
+		default:
+			return nil, webauthncose.ErrUnsupportedKey
+		}
+	case *rsa.PrivateKey:
+		credential.Algorithm = webauthncose.AlgRS256
+	case ed25519.PrivateKey:
+		credential.Algorithm = webauthncose.AlgEdDSA
+	default:
+		return nil, webauthncose.ErrUnsupportedKey
+	}
+
+	return credential, nil
+}
+
+// PublicKey returns the COSE encoded public key of the credential.
+func (c *Credential) PublicKey() ([]byte, error) {
+	switch k := c.Key.Public().(type) {
+	case *ecdsa.PublicKey:
+		var curve webauthncose.COSEEllipticCurve
+
+		switch k.Curve {
+		case elliptic.P256():
+			curve = webauthncose.P256
+		case elliptic.P384():
+			curve = webauthncose.P384
+		case elliptic.P521():
+			curve = webauthncose.P521
+		default:
+			return nil, webauthncose.ErrUnsupportedKey
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		return webauthncbor.Marshal(map[int]interface{}{
+			1:  int64(webauthncose.EllipticKey),
+			3:  int64(c.Algorithm),
+			-1: int64(curve),
+			-2: k.X.FillBytes(make([]byte, size)),
+			-3: k.Y.FillBytes(make([]byte, size)),
+		})
+	case *rsa.PublicKey:
+		return webauthncbor.Marshal(map[int]interface{}{
+			1:  int64(webauthncose.RSAKey),
+			3:  int64(c.Algorithm),
+			-1: k.N.Bytes(),
+			-2: big.NewInt(int64(k.E)).Bytes(),
+		})
+	case ed25519.PublicKey:
+		return webauthncbor.Marshal(map[int]interface{}{
+			1:  int64(webauthncose.OctetKey),
+			3:  int64(c.Algorithm),
+			-1: int64(webauthncose.Ed25519),
+			-2: []byte(k),
+		})
+	default:
+		return nil, webauthncose.ErrUnsupportedKey
+	}
+}
+
+// Sign signs the data with the credential private key using the credential algorithm.
+func (c *Credential) Sign(data []byte) ([]byte, error) {
+	if c.Algorithm == webauthncose.AlgEdDSA {
+		return c.Key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+
+	var hash crypto.Hash
+
+	switch c.Algorithm {
+	case webauthncose.AlgES256, webauthncose.AlgRS256, webauthncose.AlgPS256:
+		hash = crypto.SHA256
+	case webauthncose.AlgES384, webauthncose.AlgRS384, webauthncose.AlgPS384:
+		hash = crypto.SHA384
+	case webauthncose.AlgES512, webauthncose.AlgRS512, webauthncose.AlgPS512:
+		hash = crypto.SHA512
+	default:
+		return nil, webauthncose.ErrUnsupportedAlgorithm
+	}
+
+	h := hash.New()
+	h.Write(data)
+
+	switch c.Algorithm {
+	case webauthncose.AlgPS256, webauthncose.AlgPS384, webauthncose.AlgPS512:
+		return c.Key.Sign(rand.Reader, h.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	default:
+		return c.Key.Sign(rand.Reader, h.Sum(nil), hash)
+	}
+}
+
+// AttestationOptions are the parameters of a generated attestation.
+type AttestationOptions struct {
+	// RPID is the Relying Party ID the credential is registered with.
+	RPID string
+
+	// Origin is the origin reported in the client data.
+	Origin string
+
+	// Challenge is the challenge of the registration ceremony, as the base64url encoded string sent to the client in
+	// the credential creation options.
+	Challenge string
+
+	// Format is the attestation statement format, either FormatNone or FormatPacked. It defaults to FormatNone.
+	Format string
+
+	// Flags are the authenticator data flags. They default to user present and user verified, and the attested
+	// credential data flag is always set.
+	Flags protocol.AuthenticatorFlags
+
+	// Counter is the signature counter of the authenticator data.
+	Counter uint32
+
+	// Transports are the transports reported with the response.
+	Transports []protocol.AuthenticatorTransport
+}
+
+// Attestation is a generated registration response.
+type Attestation struct {
+	// CredentialID is the credential ID.
+	CredentialID []byte
+
+	// AttestationObject is the CBOR encoded attestation object.
+	AttestationObject []byte
+
+	// ClientDataJSON is the serialized client data.
+	ClientDataJSON []byte
+
+	// Transports are the transports reported with the response.
+	Transports []protocol.AuthenticatorTransport
+}
+
+// Attestation generates a registration response for the credential.
+func (c *Credential) Attestation(opts AttestationOptions) (attestation *Attestation, err error) {
+	format := opts.Format
+	if format == "" {
+		format = FormatNone
+	}
+
+	flags := opts.Flags
+	if flags == 0 {
+		flags = protocol.FlagUserPresent | protocol.FlagUserVerified
+	}
+
+	flags |= protocol.FlagAttestedCredentialData
+
+	publicKey, err := c.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aaguid := make([]byte, 16)
+	copy(aaguid, c.AAGUID)
+
+	rpIDHash := sha256.Sum256([]byte(opts.RPID))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, byte(flags))
+	authData = binary.BigEndian.AppendUint32(authData, opts.Counter)
+	authData = append(authData, aaguid...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(c.ID)))
+	authData = append(authData, c.ID...)
+	authData = append(authData, publicKey...)
+
+	clientDataJSON, err := json.Marshal(protocol.CollectedClientData{
+		Type:      protocol.CreateCeremony,
+		Challenge: opts.Challenge,
+		Origin:    opts.Origin,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attStmt := map[string]interface{}{}
+
+	switch format {
+	case FormatNone:
+	case FormatPacked:
+		clientDataHash := sha256.Sum256(clientDataJSON)
+
+		sig, err := c.Sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+
+		attStmt["alg"] = int64(c.Algorithm)
+		attStmt["sig"] = sig
+	default:
+		return nil, fmt.Errorf("unsupported attestation format '%s'", format)
+	}
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      format,
+		"attStmt":  attStmt,
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Attestation{
+		CredentialID:      c.ID,
+		AttestationObject: attestationObject,
+		ClientDataJSON:    clientDataJSON,
+		Transports:        opts.Transports,
+	}, nil
+}
+
+// ResponseJSON returns the attestation as the JSON body a client sends to the Relying Party, which can be parsed with
+// protocol.ParseCredentialCreationResponseBody.
+func (a *Attestation) ResponseJSON() ([]byte, error) {
+	transports := make([]string, len(a.Transports))
+
+	for i, transport := range a.Transports {
+		transports[i] = string(transport)
+	}
+
+	return json.Marshal(protocol.CredentialCreationResponse{
+		PublicKeyCredential: protocol.PublicKeyCredential{
+			Credential: protocol.Credential{
+				ID:   base64.RawURLEncoding.EncodeToString(a.CredentialID),
+				Type: string(protocol.PublicKeyCredentialType),
+			},
+			RawID: a.CredentialID,
+		},
+		AttestationResponse: protocol.AuthenticatorAttestationResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{
+				ClientDataJSON: a.ClientDataJSON,
+			},
+			AttestationObject: a.AttestationObject,
+			Transports:        transports,
+		},
+	})
+}
@@ -0,0 +1,84 @@
+package webauthntest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flaviup/webauthn/protocol"
+	"github.com/flaviup/webauthn/protocol/webauthncose"
+)
+
+func TestCredential_Attestation(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm webauthncose.COSEAlgorithmIdentifier
+		format    string
+	}{
+		{"ShouldGenerateNoneES384", ecKey, webauthncose.AlgES384, FormatNone},
+		{"ShouldGeneratePackedRS256", rsaKey, webauthncose.AlgRS256, FormatPacked},
+		{"ShouldGeneratePackedPS256", rsaKey, webauthncose.AlgPS256, FormatPacked},
+		{"ShouldGeneratePackedEdDSA", edKey, webauthncose.AlgEdDSA, FormatPacked},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credential, err := NewCredential(tc.key)
+			require.NoError(t, err)
+
+			if tc.algorithm != webauthncose.AlgPS256 {
+				assert.Equal(t, tc.algorithm, credential.Algorithm)
+			}
+
+			credential.Algorithm = tc.algorithm
+
+			attestation, err := credential.Attestation(AttestationOptions{
+				RPID:       "example.com",
+				Origin:     "https://example.com",
+				Challenge:  "Y2hhbGxlbmdl",
+				Format:     tc.format,
+				Transports: []protocol.AuthenticatorTransport{protocol.USB},
+			})
+			require.NoError(t, err)
+
+			body, err := attestation.ResponseJSON()
+			require.NoError(t, err)
+
+			pcc, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+			require.NoError(t, err)
+
+			assert.Equal(t, credential.ID, pcc.RawID)
+			assert.Equal(t, tc.format, pcc.Response.AttestationObject.Format)
+			assert.Equal(t, []protocol.AuthenticatorTransport{protocol.USB}, pcc.Response.Transports)
+			assert.True(t, pcc.Response.AttestationObject.AuthData.Flags.HasAttestedCredentialData())
+
+			require.NoError(t, pcc.Verify("Y2hhbGxlbmdl", true, "example.com", []string{"https://example.com"}))
+		})
+	}
+}
+
+func TestNewCredentialUnsupportedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewCredential(key)
+	assert.Equal(t, webauthncose.ErrUnsupportedKey, err)
+}